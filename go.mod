@@ -5,10 +5,13 @@ go 1.19
 replace github.com/srmadden/godb => ./godb
 
 require (
-	github.com/chzyer/readline v1.5.1 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/chzyer/readline v1.5.1
+	github.com/srmadden/godb v0.0.0-00010101000000-000000000000
+)
+
+require (
 	github.com/mitchellh/hashstructure/v2 v2.0.2 // indirect
-	github.com/srmadden/godb v0.0.0-00010101000000-000000000000 // indirect
+	github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2 // indirect
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1 // indirect
 	golang.org/x/sys v0.1.0 // indirect
 )
@@ -14,6 +14,12 @@ type Aggregator struct {
 	newAggState []AggState
 
 	child Operator // the child operator for the inputs to aggregate
+
+	// The maximum number of groups kept in memory; the inputs of further
+	// groups are partitioned into spill files in dir and aggregated later
+	maxGroups int
+	dir       string
+	bufPool   *BufferPool // removes the partitions left when the transaction ends
 }
 
 type AggType int
@@ -25,14 +31,37 @@ const (
 
 const DefaultGroup int = 0 // for handling the case of no group-by
 
+// The number of partitions the inputs of the groups that don't fit in memory
+// are split into, and the number of times a partition whose groups still
+// don't fit is split again before it is aggregated in memory regardless
+const (
+	aggPartitions = 32
+	maxAggDepth   = 3
+)
+
 // Constructor for an aggregator with a group-by
 func NewGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
-	return &Aggregator{groupByFields, emptyAggState, child}
+	return NewExternalGroupedAggregator(emptyAggState, groupByFields, child, AggBufferSize, "")
+}
+
+// Constructor for an aggregator with a group-by that keeps at most maxGroups
+// groups in memory, spilling the inputs of other groups to temporary files in
+// dir (or in the default directory for temporary files if dir is empty)
+func NewExternalGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator, maxGroups int, dir string) *Aggregator {
+	return &Aggregator{groupByFields, emptyAggState, child, maxGroups, dir, nil}
 }
 
 // Constructor for an aggregator with no group-by
 func NewAggregator(emptyAggState []AggState, child Operator) *Aggregator {
-	return &Aggregator{nil, emptyAggState, child}
+	return &Aggregator{nil, emptyAggState, child, 0, "", nil}
+}
+
+// Write the partitions of the aggregate to dir, and remove any that are left
+// when the transaction running the aggregate ends, e.g. because a LIMIT
+// stopped reading its results, through bp
+func (a *Aggregator) spillTo(dir string, bp *BufferPool) {
+	a.dir = dir
+	a.bufPool = bp
 }
 
 // Return a TupleDescriptor for this aggregation. If the aggregator has no group-by, the
@@ -56,26 +85,37 @@ func (a *Aggregator) Descriptor() *TupleDesc {
 	return td
 }
 
+// Return the descriptor of the fields of the child that the aggregates and
+// group by expressions read, e.g. both price and qty for sum(price * qty), or
+// the whole descriptor of the child if they can't be told
+func (a *Aggregator) inputDesc() *TupleDesc {
+	exprs := append([]Expr{}, a.groupByFields...)
+	for _, as := range a.newAggState {
+		exprs = append(exprs, as.GetExpr())
+	}
+	selectDesc := []FieldType{}
+	for _, e := range exprs {
+		fs, ok := referencedFields(e)
+		if !ok {
+			return a.child.Descriptor()
+		}
+		for _, f := range fs {
+			if !slices.Contains(selectDesc, f) {
+				selectDesc = append(selectDesc, f)
+			}
+		}
+	}
+	return &TupleDesc{Fields: selectDesc}
+}
+
 // Aggregate operator implementation: This function should iterate over the results of
 // the aggregate. The aggregate should be the result of aggregating each group's tuples
 // and the iterator should iterate through each group's result. In the case where there
 // is no group-by, the iterator simply iterates through only one tuple, representing the
 // aggregation of all child tuples.
 func (a *Aggregator) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
-	selectDesc := []FieldType{}
-	for i := range a.newAggState {
-		if !slices.Contains(selectDesc, a.newAggState[i].GetExprDesc()) {
-			selectDesc = append(selectDesc, a.newAggState[i].GetExprDesc())
-		}
-	}
-
-	for i := range a.groupByFields {
-		if !slices.Contains(selectDesc, a.groupByFields[i].GetExprType()) {
-			selectDesc = append(selectDesc, a.groupByFields[i].GetExprType())
-		}
-	}
 	// the child iterator
-	childIter, err := a.child.Iterator(tid, &TupleDesc{Fields: selectDesc})
+	childIter, err := a.child.Iterator(tid, a.inputDesc())
 	if err != nil {
 		return nil, err
 	}
@@ -83,72 +123,155 @@ func (a *Aggregator) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tupl
 		return nil, GoDBError{MalformedDataError, "child iter unexpectedly nil"}
 
 	}
-	// the map that stores the aggregation state of each group
-	aggState := make(map[any]*[]AggState)
-	if a.groupByFields == nil {
-		var newAggState []AggState
-		for _, as := range a.newAggState {
-			copy := as.Copy()
-			if copy == nil {
-				return nil, GoDBError{MalformedDataError, "aggState Copy unexpectedly returned nil"}
+	if a.groupByFields != nil {
+		var finalizedIter func() (*Tuple, error)
+		return func() (*Tuple, error) {
+			if finalizedIter == nil {
+				finalizedIter, err = a.aggregate(tid, childIter, 0)
+				if err != nil {
+					return nil, err
+				}
 			}
-			newAggState = append(newAggState, copy)
-		}
+			return finalizedIter()
+		}, nil
+	}
 
-		aggState[DefaultGroup] = &newAggState
+	// with no group-by, there is a single group
+	var newAggState []AggState
+	for _, as := range a.newAggState {
+		copy := as.Copy()
+		if copy == nil {
+			return nil, GoDBError{MalformedDataError, "aggState Copy unexpectedly returned nil"}
+		}
+		newAggState = append(newAggState, copy)
 	}
-	// the list of group key tuples
-	var groupByList []*Tuple
-	// the iterator for iterating thru the finalized aggregation results for each group
-	var finalizedIter func() (*Tuple, error)
+	done := false
 	return func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
 		// iterates thru all child tuples
 		for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
 			if err != nil {
 				return nil, err
 			}
-			if t == nil {
-				return nil, nil
+			for i := 0; i < len(newAggState); i++ {
+				newAggState[i].AddTuple(t)
 			}
+		}
+		var tup *Tuple
+		for i := 0; i < len(newAggState); i++ {
+			newTup := newAggState[i].Finalize()
+			tup = joinTuples(tup, newTup)
+		}
+		done = true
+		return tup, nil
+	}, nil
+}
 
-			if a.groupByFields == nil { // adds tuple to the aggregation in the case of no group-by
-				for i := 0; i < len(a.newAggState); i++ {
-					(*aggState[DefaultGroup])[i].AddTuple(t)
+// Aggregate the tuples of iter by group, returning an iterator over the
+// finalized aggregates of each group.  This is a hybrid hash aggregation:
+// the first maxGroups groups are aggregated in memory, and the tuples of any
+// other group are partitioned on their group key into [spillFile]s.  Once the
+// input is consumed, the groups in memory are returned, and then each
+// partition is aggregated in the same way, one at a time, so that every group
+// is returned exactly once.  depth is the number of times the input has been
+// partitioned already.  The partitions are spill files of tid.
+func (a *Aggregator) aggregate(tid TransactionID, iter func() (*Tuple, error), depth int) (func() (*Tuple, error), error) {
+	// the map that stores the aggregation state of each group
+	aggState := make(map[any]*[]AggState)
+	// the list of group key tuples
+	var groupByList []*Tuple
+	// the inputs of the groups that didn't fit in memory
+	var partitions []*spillFile
+	for t, err := iter(); t != nil || err != nil; t, err = iter() {
+		if err != nil {
+			removeSpillFiles(partitions)
+			return nil, err
+		}
+		keygenTup, err := extractGroupByKeyTuple(a, t)
+		if err != nil {
+			removeSpillFiles(partitions)
+			return nil, err
+		}
+
+		key := keygenTup.tupleKey()
+		if aggState[key] == nil {
+			if len(groupByList) >= a.maxGroups && depth < maxAggDepth {
+				if partitions == nil {
+					for i := 0; i < aggPartitions; i++ {
+						p, err := a.bufPool.newSpillFile(tid, a.dir)
+						if err != nil {
+							removeSpillFiles(partitions)
+							return nil, err
+						}
+						partitions = append(partitions, p)
+					}
 				}
-			} else { // adds tuple to the aggregation with grouping
-				keygenTup, err := extractGroupByKeyTuple(a, t)
-				if err != nil {
+				if err := partitions[groupPartition(keygenTup, depth)].append(t); err != nil {
+					removeSpillFiles(partitions)
 					return nil, err
 				}
-
-				key := keygenTup.tupleKey()
-				if aggState[key] == nil {
-					asNew := make([]AggState, len(a.newAggState))
-					aggState[key] = &asNew
-					groupByList = append(groupByList, keygenTup)
-				}
-
-				addTupleToGrpAggState(a, t, aggState[key])
+				continue
 			}
+			asNew := make([]AggState, len(a.newAggState))
+			aggState[key] = &asNew
+			groupByList = append(groupByList, keygenTup)
 		}
 
-		if finalizedIter == nil { // builds the iterator for iterating thru the finalized aggregation results for each group
-			if a.groupByFields == nil {
-				var tup *Tuple
-				for i := 0; i < len(a.newAggState); i++ {
-					newTup := (*aggState[DefaultGroup])[i].Finalize()
-					tup = joinTuples(tup, newTup)
+		addTupleToGrpAggState(a, t, aggState[key])
+	}
+
+	// builds the iterator for iterating thru the finalized aggregation results for each group
+	finalizedIter := getFinalizedTuplesIterator(a, groupByList, aggState)
+	if partitions == nil {
+		return finalizedIter, nil
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := finalizedIter()
+			if t != nil || err != nil {
+				if err != nil {
+					removeSpillFiles(partitions)
+					partitions = nil
 				}
-				finalizedIter = func() (*Tuple, error) { return nil, nil }
-				return tup, nil
-			} else {
-				finalizedIter = getFinalizedTuplesIterator(a, groupByList, aggState)
+				return t, err
+			}
+			if len(partitions) == 0 {
+				return nil, nil
+			}
+			// move on to the next partition; it is read in full by
+			// aggregate, so it can be removed straight away
+			p := partitions[0]
+			partitions = partitions[1:]
+			if p.count == 0 {
+				p.remove()
+				continue
+			}
+			pIter, err := p.iterator()
+			if err == nil {
+				finalizedIter, err = a.aggregate(tid, pIter, depth+1)
+			}
+			p.remove()
+			if err != nil {
+				removeSpillFiles(partitions)
+				partitions = nil
+				return nil, err
 			}
 		}
-		return finalizedIter()
 	}, nil
 }
 
+// Return the partition of the group with the supplied key tuple when the
+// input has already been partitioned depth times
+func groupPartition(key *Tuple, depth int) int {
+	var h uint64
+	for _, f := range key.Fields {
+		h = h*31 + hashValue(f, depth)
+	}
+	return int(h % aggPartitions)
+}
+
 // Given a tuple t from a child iteror, return a tuple that identifies t's group.
 // The returned tuple should contain the fields from the groupByFields list
 // passed into the aggregator constructor.  The ith field can be extracted
@@ -1,6 +1,8 @@
 package godb
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -141,8 +143,8 @@ func TestGbyCountAgg(t *testing.T) {
 	agg := NewGroupedAggregator([]AggState{&sa}, gbyFields, hf)
 	iter, _ := agg.Iterator(tid, agg.Descriptor())
 	fields := []FieldType{
-		{"name", "", StringType},
-		{"count", "", IntType},
+		{Fname: "name", Ftype: StringType},
+		{Fname: "count", Ftype: IntType},
 	}
 	outt1 := Tuple{TupleDesc{fields},
 		[]DBValue{
@@ -183,8 +185,8 @@ func TestGbySumAgg(t *testing.T) {
 	iter, _ := agg.Iterator(tid, agg.Descriptor())
 
 	fields := []FieldType{
-		{"name", "", StringType},
-		{"sum", "", IntType},
+		{Fname: "name", Ftype: StringType},
+		{Fname: "sum", Ftype: IntType},
 	}
 	outt1 := Tuple{TupleDesc{fields},
 		[]DBValue{
@@ -211,7 +213,7 @@ func TestFilterCountAgg(t *testing.T) {
 	hf.insertTuple(&t1, tid)
 	hf.insertTuple(&t2, tid)
 
-	var f FieldType = FieldType{"age", "", IntType}
+	var f FieldType = FieldType{Fname: "age", Ftype: IntType}
 	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Fatalf(err.Error())
@@ -290,3 +292,201 @@ func TestRepeatedIteration(t *testing.T) {
 	}
 
 }
+
+// group by a key with many more values than the aggregator keeps in memory,
+// so that groups are spilled to disk and partitions are split again
+func TestGbySpillingAgg(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "k", Ftype: IntType}, {Fname: "v", Ftype: IntType}}}
+	bp := NewBufferPool(50)
+	os.Remove(TestingFile)
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	for i := 0; i < 3000; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{IntField{int64(i % 1000)}, IntField{int64(i)}}}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	gbyFields := []Expr{&FieldExpr{td.Fields[0]}}
+	sa := SumAggState[int64]{}
+	sa.Init("sum", &FieldExpr{td.Fields[1]}, intAggGetter)
+	ca := CountAggState{}
+	ca.Init("count", &FieldExpr{td.Fields[1]}, nil)
+	dir := t.TempDir()
+	agg := NewExternalGroupedAggregator([]AggState{&sa, &ca}, gbyFields, hf, 5, dir)
+	iter, err := agg.Iterator(tid, agg.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	seen := make(map[int64]bool)
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		k := tup.Fields[0].(IntField).Value
+		if seen[k] {
+			t.Fatalf("group %d returned twice", k)
+		}
+		seen[k] = true
+		// the group holds k, k+1000 and k+2000
+		if sum := tup.Fields[1].(IntField).Value; sum != 3*k+3000 {
+			t.Errorf("unexpected sum %d for group %d", sum, k)
+		}
+		if cnt := tup.Fields[2].(IntField).Value; cnt != 3 {
+			t.Errorf("unexpected count %d for group %d", cnt, k)
+		}
+	}
+	if len(seen) != 1000 {
+		t.Errorf("expected 1000 groups, got %d", len(seen))
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("expected the aggregator to remove its spill files, found %d", len(files))
+	}
+}
+
+func TestCountDistinctAgg(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	_, tuples := runQuery(t, c, "select count(distinct age), count(age) from t")
+	if len(tuples) != 1 {
+		t.Fatalf("expected one result, got %d", len(tuples))
+	}
+	if n := tuples[0].Fields[0].(IntField).Value; n != 10 {
+		t.Errorf("expected 10 distinct ages, got %d", n)
+	}
+	if n := tuples[0].Fields[1].(IntField).Value; n != 200 {
+		t.Errorf("expected 200 ages, got %d", n)
+	}
+
+	// one age per group, and a single distinct name across groups
+	_, tuples = runQuery(t, c, "select age, count(distinct name), count(distinct age) from t group by age")
+	if len(tuples) != 10 {
+		t.Fatalf("expected 10 groups, got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		if tup.Fields[1].(IntField).Value != 1 || tup.Fields[2].(IntField).Value != 1 {
+			t.Errorf("expected one distinct name and age per group, got %v", tup.Fields)
+		}
+	}
+
+	if _, _, err := Parse(c, "select sum(distinct age) from t"); err == nil {
+		t.Errorf("expected an error for an unsupported distinct aggregate")
+	}
+}
+
+func TestHaving(t *testing.T) {
+	// ages 0 to 4 appear 21 times, and the others 20 times
+	c, _, _ := makeCatalogTestVars(t, 205)
+	queries := []struct {
+		sql    string
+		groups int
+	}{
+		{"select age, count(*) from t group by age having count(*) > 20", 5},
+		{"select age, count(*) from t group by age having age >= 7", 3},
+		{"select age, sum(age) from t group by age having sum(age) > 100 and age < 9", 3},
+		{"select age from t group by age having count(*) = 21", 5},
+		{"select count(*) from t having count(*) > 1000", 0},
+	}
+	for _, q := range queries {
+		plan, tuples := runQuery(t, c, q.sql)
+		if len(tuples) != q.groups {
+			t.Errorf("expected %d groups from %s, got %d", q.groups, q.sql, len(tuples))
+		}
+		if _, ok := plan.(*Project).child.(*Filter[int64]); !ok {
+			t.Errorf("expected a filter above the aggregate for %s, got %T", q.sql, plan.(*Project).child)
+		}
+	}
+
+	if _, _, err := Parse(c, "select age from t having age > 2"); err == nil {
+		t.Errorf("expected an error for having without group by or aggregates")
+	}
+}
+
+func TestNullAggregates(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 10)
+	runQuery(t, c, "insert into t values ('ann', null), ('bob', null)")
+	_, tuples := runQuery(t, c, "select count(*), count(age), count(distinct age), sum(age), avg(age), min(age), max(age) from t")
+	expected := []DBValue{IntField{12}, IntField{10}, IntField{10}, IntField{45}, FloatField{4.5}, IntField{0}, IntField{9}}
+	for i, v := range expected {
+		if tuples[0].Fields[i] != v {
+			t.Errorf("expected %v for aggregate %d, got %v", v, i, tuples[0].Fields[i])
+		}
+	}
+
+	// aggregates of groups with only missing values are missing, except counts;
+	// the missing values form a group of their own
+	_, tuples = runQuery(t, c, "select name, count(*), count(age), sum(age), avg(age), min(age), max(age) from t group by name")
+	if len(tuples) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		name := tup.Fields[0].(StringField).Value
+		if name == "sam" {
+			continue
+		}
+		if tup.Fields[1] != (IntField{1}) || tup.Fields[2] != (IntField{0}) {
+			t.Errorf("expected counts of 1 and 0 for %s, got %v", name, tup.Fields)
+		}
+		for _, f := range tup.Fields[3:] {
+			if !isNull(f) {
+				t.Errorf("expected missing aggregates for %s, got %v", name, tup.Fields)
+			}
+		}
+	}
+	_, tuples = runQuery(t, c, "select age, count(*) from t group by age")
+	if len(tuples) != 11 {
+		t.Errorf("expected 10 ages and a group of missing ages, got %d groups", len(tuples))
+	}
+}
+
+func TestAggAbandoned(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/catalog.txt", []byte("g (x int)\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c.SetAggBufferSize(2)
+	runQuery(t, c, "insert into g values (1), (2), (3), (4), (5), (1), (2), (3), (4), (5)")
+	spills := func() []string {
+		files, _ := filepath.Glob(dir + "/godb-spill-*")
+		return files
+	}
+
+	// stop reading after the first group, as a client closing the cursor
+	// would
+	_, plan, err := Parse(c, "select x, count(*) from g group by x")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	iter, err := plan.Iterator(tid, plan.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup == nil {
+		t.Fatalf("expected a group, got %v, %v", tup, err)
+	}
+	if len(spills()) == 0 {
+		t.Fatalf("expected the aggregate to partition the groups past the first 2 in %s", dir)
+	}
+	if err := c.bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if files := spills(); len(files) != 0 {
+		t.Errorf("expected the partitions to be removed at commit, found %v", files)
+	}
+}
@@ -30,21 +30,31 @@ type AggState interface {
 
 	// Gets the tupledesc of the expr
 	GetExprDesc() FieldType
+
+	// Gets the expr whose values are aggregated
+	GetExpr() Expr
 }
 
-// Implements the aggregation state for COUNT
+// Implements the aggregation state for COUNT.  Like the other aggregates,
+// COUNT(x) ignores tuples where x is missing, unless countAll is set, as it is
+// for COUNT(*).
 type CountAggState struct {
-	alias string
-	expr  Expr
-	count int
+	alias    string
+	expr     Expr
+	count    int
+	countAll bool
 }
 
 func (a *CountAggState) GetExprDesc() FieldType {
 	return a.expr.GetExprType()
 }
 
+func (a *CountAggState) GetExpr() Expr {
+	return a.expr
+}
+
 func (a *CountAggState) Copy() AggState {
-	return &CountAggState{a.alias, a.expr, a.count}
+	return &CountAggState{a.alias, a.expr, a.count, a.countAll}
 }
 
 func (a *CountAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
@@ -55,6 +65,12 @@ func (a *CountAggState) Init(alias string, expr Expr, getter func(DBValue) any)
 }
 
 func (a *CountAggState) AddTuple(t *Tuple) {
+	if !a.countAll {
+		v, err := a.expr.EvalExpr(t)
+		if err != nil || isNull(v) {
+			return
+		}
+	}
 	a.count++
 }
 
@@ -67,27 +83,112 @@ func (a *CountAggState) Finalize() *Tuple {
 }
 
 func (a *CountAggState) GetTupleDesc() *TupleDesc {
-	ft := FieldType{a.alias, "", IntType}
+	ft := FieldType{Fname: a.alias, Ftype: IntType}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
 	td.Fields = fts
 	return &td
 }
 
-// Implements the aggregation state for SUM
+// Implements the aggregation state for COUNT(DISTINCT x), counting the
+// distinct values of the expression in the group
+type CountDistinctAggState struct {
+	alias string
+	expr  Expr
+	seen  map[DBValue]bool
+}
+
+func (a *CountDistinctAggState) GetExprDesc() FieldType {
+	return a.expr.GetExprType()
+}
+
+func (a *CountDistinctAggState) GetExpr() Expr {
+	return a.expr
+}
+
+func (a *CountDistinctAggState) Copy() AggState {
+	seen := make(map[DBValue]bool, len(a.seen))
+	for v := range a.seen {
+		seen[v] = true
+	}
+	return &CountDistinctAggState{a.alias, a.expr, seen}
+}
+
+func (a *CountDistinctAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.seen = make(map[DBValue]bool)
+	a.expr = expr
+	a.alias = alias
+	return nil
+}
+
+func (a *CountDistinctAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || isNull(v) {
+		return
+	}
+	if d, ok := v.(DecimalField); ok {
+		v = d.normalized()
+	}
+	a.seen[v] = true
+}
+
+func (a *CountDistinctAggState) Finalize() *Tuple {
+	td := a.GetTupleDesc()
+	f := IntField{int64(len(a.seen))}
+	fs := []DBValue{f}
+	t := Tuple{*td, fs, nil}
+	return &t
+}
+
+func (a *CountDistinctAggState) GetTupleDesc() *TupleDesc {
+	ft := FieldType{Fname: a.alias, Ftype: IntType}
+	fts := []FieldType{ft}
+	td := TupleDesc{}
+	td.Fields = fts
+	return &td
+}
+
+// Implements the aggregation state for SUM.  Missing values are ignored, and
+// the sum of no values is missing.  Decimals, which are not Go numbers, are
+// summed exactly into dsum, with the scale of the decimal column summed, or as
+// many digits after the decimal point as the value with the most; a sum too
+// large for a decimal is missing.
 type SumAggState[T Number] struct {
 	alias  string
 	expr   Expr
 	sum    T
+	len    int
 	getter func(DBValue) any
+	dsum   decimalSum
+}
+
+// The exact sum of decimals, or an error if it overflowed
+type decimalSum struct {
+	sum DecimalField
+	err error
+}
+
+// Return an empty sum of the values of expr, at the scale declared for them
+func newDecimalSum(expr Expr) decimalSum {
+	return decimalSum{sum: DecimalField{0, expr.GetExprType().Scale}}
+}
+
+func (s *decimalSum) add(v DBValue) {
+	if s.err == nil {
+		s.sum, s.err = s.sum.add(v.(DecimalField))
+	}
 }
 
 func (a *SumAggState[T]) GetExprDesc() FieldType {
 	return a.expr.GetExprType()
 }
 
+func (a *SumAggState[T]) GetExpr() Expr {
+	return a.expr
+}
+
 func (a *SumAggState[T]) Copy() AggState {
-	return &SumAggState[T]{alias: a.alias, expr: a.expr, sum: a.sum, getter: a.getter}
+	return &SumAggState[T]{alias: a.alias, expr: a.expr, sum: a.sum, len: a.len, getter: a.getter, dsum: a.dsum}
 }
 
 func intAggGetter(v DBValue) any {
@@ -95,6 +196,30 @@ func intAggGetter(v DBValue) any {
 	return intV.Value
 }
 
+// Return the value of a date or a timestamp, so that their maximum and minimum
+// are found as int64s
+func temporalAggGetter(v DBValue) any {
+	return temporalFilterGetter(v)
+}
+
+// Return the type of the int64 maximum or minimum of expr, which is that of
+// expr if it is a date or a timestamp, and otherwise int
+func int64AggType(expr Expr) DBType {
+	if t := expr.GetExprType().Ftype; t == DateType || t == TimestampType {
+		return t
+	}
+	return IntType
+}
+
+func decimalAggGetter(v DBValue) any {
+	return v.(DecimalField)
+}
+
+func floatAggGetter(v DBValue) any {
+	floatV := v.(FloatField)
+	return floatV.Value
+}
+
 func stringAggGetter(v DBValue) any {
 	stringV := v.(StringField)
 	return stringV.Value
@@ -104,17 +229,32 @@ func (a *SumAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 	a.alias = alias
 	a.expr = expr
 	a.sum = 0
+	a.len = 0
 	a.getter = getter
+	a.dsum = newDecimalSum(expr)
 	return nil
 }
 
 func (a *SumAggState[T]) AddTuple(t *Tuple) {
-	rt, _ := a.expr.EvalExpr(t)
-	a.sum += a.getter(rt).(T)
+	rt, err := a.expr.EvalExpr(t)
+	if err != nil || isNull(rt) {
+		return
+	}
+	if _, ok := rt.(DecimalField); ok {
+		a.dsum.add(rt)
+	} else {
+		a.sum += a.getter(rt).(T)
+	}
+	a.len++
 }
 
 func (a *SumAggState[T]) GetTupleDesc() *TupleDesc {
-	ft := FieldType{a.alias, "", IntType}
+	ft := FieldType{Fname: a.alias, Ftype: IntType}
+	if _, ok := any(a.sum).(float64); ok {
+		ft.Ftype = FloatType
+	} else if a.expr.GetExprType().Ftype == DecimalType {
+		ft.Ftype = DecimalType
+	}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
 	td.Fields = fts
@@ -123,29 +263,44 @@ func (a *SumAggState[T]) GetTupleDesc() *TupleDesc {
 
 func (a *SumAggState[T]) Finalize() *Tuple {
 	td := a.GetTupleDesc()
-	f := IntField{int64(a.sum)}
+	var f DBValue = IntField{int64(a.sum)}
+	if sum, ok := any(a.sum).(float64); ok {
+		f = FloatField{sum}
+	} else if td.Fields[0].Ftype == DecimalType {
+		f = a.dsum.sum
+	}
+	if a.len == 0 || a.dsum.err != nil {
+		f = NullField{}
+	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
 
-// Implements the aggregation state for AVG
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for divide-by-zero
+// Implements the aggregation state for AVG.  The average, even of ints, is a
+// float, except that the average of decimals is a decimal, computed exactly
+// from their sum, with decimalDivisionScale more digits after the decimal point
+// than their scale (see [DecimalField.div]).  Missing values are ignored, and the
+// average of no values is missing.
 type AvgAggState[T Number] struct {
 	alias  string
 	expr   Expr
 	sum    T
 	len    int
 	getter func(DBValue) any
+	dsum   decimalSum
 }
 
 func (a *AvgAggState[T]) GetExprDesc() FieldType {
 	return a.expr.GetExprType()
 }
 
+func (a *AvgAggState[T]) GetExpr() Expr {
+	return a.expr
+}
+
 func (a *AvgAggState[T]) Copy() AggState {
-	return &AvgAggState[T]{alias: a.alias, expr: a.expr, sum: a.sum, len: a.len, getter: a.getter}
+	return &AvgAggState[T]{alias: a.alias, expr: a.expr, sum: a.sum, len: a.len, getter: a.getter, dsum: a.dsum}
 }
 
 func (a *AvgAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any) error {
@@ -154,17 +309,28 @@ func (a *AvgAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 	a.sum = 0
 	a.len = 0
 	a.getter = getter
+	a.dsum = newDecimalSum(expr)
 	return nil
 }
 
 func (a *AvgAggState[T]) AddTuple(t *Tuple) {
-	rt, _ := a.expr.EvalExpr(t)
-	a.sum += a.getter(rt).(T)
+	rt, err := a.expr.EvalExpr(t)
+	if err != nil || isNull(rt) {
+		return
+	}
+	if _, ok := rt.(DecimalField); ok {
+		a.dsum.add(rt)
+	} else {
+		a.sum += a.getter(rt).(T)
+	}
 	a.len += 1
 }
 
 func (a *AvgAggState[T]) GetTupleDesc() *TupleDesc {
-	ft := FieldType{a.alias, "", IntType}
+	ft := FieldType{Fname: a.alias, Ftype: FloatType}
+	if a.expr.GetExprType().Ftype == DecimalType {
+		ft.Ftype = DecimalType
+	}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
 	td.Fields = fts
@@ -173,16 +339,21 @@ func (a *AvgAggState[T]) GetTupleDesc() *TupleDesc {
 
 func (a *AvgAggState[T]) Finalize() *Tuple {
 	td := a.GetTupleDesc()
-	val := int64(int(a.sum) / a.len)
-	f := IntField{val}
+	var f DBValue = NullField{}
+	if a.len > 0 && td.Fields[0].Ftype == DecimalType {
+		if avg, err := a.dsum.sum.div(DecimalField{int64(a.len), 0}); err == nil && a.dsum.err == nil {
+			f = avg
+		}
+	} else if a.len > 0 {
+		f = FloatField{float64(a.sum) / float64(a.len)}
+	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
 
-// Implements the aggregation state for MAX
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for NaN max
+// Implements the aggregation state for MAX.  Missing values are ignored, and
+// the maximum of no values is missing.
 type MaxAggState[T constraints.Ordered] struct {
 	alias  string
 	expr   Expr
@@ -195,11 +366,16 @@ func (a *MaxAggState[T]) GetExprDesc() FieldType {
 	return a.expr.GetExprType()
 }
 
+func (a *MaxAggState[T]) GetExpr() Expr {
+	return a.expr
+}
+
 func (a *MaxAggState[T]) Copy() AggState {
 	return &MaxAggState[T]{a.alias, a.expr, a.max, true, a.getter}
 }
 
 func (a *MaxAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.null = true
 	a.expr = expr
 	a.getter = getter
 	a.alias = alias
@@ -208,7 +384,7 @@ func (a *MaxAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 
 func (a *MaxAggState[T]) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || isNull(v) {
 		return
 	}
 	val := a.getter(v).(T)
@@ -224,9 +400,11 @@ func (a *MaxAggState[T]) GetTupleDesc() *TupleDesc {
 	var ft FieldType
 	switch any(a.max).(type) {
 	case string:
-		ft = FieldType{a.alias, "", StringType}
+		ft = FieldType{Fname: a.alias, Ftype: StringType}
+	case float64:
+		ft = FieldType{Fname: a.alias, Ftype: FloatType}
 	default:
-		ft = FieldType{a.alias, "", IntType}
+		ft = FieldType{Fname: a.alias, Ftype: int64AggType(a.expr)}
 	}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
@@ -237,20 +415,24 @@ func (a *MaxAggState[T]) GetTupleDesc() *TupleDesc {
 func (a *MaxAggState[T]) Finalize() *Tuple {
 	td := a.GetTupleDesc()
 	var f any
-	switch any(a.max).(type) {
+	switch v := any(a.max).(type) {
 	case string:
-		f = StringField{any(a.max).(string)}
+		f = StringField{v}
+	case float64:
+		f = FloatField{v}
 	default:
-		f = IntField{any(a.max).(int64)}
+		f = int64Field(td.Fields[0].Ftype, v.(int64))
+	}
+	if a.null {
+		f = NullField{}
 	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
 
-// Implements the aggregation state for MIN
-// Note that we always AddTuple() at least once before Finalize()
-// so no worries for NaN min
+// Implements the aggregation state for MIN.  Missing values are ignored, and
+// the minimum of no values is missing.
 type MinAggState[T constraints.Ordered] struct {
 	alias  string
 	expr   Expr
@@ -263,11 +445,16 @@ func (a *MinAggState[T]) GetExprDesc() FieldType {
 	return a.expr.GetExprType()
 }
 
+func (a *MinAggState[T]) GetExpr() Expr {
+	return a.expr
+}
+
 func (a *MinAggState[T]) Copy() AggState {
 	return &MinAggState[T]{a.alias, a.expr, a.min, true, a.getter}
 }
 
 func (a *MinAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.null = true
 	a.expr = expr
 	a.getter = getter
 	a.alias = alias
@@ -276,7 +463,7 @@ func (a *MinAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 
 func (a *MinAggState[T]) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || isNull(v) {
 		return
 	}
 	val := a.getter(v).(T)
@@ -292,9 +479,11 @@ func (a *MinAggState[T]) GetTupleDesc() *TupleDesc {
 	var ft FieldType
 	switch any(a.min).(type) {
 	case string:
-		ft = FieldType{a.alias, "", StringType}
+		ft = FieldType{Fname: a.alias, Ftype: StringType}
+	case float64:
+		ft = FieldType{Fname: a.alias, Ftype: FloatType}
 	default:
-		ft = FieldType{a.alias, "", IntType}
+		ft = FieldType{Fname: a.alias, Ftype: int64AggType(a.expr)}
 	}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
@@ -305,13 +494,129 @@ func (a *MinAggState[T]) GetTupleDesc() *TupleDesc {
 func (a *MinAggState[T]) Finalize() *Tuple {
 	td := a.GetTupleDesc()
 	var f any
-	switch any(a.min).(type) {
+	switch v := any(a.min).(type) {
 	case string:
-		f = StringField{any(a.min).(string)}
+		f = StringField{v}
+	case float64:
+		f = FloatField{v}
 	default:
-		f = IntField{any(a.min).(int64)}
+		f = int64Field(td.Fields[0].Ftype, v.(int64))
+	}
+	if a.null {
+		f = NullField{}
 	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
 }
+
+// Implements the aggregation state for MAX, or MIN if min is set, of
+// decimals, which, unlike the values of a [MaxAggState], are not ordered by
+// Go's operators.  Missing values are ignored, and the maximum of no values is
+// missing.
+type DecimalMaxAggState struct {
+	alias string
+	expr  Expr
+	max   DecimalField
+	null  bool // whether the agg state have not seen any tuple inputted yet
+	min   bool
+}
+
+func (a *DecimalMaxAggState) GetExprDesc() FieldType {
+	return a.expr.GetExprType()
+}
+
+func (a *DecimalMaxAggState) GetExpr() Expr {
+	return a.expr
+}
+
+func (a *DecimalMaxAggState) Copy() AggState {
+	return &DecimalMaxAggState{a.alias, a.expr, a.max, true, a.min}
+}
+
+func (a *DecimalMaxAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.null = true
+	a.expr = expr
+	a.alias = alias
+	return nil
+}
+
+func (a *DecimalMaxAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || isNull(v) {
+		return
+	}
+	val := v.(DecimalField)
+	if a.null || (!a.min && val.cmp(a.max) > 0) || (a.min && val.cmp(a.max) < 0) {
+		a.max = val
+		a.null = false
+	}
+}
+
+func (a *DecimalMaxAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{Fname: a.alias, Ftype: DecimalType}}}
+}
+
+func (a *DecimalMaxAggState) Finalize() *Tuple {
+	var f DBValue = a.max
+	if a.null {
+		f = NullField{}
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{f}, nil}
+}
+
+// Implements the aggregation state for BOOL_AND, or BOOL_OR if or is set,
+// which is true if all (or any) of the boolean values are true.  Missing
+// values are ignored, and the result for no values is missing.
+type BoolAggState struct {
+	alias string
+	expr  Expr
+	value bool
+	null  bool // whether the agg state have not seen any tuple inputted yet
+	or    bool
+}
+
+func (a *BoolAggState) GetExprDesc() FieldType {
+	return a.expr.GetExprType()
+}
+
+func (a *BoolAggState) GetExpr() Expr {
+	return a.expr
+}
+
+func (a *BoolAggState) Copy() AggState {
+	return &BoolAggState{a.alias, a.expr, !a.or, true, a.or}
+}
+
+func (a *BoolAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.value = !a.or
+	a.null = true
+	a.expr = expr
+	a.alias = alias
+	return nil
+}
+
+func (a *BoolAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || isNull(v) {
+		return
+	}
+	if a.or {
+		a.value = a.value || v.(BoolField).Value
+	} else {
+		a.value = a.value && v.(BoolField).Value
+	}
+	a.null = false
+}
+
+func (a *BoolAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{Fname: a.alias, Ftype: BoolType}}}
+}
+
+func (a *BoolAggState) Finalize() *Tuple {
+	var f DBValue = BoolField{a.value}
+	if a.null {
+		f = NullField{}
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{f}, nil}
+}
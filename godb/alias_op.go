@@ -0,0 +1,42 @@
+package godb
+
+// AliasOp returns the tuples of its child with the table qualifier of every
+// field set to the name by which a query refers to the child's table or
+// subquery.  The planner places it under joins, so that fields of the same
+// name from the two sides of a join, such as those of a table joined with
+// itself, can be told apart in the joined tuples.
+type AliasOp struct {
+	alias string
+	child Operator
+}
+
+// Construct an operator that renames the table of the fields of child to alias
+func NewAliasOp(alias string, child Operator) *AliasOp {
+	return &AliasOp{alias, child}
+}
+
+// Return the descriptor of the child, with every field qualified by the alias
+func (a *AliasOp) Descriptor() *TupleDesc {
+	desc := a.child.Descriptor().copy()
+	desc.setTableAlias(a.alias)
+	return desc
+}
+
+// Return an iterator over copies of the tuples of the child that have the
+// aliased descriptor
+func (a *AliasOp) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	childIter, err := a.child.Iterator(tid, a.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	aliased := a.Descriptor()
+	return func() (*Tuple, error) {
+		t, err := childIter()
+		if t == nil || err != nil {
+			return nil, err
+		}
+		renamed := *t
+		renamed.Desc = *aliased
+		return &renamed, nil
+	}, nil
+}
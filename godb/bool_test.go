@@ -0,0 +1,82 @@
+package godb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestBoolQueries(t *testing.T) {
+	c, dir := makeQueryCatalog(t, "p (id int, age int, active bool)\n")
+	runQuery(t, c, "insert into p values (1, 25, true), (2, 40, false)")
+	csv := dir + "/p.csv"
+	if err := os.WriteFile(csv, []byte("3,35,TRUE\n4,50,\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	f, err := os.Open(csv)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	p, _ := c.GetTable("p")
+	if err := p.(*ColumnFile).LoadFromCSV(f, false, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	checkQueryCounts(t, c, []queryCount{
+		{"select id from p where active", 2},
+		{"select id from p where active = true", 2},
+		{"select id from p where not active", 1},
+		{"select id from p where active or age > 45", 3},
+		{"select id from p where (age > 30) = active", 1},
+		{"select id from p where active is null", 1},
+	})
+
+	checkQueryRows(t, c, "select id, active, age > 30 old, not active, active and age < 30, false from p order by id", []string{
+		"1,true,false,false,true,false",
+		"2,false,true,true,false,false",
+		"3,true,true,false,false,false",
+		"4,NULL,true,NULL,false,false",
+	})
+	checkQueryRows(t, c, "select bool_and(active), bool_or(active), count(active) from p where age > 30", []string{"false,true,2"})
+	checkQueryRows(t, c, "select active, count(*), bool_and(age > 30) from p group by active order by active", []string{"false,1,true", "true,2,false", "NULL,1,true"})
+
+	for _, sql := range []string{"select sum(active) from p", "select bool_or(age) from p", "select id from p where age", "select id from p where active = 1"} {
+		if err := queryError(c, sql); err == nil {
+			t.Errorf("expected an error from %s", sql)
+		}
+	}
+
+	if _, _, err := Parse(c, "create table e (a bool, b boolean, `boolean` int, `is bool` BOOL)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	e, err := c.GetTable("e")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// only column types are rewritten, not column names
+	if fs := e.Descriptor().Fields; fs[0].Ftype != BoolType || fs[1].Ftype != BoolType || fs[2].Ftype != IntType || fs[3].Ftype != BoolType {
+		t.Errorf("expected boolean columns, got %v", fs)
+	}
+	if s := replaceUnquoted(boolTypeRegexp, "create table e (a bool comment 'b, c boolean')", "${1}bit"); s != "create table e (a bit comment 'b, c boolean')" {
+		t.Errorf("unexpected rewrite %s", s)
+	}
+
+	// booleans are stored in a byte
+	desc := TupleDesc{Fields: []FieldType{{Fname: "a", Ftype: BoolType}, {Fname: "b", Ftype: BoolType}}}
+	tup := Tuple{Desc: desc, Fields: []DBValue{BoolField{true}, BoolField{false}}}
+	var buf bytes.Buffer
+	if err := tup.writeTo(&buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if buf.Len() != tup.size() || buf.Len() != nullBitmapSize(&desc)+2 {
+		t.Errorf("expected a tuple of %d bytes, got %d", nullBitmapSize(&desc)+2, buf.Len())
+	}
+	read, err := readTupleFrom(&buf, &desc)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !read.equals(&tup) {
+		t.Errorf("expected %v after a round trip, got %v", tup.Fields, read.Fields)
+	}
+}
@@ -0,0 +1,555 @@
+package godb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mitchellh/hashstructure/v2"
+)
+
+// BTreeFile is a B+ tree index over one field (the key) of a [HeapFile] or a
+// [ColumnFile].  Its nodes are stored as [btreePage] objects in a file of its
+// own, and are read and locked through the [BufferPool] just like the pages of
+// a HeapFile.  Page 0 is always the root of the tree.
+//
+// The index is kept up to date by the HeapFile it indexes (or, for a
+// ColumnFile, by the HeapFile storing the key column):  tuples inserted
+// with [HeapFile.insertTuple] are added to the index, and are removed from it
+// once the version of the tuple is reclaimed by the heap file (see
+// [HeapFile.Vacuum]).  Because deleting a tuple only marks the version as
+// deleted, the index may return tuple versions that are not visible to a
+// transaction, so scans check every tuple against the transaction's snapshot.
+//
+// The index supports duplicate keys, and keys of type IntType and StringType.
+// Nodes are split when they fill up, but are not merged when entries are
+// removed.
+type BTreeFile struct {
+	numPages int
+	fileName string
+	file     *os.File
+	table    indexedFile
+	keyField FieldType
+	keyIdx   int // index of the key in the tuples of the file maintaining the index
+	bufPool  *BufferPool
+	m        sync.Mutex
+}
+
+// Files that can be indexed by a BTreeFile
+type indexedFile interface {
+	DBFile
+	// register an index to keep up to date
+	attachIndex(bf *BTreeFile)
+	// return the tuple at rid if it is visible to snap
+	fetchTuple(rid RecordID, tid TransactionID, snap snapshot) (*Tuple, error)
+}
+
+const rootPageNo int = 0
+
+// Create a BTreeFile indexing the field named keyField of table.
+// Parameters
+// - fromFile: backing file for the index.  May be empty or a previously created index.
+// - table: the HeapFile or ColumnFile to index.  The index registers itself
+// with the table, so that tuples inserted into the table from now on are
+// indexed; tuples already in the table have to be added with
+// [BTreeFile.build].
+// - keyField: the name of the field to index
+// - bp: the BufferPool that is used to store pages read from the index
+// Returns an error if the file cannot be opened or created, or if the table
+// has no such field or its type can't be indexed.
+func NewBTreeFile(fromFile string, table indexedFile, keyField string, bp *BufferPool) (*BTreeFile, error) {
+	keyIdx, err := findFieldInTd(FieldType{Fname: keyField, Ftype: UnknownType}, table.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	field := table.Descriptor().Fields[keyIdx]
+	if field.Ftype != IntType && field.Ftype != StringType {
+		return nil, GoDBError{TypeMismatchError, "can only index int and string fields"}
+	}
+	if _, ok := table.(*ColumnFile); ok {
+		// the key column stores the key on its own
+		keyIdx = 0
+	}
+	file, err := os.OpenFile(fromFile, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	bf := &BTreeFile{
+		numPages: int(info.Size()) / PageSize,
+		fileName: fromFile,
+		file:     file,
+		table:    table,
+		keyField: field,
+		keyIdx:   keyIdx,
+		bufPool:  bp,
+	}
+	if bf.numPages == 0 {
+		// a new index starts out as a single, empty leaf
+		var root Page = newBTreePage(bf, rootPageNo, true)
+		if err := bf.flushPage(&root); err != nil {
+			file.Close()
+			return nil, err
+		}
+		bf.numPages = 1
+	}
+	table.attachIndex(bf)
+	return bf, nil
+}
+
+// Add the tuples of the indexed table that are visible to tid to the index
+func (bf *BTreeFile) build(tid TransactionID) error {
+	iter, err := bf.table.Iterator(tid, bf.table.Descriptor())
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return nil
+		}
+		rid, ok := t.Rid.(RecordID)
+		if !ok {
+			return GoDBError{IllegalOperationError, "indexed table did not return record ids"}
+		}
+		key := t.Fields[bf.tableKeyIdx()]
+		if isNull(key) {
+			continue
+		}
+		if err := bf.checkKeyLength(key); err != nil {
+			return err
+		}
+		err = bf.insertEntry(btreeEntry{key, rid}, tid)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Return the index of the key in the tuples of the indexed table
+func (bf *BTreeFile) tableKeyIdx() int {
+	idx, _ := findFieldInTd(bf.keyField, bf.table.Descriptor())
+	return idx
+}
+
+// Return the number of pages in the index
+func (bf *BTreeFile) NumPages() int {
+	bf.m.Lock()
+	defer bf.m.Unlock()
+	return bf.numPages
+}
+
+// Read the specified page number from the index file on disk.
+func (bf *BTreeFile) readPage(pageNo int) (*Page, error) {
+	byteArray := make([]byte, PageSize)
+	numBytes, err := bf.file.ReadAt(byteArray, int64(PageSize*pageNo))
+	if numBytes != PageSize || err != nil {
+		if err == nil {
+			err = GoDBError{MalformedDataError, "short read of btree page"}
+		}
+		return nil, err
+	}
+	pg := newBTreePage(bf, pageNo, true)
+	if err := pg.initFromBuffer(bytes.NewBuffer(byteArray)); err != nil {
+		return nil, err
+	}
+	var p Page = pg
+	return &p, nil
+}
+
+// Write the page back to the index file, at the offset given by its page
+// number.
+func (bf *BTreeFile) flushPage(p *Page) error {
+	pg := (*p).(*btreePage)
+	buf, err := pg.toBuffer()
+	if err != nil {
+		return err
+	}
+	if _, err := bf.file.WriteAt(buf.Bytes(), int64(PageSize*pg.pageNo)); err != nil {
+		return err
+	}
+	pg.setDirty(false)
+	return nil
+}
+
+// Return a key for a page of the index to use in the BufferPool.
+func (bf *BTreeFile) pageKey(pgNo int) any {
+	hash, _ := hashstructure.Hash(heapHash{FileName: bf.fileName, PageNo: pgNo}, hashstructure.FormatV2, nil)
+	return hash
+}
+
+// Return the descriptor of the tuples returned by the index, i.e., the
+// descriptor of the indexed table.
+func (bf *BTreeFile) Descriptor() *TupleDesc {
+	return bf.table.Descriptor()
+}
+
+func (bf *BTreeFile) getPage(pageNo int, tid TransactionID, perm RWPerm) (*btreePage, error) {
+	p, err := bf.bufPool.GetPage(bf, pageNo, tid, perm)
+	if err != nil {
+		return nil, err
+	}
+	return (*p).(*btreePage), nil
+}
+
+// Append a new, empty node to the index file, and return it, locked by tid.
+func (bf *BTreeFile) newPage(leaf bool, tid TransactionID) (*btreePage, error) {
+	bf.m.Lock()
+	var p Page = newBTreePage(bf, bf.numPages, leaf)
+	if err := bf.flushPage(&p); err != nil {
+		bf.m.Unlock()
+		return nil, err
+	}
+	bf.numPages++
+	bf.m.Unlock()
+	return bf.getPage(p.(*btreePage).pageNo, tid, WritePerm)
+}
+
+// Return the entry indexing t, which must have been read from or inserted
+// into the indexed table
+func (bf *BTreeFile) entryFor(t *Tuple) (btreeEntry, error) {
+	rid, ok := t.Rid.(RecordID)
+	if !ok || bf.keyIdx >= len(t.Fields) {
+		return btreeEntry{}, GoDBError{IllegalOperationError, "tuple is not stored in the indexed table"}
+	}
+	return btreeEntry{key: t.Fields[bf.keyIdx], rid: rid}, nil
+}
+
+// Return an error if the key of t is too long to be stored in the index
+func (bf *BTreeFile) checkKeyOf(t *Tuple) error {
+	if bf.keyIdx >= len(t.Fields) {
+		return nil
+	}
+	return bf.checkKeyLength(t.Fields[bf.keyIdx])
+}
+
+// Return an error if key is a string longer than the [keySize] bytes that
+// index entries hold for keys.  This can only happen if the indexed field is
+// not a varchar(n), as the index holds the longest strings of those.
+func (bf *BTreeFile) checkKeyLength(key DBValue) error {
+	if s, ok := key.(StringField); ok && len(s.Value) > keySize(bf.keyField) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("key of %d bytes is longer than the maximum of %d for an index", len(s.Value), keySize(bf.keyField))}
+	}
+	return nil
+}
+
+// Add t to the index.  t must already be stored in the indexed table, i.e.,
+// have its Rid set; tuples are normally added to the table with
+// [HeapFile.insertTuple], which takes care of updating its indexes.
+//
+// Only the nodes the insert modifies are locked exclusively (see
+// [BTreeFile.lockPath]): the leaf, and the full nodes above it that are split
+// on the way back up along with the node the split stops at.  In particular
+// the root is only locked when it is split.
+//
+// Tuples whose key is missing are not indexed, as no range of keys contains
+// them.
+func (bf *BTreeFile) insertTuple(t *Tuple, tid TransactionID) error {
+	e, err := bf.entryFor(t)
+	if err != nil || isNull(e.key) {
+		return err
+	}
+	if err := bf.checkKeyLength(e.key); err != nil {
+		return err
+	}
+	return bf.insertEntry(e, tid)
+}
+
+func (bf *BTreeFile) insertEntry(e btreeEntry, tid TransactionID) error {
+	path, err := bf.lockPath(e, true, tid)
+	if err != nil {
+		return err
+	}
+	return bf.insertAt(path, e, -1, tid)
+}
+
+// Return the pages on the path from the root to the leaf e belongs in, along
+// with whether each node is full, reading them without locking them like
+// [BTreeFile.entryIterator] does.
+func (bf *BTreeFile) pathTo(e btreeEntry, tid TransactionID) ([]int, []bool, error) {
+	path := []int{rootPageNo}
+	full := []bool{}
+	for {
+		pg, err := bf.getPage(path[len(path)-1], tid, SnapshotPerm)
+		if err != nil {
+			return nil, nil, err
+		}
+		pg.latch.RLock()
+		full = append(full, len(pg.entries) >= pg.maxEntries())
+		leaf := pg.leaf
+		if !leaf {
+			path = append(path, pg.childFor(e))
+		}
+		pg.latch.RUnlock()
+		if leaf {
+			return path, full, nil
+		}
+	}
+}
+
+// Return the path from the root to the leaf e belongs in, with the nodes that
+// adding e modifies locked exclusively by tid: the leaf, and if split is set,
+// the full nodes above it and the lowest node that is not.  The path is read
+// without locking it, so that other transactions can still update the tree
+// below the nodes a transaction locked; once the nodes are locked their ranges
+// of keys can't change anymore, as only splitting a node changes its range,
+// and the path is read again to check that e still belongs in them.  Locks on
+// nodes that turn out not to be on the path are kept until tid ends.
+func (bf *BTreeFile) lockPath(e btreeEntry, split bool, tid TransactionID) ([]int, error) {
+	for {
+		path, full, err := bf.pathTo(e, tid)
+		if err != nil {
+			return nil, err
+		}
+		top := len(path) - 1
+		for split && top > 0 && full[top] {
+			top--
+		}
+		for _, pageNo := range path[top:] {
+			if _, err := bf.getPage(pageNo, tid, WritePerm); err != nil {
+				return nil, err
+			}
+		}
+		again, full, err := bf.pathTo(e, tid)
+		if err != nil {
+			return nil, err
+		}
+		locked := len(path) - top
+		if len(again) < locked || (split && top > 0 && full[len(again)-locked]) {
+			continue
+		}
+		same := true
+		for i, pageNo := range path[top:] {
+			same = same && again[len(again)-locked+i] == pageNo
+		}
+		if same {
+			return again, nil
+		}
+	}
+}
+
+// Add e to the last node on path, splitting it if it is full, and insert the
+// resulting separator into its parent.  right is the child to the right of e
+// when inserting into an internal node.
+func (bf *BTreeFile) insertAt(path []int, e btreeEntry, right int, tid TransactionID) error {
+	pg, err := bf.getPage(path[len(path)-1], tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	if len(pg.entries) < pg.maxEntries() {
+		pg.latch.Lock()
+		pg.add(e, right)
+		pg.latch.Unlock()
+		return nil
+	}
+	if len(path) == 1 {
+		return bf.splitRoot(e, right, tid)
+	}
+	sibling, err := bf.newPage(pg.leaf, tid)
+	if err != nil {
+		return err
+	}
+	pg.latch.Lock()
+	sibling.latch.Lock()
+	pg.add(e, right)
+	sep := pg.splitInto(sibling)
+	sibling.latch.Unlock()
+	pg.latch.Unlock()
+	return bf.insertAt(path[:len(path)-1], sep, sibling.pageNo, tid)
+}
+
+// Add e to the full root node by moving its contents into two new nodes, so
+// that the root stays on page 0 and grows the tree by a level.
+func (bf *BTreeFile) splitRoot(e btreeEntry, right int, tid TransactionID) error {
+	root, err := bf.getPage(rootPageNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	left, err := bf.newPage(root.leaf, tid)
+	if err != nil {
+		return err
+	}
+	sibling, err := bf.newPage(root.leaf, tid)
+	if err != nil {
+		return err
+	}
+	root.latch.Lock()
+	left.latch.Lock()
+	sibling.latch.Lock()
+	left.entries = root.entries
+	left.children = root.children
+	left.next = root.next
+	left.add(e, right)
+	sep := left.splitInto(sibling)
+	root.leaf = false
+	root.entries = []btreeEntry{sep}
+	root.children = []int{left.pageNo, sibling.pageNo}
+	root.next = -1
+	root.setDirty(true)
+	sibling.latch.Unlock()
+	left.latch.Unlock()
+	root.latch.Unlock()
+	return nil
+}
+
+// Remove t from the index.  Like [BTreeFile.insertTuple], this is normally
+// done by the indexed table, when the version of t is reclaimed.  Returns a
+// TupleNotFoundError if t is not in the index.
+func (bf *BTreeFile) deleteTuple(t *Tuple, tid TransactionID) error {
+	e, err := bf.entryFor(t)
+	if err != nil || isNull(e.key) {
+		return err
+	}
+	path, err := bf.lockPath(e, false, tid)
+	if err != nil {
+		return err
+	}
+	pg, err := bf.getPage(path[len(path)-1], tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	pg.latch.Lock()
+	defer pg.latch.Unlock()
+	if !pg.remove(e) {
+		return GoDBError{TupleNotFoundError, "tuple is not in the index"}
+	}
+	return nil
+}
+
+// A range of keys to scan.  A nil bound leaves the range open on that side.
+type keyRange struct {
+	lo, hi                   DBValue
+	loInclusive, hiInclusive bool
+}
+
+// Whether key is before the start of the range
+func (r keyRange) before(key DBValue) bool {
+	if r.lo == nil {
+		return false
+	}
+	c := compareKeys(key, r.lo)
+	return c < 0 || (c == 0 && !r.loInclusive)
+}
+
+// Whether key is after the end of the range
+func (r keyRange) after(key DBValue) bool {
+	if r.hi == nil {
+		return false
+	}
+	c := compareKeys(key, r.hi)
+	return c > 0 || (c == 0 && !r.hiInclusive)
+}
+
+// Return an iterator over the entries with keys in the range, in order.  Nodes
+// are read without locking them, like the pages read by [HeapFile.Iterator].
+func (bf *BTreeFile) entryIterator(tid TransactionID, r keyRange) func() (*btreeEntry, error) {
+	pageNo := rootPageNo
+	descended := false
+	entries := []btreeEntry{}
+	done := false
+	return func() (*btreeEntry, error) {
+		for !done {
+			if !descended {
+				pg, err := bf.getPage(pageNo, tid, SnapshotPerm)
+				if err != nil {
+					return nil, err
+				}
+				pg.latch.RLock()
+				if pg.leaf {
+					descended = true
+				} else if r.lo == nil {
+					pageNo = pg.children[0]
+				} else {
+					pageNo = pg.childForKey(r.lo)
+				}
+				pg.latch.RUnlock()
+				continue
+			}
+			for len(entries) > 0 {
+				e := entries[0]
+				entries = entries[1:]
+				if r.before(e.key) {
+					continue
+				}
+				if r.after(e.key) {
+					done = true
+					return nil, nil
+				}
+				return &e, nil
+			}
+			if pageNo == -1 {
+				done = true
+				break
+			}
+			pg, err := bf.getPage(pageNo, tid, SnapshotPerm)
+			if err != nil {
+				return nil, err
+			}
+			// copy the entries, as concurrent writers may modify the leaf
+			pg.latch.RLock()
+			entries = append([]btreeEntry{}, pg.entries...)
+			pageNo = pg.next
+			pg.latch.RUnlock()
+		}
+		return nil, nil
+	}
+}
+
+// Return an iterator over the tuples of the indexed table with keys between
+// lo and hi, in key order.  A nil lo or hi leaves the range open on that side,
+// and loInclusive and hiInclusive determine whether tuples with keys equal to
+// the bounds are returned.  Only tuples visible to tid's snapshot are
+// returned, and pages are not locked.
+func (bf *BTreeFile) RangeIterator(tid TransactionID, lo DBValue, loInclusive bool, hi DBValue, hiInclusive bool) (func() (*Tuple, error), error) {
+	for _, bound := range []DBValue{lo, hi} {
+		if bound != nil && !bf.checkKey(bound) {
+			return nil, GoDBError{TypeMismatchError, "range bound does not match the type of the index key"}
+		}
+	}
+	snap := bf.bufPool.snapshot(tid)
+	next := bf.entryIterator(tid, keyRange{lo, hi, loInclusive, hiInclusive})
+	return func() (*Tuple, error) {
+		for {
+			e, err := next()
+			if err != nil || e == nil {
+				return nil, err
+			}
+			t, err := bf.table.fetchTuple(e.rid, tid, snap)
+			if err != nil {
+				return nil, err
+			}
+			if t != nil {
+				return t, nil
+			}
+		}
+	}, nil
+}
+
+// Return whether v is of the type of the keys of the index
+func (bf *BTreeFile) checkKey(v DBValue) bool {
+	return (bf.keyField.Ftype == IntType && isIntField(v)) || (bf.keyField.Ftype == StringType && isStringField(v))
+}
+
+func isIntField(v DBValue) bool {
+	_, ok := v.(IntField)
+	return ok
+}
+
+func isStringField(v DBValue) bool {
+	_, ok := v.(StringField)
+	return ok
+}
+
+// [Operator] iterator method -- return all of the tuples of the indexed table
+// that are visible to tid, in key order.
+func (bf *BTreeFile) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	return bf.RangeIterator(tid, nil, false, nil, false)
+}
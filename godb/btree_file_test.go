@@ -0,0 +1,330 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+const TestingIndexFile string = "test_index.dat"
+
+// Create an index over the named field of the heap file returned by
+// makeTestVars
+func makeIndexTestVars(t *testing.T, field string) (*HeapFile, *BTreeFile, *BufferPool, TransactionID) {
+	_, _, _, hf, bp, tid := makeTestVars()
+	os.Remove(TestingIndexFile)
+	bf, err := NewBTreeFile(TestingIndexFile, hf, field, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return hf, bf, bp, tid
+}
+
+func ageTuple(hf *HeapFile, name string, age int64) *Tuple {
+	return &Tuple{Desc: *hf.Descriptor(), Fields: []DBValue{StringField{name}, IntField{age}}}
+}
+
+// Drain iter, checking that the tuples come out ordered by the field at
+// keyIdx
+func collectOrdered(t *testing.T, iter func() (*Tuple, error), keyIdx int) []*Tuple {
+	tuples := []*Tuple{}
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return tuples
+		}
+		if len(tuples) > 0 && compareKeys(tuples[len(tuples)-1].Fields[keyIdx], tup.Fields[keyIdx]) > 0 {
+			t.Fatalf("index scan out of order: %v before %v", tuples[len(tuples)-1].Fields, tup.Fields)
+		}
+		tuples = append(tuples, tup)
+	}
+}
+
+func TestBTreeIntRangeScan(t *testing.T) {
+	hf, bf, bp, tid := makeIndexTestVars(t, "age")
+	bp.Size = 100
+	for i := 0; i < 2000; i++ {
+		// insert out of order, with every key appearing 20 times
+		err := hf.insertTuple(ageTuple(hf, "sam", int64((i*37)%100)), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	if bf.NumPages() < 3 {
+		t.Fatalf("expected the root of the index to have split")
+	}
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, _ := bf.Iterator(tid, bf.Descriptor())
+	if n := len(collectOrdered(t, iter, 1)); n != 2000 {
+		t.Errorf("expected 2000 tuples in a full index scan, got %d", n)
+	}
+
+	iter, _ = bf.RangeIterator(tid, IntField{10}, true, IntField{20}, false)
+	tuples := collectOrdered(t, iter, 1)
+	if len(tuples) != 200 {
+		t.Errorf("expected 200 tuples in [10, 20), got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		if age := tup.Fields[1].(IntField).Value; age < 10 || age >= 20 {
+			t.Fatalf("tuple with age %d outside of [10, 20)", age)
+		}
+	}
+
+	iter, _ = bf.RangeIterator(tid, IntField{99}, false, nil, false)
+	if n := len(collectOrdered(t, iter, 1)); n != 0 {
+		t.Errorf("expected no tuples after the largest key, got %d", n)
+	}
+	iter, _ = bf.RangeIterator(tid, nil, false, IntField{0}, true)
+	if n := len(collectOrdered(t, iter, 1)); n != 20 {
+		t.Errorf("expected 20 tuples with the smallest key, got %d", n)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeStringKeys(t *testing.T) {
+	hf, bf, bp, tid := makeIndexTestVars(t, "name")
+	bp.Size = 100
+	for i := 0; i < 500; i++ {
+		hf.insertTuple(ageTuple(hf, fmt.Sprintf("name%03d", i%50), int64(i)), tid)
+	}
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := bf.RangeIterator(tid, StringField{"name007"}, true, StringField{"name007"}, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tuples := collectOrdered(t, iter, 0)
+	if len(tuples) != 10 {
+		t.Errorf("expected 10 tuples named name007, got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		if tup.Fields[0].(StringField).Value != "name007" {
+			t.Errorf("unexpected tuple %v", tup.Fields)
+		}
+	}
+
+	_, err = bf.RangeIterator(tid, IntField{7}, true, nil, false)
+	if err == nil {
+		t.Errorf("expected an error for a bound of the wrong type")
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeDeepTree(t *testing.T) {
+	hf, bf, bp, tid := makeIndexTestVars(t, "name")
+	bp.Size = 1000
+	// add entries directly, so the tree grows a few levels quickly
+	n := 20000
+	for i := 0; i < n; i++ {
+		e := btreeEntry{StringField{fmt.Sprintf("key%05d", (i*7919)%n)}, RecordID{pageNo: i, slot: 0}}
+		if err := bf.insertEntry(e, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for i := 0; i < n; i += 2 {
+		tup := ageTuple(hf, fmt.Sprintf("key%05d", (i*7919)%n), 0)
+		tup.Rid = RecordID{pageNo: i, slot: 0}
+		if err := bf.deleteTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	root, _ := bf.readPage(rootPageNo)
+	child, _ := bf.readPage((*root).(*btreePage).children[0])
+	if (*child).(*btreePage).leaf {
+		t.Fatalf("expected a tree with at least three levels")
+	}
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	next := bf.entryIterator(tid, keyRange{StringField{"key10000"}, nil, true, false})
+	cnt := 0
+	var prev *btreeEntry
+	for {
+		e, err := next()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if e == nil {
+			break
+		}
+		if prev != nil && prev.compare(*e) >= 0 {
+			t.Fatalf("entries out of order")
+		}
+		if e.rid.pageNo%2 == 0 {
+			t.Fatalf("found deleted entry %v", e)
+		}
+		prev = e
+		cnt++
+	}
+	if cnt != (n-10000)/2 {
+		t.Errorf("expected %d entries, got %d", (n-10000)/2, cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeAbort(t *testing.T) {
+	hf, bf, bp, tid := makeIndexTestVars(t, "age")
+	hf.insertTuple(ageTuple(hf, "sam", 25), tid)
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	hf.insertTuple(ageTuple(hf, "joe", 25), tid)
+	bp.AbortTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	next := bf.entryIterator(tid, keyRange{})
+	cnt := 0
+	for e, _ := next(); e != nil; e, _ = next() {
+		cnt++
+	}
+	if cnt != 1 {
+		t.Errorf("expected the aborted insert to be rolled back from the index, got %d entries", cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeInsertLocksOnlyLeaf(t *testing.T) {
+	hf, bf, bp, tid := makeIndexTestVars(t, "age")
+	bp.Size = 100
+	for i := 0; i < 2000; i++ {
+		err := hf.insertTuple(ageTuple(hf, "sam", int64(i)), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	// add entries at both ends of the key range directly to the index, so
+	// that the transactions don't contend for heap pages
+	entry := func(age int64, slot int) *Tuple {
+		tup := ageTuple(hf, "sam", age)
+		tup.Rid = RecordID{pageNo: 0, slot: slot}
+		return tup
+	}
+	tid1, tid2 := NewTID(), NewTID()
+	bp.BeginTransaction(tid1)
+	bp.BeginTransaction(tid2)
+	if err := bf.insertTuple(entry(-1, 0), tid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if holder, ok := bp.locks.exclusiveHolder(bf.pageKey(rootPageNo)); ok {
+		t.Errorf("expected the root not to be locked by an insert that doesn't split it, locked by %v", holder)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- bf.insertTuple(entry(5000, 1), tid2)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("insert into another leaf blocked behind the first transaction")
+	}
+	bp.CommitTransaction(tid1)
+	bp.CommitTransaction(tid2)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	next := bf.entryIterator(tid, keyRange{})
+	cnt := 0
+	for e, _ := next(); e != nil; e, _ = next() {
+		cnt++
+	}
+	if cnt != 2002 {
+		t.Errorf("expected 2002 entries in the index, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeDeleteAndVacuum(t *testing.T) {
+	hf, bf, bp, tid := makeIndexTestVars(t, "age")
+	for i := 0; i < 10; i++ {
+		hf.insertTuple(ageTuple(hf, "sam", int64(i)), tid)
+	}
+	bp.CommitTransaction(tid)
+
+	reader := NewTID()
+	bp.BeginTransaction(reader)
+	countVisible(t, hf, reader)
+
+	deleter := NewTID()
+	bp.BeginTransaction(deleter)
+	iter, _ := bf.RangeIterator(deleter, IntField{5}, true, IntField{5}, true)
+	tup, _ := iter()
+	if tup == nil {
+		t.Fatalf("expected to find age 5 through the index")
+	}
+	if err := hf.deleteTuple(tup, deleter); err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, _ = bf.RangeIterator(deleter, IntField{5}, true, IntField{5}, true)
+	if tup, _ := iter(); tup != nil {
+		t.Errorf("deleted tuple should be invisible to the deleter")
+	}
+	bp.CommitTransaction(deleter)
+
+	// the reader's snapshot still sees the deleted version through the index
+	iter, _ = bf.RangeIterator(reader, IntField{5}, true, IntField{5}, true)
+	if tup, _ := iter(); tup == nil {
+		t.Errorf("deleted tuple should still be visible to the reader")
+	}
+	bp.CommitTransaction(reader)
+
+	if n, err := hf.Vacuum(); err != nil || n != 1 {
+		t.Fatalf("expected to vacuum 1 version, got %d (err = %v)", n, err)
+	}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	next := bf.entryIterator(tid, keyRange{})
+	cnt := 0
+	for e, _ := next(); e != nil; e, _ = next() {
+		if compareKeys(e.key, IntField{5}) == 0 {
+			t.Errorf("vacuumed version still in the index")
+		}
+		cnt++
+	}
+	if cnt != 9 {
+		t.Errorf("expected 9 index entries after vacuum, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestBTreeReopen(t *testing.T) {
+	hf, _, bp, tid := makeIndexTestVars(t, "age")
+	bp.Size = 100
+	for i := 0; i < 300; i++ {
+		if err := hf.insertTuple(ageTuple(hf, "sam", int64(i%30)), tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	bp2 := NewBufferPool(10)
+	hf2, _ := NewHeapFile(TestingFile, hf.Descriptor(), bp2)
+	bf2, err := NewBTreeFile(TestingIndexFile, hf2, "age", bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	iter, _ := bf2.RangeIterator(tid, IntField{3}, true, IntField{3}, true)
+	if n := len(collectOrdered(t, iter, 1)); n != 10 {
+		t.Errorf("expected 10 tuples with age 3 after reopening, got %d", n)
+	}
+	bp2.CommitTransaction(tid)
+}
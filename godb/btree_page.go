@@ -0,0 +1,333 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/* btreePage implements the Page interface for the nodes of a [BTreeFile].
+
+Every node stores a sorted list of entries, where an entry is the key of an
+indexed tuple together with the record id of the tuple in the indexed
+[HeapFile].  Entries are ordered by key and then by record id, so every entry
+is unique even if many tuples share the same key.
+
+Leaf nodes store the entries of the index, and a link to the next leaf, so that
+range scans can walk the leaves in key order.  Internal nodes store separator
+entries and the page numbers of their children: child i holds the entries that
+are >= separator i-1 and < separator i.
+
+Pages begin with a header holding a 32 bit integer that is 1 for internal nodes
+and 0 for leaves, a 32 bit integer with the number of entries, the 64 bit LSN
+of the page (see [LogFile]), and a 32 bit integer with the page number of the
+next leaf (-1 for the last leaf, and for internal nodes), padded to 24 bytes.
+The header is followed by the entries, each written as the key (an int64, or a
+byte array of keySize bytes for strings) followed by the page number and slot of
+the record id as 32 bit integers.  Internal nodes then store the page numbers
+of their children as 32 bit integers.
+*/
+
+type btreePage struct {
+	file     *BTreeFile
+	pageNo   int
+	leaf     bool
+	entries  []btreeEntry
+	children []int // page numbers of the children of an internal node
+	next     int   // page number of the next leaf, -1 if none
+	dirty    bool
+	lsn      int64
+	latch    sync.RWMutex // protects the entries from concurrent scans
+}
+
+type btreeEntry struct {
+	key DBValue
+	rid RecordID
+}
+
+// size of the page header: node type, number of entries, page LSN, next leaf
+// and padding
+const btreePageHeaderSize int = 24
+
+// Construct a new, empty btree node
+func newBTreePage(f *BTreeFile, pageNo int, leaf bool) *btreePage {
+	return &btreePage{file: f, pageNo: pageNo, leaf: leaf, next: -1}
+}
+
+// Return the number of bytes a key of the specified field occupies on a page.
+// Strings take StringLength bytes, or, if the field is a varchar(n) whose
+// longest strings take more, enough bytes for those.
+func keySize(f FieldType) int {
+	if f.Ftype != StringType {
+		return 8
+	}
+	if n := f.Length * utf8.UTFMax; n > StringLength {
+		return n
+	}
+	return StringLength
+}
+
+// The fewest entries a node must hold, which limits the length of the
+// varchar columns that can be indexed (see [nodeCapacity])
+const minNodeEntries int = 16
+
+// Return the number of entries with keys of the specified field that fit on a
+// leaf or internal node
+func nodeCapacity(f FieldType, leaf bool) int {
+	entrySize := keySize(f) + 8
+	if leaf {
+		return (PageSize - btreePageHeaderSize) / entrySize
+	}
+	// internal nodes have one more child than they have entries
+	return (PageSize - btreePageHeaderSize - 4) / (entrySize + 4)
+}
+
+// Return the number of entries that fit on a node
+func (p *btreePage) maxEntries() int {
+	return nodeCapacity(p.file.keyField, p.leaf)
+}
+
+// Compare two keys of the same type, returning -1, 0 or 1 if k1 is less than,
+// equal to or greater than k2
+func compareKeys(k1 DBValue, k2 DBValue) int {
+	switch v1 := k1.(type) {
+	case IntField:
+		v2 := k2.(IntField)
+		if v1.Value < v2.Value {
+			return -1
+		} else if v1.Value > v2.Value {
+			return 1
+		}
+		return 0
+	case StringField:
+		return strings.Compare(v1.Value, k2.(StringField).Value)
+	}
+	return 0
+}
+
+// Compare two entries by key, and then by record id
+func (e btreeEntry) compare(e2 btreeEntry) int {
+	if c := compareKeys(e.key, e2.key); c != 0 {
+		return c
+	}
+	if e.rid.pageNo != e2.rid.pageNo {
+		if e.rid.pageNo < e2.rid.pageNo {
+			return -1
+		}
+		return 1
+	}
+	if e.rid.slot != e2.rid.slot {
+		if e.rid.slot < e2.rid.slot {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// Return the page number of the child of an internal node that holds the
+// supplied entry
+func (p *btreePage) childFor(e btreeEntry) int {
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].compare(e) > 0 })
+	return p.children[i]
+}
+
+// Return the page number of the leftmost child of an internal node that may
+// hold entries with keys >= key
+func (p *btreePage) childForKey(key DBValue) int {
+	i := sort.Search(len(p.entries), func(i int) bool { return compareKeys(p.entries[i].key, key) >= 0 })
+	return p.children[i]
+}
+
+// Add an entry to the node, keeping the entries sorted.  For internal nodes,
+// right is the page number of the child holding the entries >= e.  The node
+// may temporarily hold one entry more than fits on the page; it must be split
+// before it is written out.
+func (p *btreePage) add(e btreeEntry, right int) {
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].compare(e) > 0 })
+	p.entries = append(p.entries, btreeEntry{})
+	copy(p.entries[i+1:], p.entries[i:])
+	p.entries[i] = e
+	if !p.leaf {
+		p.children = append(p.children, 0)
+		copy(p.children[i+2:], p.children[i+1:])
+		p.children[i+1] = right
+	}
+	p.setDirty(true)
+}
+
+// Remove an entry from a leaf, returning false if it is not there
+func (p *btreePage) remove(e btreeEntry) bool {
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].compare(e) >= 0 })
+	if i == len(p.entries) || p.entries[i].compare(e) != 0 {
+		return false
+	}
+	p.entries = append(p.entries[:i], p.entries[i+1:]...)
+	p.setDirty(true)
+	return true
+}
+
+// Move the upper half of the node into the empty node sibling, which becomes
+// its right neighbor.  Returns the separator entry to add to the parent along
+// with sibling.
+func (p *btreePage) splitInto(sibling *btreePage) btreeEntry {
+	mid := len(p.entries) / 2
+	var sep btreeEntry
+	if p.leaf {
+		sibling.entries = append([]btreeEntry{}, p.entries[mid:]...)
+		sibling.next = p.next
+		p.next = sibling.pageNo
+		sep = sibling.entries[0]
+		p.entries = append([]btreeEntry{}, p.entries[:mid]...)
+	} else {
+		// the middle entry moves up to the parent
+		sep = p.entries[mid]
+		sibling.entries = append([]btreeEntry{}, p.entries[mid+1:]...)
+		sibling.children = append([]int{}, p.children[mid+1:]...)
+		p.entries = append([]btreeEntry{}, p.entries[:mid]...)
+		p.children = append([]int{}, p.children[:mid+1]...)
+	}
+	p.setDirty(true)
+	sibling.setDirty(true)
+	return sep
+}
+
+// Page method - return whether or not the page is dirty
+func (p *btreePage) isDirty() bool {
+	return p.dirty
+}
+
+// Page method - mark the page as dirty
+func (p *btreePage) setDirty(dirty bool) {
+	p.dirty = dirty
+}
+
+// Page method - return the corresponding BTreeFile for this page
+func (p *btreePage) getFile() *DBFile {
+	var file DBFile = p.file
+	return &file
+}
+
+// Page method - set the LSN of the last log record that updated the page
+func (p *btreePage) setLSN(lsn int64) {
+	p.lsn = lsn
+}
+
+// Page method - return the name of the file the page belongs to and its page
+// number, as recorded in the log
+func (p *btreePage) location() (string, int) {
+	return p.file.fileName, p.pageNo
+}
+
+// Write a key of the specified field to the buffer, padding strings to
+// [keySize] bytes.  Longer strings are rejected before they get into the index
+// (see [BTreeFile.checkKeyLength]).
+func writeKey(b *bytes.Buffer, key DBValue, f FieldType) error {
+	switch v := key.(type) {
+	case IntField:
+		return binary.Write(b, binary.LittleEndian, v.Value)
+	case StringField:
+		if len(v.Value) > keySize(f) {
+			return GoDBError{IllegalOperationError, "index key is too long"}
+		}
+		buf := make([]byte, keySize(f))
+		copy(buf, v.Value)
+		_, err := b.Write(buf)
+		return err
+	}
+	return GoDBError{TypeMismatchError, "unsupported index key type"}
+}
+
+// Read a key of the specified field from the buffer
+func readKey(b *bytes.Buffer, f FieldType) (DBValue, error) {
+	if f.Ftype == StringType {
+		buf := make([]byte, keySize(f))
+		if err := binary.Read(b, binary.LittleEndian, buf); err != nil {
+			return nil, err
+		}
+		return StringField{strings.TrimRight(string(buf), "\x00")}, nil
+	}
+	var v int64
+	if err := binary.Read(b, binary.LittleEndian, &v); err != nil {
+		return nil, err
+	}
+	return IntField{v}, nil
+}
+
+// Allocate a new bytes.Buffer and write the node to it, in the format
+// described above.
+func (p *btreePage) toBuffer() (*bytes.Buffer, error) {
+	p.latch.RLock()
+	defer p.latch.RUnlock()
+	if len(p.entries) > p.maxEntries() {
+		return nil, GoDBError{PageFullError, "btree node overflows its page"}
+	}
+	b := new(bytes.Buffer)
+	kind := int32(0)
+	if !p.leaf {
+		kind = 1
+	}
+	binary.Write(b, binary.LittleEndian, kind)
+	binary.Write(b, binary.LittleEndian, int32(len(p.entries)))
+	binary.Write(b, binary.LittleEndian, p.lsn)
+	binary.Write(b, binary.LittleEndian, int32(p.next))
+	binary.Write(b, binary.LittleEndian, int32(0))
+	for _, e := range p.entries {
+		if err := writeKey(b, e.key, p.file.keyField); err != nil {
+			return nil, err
+		}
+		binary.Write(b, binary.LittleEndian, int32(e.rid.pageNo))
+		binary.Write(b, binary.LittleEndian, int32(e.rid.slot))
+	}
+	if !p.leaf {
+		for _, c := range p.children {
+			binary.Write(b, binary.LittleEndian, int32(c))
+		}
+	}
+	b.Write(make([]byte, PageSize-b.Len()))
+	return b, nil
+}
+
+// Read the contents of the node from the supplied buffer.
+func (p *btreePage) initFromBuffer(buf *bytes.Buffer) error {
+	var kind, numEntries, next, pad int32
+	binary.Read(buf, binary.LittleEndian, &kind)
+	binary.Read(buf, binary.LittleEndian, &numEntries)
+	binary.Read(buf, binary.LittleEndian, &p.lsn)
+	binary.Read(buf, binary.LittleEndian, &next)
+	if err := binary.Read(buf, binary.LittleEndian, &pad); err != nil {
+		return err
+	}
+	p.leaf = kind == 0
+	p.next = int(next)
+	if int(numEntries) > p.maxEntries() || numEntries < 0 {
+		return GoDBError{MalformedDataError, "corrupt btree node"}
+	}
+	p.entries = make([]btreeEntry, numEntries)
+	for i := range p.entries {
+		key, err := readKey(buf, p.file.keyField)
+		if err != nil {
+			return err
+		}
+		var pageNo, slot int32
+		binary.Read(buf, binary.LittleEndian, &pageNo)
+		if err := binary.Read(buf, binary.LittleEndian, &slot); err != nil {
+			return err
+		}
+		p.entries[i] = btreeEntry{key, RecordID{pageNo: int(pageNo), slot: int(slot)}}
+	}
+	if !p.leaf {
+		p.children = make([]int, numEntries+1)
+		for i := range p.children {
+			var c int32
+			if err := binary.Read(buf, binary.LittleEndian, &c); err != nil {
+				return err
+			}
+			p.children[i] = int(c)
+		}
+	}
+	return nil
+}
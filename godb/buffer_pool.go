@@ -1,10 +1,9 @@
 package godb
 
 import (
+	"os"
+	"path/filepath"
 	"sync"
-	"time"
-
-	"golang.org/x/exp/slices"
 )
 
 // import (
@@ -15,7 +14,28 @@ import (
 //BufferPool provides methods to cache pages that have been read from disk.
 //It has a fixed capacity to limit the total amount of memory used by GoDB.
 //It is also the primary way in which transactions are enforced, by using page
-//level locking (you will not need to worry about this until lab3).
+//level locking (you will not need to worry about this until lab3).  Page locks
+//are managed by a [LockManager].
+//
+//Without a log the buffer pool is FORCE/NO STEAL.  Once a [LogFile] is attached
+//(see [NewCatalogFromFile]) commits only force the log, and pages dirtied by
+//committed transactions are written back to disk when they are evicted.
+//
+//The buffer pool can optionally run with a STEAL policy (see
+//[BufferPool.SetSteal]), in which case a transaction whose dirty pages fill the
+//buffer pool has them written to disk instead of failing with
+//BufferPoolFullError.  The image each stolen page had before the transaction
+//modified it is logged, or written to an undo file if the buffer pool isn't
+//logging, and read back and written to the page if the transaction aborts.
+//
+//Reads through [HeapFile.Iterator] don't lock pages; instead they see the
+//snapshot of the database taken when the transaction first read or wrote a
+//tuple (see [BufferPool.snapshot]).  Writers still lock the pages they modify,
+//and when a transaction commits the buffer pool stamps the tuple versions it
+//created and deleted with its commit timestamp.  Commit timestamps come from a
+//counter that starts over with every buffer pool, so the versions on a page
+//the buffer pool reads without having written it, which were committed before
+//the buffer pool was created, are frozen (see [BufferPool.cachePage]).
 
 // Permissions used to when reading / locking pages
 type RWPerm int
@@ -23,123 +43,272 @@ type RWPerm int
 const (
 	ReadPerm  RWPerm = iota
 	WritePerm RWPerm = iota
+	// pages retrieved with SnapshotPerm are not locked; only the tuple
+	// versions visible to the transaction's snapshot may be read from them
+	SnapshotPerm RWPerm = iota
 )
 
-type LockWait struct {
-	tid  TransactionID
-	page any
+type BufferPool struct {
+	Size         int
+	Pages        map[any]*Page
+	Order        []any
+	Mutex        sync.Mutex
+	locks        *LockManager               // page locks held by transactions
+	log          *LogFile                   // write-ahead log, nil if the buffer pool is not logging
+	beforeImages map[any][]byte             // image of each page on disk before the transaction holding its exclusive lock dirtied it
+	steal        bool                       // whether dirty pages of running transactions may be evicted
+	stolenPages  map[any]undoRecord         // pages evicted before the transaction holding their exclusive lock finished
+	undoFile     *os.File                   // before images of the stolen pages if the buffer pool is not logging
+	clock        int64                      // timestamp of the last commit
+	written      sync.Map                   // keys of the pages written since the buffer pool was created
+	freeSpace    map[string]*freeSpaceHints // free space of the pages of each heap file
+	snapshots    map[TransactionID]int64    // snapshot timestamp of each running transaction that has read or written
+	droppedPages map[any]droppedPage        // pages written out and dropped, other than by stealing them, before the transaction holding their exclusive lock finished
+
+	// spill files of running transactions that have not been removed yet
+	spillFiles map[TransactionID]map[*spillFile]bool
 }
 
-type BufferPool struct {
-	Size           int
-	Pages          map[any]*Page
-	Order          []any
-	Mutex          sync.Mutex
-	SharedLocks    map[any][]TransactionID      // map that keeps track of which transactions have a lock on a specific page
-	ExclusiveLocks map[any]TransactionID        // map that keeps track of which page transaction has an exclusive lock on a specific pageId
-	waitGraph      map[TransactionID][]LockWait // map that keeps track of which transaction waits on what other transactions
+// Implemented by pages that store tuple versions
+type versionedPage interface {
+	// returns whether the page held versions of the transaction
+	commitVersions(stamp int64, commitTs int64) bool
+	freezeVersions()
+}
+
+// A page written out and dropped from the buffer pool, e.g. by FlushAllPages,
+// while a running transaction held its exclusive lock
+type droppedPage struct {
+	file   DBFile
+	pageNo int
+}
+
+// Undo information for a page that was written to disk by a transaction that
+// has not committed yet
+type undoRecord struct {
+	file     DBFile
+	fileName string
+	pageNo   int
+	// where the before image of the page is kept: the LSN of the update
+	// record logged when the page was stolen, or the offset of the image in
+	// the undo file if the buffer pool is not logging
+	undoAt int64
 }
 
 // Create a new BufferPool with the specified number of pages
 func NewBufferPool(numPages int) *BufferPool {
 	return &BufferPool{
-		Size:           numPages,
-		Pages:          map[any]*Page{},
-		Order:          []any{},
-		SharedLocks:    map[any][]TransactionID{},
-		ExclusiveLocks: map[any]TransactionID{},
-		waitGraph:      map[TransactionID][]LockWait{},
+		Size:         numPages,
+		Pages:        map[any]*Page{},
+		Order:        []any{},
+		locks:        NewLockManager(),
+		beforeImages: map[any][]byte{},
+		stolenPages:  map[any]undoRecord{},
+		clock:        frozenStamp,
+		freeSpace:    map[string]*freeSpaceHints{},
+		snapshots:    map[TransactionID]int64{},
+		droppedPages: map[any]droppedPage{},
+		spillFiles:   map[TransactionID]map[*spillFile]bool{},
 	}
 }
 
-func (bp *BufferPool) addLockWait(waitingTid TransactionID, waitingOnTid TransactionID, lockedPage any) {
-	edge := LockWait{waitingOnTid, lockedPage}
-	// if edge already included
-	for _, currentEdge := range bp.waitGraph[waitingTid] {
-		if currentEdge == edge {
-			return
-		}
+// Return the snapshot tid reads from, taking it if this is the first time tid
+// reads or writes tuples.
+func (bp *BufferPool) snapshot(tid TransactionID) snapshot {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	ts, ok := bp.snapshots[tid]
+	if !ok {
+		ts = bp.clock
+		bp.snapshots[tid] = ts
 	}
-	// add edge in graph
-	bp.waitGraph[waitingTid] = append(bp.waitGraph[waitingTid], edge)
+	return snapshot{ts: ts, stamp: inProgressStamp(tid)}
 }
 
-// Remove lock from graph
-func (bp *BufferPool) removeLockWait(tid TransactionID, pageId any) {
-	// Before I acquire a lock, check if I was waiting for that lock to remove it from the wait graph
-	index := -1
-	for i, val := range bp.waitGraph[tid] {
-		// If I was waiting for a lock on that
-		if val.page == pageId {
-			index = i
+// Return the timestamp of the oldest snapshot in use. Tuple versions deleted at
+// or before it are invisible to every running and future transaction.
+func (bp *BufferPool) vacuumHorizon() int64 {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	horizon := bp.clock
+	for _, ts := range bp.snapshots {
+		if ts < horizon {
+			horizon = ts
 		}
 	}
-	// if I was waiting for a lock remove it from the graph
-	if index > 0 {
-		bp.waitGraph[tid] = append(bp.waitGraph[tid][:index], bp.waitGraph[tid][index+1:]...)
-	}
+	return horizon
 }
 
-func (bp *BufferPool) removeTransactionFromWaitGraph(tid TransactionID) {
-	// If I commit or abort remove transaction node as well as all edges into transaction node from the graph
-	// if transaction in wait graph remove the transaction
-	if _, ok := bp.waitGraph[tid]; ok {
-		// delete all outgoing edges
-		delete(bp.waitGraph, tid)
-		// delete all incoming edges
-		for key := range bp.waitGraph {
-			for _, edge := range bp.waitGraph[key] {
-				if edge.tid == tid {
-					bp.removeLockWait(key, edge.page)
-				}
+// Assign tid the next commit timestamp and stamp the tuple versions it created
+// and deleted on the pages in the buffer pool with it. The versions on pages
+// that were written out and dropped are stamped by
+// [BufferPool.stampDroppedPages] once the commit is durable. Must be called
+// with bp.Mutex held.
+func (bp *BufferPool) commitVersions(tid TransactionID) {
+	bp.clock++
+	stamp := inProgressStamp(tid)
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		if page, ok := bp.Pages[pageId]; ok {
+			if vp, ok := (*page).(versionedPage); ok && vp.commitVersions(stamp, bp.clock) {
+				// the page may have been written out and read back in,
+				// so it is no longer dirty
+				(*page).setDirty(true)
 			}
 		}
 	}
+	delete(bp.snapshots, tid)
 }
 
-func dfs(bp *BufferPool, startnode TransactionID, visited *map[TransactionID]bool) bool {
-	(*visited)[startnode] = true
-	graph := bp.waitGraph
-	for _, child := range graph[startnode] {
-		// if child is visited in the recursion stack there is a cycle
-		if _, ok := (*visited)[child.tid]; ok {
-			return true
+// Stamp the tuple versions tid created and deleted on the pages it modified
+// that were stolen or dropped from the buffer pool directly on disk, with the
+// commit timestamp assigned by [BufferPool.commitVersions]. Must be called
+// with bp.Mutex held, after tid's commit is durable.
+func (bp *BufferPool) stampDroppedPages(tid TransactionID) error {
+	stamp := inProgressStamp(tid)
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		if _, ok := bp.Pages[pageId]; ok {
+			continue
+		}
+		dropped, ok := bp.droppedPages[pageId]
+		if undo, stolen := bp.stolenPages[pageId]; stolen {
+			dropped, ok = droppedPage{undo.file, undo.pageNo}, true
+		}
+		if !ok {
+			continue
+		}
+		page, err := dropped.file.readPage(dropped.pageNo)
+		if err != nil {
+			return err
 		}
-		val := dfs(bp, child.tid, visited) // explore all other tids
-		if val {
-			return val
+		vp, ok := (*page).(versionedPage)
+		if !ok || !vp.commitVersions(stamp, bp.clock) {
+			continue
+		}
+		if err := dropped.file.flushPage(page); err != nil {
+			return err
+		}
+		if bp.log != nil {
+			// the page is not logged, so it has to be forced before the
+			// log can be checkpointed
+			fileName, _ := (*page).location()
+			if err := syncFile(fileName); err != nil {
+				return err
+			}
 		}
 	}
-	return false
+	return nil
+}
+
+// Enable or disable the STEAL policy. With STEAL enabled, when the buffer pool
+// is full a transaction may evict pages it has dirtied itself, after saving
+// undo information for them. Pages dirtied by other running transactions are
+// never evicted.
+func (bp *BufferPool) SetSteal(steal bool) {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	bp.steal = steal
 }
 
-func (bp *BufferPool) detectCycle(tid TransactionID) bool {
-	visited := map[TransactionID]bool{}
-	return dfs(bp, tid, &visited)
+// Attach a write-ahead log to the buffer pool, first recovering the files
+// referenced by the log.  Any pages cached by the buffer pool are flushed
+// before recovery runs.
+func (bp *BufferPool) useLog(l *LogFile) error {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	bp.FlushAllPages()
+	if bp.log != nil {
+		bp.log.Close()
+		bp.log = nil
+	}
+	err := l.recover()
+	if err != nil {
+		return err
+	}
+	bp.log = l
+	return nil
 }
 
 // Testing method -- iterate through all pages in the buffer pool
 // and flush them using [DBFile.flushPage]. Does not need to be thread/transaction safe
+//
+// Pages dirtied by transactions that are still running are written out as if
+// they were stolen (see [BufferPool.stealPage]), so that they are restored if
+// the transaction aborts, and logged with the transaction if it commits.
 func (bp *BufferPool) FlushAllPages() {
 	for pageKey, pagePtr := range bp.Pages {
 		page := *pagePtr
-		dbfile := *page.getFile()
-		dbfile.flushPage(&page)
+		if holder, locked := bp.locks.exclusiveHolder(pageKey); locked && page.isDirty() {
+			if err := bp.stealPage(pageKey, page, holder); err != nil {
+				// leave the page in the buffer pool rather than lose
+				// the means to undo it
+				continue
+			}
+		} else {
+			dbfile := *page.getFile()
+			dbfile.flushPage(&page)
+			bp.noteDropped(pageKey, page)
+		}
 		delete(bp.Pages, pageKey)
+		index := IndexOf(bp.Order, pageKey)
+		bp.Order = append(bp.Order[:index], bp.Order[index+1:]...)
 	}
-	bp.Order = []any{}
 }
 
-func IndexOf(array []any, val any) int {
-	for i := range array {
-		if array[i] == val {
-			return i
+// Remember where a page that is dropped from the buffer pool while a running
+// transaction holds its exclusive lock is stored, so that the versions on it
+// can be stamped when the transaction commits. Must be called with bp.Mutex
+// held.
+func (bp *BufferPool) noteDropped(pageKey any, page Page) {
+	if _, locked := bp.locks.exclusiveHolder(pageKey); locked {
+		_, pageNo := page.location()
+		bp.droppedPages[pageKey] = droppedPage{*page.getFile(), pageNo}
+	}
+}
+
+// Drop the pages of the named file from the buffer pool without writing them
+// out, e.g. because the file is being removed
+func (bp *BufferPool) discardFile(fileName string) {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	delete(bp.freeSpace, fileName)
+	for pageKey, pagePtr := range bp.Pages {
+		if name, _ := (*pagePtr).location(); name == fileName {
+			delete(bp.Pages, pageKey)
+			index := IndexOf(bp.Order, pageKey)
+			bp.Order = append(bp.Order[:index], bp.Order[index+1:]...)
 		}
 	}
-	return -1
 }
 
-func TransactionIndexOf(array []TransactionID, val any) int {
+// Return the free space hints of the named heap file, shared by every HeapFile
+// opened over it
+func (bp *BufferPool) freeSpaceOf(fileName string) *freeSpaceHints {
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	hints, ok := bp.freeSpace[fileName]
+	if !ok {
+		hints = &freeSpaceHints{free: map[int]int{}}
+		bp.freeSpace[fileName] = hints
+	}
+	return hints
+}
+
+// Forget the free space recorded for a page. Must be called with bp.Mutex
+// held.
+func (bp *BufferPool) forgetFreeSpace(fileName string, pageNo int) {
+	if hints, ok := bp.freeSpace[fileName]; ok {
+		hints.forget(pageNo)
+	}
+}
+
+// Record that the page with the supplied key was written to disk, so that the
+// commit timestamps on it are kept when it is read back in. Called by the
+// files as they write pages out.
+func (bp *BufferPool) noteWritten(pageKey any) {
+	bp.written.Store(pageKey, true)
+}
+
+func IndexOf(array []any, val any) int {
 	for i := range array {
 		if array[i] == val {
 			return i
@@ -148,79 +317,196 @@ func TransactionIndexOf(array []TransactionID, val any) int {
 	return -1
 }
 
-// Abort the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
-// of the pages tid has dirtired will be on disk so it is sufficient to just
-// release locks to abort. You do not need to implement this for lab 1.
-func (bp *BufferPool) AbortTransaction(tid TransactionID) {
+// Abort the transaction, releasing locks. Unless the buffer pool stole some
+// of the pages tid has dirtied, none of them will be on disk so it is
+// sufficient to just release locks to abort. Stolen pages are restored to
+// their before images first; if that fails the error is returned, and the
+// pages are left for recovery to undo.
+func (bp *BufferPool) AbortTransaction(tid TransactionID) error {
 	// println("I am aborting")
 	bp.Mutex.Lock()
-	bp.removeTransactionFromWaitGraph(tid)
-	// release all read locks by tid
-	for pageId := range bp.SharedLocks {
-		if slices.Contains(bp.SharedLocks[pageId], tid) {
-			index := TransactionIndexOf(bp.SharedLocks[pageId], tid)
-			bp.SharedLocks[pageId] = append(bp.SharedLocks[pageId][:index], bp.SharedLocks[pageId][index+1:]...)
-		}
-		if len(bp.SharedLocks[pageId]) == 0 {
-			delete(bp.SharedLocks, pageId)
-		}
-	}
-
-	for pageId, pageTid := range bp.ExclusiveLocks {
-		// If the file is locked by this transaction delete it
-		if pageTid == tid {
-			_, ok := bp.Pages[pageId]
-			if ok {
-				// if pageId exists in buferpool delete page and update order
-				delete(bp.Pages, pageId)
-				index := IndexOf(bp.Order, pageId)
-				bp.Order = append(bp.Order[:index], bp.Order[index+1:]...)
-			}
-			delete(bp.ExclusiveLocks, pageId)
+	defer bp.Mutex.Unlock()
+	return bp.abort(tid)
+}
+
+// Abort tid; must be called with bp.Mutex held
+func (bp *BufferPool) abort(tid TransactionID) error {
+	// the free space recorded for the pages tid modified is lost with its
+	// changes
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		if page, ok := bp.Pages[pageId]; ok {
+			bp.forgetFreeSpace((*page).location())
+		} else if undo, ok := bp.stolenPages[pageId]; ok {
+			bp.forgetFreeSpace(undo.fileName, undo.pageNo)
 		}
 	}
-	bp.Mutex.Unlock()
-	time.Sleep(10 * time.Millisecond)
+	err := bp.undoStolenPages(tid)
+	if bp.log != nil && err == nil {
+		// without an abort record recovery treats tid as a loser
+		err = bp.log.logAbort(tid)
+	}
+	delete(bp.snapshots, tid)
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		// pages locked by this transaction may be dirty, so drop them
+		_, ok := bp.Pages[pageId]
+		if ok {
+			// if pageId exists in buferpool delete page and update order
+			delete(bp.Pages, pageId)
+			index := IndexOf(bp.Order, pageId)
+			bp.Order = append(bp.Order[:index], bp.Order[index+1:]...)
+		}
+	}
+	bp.releaseLocks(tid)
+	return err
 }
 
-// Commit the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
-// of the pages tid has dirtied will be on disk, so prior to releasing locks you
-// should iterate through pages and write them to disk.  In GoDB lab3 we assume
-// that the system will not crash while doing this, allowing us to avoid using a
-// WAL. You do not need to implement this for lab 1.
-func (bp *BufferPool) CommitTransaction(tid TransactionID) {
+// Commit the transaction, releasing locks. If the buffer pool is logging, the
+// pages tid has dirtied are logged and the log is forced, but the pages
+// themselves stay dirty in the buffer pool until they are evicted. If the
+// commit can't be logged, tid is aborted instead and the error returned.
+// Otherwise GoDB is FORCE/NO STEAL, none of the pages tid has dirtied will be
+// on disk, so prior to releasing locks we iterate through pages and write them
+// to disk.
+func (bp *BufferPool) CommitTransaction(tid TransactionID) error {
 	bp.Mutex.Lock()
-	bp.removeTransactionFromWaitGraph(tid)
+	bp.commitVersions(tid)
+	if bp.log != nil {
+		if err := bp.logCommit(tid); err != nil {
+			// the versions stamped by commitVersions are on pages that
+			// the abort drops from the buffer pool
+			bp.abort(tid)
+			bp.Mutex.Unlock()
+			return err
+		}
+		err := bp.stampDroppedPages(tid)
+		bp.releaseLocks(tid)
+		if err == nil && bp.log.size() >= bp.log.checkpointSize {
+			err = bp.checkpoint()
+		}
+		bp.Mutex.Unlock()
+		return err
+	}
 	// flush each page tid edited to disk
-	for pageId, pageTid := range bp.ExclusiveLocks {
-		// If the file is locked by this transaction flush it
-		if pageTid == tid {
-			toEvictPage, ok := bp.Pages[pageId]
-			if ok {
-				dbfile := *(*toEvictPage).getFile()
-				dbfile.flushPage(toEvictPage)
-				delete(bp.Pages, pageId)
-				index := IndexOf(bp.Order, pageId)
-				bp.Order = append(bp.Order[:index], bp.Order[index+1:]...)
-			}
-			delete(bp.ExclusiveLocks, pageId)
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		toEvictPage, ok := bp.Pages[pageId]
+		if ok {
+			dbfile := *(*toEvictPage).getFile()
+			dbfile.flushPage(toEvictPage)
+			delete(bp.Pages, pageId)
+			index := IndexOf(bp.Order, pageId)
+			bp.Order = append(bp.Order[:index], bp.Order[index+1:]...)
+		}
+	}
+	err := bp.stampDroppedPages(tid)
+	bp.releaseLocks(tid)
+	bp.Mutex.Unlock()
+	return err
+}
+
+// Write back the pages dirtied by committed transactions and discard the log,
+// so that it doesn't grow for as long as the database runs.  Pages locked by
+// running transactions hold no committed updates that aren't on disk (see
+// [BufferPool.saveBeforeImage]), and their own updates are only logged when
+// they commit, unless the pages are stolen; while any are, their undo
+// information is in the log and the log is kept. Must be called with
+// bp.Mutex held.
+func (bp *BufferPool) checkpoint() error {
+	if len(bp.stolenPages) > 0 {
+		return nil
+	}
+	for pageKey, page := range bp.Pages {
+		if _, locked := bp.locks.exclusiveHolder(pageKey); locked || !(*page).isDirty() {
+			continue
+		}
+		dbfile := *(*page).getFile()
+		if err := dbfile.flushPage(page); err != nil {
+			return err
 		}
+		(*page).setDirty(false)
 	}
-	// release all read locks by this tid
-	for pageId := range bp.SharedLocks {
-		if slices.Contains(bp.SharedLocks[pageId], tid) {
-			index := TransactionIndexOf(bp.SharedLocks[pageId], tid)
-			bp.SharedLocks[pageId] = append(bp.SharedLocks[pageId][:index], bp.SharedLocks[pageId][index+1:]...)
+	// pages are written without forcing them, so every file the log
+	// updates is forced before the records that could redo them are gone
+	for _, fileName := range bp.log.fileNames() {
+		if err := syncFile(fileName); err != nil {
+			return err
+		}
+	}
+	return bp.log.truncate()
+}
+
+// Write an update record for every page tid dirtied, followed by a commit
+// record, and force the log. Must be called with bp.Mutex held.
+func (bp *BufferPool) logCommit(tid TransactionID) error {
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		page, ok := bp.Pages[pageId]
+		if !ok || !(*page).isDirty() {
+			continue
+		}
+		before, err := bp.beforeImage(pageId, *page)
+		if err != nil {
+			return err
 		}
-		if len(bp.SharedLocks[pageId]) == 0 {
-			delete(bp.SharedLocks, pageId)
+		_, err = bp.log.logUpdate(tid, *page, before)
+		if err != nil {
+			return err
 		}
 	}
-	bp.Mutex.Unlock()
+	err := bp.log.logCommit(tid)
+	if err != nil {
+		return err
+	}
+	return bp.log.force()
+}
+
+// Release all locks held by tid, forgetting the undo information for the pages
+// it dirtied. Must be called with bp.Mutex held.
+func (bp *BufferPool) releaseLocks(tid TransactionID) {
+	for _, pageId := range bp.locks.exclusiveKeys(tid) {
+		delete(bp.beforeImages, pageId)
+		delete(bp.stolenPages, pageId)
+		delete(bp.droppedPages, pageId)
+	}
+	// operators that stopped before reading all their spill files, e.g.
+	// under a LIMIT, leave them for the end of the transaction
+	for f := range bp.spillFiles[tid] {
+		f.file.Close()
+		os.Remove(f.file.Name())
+	}
+	delete(bp.spillFiles, tid)
+	if len(bp.stolenPages) == 0 && bp.undoFile != nil {
+		bp.undoFile.Close()
+		os.Remove(bp.undoFile.Name())
+		bp.undoFile = nil
+	}
+	bp.locks.ReleaseAll(tid)
+}
+
+// Create a spill file in dir (see [newSpillFile]) that is removed when tid
+// commits or aborts, unless it has been removed by then. If bp is nil, as for
+// operators constructed outside of a catalog, only the operator removes it.
+func (bp *BufferPool) newSpillFile(tid TransactionID, dir string) (*spillFile, error) {
+	f, err := newSpillFile(dir)
+	if err != nil || bp == nil {
+		return f, err
+	}
+	bp.Mutex.Lock()
+	defer bp.Mutex.Unlock()
+	if bp.spillFiles[tid] == nil {
+		bp.spillFiles[tid] = map[*spillFile]bool{}
+	}
+	bp.spillFiles[tid][f] = true
+	f.release = func() {
+		bp.Mutex.Lock()
+		defer bp.Mutex.Unlock()
+		delete(bp.spillFiles[tid], f)
+	}
+	return f, nil
 }
 
 func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
-	// TODO: some code goes here
+	if bp.log != nil {
+		return bp.log.logBegin(tid)
+	}
 	return nil
 }
 
@@ -228,152 +514,266 @@ func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 // behalf of the specified transaction. If a page is not cached in the buffer pool,
 // you can read it from disk uing [DBFile.readPage]. If the buffer pool is full (i.e.,
 // already stores numPages pages), a page should be evicted.  Should not evict
-// pages that are dirty, as this would violate NO STEAL. If the buffer pool is
-// full of dirty pages, you should return an error. For lab 1, you do not need to
-// implement locking or deadlock detection. [For future labs, before returning the page,
-// attempt to lock it with the specified permission. If the lock is
-// unavailable, should block until the lock is free. If a deadlock occurs, abort
-// one of the transactions in the deadlock]. You will likely want to store a list
-// of pages in the BufferPool in a map keyed by the [DBFile.pageKey].
+// pages that are dirty, as this would violate NO STEAL, unless the buffer pool
+// is logging and the transaction that dirtied them committed. If the buffer pool is
+// full of dirty pages, you should return an error. Before returning the page,
+// it is locked with the specified permission through the [LockManager],
+// blocking until the lock is free. If waiting would deadlock, tid is aborted
+// and a DeadlockError is returned. Pages are stored in the BufferPool in a map
+// keyed by the [DBFile.pageKey].
 func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*Page, error) {
 	// println("Info", tid, pageNo, perm)
 	pageKey := file.pageKey(pageNo)
-	for {
-		bp.Mutex.Lock()
-		// if write perm check if there is any lock on this page
-		if perm == WritePerm {
-			_, areSharedLocks := bp.SharedLocks[pageKey]
-			exclusiveLockTid, isExclusiveLock := bp.ExclusiveLocks[pageKey]
-			// if there are no locks on the page get exclusive lock
-			// if there are no exclusive locks check shared locks
-			//
-			if isExclusiveLock {
-				// if there is exclusive locks on the page if another tid holds the lock sleep else if you hold it break
-				if exclusiveLockTid != tid {
-					// If lock is being held try to add edge to the wait graph
-					bp.addLockWait(tid, exclusiveLockTid, pageKey)
-					// if cycle abort
-					if bp.detectCycle(tid) {
-						// release mutex
-						bp.Mutex.Unlock()
-						bp.AbortTransaction(tid)
-						// throw error
-						return nil, GoDBError{code: DeadlockError, errString: "Transaction deadlocked"}
-					}
-					bp.Mutex.Unlock()
-					time.Sleep(10 * time.Microsecond)
-				} else {
-					break
-				}
-
-			} else if areSharedLocks {
-				// if tid has a shared lock and it is the only shared lock upgrade to exclusive else sleep
-				if slices.Contains(bp.SharedLocks[pageKey], tid) && len(bp.SharedLocks[pageKey]) == 1 {
-					bp.SharedLocks[pageKey] = []TransactionID{}
-					bp.ExclusiveLocks[pageKey] = tid
-					break
-				} else {
-					// add an edge waiting for every shared in
-					for _, sharedTid := range bp.SharedLocks[pageKey] {
-						if tid != sharedTid {
-							bp.addLockWait(tid, sharedTid, pageKey)
-						}
-					}
-					// if cycle abort
-					if bp.detectCycle(tid) {
-						// release mutex
-						bp.Mutex.Unlock()
-						// abort transaction
-						bp.AbortTransaction(tid)
-						// throw error
-						return nil, GoDBError{code: DeadlockError, errString: "Transaction deadlocked"}
-					}
-					bp.Mutex.Unlock()
-					// print("here1")
-					time.Sleep(10 * time.Microsecond)
-				}
-			} else {
-				// no locks just acquire the write lock
-				bp.ExclusiveLocks[pageKey] = tid
-				break
-			}
-		}
-
-		// if read perm check if there is any exclusive lock on this page
-		if perm == ReadPerm {
-			_, areSharedLocks := bp.SharedLocks[pageKey]
-			exclusiveLockTid, isExclusiveLock := bp.ExclusiveLocks[pageKey]
-			// if there is exclusive lock by some other transaction sleep
-			// else if there are shared locks by other transaction but not by this tid obtain a read transaction
-			// otherwise if there are no shared locks on this page acquire a shared lock on the page
-			// if successfully acquire lock break from the for loop but don't unlock. Get page and unlock before return
-			if isExclusiveLock {
-				// if I don't hold the lock sleep else break
-				if exclusiveLockTid != tid {
-					bp.addLockWait(tid, exclusiveLockTid, pageKey)
-					// if cycle abort
-					if bp.detectCycle(tid) {
-						// release mutex
-						bp.Mutex.Unlock()
-						// abort transaction
-						bp.AbortTransaction(tid)
-						// throw error
-						return nil, GoDBError{code: DeadlockError, errString: "Transaction deadlocked"}
-					}
-					// print("here3")
-					bp.Mutex.Unlock()
-					time.Sleep(10 * time.Microsecond)
-				} else {
-					break
-				}
-			} else if areSharedLocks {
-				// if there is no shared lock by this transaction acquire it and then just read
-				if !slices.Contains(bp.SharedLocks[pageKey], tid) {
-					bp.SharedLocks[pageKey] = append(bp.SharedLocks[pageKey], tid)
-				}
-				break
-			} else {
-				// if there are no locks just take one by this tid
-				bp.SharedLocks[pageKey] = []TransactionID{tid}
-				break
-			}
+	// wait for the page lock without holding the buffer pool mutex, so other
+	// transactions can make progress (and release the lock)
+	if perm != SnapshotPerm {
+		err := bp.locks.Lock(tid, pageKey, perm)
+		if err != nil {
+			bp.AbortTransaction(tid)
+			return nil, err
 		}
 	}
+	bp.Mutex.Lock()
+	page, err := bp.cachePage(file, pageNo, pageKey, tid)
+	if err == nil && perm == WritePerm && (bp.log != nil || bp.steal) {
+		err = bp.saveBeforeImage(page, pageKey)
+	}
+	bp.Mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Return the page with the supplied key from the buffer pool, reading it from
+// disk and evicting another page if necessary. Must be called with bp.Mutex
+// held.
+func (bp *BufferPool) cachePage(file DBFile, pageNo int, pageKey any, tid TransactionID) (*Page, error) {
 	bpPage, ok := bp.Pages[pageKey]
 	// If page in buffer pool retrieve page from the buffer pool
 	if ok {
-		bp.Mutex.Unlock()
 		return bpPage, nil
 	}
 	// If page not in buffer pool no one has a lock on it so we are first move page to memory take lock
 	diskPage, diskReadError := file.readPage(pageNo)
 	if diskReadError != nil {
-		bp.Mutex.Unlock()
 		return nil, diskReadError
 	}
+	if vp, ok := (*diskPage).(versionedPage); ok {
+		if _, written := bp.written.Load(pageKey); !written {
+			// the versions were committed by an earlier buffer pool, before
+			// every snapshot of this one
+			vp.freezeVersions()
+		}
+	}
 	// If buffer pool has space add diskPage to bp
 	if len(bp.Pages) < bp.Size {
 		bp.Pages[pageKey] = diskPage
 		bp.Order = append(bp.Order, pageKey)
-		bp.Mutex.Unlock()
 		return diskPage, nil
 	}
-	// Buffer pool doesn't have space. Get LRU clean page id and evict it. If none throw error
+	// Buffer pool doesn't have space. Get LRU evictable page id and evict it. If none throw error
 	for i := 0; i < len(bp.Order); i++ {
 		currentPage := *bp.Pages[bp.Order[i]]
-		if !currentPage.isDirty() {
+		if bp.canEvict(bp.Order[i], currentPage) {
+			if currentPage.isDirty() {
+				dbfile := *currentPage.getFile()
+				err := dbfile.flushPage(&currentPage)
+				if err != nil {
+					return nil, err
+				}
+			}
 			// Remove LRU
+			bp.noteDropped(bp.Order[i], currentPage)
 			delete(bp.Pages, bp.Order[i])
 			bp.Order = append(bp.Order[:i], bp.Order[i+1:]...)
 			// Add current page
 			bp.Pages[pageKey] = diskPage
 			bp.Order = append(bp.Order, pageKey)
-			bp.Mutex.Unlock()
+			return diskPage, nil
+		}
+	}
+	// Under STEAL, evict the LRU page dirtied by tid itself
+	for i := 0; bp.steal && i < len(bp.Order); i++ {
+		if holder, _ := bp.locks.exclusiveHolder(bp.Order[i]); holder == tid {
+			err := bp.stealPage(bp.Order[i], *bp.Pages[bp.Order[i]], tid)
+			if err != nil {
+				return nil, err
+			}
+			delete(bp.Pages, bp.Order[i])
+			bp.Order = append(bp.Order[:i], bp.Order[i+1:]...)
+			bp.Pages[pageKey] = diskPage
+			bp.Order = append(bp.Order, pageKey)
 			return diskPage, nil
 		}
 	}
 
 	// Buffer pool has only dirty entries
-	bp.Mutex.Unlock()
 	return nil, GoDBError{code: BufferPoolFullError, errString: "Buffer is full of dirty pages"}
 }
+
+// Clean pages can always be evicted. When the buffer pool is logging, dirty
+// pages can also be evicted once the transaction that dirtied them committed,
+// because their updates are in the log.
+func (bp *BufferPool) canEvict(pageKey any, page Page) bool {
+	if !page.isDirty() {
+		return true
+	}
+	if bp.log == nil {
+		return false
+	}
+	_, locked := bp.locks.exclusiveHolder(pageKey)
+	return !locked
+}
+
+// Write a page dirtied by tid, which is still running, to disk, remembering
+// where its before image is kept so that it can be restored if tid aborts. If
+// the buffer pool is logging, the update is logged and the log forced before
+// the page is written; otherwise the before image is appended to the undo
+// file. If the page was already stolen, the first before image is the one that
+// is restored. Must be called with bp.Mutex held.
+func (bp *BufferPool) stealPage(pageKey any, page Page, tid TransactionID) error {
+	fileName, pageNo := page.location()
+	before, err := bp.beforeImage(pageKey, page)
+	if err != nil {
+		return err
+	}
+	_, stolen := bp.stolenPages[pageKey]
+	var undoAt int64
+	if bp.log != nil {
+		lsn, err := bp.log.logUpdate(tid, page, before)
+		if err != nil {
+			return err
+		}
+		err = bp.log.force()
+		if err != nil {
+			return err
+		}
+		undoAt = lsn
+	} else if !stolen {
+		offset, err := bp.appendUndoImage(fileName, before)
+		if err != nil {
+			return err
+		}
+		undoAt = offset
+	}
+	dbfile := *page.getFile()
+	err = dbfile.flushPage(&page)
+	if err != nil {
+		return err
+	}
+	if !stolen {
+		bp.stolenPages[pageKey] = undoRecord{dbfile, fileName, pageNo, undoAt}
+	}
+	delete(bp.beforeImages, pageKey)
+	return nil
+}
+
+// Return the image the page had before the transaction holding its exclusive
+// lock modified it. Pages stolen before and read back in have no before image
+// in memory, but the disk holds the image they had then. Must be called with
+// bp.Mutex held.
+func (bp *BufferPool) beforeImage(pageKey any, page Page) ([]byte, error) {
+	if before, ok := bp.beforeImages[pageKey]; ok {
+		return before, nil
+	}
+	return readPageImage(page.location())
+}
+
+// Append the before image of a stolen page to the undo file, creating it next
+// to the file the page belongs to if needed, and return its offset. Must be
+// called with bp.Mutex held.
+func (bp *BufferPool) appendUndoImage(fileName string, image []byte) (int64, error) {
+	if bp.undoFile == nil {
+		file, err := os.CreateTemp(filepath.Dir(fileName), "godb-undo-*.tmp")
+		if err != nil {
+			return 0, err
+		}
+		bp.undoFile = file
+	}
+	info, err := bp.undoFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	_, err = bp.undoFile.WriteAt(image, info.Size())
+	return info.Size(), err
+}
+
+// Read back the before image of a stolen page, from the log or the undo file.
+// Must be called with bp.Mutex held.
+func (bp *BufferPool) readUndoImage(undo undoRecord) ([]byte, error) {
+	if bp.log != nil {
+		rec, err := bp.log.readUpdate(undo.undoAt)
+		if err != nil {
+			return nil, err
+		}
+		return rec.before, nil
+	}
+	image := make([]byte, PageSize)
+	_, err := bp.undoFile.ReadAt(image, undo.undoAt)
+	return image, err
+}
+
+// Write the before images of the pages stolen from tid back to disk. If the
+// buffer pool is logging, each undo is logged as a compensation record first.
+// Must be called with bp.Mutex held.
+func (bp *BufferPool) undoStolenPages(tid TransactionID) error {
+	for pageId, undo := range bp.stolenPages {
+		if holder, _ := bp.locks.exclusiveHolder(pageId); holder != tid {
+			continue
+		}
+		image, err := bp.readUndoImage(undo)
+		if err != nil {
+			return err
+		}
+		if bp.log != nil {
+			current, err := readPageImage(undo.fileName, undo.pageNo)
+			if os.IsNotExist(err) {
+				// the file was removed, so there is nothing to undo
+				delete(bp.stolenPages, pageId)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			image, err = bp.log.logCompensation(int64(*tid), undo.fileName, undo.pageNo, current, image)
+			if err != nil {
+				return err
+			}
+			err = bp.log.force()
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := writePageImage(undo.fileName, undo.pageNo, image); err != nil {
+			return err
+		}
+		delete(bp.stolenPages, pageId)
+	}
+	return nil
+}
+
+// Remember the image of the page before the transaction holding its exclusive
+// lock modifies it, so it can be logged as the before image at commit. If the
+// page is still dirty from a committed transaction it is written back first,
+// so that the disk always holds the before image. Must be called with
+// bp.Mutex held.
+func (bp *BufferPool) saveBeforeImage(page *Page, pageKey any) error {
+	if _, ok := bp.beforeImages[pageKey]; ok {
+		return nil
+	}
+	if (*page).isDirty() {
+		dbfile := *(*page).getFile()
+		err := dbfile.flushPage(page)
+		if err != nil {
+			return err
+		}
+		(*page).setDirty(false)
+	}
+	buf, err := (*page).toBuffer()
+	if err != nil {
+		return err
+	}
+	bp.beforeImages[pageKey] = buf.Bytes()
+	return nil
+}
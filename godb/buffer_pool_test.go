@@ -2,6 +2,7 @@ package godb
 
 import (
 	"fmt"
+	"os"
 	"testing"
 )
 
@@ -53,18 +54,206 @@ func TestGetPage(t *testing.T) {
 	}
 	fmt.Println("How about here")
 	bp.BeginTransaction(tid)
-	//expect 6 pages
+	//expect enough pages for 600 tuples
+	slots := 2 * ((PageSize - heapPageHeaderSize) / (pageSpace(&t1) + pageSpace(&t2)))
+	numPages := (600 + slots - 1) / slots
 
-	for i := 0; i < 6; i++ {
+	for i := 0; i < numPages; i++ {
 		fmt.Println("Num pages in the file", hf.numPages)
 		pg, err := bp.GetPage(hf, i, tid, ReadPerm)
 		if pg == nil || err != nil {
 			t.Fatalf("failed to get page %d (err = %v)", i, err)
 		}
 	}
-	_, err := bp.GetPage(hf, 7, tid, ReadPerm)
+	_, err := bp.GetPage(hf, numPages, tid, ReadPerm)
 	if err == nil {
-		t.Fatalf("expected to get page 7 but failed")
+		t.Fatalf("expected to fail to get page %d", numPages)
 	}
 
 }
+
+// insert enough tuples into a fresh heap file to dirty more pages than fit in
+// the buffer pool
+func fillPastBufferPool(t *testing.T, hf *HeapFile, bp *BufferPool, t1 *Tuple, tid TransactionID) int {
+	cnt := 0
+	for hf.NumPages() <= bp.Size {
+		err := hf.insertTuple(t1, tid)
+		if err != nil {
+			t.Fatalf("insert failed under STEAL: %v", err)
+		}
+		cnt++
+	}
+	return cnt
+}
+
+func TestStealCommit(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars()
+	bp.SetSteal(true)
+	cnt := fillPastBufferPool(t, hf, bp, &t1, tid)
+	bp.CommitTransaction(tid)
+
+	if got := countTuples(t, hf, bp, &t1); got != cnt {
+		t.Errorf("expected %d tuples after commit, got %d", cnt, got)
+	}
+}
+
+func TestCommitAfterFlushAllPages(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars()
+	err := hf.insertTuple(&t1, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the page is written out with the versions of tid, which is still
+	// running
+	bp.FlushAllPages()
+	err = bp.CommitTransaction(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(bp.droppedPages) != 0 {
+		t.Errorf("expected no dropped pages to be remembered after commit, got %d", len(bp.droppedPages))
+	}
+	if got := countTuples(t, hf, bp, &t1); got != 1 {
+		t.Errorf("expected the tuple on the dropped page to be committed, got %d", got)
+	}
+}
+
+func TestAbortAfterFlushAllPages(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars()
+	if err := hf.insertTuple(&t1, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the page is written out with the insert of tid, which is undone
+	// when tid aborts
+	bp.FlushAllPages()
+	if err := bp.AbortTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	page, err := hf.readPage(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, used := range (*page).(*heapPage).UsedSlots {
+		if used {
+			t.Errorf("expected the insert of the aborted transaction to be undone on disk")
+		}
+	}
+}
+
+func TestStealCommitLogged(t *testing.T) {
+	td, t1, _, hf, bp, tid := makeLogTestVars(t)
+	bp.SetSteal(true)
+	cnt := fillPastBufferPool(t, hf, bp, &t1, tid)
+	if len(bp.stolenPages) == 0 {
+		t.Fatalf("expected pages to be stolen")
+	}
+	err := bp.CommitTransaction(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := countTuples(t, hf, bp, &t1); got != cnt {
+		t.Errorf("expected %d tuples after commit, got %d", cnt, got)
+	}
+
+	bp.log.Close()
+	hf, bp = restartFromLog(t, &td)
+	if got := countTuples(t, hf, bp, &t1); got != cnt {
+		t.Errorf("expected %d tuples after recovery, got %d", cnt, got)
+	}
+}
+
+func TestStealAbort(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars()
+	bp.SetSteal(true)
+	err := hf.insertTuple(&t2, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	fillPastBufferPool(t, hf, bp, &t1, tid2)
+	if len(bp.stolenPages) == 0 {
+		t.Fatalf("expected pages to be stolen")
+	}
+	// the before images of stolen pages are kept on disk
+	for pageKey := range bp.stolenPages {
+		if _, ok := bp.beforeImages[pageKey]; ok {
+			t.Errorf("expected the before image of stolen page %v to be dropped", pageKey)
+		}
+	}
+	if bp.undoFile == nil {
+		t.Fatalf("expected an undo file")
+	}
+	undoFile := bp.undoFile.Name()
+	err = bp.AbortTransaction(tid2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := os.Stat(undoFile); !os.IsNotExist(err) {
+		t.Errorf("expected the undo file to be removed after abort")
+	}
+
+	if got := countTuples(t, hf, bp, &t1); got != 0 {
+		t.Errorf("expected aborted tuples to be rolled back, got %d", got)
+	}
+	if got := countTuples(t, hf, bp, &t2); got != 1 {
+		t.Errorf("expected committed tuple to survive abort, got %d", got)
+	}
+}
+
+func TestStealAbortLogged(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeLogTestVars(t)
+	bp.SetSteal(true)
+	err := hf.insertTuple(&t2, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	fillPastBufferPool(t, hf, bp, &t1, tid2)
+	if len(bp.stolenPages) == 0 {
+		t.Fatalf("expected pages to be stolen")
+	}
+	if bp.undoFile != nil {
+		t.Errorf("expected the before images of stolen pages to be read from the log")
+	}
+	err = bp.AbortTransaction(tid2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if got := countTuples(t, hf, bp, &t1); got != 0 {
+		t.Errorf("expected aborted tuples to be rolled back, got %d", got)
+	}
+	if got := countTuples(t, hf, bp, &t2); got != 1 {
+		t.Errorf("expected committed tuple to survive abort, got %d", got)
+	}
+}
+
+func TestStealRecovery(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeLogTestVars(t)
+	bp.SetSteal(true)
+	err := hf.insertTuple(&t2, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	fillPastBufferPool(t, hf, bp, &t1, tid2)
+
+	// crash with stolen pages of tid2 on disk
+	bp.log.Close()
+	hf, bp = restartFromLog(t, &td)
+	if got := countTuples(t, hf, bp, &t1); got != 0 {
+		t.Errorf("expected stolen pages to be undone by recovery, got %d", got)
+	}
+	if got := countTuples(t, hf, bp, &t2); got != 1 {
+		t.Errorf("expected committed tuple after recovery, got %d", got)
+	}
+}
@@ -0,0 +1,37 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestCaseQueries(t *testing.T) {
+	c, _ := makeQueryCatalog(t, "s (id int, qty int, price decimal, shipped date)\n")
+	runQuery(t, c, "insert into s values (1, 5, 2.50, '1995-01-31'), (2, 12, 1.25, '1995-03-15'), (3, 30, 0.5, null), (4, null, 10, '1996-02-29')")
+
+	checkQueryRows(t, c, "select id, case when qty > 20 then 'high' when qty > 10 then 'medium' else 'low' end bucket, case id when 1 then price when 2 then 1 end, case when shipped is null then '1995-01-01' else shipped end from s order by id", []string{
+		"1,low,2.5,1995-01-31",
+		"2,medium,1,1995-03-15",
+		"3,high,NULL,1995-01-01",
+		"4,low,NULL,1996-02-29",
+	})
+
+	checkQueryCounts(t, c, []queryCount{
+		{"select id from s where case when qty > 10 then price else 0 end > 1", 1},
+		{"select id from s where case when qty is null then true else qty < 10 end", 2},
+		{"select id from s where case id when 3 then 'x' end is null", 3},
+	})
+
+	checkQueryRows(t, c, "select sum(case when qty > 10 then 1 else 0 end), count(case when price < 2 then id end), max(case when shipped < '1996-01-01' then price end) from s", []string{"2,2,2.5"})
+	checkQueryRows(t, c, "select case when qty > 10 then 'big' else 'small' end size, count(*), sum(qty) from s group by case when qty > 10 then 'big' else 'small' end order by size", []string{"big,2,42", "small,2,5"})
+
+	// a group by name can be the alias of an expression of the select list,
+	// but names a field of the table first
+	checkQueryRows(t, c, "select case when qty > 10 then 'big' else 'small' end as size, count(*) from s group by size order by size", []string{"big,2", "small,2"})
+	checkQueryRows(t, c, "select qty + 1 as more, count(*) from s group by more order by more", []string{"6,1", "13,1", "31,1", "NULL,1"})
+
+	for _, sql := range []string{"select case when qty > 10 then 'high' else 0 end from s", "select count(*) as n from s group by n", "select qty + 1 as id, count(*) from s group by id", "select case when qty then 1 end from s", "select case when id = 1 then shipped else price end from s"} {
+		if err := queryError(c, sql); err == nil {
+			t.Errorf("expected an error from %s", sql)
+		}
+	}
+}
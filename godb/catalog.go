@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -12,12 +14,42 @@ type Table struct {
 	desc TupleDesc
 }
 
+// An index over one column of a table, stored in its own [BTreeFile]
+type tableIndex struct {
+	name   string
+	table  string
+	column string
+	file   *BTreeFile
+}
+
 type Catalog struct {
 	tables    []*Table
 	tableMap  map[string]*Table
 	columnMap map[string][]*Table
 	bp        *BufferPool
 	rootPath  string
+	indexes   []*tableIndex
+
+	// the most tuples an ORDER BY sorts in memory before writing sorted runs
+	// to disk
+	sortBufferSize int
+	// the most groups a GROUP BY aggregates in memory before partitioning the
+	// inputs of the others to disk
+	aggBufferSize int
+}
+
+// Set the most tuples an ORDER BY sorts in memory; larger inputs are sorted in
+// runs written to disk (see [OrderBy.Iterator]).  Applies to the queries
+// planned from then on.
+func (c *Catalog) SetSortBufferSize(n int) {
+	c.sortBufferSize = n
+}
+
+// Set the most groups a GROUP BY aggregates in memory; the inputs of other
+// groups are partitioned to disk (see [Aggregator.aggregate]).  Applies to the
+// queries planned from then on.
+func (c *Catalog) SetAggBufferSize(n int) {
+	c.aggBufferSize = n
 }
 
 func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
@@ -38,12 +70,139 @@ func (c *Catalog) dropTable(table string) error {
 			c.columnMap[table] = nil
 			c.tables = append(c.tables[:i], c.tables[i+1:]...)
 			os.Remove(c.tableNameToFile(table))
+			for _, idx := range c.tableIndexes(table) {
+				c.dropIndex(idx.name)
+			}
 			return nil
 		}
 	}
 	return GoDBError{NoSuchTableError, "couldn't find table to drop"}
 }
 
+// Create an index named name over the column of the table.  The tuples
+// already in the table are added to the index in a transaction of its own;
+// afterwards the index is kept up to date by the files returned by
+// [Catalog.GetTable].
+func (c *Catalog) createIndex(name string, table string, column string) error {
+	if c.findIndex(name) != nil {
+		return GoDBError{DuplicateIndexError, fmt.Sprintf("an index named '%s' already exists", name)}
+	}
+	file, err := c.GetTable(table)
+	if err != nil {
+		return err
+	}
+	// strings that don't fit in the index would make inserts into the table
+	// fail, so only varchar(n) columns short enough to index are
+	if i, err := findFieldInTd(FieldType{Fname: column, Ftype: UnknownType}, file.Descriptor()); err == nil {
+		f := file.Descriptor().Fields[i]
+		if f.Ftype == StringType && f.Length == 0 {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("can't index column %s of unbounded length; declare it varchar(n)", column)}
+		}
+		if nodeCapacity(f, false) < minNodeEntries {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("can't index column %s, as strings of varchar(%d) are too long for an index", column, f.Length)}
+		}
+	}
+	fileName := c.indexNameToFile(name)
+	os.Remove(fileName)
+	bf, err := NewBTreeFile(fileName, file.(*ColumnFile), column, c.bp)
+	if err != nil {
+		return err
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	err = bf.build(tid)
+	if err != nil {
+		c.bp.AbortTransaction(tid)
+		bf.file.Close()
+		os.Remove(fileName)
+		return err
+	}
+	if err := c.bp.CommitTransaction(tid); err != nil {
+		bf.file.Close()
+		os.Remove(fileName)
+		return err
+	}
+	c.indexes = append(c.indexes, &tableIndex{name, table, column, bf})
+	return nil
+}
+
+// Open the index described by idx, rebuilding it if its file is missing
+func (c *Catalog) openIndex(idx *tableIndex) error {
+	file, err := c.GetTable(idx.table)
+	if err != nil {
+		return err
+	}
+	fileName := c.indexNameToFile(idx.name)
+	_, statErr := os.Stat(fileName)
+	idx.file, err = NewBTreeFile(fileName, file.(*ColumnFile), idx.column, c.bp)
+	if err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		tid := NewTID()
+		c.bp.BeginTransaction(tid)
+		err = idx.file.build(tid)
+		if err != nil {
+			c.bp.AbortTransaction(tid)
+			return err
+		}
+		if err := c.bp.CommitTransaction(tid); err != nil {
+			return err
+		}
+	}
+	c.indexes = append(c.indexes, idx)
+	return nil
+}
+
+// Remove the named index from the catalog and delete its file
+func (c *Catalog) dropIndex(name string) error {
+	for i, idx := range c.indexes {
+		if idx.name == name {
+			c.indexes = append(c.indexes[:i], c.indexes[i+1:]...)
+			c.bp.discardFile(idx.file.fileName)
+			idx.file.file.Close()
+			os.Remove(idx.file.fileName)
+			return nil
+		}
+	}
+	return GoDBError{NoSuchIndexError, fmt.Sprintf("no index '%s' found", name)}
+}
+
+func (c *Catalog) findIndex(name string) *tableIndex {
+	for _, idx := range c.indexes {
+		if idx.name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// Return the index over the column of the named table, or nil if the column
+// isn't indexed
+func (c *Catalog) findIndexOn(table string, column string) *tableIndex {
+	for _, idx := range c.indexes {
+		if idx.table == table && idx.column == column && idx.file != nil {
+			return idx
+		}
+	}
+	return nil
+}
+
+// Return the indexes over the named table
+func (c *Catalog) tableIndexes(table string) []*tableIndex {
+	var indexes []*tableIndex
+	for _, idx := range c.indexes {
+		if idx.table == table {
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes
+}
+
+func (c *Catalog) indexNameToFile(indexName string) string {
+	return c.rootPath + "/" + indexName + ".idx"
+}
+
 func ImportCatalogFromCSVs(catalogFile string, bp *BufferPool, rootPath string, tableSuffix string, separator string) error {
 	c, err := NewCatalogFromFile(catalogFile, bp, rootPath)
 	if err != nil {
@@ -69,64 +228,135 @@ func ImportCatalogFromCSVs(catalogFile string, bp *BufferPool, rootPath string,
 	return nil
 }
 
-func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []string, error) {
+// catalog entry describing an index, as written by [Catalog.CatalogString]
+var indexEntryRegexp = regexp.MustCompile(`^index\s+(\w+)\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)\s*$`)
+
+// catalog entry describing a table: its name and its list of fields
+var tableEntryRegexp = regexp.MustCompile(`^\s*(\w+)\s*\((.*)\)\s*$`)
+
+// a field of a table entry: its name and type, which may have a parenthesized
+// list of parameters, such as decimal(15,2)
+var catalogFieldRegexp = regexp.MustCompile(`[^,(]+(\([^)]*\))?`)
+
+// a varchar type with a length
+var varcharTypeRegexp = regexp.MustCompile(`^\s*varchar\s*\(\s*(\d+)\s*\)\s*$`)
+
+// a decimal type with an optional precision and scale
+var decimalTypeRegexp = regexp.MustCompile(`^\s*(?:decimal|numeric)\s*(?:\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\))?\s*$`)
+
+func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []string, []*tableIndex, error) {
 	var tables []TupleDesc
 	var names []string
+	var indexes []*tableIndex
 	f, err := os.Open(rootPath + "/" + catalogFile)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	scanner := bufio.NewScanner(f)
 
 	for scanner.Scan() {
 		// code to read each line
 		line := strings.ToLower(scanner.Text())
-		sep := strings.Split(line, "(")
-		if len(sep) != 2 {
-			return nil, nil, GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
+		if m := indexEntryRegexp.FindStringSubmatch(line); m != nil {
+			indexes = append(indexes, &tableIndex{name: m[1], table: m[2], column: m[3]})
+			continue
+		}
+		m := tableEntryRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("expected a table name followed by its fields in parens in catalog entry %s", line)}
 		}
-		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
-		fields := strings.Split(rest, ",")
+		tableName := m[1]
+		fields := catalogFieldRegexp.FindAllString(m[2], -1)
 		var fieldArray []FieldType
 		for _, f := range fields {
 			f := strings.TrimSpace(f)
-			nameType := strings.Split(f, " ")
+			nameType := strings.SplitN(f, " ", 2)
 			if len(nameType) != 2 {
-				return nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
+				return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
+			}
+			if d := decimalTypeRegexp.FindStringSubmatch(nameType[1]); d != nil {
+				// decimal(p,s) or numeric(p,s), whose precision and scale
+				// are optional
+				field := FieldType{Fname: nameType[0], Ftype: DecimalType}
+				if d[1] != "" {
+					field.Precision, _ = strconv.Atoi(d[1])
+					field.Scale, _ = strconv.Atoi(d[2])
+					if err := checkDecimalPrecision(field.Precision, field.Scale); err != nil {
+						return nil, nil, nil, err
+					}
+				}
+				fieldArray = append(fieldArray, field)
+				continue
 			}
-			switch nameType[1] {
+			if v := varcharTypeRegexp.FindStringSubmatch(nameType[1]); v != nil {
+				length, err := checkVarcharLength(v[1])
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: StringType, Length: length})
+				continue
+			}
+			switch strings.TrimSpace(nameType[1]) {
 			case "int":
 				fallthrough
 			case "integer":
-				fieldArray = append(fieldArray, FieldType{nameType[0], "", IntType})
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: IntType})
+			case "float", "double":
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: FloatType})
+			case "date":
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: DateType})
+			case "timestamp", "datetime":
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: TimestampType})
+			case "bool", "boolean":
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: BoolType})
 			case "string":
 				fallthrough
 			case "varchar":
 				fallthrough
 			case "text":
-				fieldArray = append(fieldArray, FieldType{nameType[0], "", StringType})
+				fieldArray = append(fieldArray, FieldType{Fname: nameType[0], Ftype: StringType})
 			default:
-				return nil, nil, GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
+				return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
 			}
 		}
+		if err := checkRowSize(&TupleDesc{fieldArray}); err != nil {
+			return nil, nil, nil, err
+		}
 		tables = append(tables, TupleDesc{fieldArray})
 		names = append(names, tableName)
 	}
-	return tables, names, nil
+	return tables, names, indexes, nil
 
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
-	tabs, names, err := parseCatalogFile(catalogFile, rootPath)
+	tabs, names, indexes, err := parseCatalogFile(catalogFile, rootPath)
 	if err != nil {
 		return nil, err
 	}
-	c := &Catalog{make([]*Table, 0), make(map[string]*Table), make(map[string][]*Table), bp, rootPath}
+	c := &Catalog{make([]*Table, 0), make(map[string]*Table), make(map[string][]*Table), bp, rootPath, nil, SortBufferSize, AggBufferSize}
 	for i, t := range tabs {
 		c.addTable(names[i], t)
 	}
 
+	// recover the tables from the log left behind by the last process that
+	// used this database, and log to it from now on
+	log, err := NewLogFile(rootPath + "/" + LogFileName)
+	if err != nil {
+		return nil, err
+	}
+	err = bp.useLog(log)
+	if err != nil {
+		return nil, err
+	}
+
+	// indexes are opened once recovery brought their files up to date
+	for _, idx := range indexes {
+		err = c.openIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return c, nil
 
 }
@@ -160,7 +390,16 @@ func (c *Catalog) GetTable(named string) (DBFile, error) {
 	if t == nil {
 		return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", named)}
 	}
-	return NewColumnFile(c.tableNameToFile(named), t.desc.copy(), c.bp)
+	cf, err := NewColumnFile(c.tableNameToFile(named), t.desc.copy(), c.bp)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range c.tableIndexes(named) {
+		if idx.file != nil {
+			cf.attachIndex(idx.file)
+		}
+	}
+	return cf, nil
 }
 
 func (c *Catalog) findTablesWithColumn(named string) []*Table {
@@ -186,9 +425,18 @@ func (c *Catalog) CatalogString() string {
 			if i != 0 {
 				fieldStr = fieldStr + ", "
 			}
-			fieldStr = fieldStr + f.Fname + " " + typeNames[f.Ftype]
+			if f.Ftype == StringType && f.Length > 0 {
+				fieldStr = fieldStr + f.Fname + " varchar(" + strconv.Itoa(f.Length) + ")"
+			} else if f.Ftype == DecimalType && f.Precision > 0 {
+				fieldStr = fieldStr + f.Fname + " decimal(" + strconv.Itoa(f.Precision) + "," + strconv.Itoa(f.Scale) + ")"
+			} else {
+				fieldStr = fieldStr + f.Fname + " " + typeNames[f.Ftype]
+			}
 		}
 		outStr = outStr + t.name + " " + fieldStr + ")\n"
 	}
+	for _, idx := range c.indexes {
+		outStr = outStr + "index " + idx.name + " on " + idx.table + " (" + idx.column + ")\n"
+	}
 	return outStr
 }
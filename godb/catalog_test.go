@@ -0,0 +1,226 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Create a catalog in a new directory with a single table t (name, age)
+// holding n tuples
+func makeCatalogTestVars(t *testing.T, n int) (*Catalog, *BufferPool, string) {
+	c, dir := makeQueryCatalog(t, "t (name string, age int)\n")
+	insertAges(t, c, 0, n)
+	return c, c.bp, dir
+}
+
+// Insert tuples with ages from..to-1 (mod 10) into table t in one transaction
+func insertAges(t *testing.T, c *Catalog, from int, to int) {
+	file, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	for i := from; i < to; i++ {
+		tup := &Tuple{Desc: *file.Descriptor(), Fields: []DBValue{StringField{"sam"}, IntField{int64(i % 10)}}}
+		if err := file.insertTuple(tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	c.bp.CommitTransaction(tid)
+}
+
+// Return the number of tuples with the supplied age found through the index
+func countThroughIndex(t *testing.T, c *Catalog, name string, age int64) int {
+	idx := c.findIndex(name)
+	if idx == nil {
+		t.Fatalf("index %s not found", name)
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	defer c.bp.CommitTransaction(tid)
+	iter, err := idx.file.RangeIterator(tid, IntField{age}, true, IntField{age}, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return cnt
+		}
+		if tup.Fields[1].(IntField).Value != age {
+			t.Fatalf("index returned tuple %v for age %d", tup.Fields, age)
+		}
+		cnt++
+	}
+}
+
+func TestCreateIndex(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	qType, _, err := Parse(c, "CREATE INDEX t_age ON t (age);")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if qType != CreateIndexQueryType {
+		t.Fatalf("expected CreateIndexQueryType, got %d", qType)
+	}
+	// the tuples already in the table are indexed
+	if n := countThroughIndex(t, c, "t_age", 3); n != 20 {
+		t.Errorf("expected 20 tuples with age 3, got %d", n)
+	}
+	// and so are the tuples inserted afterwards
+	insertAges(t, c, 200, 250)
+	if n := countThroughIndex(t, c, "t_age", 3); n != 25 {
+		t.Errorf("expected 25 tuples with age 3 after inserting, got %d", n)
+	}
+
+	if _, _, err := Parse(c, "create index t_age on t(name)"); err == nil {
+		t.Errorf("expected an error creating a second index named t_age")
+	}
+	if _, _, err := Parse(c, "create index t_x on t(x)"); err == nil {
+		t.Errorf("expected an error indexing a column that doesn't exist")
+	}
+	if _, _, err := Parse(c, "create index t_x on nosuchtable(age)"); err == nil {
+		t.Errorf("expected an error indexing a table that doesn't exist")
+	}
+}
+
+func TestIndexSavedInCatalog(t *testing.T) {
+	c, _, dir := makeCatalogTestVars(t, 100)
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// a varchar of the longest length fits on a page, whatever its characters
+	if _, _, err := Parse(c, fmt.Sprintf("create table y (name varchar(%d))", maxVarcharLength)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runQuery(t, c, fmt.Sprintf("insert into y values ('%s')", strings.Repeat("😀", maxVarcharLength)))
+
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(c.CatalogString(), "index t_age on t (age)") {
+		t.Errorf("index missing from catalog string %s", c.CatalogString())
+	}
+
+	c2, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := countThroughIndex(t, c2, "t_age", 7); n != 10 {
+		t.Errorf("expected 10 tuples with age 7 after reloading the catalog, got %d", n)
+	}
+
+	// a missing index file is rebuilt from the table
+	os.Remove(dir + "/t_age.idx")
+	c3, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := countThroughIndex(t, c3, "t_age", 7); n != 10 {
+		t.Errorf("expected 10 tuples with age 7 after rebuilding the index, got %d", n)
+	}
+}
+
+func TestDropIndex(t *testing.T) {
+	c, _, dir := makeCatalogTestVars(t, 50)
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, _, err := Parse(c, "drop index t_age on t2"); err == nil {
+		t.Errorf("expected an error dropping the index from the wrong table")
+	}
+	qType, _, err := Parse(c, "DROP INDEX t_age")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if qType != DropIndexQueryType {
+		t.Fatalf("expected DropIndexQueryType, got %d", qType)
+	}
+	if c.findIndex("t_age") != nil || strings.Contains(c.CatalogString(), "t_age") {
+		t.Errorf("index still in the catalog after being dropped")
+	}
+	if _, err := os.Stat(dir + "/t_age.idx"); !os.IsNotExist(err) {
+		t.Errorf("index file still exists after the index was dropped")
+	}
+	// the table can still be written to
+	insertAges(t, c, 0, 10)
+
+	if _, _, err := Parse(c, "drop index t_age"); err == nil {
+		t.Errorf("expected an error dropping an index that doesn't exist")
+	}
+}
+
+func TestVarcharColumns(t *testing.T) {
+	c, dir := makeQueryCatalog(t, "v (id int, code varchar(5), note text)\n")
+	runQuery(t, c, "insert into v values (1, 'abcde', 'a note of any length'), (2, 'déjà', null)")
+
+	// strings longer than the length of their column are rejected, whether
+	// inserted, updated or loaded
+	for _, sql := range []string{"insert into v values (3, 'abcdef', 'x')", "update v set code = 'abcdef' where id = 1"} {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tid := NewTID()
+		c.bp.BeginTransaction(tid)
+		iter, err := plan.Iterator(tid, plan.Descriptor())
+		if err == nil {
+			_, err = iter()
+		}
+		if err == nil {
+			t.Errorf("expected an error from %s", sql)
+		}
+		c.bp.AbortTransaction(tid)
+	}
+	csv := dir + "/v.csv"
+	if err := os.WriteFile(csv, []byte("4,abc,x\n5,abcdef,y\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	f, err := os.Open(csv)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	v, _ := c.GetTable("v")
+	if err := v.(*ColumnFile).LoadFromCSV(f, false, ",", false); err == nil {
+		t.Errorf("expected an error loading a string longer than its column")
+	}
+	_, tuples := runQuery(t, c, "select id, code from v order by id")
+	if len(tuples) != 3 || tuples[0].Fields[1].(StringField).Value != "abcde" || tuples[1].Fields[1].(StringField).Value != "déjà" || tuples[2].Fields[1].(StringField).Value != "abc" {
+		t.Errorf("expected the rows inserted and loaded before the long strings, got %v", tuples)
+	}
+
+	// the lengths are kept in the catalog
+	if _, _, err := Parse(c, "create table w (name varchar(12), body varchar)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, sql := range []string{"create table x (name varchar(0))", "create table x (name varchar(65535))", "create table x (id int, a varchar(600), b varchar(600))", "create index w_body on w(body)", "create index v_note on v(note)"} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error from %s", sql)
+		}
+	}
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	w, err := c2.GetTable("w")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if fs := w.Descriptor().Fields; fs[0].Length != 12 || fs[1].Length != 0 {
+		t.Errorf("expected varchar(12) and unbounded columns after reloading the catalog, got %v", fs)
+	}
+	if err := queryError(c2, "insert into v values (6, 'abcdef', 'x')"); err == nil {
+		t.Errorf("expected an error inserting a long string after reloading the catalog")
+	}
+}
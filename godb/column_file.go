@@ -115,6 +115,11 @@ func MakeColumnOrientedTransitDatabase() error {
 // ColumnFile represents a file that stores a specific column
 // Each column file has a descriptor desc of all the columns it contains
 // Each column file has an array of all the heapfiles that represent a column in the table
+//
+// A tuple is stored at the same record id, page and slot, in every column, so
+// a tuple can be found in each column from its record id.  As fields are of
+// different sizes, a page of one column may run out of room before the same
+// page of another, in which case the tuple goes to another page.
 type ColumnFile struct {
 	name           string
 	Desc           *TupleDesc
@@ -149,17 +154,52 @@ func (cf *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
 	if len(t.Fields) != len(cf.ColumnFiles) {
 		return GoDBError{code: IllegalOperationError, errString: "Could not insert Tuple"}
 	}
+	// reclaim the same versions in every column, to keep the columns aligned
+	horizon := cf.bufPool.vacuumHorizon()
+	fieldTuples := make([]*Tuple, len(t.Fields))
 	for i := range t.Fields {
-		fieldTuple := &Tuple{
+		fieldTuples[i] = &Tuple{
 			Desc:   TupleDesc{Fields: []FieldType{t.Desc.Fields[i]}},
 			Fields: []DBValue{t.Fields[i]},
 		}
-		err := cf.ColumnFiles[i].insertTuple(fieldTuple, tid)
-		if err != nil {
+		if err := cf.ColumnFiles[i].checkInsert(fieldTuples[i]); err != nil {
+			return err
+		}
+	}
+	for {
+		// the first column picks the rid, and the others follow it
+		if err := cf.ColumnFiles[0].placeVersion(fieldTuples[0], tid, horizon); err != nil {
+			return err
+		}
+		rid := fieldTuples[0].Rid.(RecordID)
+		placed := 1
+		for ; placed < len(fieldTuples); placed++ {
+			ok, err := cf.ColumnFiles[placed].placeVersionAt(fieldTuples[placed], tid, horizon, rid)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+		}
+		if placed == len(fieldTuples) {
+			break
+		}
+		// a column has no room on the page, so take the tuple out of the
+		// columns it was placed in and move on to another page
+		for i := 0; i < placed; i++ {
+			if err := cf.ColumnFiles[i].removeVersion(rid, tid); err != nil {
+				return err
+			}
+		}
+		cf.ColumnFiles[0].setFull(rid.pageNo)
+	}
+	for i, fieldTuple := range fieldTuples {
+		if err := cf.ColumnFiles[i].index(fieldTuple, tid); err != nil {
 			return err
 		}
-		t.Rid = fieldTuple.Rid
 	}
+	t.Rid = fieldTuples[0].Rid
 	return nil
 }
 
@@ -216,6 +256,42 @@ func (cf *ColumnFile) Iterator(tid TransactionID, selectDesc *TupleDesc) (func()
 	}, nil
 }
 
+// Reclaim the slots of deleted tuple versions in every column, returning the
+// number of slots freed. See [HeapFile.Vacuum].
+func (cf *ColumnFile) Vacuum() (int, error) {
+	horizon := cf.bufPool.vacuumHorizon()
+	cnt := 0
+	for _, f := range cf.ColumnFiles {
+		n, err := f.vacuum(horizon)
+		cnt += n
+		if err != nil {
+			return cnt, err
+		}
+	}
+	return cnt, nil
+}
+
+// Register an index over the file with the column holding its key, which
+// keeps it up to date
+func (cf *ColumnFile) attachIndex(bf *BTreeFile) {
+	cf.ColumnFilesMap[bf.keyField.Fname].attachIndex(bf)
+}
+
+// Return the tuple stored at rid if it is visible to the snapshot snap of tid,
+// or nil otherwise.  See [HeapFile.fetchTuple].
+func (cf *ColumnFile) fetchTuple(rid RecordID, tid TransactionID, snap snapshot) (*Tuple, error) {
+	var tuple *Tuple
+	for _, f := range cf.ColumnFiles {
+		t, err := f.fetchTuple(rid, tid, snap)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		tuple = joinTuples(tuple, t)
+	}
+	tuple.Rid = rid
+	return tuple, nil
+}
+
 // [Operator] descriptor method -- return the TupleDesc for this HeapFile
 // Supplied as argument to NewHeapFile.
 func (cf *ColumnFile) Descriptor() *TupleDesc {
@@ -248,16 +324,73 @@ func (cf *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, ski
 			switch cf.Descriptor().Fields[fno].Ftype {
 			case IntType:
 				field = strings.TrimSpace(field)
+				if field == "" {
+					// an empty number is missing
+					newFields = append(newFields, NullField{})
+					continue
+				}
 				floatVal, err := strconv.ParseFloat(field, 64)
 				if err != nil {
 					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to int, tuple %d", field, cnt)}
 				}
 				intValue := int(floatVal)
 				newFields = append(newFields, IntField{int64(intValue)})
-			case StringType:
-				if len(field) > StringLength {
-					field = field[0:StringLength]
+			case FloatType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				floatVal, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to float, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, FloatField{floatVal})
+			case DecimalType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				decimalVal, err := parseDecimal(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to decimal, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, decimalVal)
+			case DateType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				dateVal, err := parseDate(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to date, tuple %d", field, cnt)}
 				}
+				newFields = append(newFields, dateVal)
+			case TimestampType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				tsVal, err := parseTimestamp(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to timestamp, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, tsVal)
+			case BoolType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				boolVal, err := strconv.ParseBool(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to bool, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, BoolField{boolVal})
+			case StringType:
 				newFields = append(newFields, StringField{field})
 			}
 		}
@@ -265,8 +398,13 @@ func (cf *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, ski
 		tid := NewTID()
 		bp := cf.bufPool
 		bp.BeginTransaction(tid)
-		cf.insertTuple(&newT, tid)
-		bp.CommitTransaction(tid)
+		if err := cf.insertTuple(&newT, tid); err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
+		if err := bp.CommitTransaction(tid); err != nil {
+			return err
+		}
 	}
 	return nil
 }
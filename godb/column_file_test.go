@@ -1,7 +1,9 @@
 package godb
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -25,7 +27,9 @@ func makeCFTestVars() (TupleDesc, Tuple, Tuple, *ColumnFile, *BufferPool, Transa
 			IntField{999},
 		}}
 
-	bp := NewBufferPool(3)
+	// the columns fill their pages in lockstep, so a transaction inserting
+	// two tuples may dirty two pages of every column
+	bp := NewBufferPool(2*len(td.Fields) + 1)
 	for _, field := range td.Fields {
 		os.Remove(TestingFile + "_" + field.Fname + ".dat")
 	}
@@ -215,3 +219,58 @@ func TestEachColumnHasOneTuple(t *testing.T) {
 		t.Errorf("HeapFile iterator expected 18 tuples, got %d", i)
 	}
 }
+
+// store strings of very different lengths, so that the pages of the columns
+// fill at different rates, and check that they are read back whole and in
+// the same rows as the other fields
+func TestVariableLengthStrings(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/catalog.txt", nil, 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, _, err := Parse(c, "create table notes (id int, title varchar(30), body text)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	body := func(i int) string {
+		return strings.Repeat(string(rune('a'+i%26)), i*7%300)
+	}
+	for i := 0; i < 200; i++ {
+		runQuery(t, c, fmt.Sprintf("insert into notes values (%d, 'a title longer than ten', '%s')", i, body(i)))
+	}
+	_, tuples := runQuery(t, c, "select id, title, body from notes")
+	if len(tuples) != 200 {
+		t.Fatalf("expected 200 rows, got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		i := int(tup.Fields[0].(IntField).Value)
+		if tup.Fields[1].(StringField).Value != "a title longer than ten" || tup.Fields[2].(StringField).Value != body(i) {
+			t.Fatalf("unexpected strings in row %d: %v", i, tup.Fields[1:])
+		}
+	}
+	_, tuples = runQuery(t, c, "select id from notes where body = '"+body(150)+"'")
+	if len(tuples) != 1 || tuples[0].Fields[0].(IntField).Value != 150 {
+		t.Errorf("expected to find row 150 by its body, got %v", tuples)
+	}
+
+	// strings of unbounded length can't be indexed, but those of a
+	// varchar(n) can, however many bytes their characters take
+	if _, _, err := Parse(c, "create index notes_body on notes(body)"); err == nil {
+		t.Errorf("expected an error indexing a text column")
+	}
+	if _, _, err := Parse(c, "create index notes_title on notes(title)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	long := strings.Repeat("é", 30)
+	runQuery(t, c, "insert into notes values (200, '"+long+"', 'b')")
+	_, tuples = runQuery(t, c, "select id from notes where title = '"+long+"'")
+	if len(tuples) != 1 || tuples[0].Fields[0].(IntField).Value != 200 {
+		t.Errorf("expected to find row 200 by its title, got %v", tuples)
+	}
+	if err := queryError(c, "insert into notes values (201, '"+long+"x', 'b')"); err == nil {
+		t.Errorf("expected an error inserting a title longer than 30 characters")
+	}
+}
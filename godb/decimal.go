@@ -0,0 +1,200 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DecimalField is an exact fixed point number, whose value is Value / 10^Scale.
+// Unlike floats, decimals represent amounts such as 0.1 exactly, and their
+// sums and products are exact, which is what money columns need.
+//
+// Decimals keep the digits after the decimal point they are written with, or
+// that the column they are stored in is declared with (1.50 in a decimal(5,2)
+// column is 150 with a Scale of 2), so that they print as they were stored.
+// Equal numbers of different scales, such as 1.5 and 1.50, compare as equal,
+// and are the same key in joins and groups (see [DecimalField.normalized]).
+type DecimalField struct {
+	Value int64
+	Scale int
+}
+
+// The most digits a decimal may have, before or after the decimal point; any
+// number of up to 18 digits fits in an int64
+const maxDecimalDigits int = 18
+
+// The number of digits of the quotient of a division after the decimal point,
+// beyond the most that either operand has
+const decimalDivisionScale int = 6
+
+var bigTen = big.NewInt(10)
+
+// 10^18, the smallest number with too many digits for a decimal
+var decimalLimit = pow10(maxDecimalDigits)
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// Return v / d, rounded half away from zero
+func roundQuo(v *big.Int, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(v, d, new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		q.Add(q, big.NewInt(int64(v.Sign()*d.Sign())))
+	}
+	return q
+}
+
+// Return the decimal v / 10^scale.  If v has too many
+// digits, digits after the decimal point are rounded away until it fits;
+// returns an error if the digits before the decimal point don't fit.
+func newDecimal(v *big.Int, scale int) (DecimalField, error) {
+	for scale > 0 && (scale > maxDecimalDigits || new(big.Int).Abs(v).Cmp(decimalLimit) >= 0) {
+		v = roundQuo(v, bigTen)
+		scale--
+	}
+	if new(big.Int).Abs(v).Cmp(decimalLimit) >= 0 {
+		return DecimalField{}, GoDBError{IllegalOperationError, fmt.Sprintf("decimal value has more than %d digits", maxDecimalDigits)}
+	}
+	return DecimalField{v.Int64(), scale}, nil
+}
+
+// Parse a decimal written as digits with an optional sign and decimal point,
+// e.g. -12.30
+func parseDecimal(s string) (DecimalField, error) {
+	malformed := GoDBError{TypeMismatchError, fmt.Sprintf("malformed decimal %s", s)}
+	digits := strings.TrimSpace(s)
+	digits = strings.TrimPrefix(digits, "+")
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	digits = intPart + fracPart
+	if strings.TrimPrefix(digits, "-") == "" || strings.ContainsAny(digits[1:], "+-") {
+		return DecimalField{}, malformed
+	}
+	v, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return DecimalField{}, malformed
+	}
+	return newDecimal(v, len(fracPart))
+}
+
+// Return the decimal closest to f, which has the digits of the shortest
+// representation of f, so that a constant such as 0.1 gives exactly 0.1
+func decimalFromFloat(f float64) (DecimalField, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return DecimalField{}, GoDBError{TypeMismatchError, "infinite value can't be a decimal"}
+	}
+	return parseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// Return d multiplied by 10^(scale-d.Scale), where scale >= d.Scale
+func (d DecimalField) rescaled(scale int) *big.Int {
+	v := big.NewInt(d.Value)
+	return v.Mul(v, pow10(scale-d.Scale))
+}
+
+func (d DecimalField) add(e DecimalField) (DecimalField, error) {
+	scale := maxInt(d.Scale, e.Scale)
+	return newDecimal(new(big.Int).Add(d.rescaled(scale), e.rescaled(scale)), scale)
+}
+
+func (d DecimalField) sub(e DecimalField) (DecimalField, error) {
+	scale := maxInt(d.Scale, e.Scale)
+	return newDecimal(new(big.Int).Sub(d.rescaled(scale), e.rescaled(scale)), scale)
+}
+
+func (d DecimalField) mul(e DecimalField) (DecimalField, error) {
+	return newDecimal(new(big.Int).Mul(big.NewInt(d.Value), big.NewInt(e.Value)), d.Scale+e.Scale)
+}
+
+// Return d / e, with decimalDivisionScale more digits after the decimal point
+// than d and e have, which for values of decimal(p,s) columns is their scale s,
+// rounded half away from zero
+func (d DecimalField) div(e DecimalField) (DecimalField, error) {
+	if e.Value == 0 {
+		return DecimalField{}, GoDBError{IllegalOperationError, "division by zero"}
+	}
+	scale := maxInt(d.Scale, e.Scale) + decimalDivisionScale
+	num := new(big.Int).Mul(big.NewInt(d.Value), pow10(scale-d.Scale+e.Scale))
+	return newDecimal(roundQuo(num, big.NewInt(e.Value)), scale)
+}
+
+// Return d without trailing zeros after the decimal point, the same value for
+// all the decimals equal to d, to hash or to use as a key
+func (d DecimalField) normalized() DecimalField {
+	for d.Scale > 0 && d.Value%10 == 0 {
+		d.Value /= 10
+		d.Scale--
+	}
+	return d
+}
+
+// Return d rounded half away from zero to the scale of a decimal(precision,
+// scale) column, or an error if it has more than precision - scale digits
+// before the decimal point.  A precision of 0 is a decimal column without a
+// precision, which takes d as it is.
+func (d DecimalField) fitTo(precision int, scale int) (DecimalField, error) {
+	if precision == 0 {
+		return d, nil
+	}
+	v := big.NewInt(d.Value)
+	if scale >= d.Scale {
+		v.Mul(v, pow10(scale-d.Scale))
+	} else {
+		v = roundQuo(v, pow10(d.Scale-scale))
+	}
+	if new(big.Int).Abs(v).Cmp(pow10(precision)) >= 0 {
+		return DecimalField{}, GoDBError{IllegalOperationError, fmt.Sprintf("value %s has too many digits for decimal(%d,%d)", d, precision, scale)}
+	}
+	return DecimalField{v.Int64(), scale}, nil
+}
+
+// Return -1, 0 or 1 as d is less than, equal to or greater than e
+func (d DecimalField) cmp(e DecimalField) int {
+	scale := maxInt(d.Scale, e.Scale)
+	return d.rescaled(scale).Cmp(e.rescaled(scale))
+}
+
+// Return d rounded to an integer, half away from zero
+func (d DecimalField) round() int64 {
+	return roundQuo(big.NewInt(d.Value), pow10(d.Scale)).Int64()
+}
+
+// Return the float closest to d
+func (d DecimalField) float() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func (d DecimalField) String() string {
+	s := strconv.FormatInt(d.Value, 10)
+	if d.Scale == 0 {
+		return s
+	}
+	sign := ""
+	if d.Value < 0 {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= d.Scale {
+		s = strings.Repeat("0", d.Scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-d.Scale] + "." + s[len(s)-d.Scale:]
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Return an error if a DECIMAL(precision, scale) column can't hold its
+// numbers exactly
+func checkDecimalPrecision(precision int, scale int) error {
+	if precision < 1 || precision > maxDecimalDigits || scale < 0 || scale > precision {
+		return GoDBError{ParseError, fmt.Sprintf("decimal(%d,%d) is not supported; the precision must be at most %d, and the scale at most the precision", precision, scale, maxDecimalDigits)}
+	}
+	return nil
+}
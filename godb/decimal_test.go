@@ -0,0 +1,114 @@
+package godb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecimalArithmetic(t *testing.T) {
+	parse := func(s string) DecimalField {
+		d, err := parseDecimal(s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return d
+	}
+	for in, out := range map[string]string{"12.30": "12.30", "-0.05": "-0.05", "+7": "7", ".5": "0.5", "100.000": "100.000", "-0.0": "0.0"} {
+		if s := parse(in).String(); s != out {
+			t.Errorf("expected %s to parse as %s, got %s", in, out, s)
+		}
+	}
+	for _, in := range []string{"", "-", "1.2.3", "1e5", "1-2", "abc", "1234567890123456789"} {
+		if _, err := parseDecimal(in); err == nil {
+			t.Errorf("expected an error parsing %q", in)
+		}
+	}
+	// equal decimals keep their own digits, but are the same key
+	if parse("1.50") == parse("1.5") || parse("1.50").normalized() != parse("1.5") || parse("0.00").normalized() != parse("0") {
+		t.Errorf("expected equal decimals to be the same key")
+	}
+
+	// 0.1 + 0.2 is not 0.3 in floating point
+	sum, _ := parse("0.1").add(parse("0.2"))
+	if sum != parse("0.3") {
+		t.Errorf("expected 0.1 + 0.2 = 0.3, got %s", sum)
+	}
+	ops := []struct {
+		f        func(DecimalField, DecimalField) (DecimalField, error)
+		a, b, is string
+	}{
+		{DecimalField.sub, "10", "0.01", "9.99"},
+		{DecimalField.mul, "19.99", "0.95", "18.9905"},
+		{DecimalField.mul, "-1.5", "1.5", "-2.25"},
+		{DecimalField.div, "1", "3", "0.333333"},
+		{DecimalField.div, "2", "3", "0.666667"},
+		{DecimalField.div, "-7.5", "2", "-3.7500000"},
+		// the scale of a quotient follows from the scales of the operands,
+		// not from their digits
+		{DecimalField.div, "10.25", "3", "3.41666667"},
+		{DecimalField.div, "10.10", "3", "3.36666667"},
+		// digits after the decimal point are rounded away to fit
+		{DecimalField.mul, "1234567.123456789", "1000.000000001", "1234567123.45802357"},
+	}
+	for _, op := range ops {
+		d, err := op.f(parse(op.a), parse(op.b))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if d.String() != op.is {
+			t.Errorf("expected %s, got %s from %s and %s", op.is, d, op.a, op.b)
+		}
+	}
+	if _, err := parse("1").div(parse("0")); err == nil {
+		t.Errorf("expected an error dividing by zero")
+	}
+	if _, err := parse("999999999999999999").add(parse("1")); err == nil {
+		t.Errorf("expected an error when a sum has too many digits")
+	}
+	if parse("2.5").cmp(parse("2.45")) != 1 || parse("-3").cmp(parse("-2.999")) != -1 || parse("1.10").cmp(parse("1.1")) != 0 {
+		t.Errorf("unexpected decimal comparison")
+	}
+	fits := []struct {
+		in               string
+		precision, scale int
+		is               string
+	}{
+		{"10.1", 5, 2, "10.10"},
+		{"1.005", 5, 2, "1.01"},
+		{"-1.005", 5, 2, "-1.01"},
+		{"999.994", 5, 2, "999.99"},
+		{"12.5", 3, 0, "13"},
+		{"123456.789", 0, 0, "123456.789"},
+	}
+	for _, f := range fits {
+		d, err := parse(f.in).fitTo(f.precision, f.scale)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if d.String() != f.is {
+			t.Errorf("expected %s in decimal(%d,%d), got %s", f.is, f.precision, f.scale, d)
+		}
+	}
+	for _, in := range []string{"123456.789", "1000", "999.995", "-1000.00"} {
+		if d, err := parse(in).fitTo(5, 2); err == nil {
+			t.Errorf("expected %s not to fit in decimal(5,2), got %s", in, d)
+		}
+	}
+	if parse("2.5").round() != 3 || parse("-2.5").round() != -3 || parse("2.49").round() != 2 {
+		t.Errorf("expected decimals to round half away from zero")
+	}
+
+	td := TupleDesc{Fields: []FieldType{{Fname: "price", Ftype: DecimalType}, {Fname: "qty", Ftype: IntType}}}
+	t1 := Tuple{Desc: td, Fields: []DBValue{parse("-1234.5625"), IntField{3}}}
+	b := new(bytes.Buffer)
+	if err := t1.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	t2, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !t1.equals(t2) {
+		t.Errorf("expected %v after serialization, got %v", t1.Fields, t2.Fields)
+	}
+}
@@ -13,7 +13,7 @@ func NewDeleteOp(deleteFile DBFile, child Operator) *DeleteOp {
 
 // The delete TupleDesc is a one column descriptor with an integer field named "count"
 func (i *DeleteOp) Descriptor() *TupleDesc {
-	ft := FieldType{"count", "", IntType}
+	ft := FieldType{Fname: "count", Ftype: IntType}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
 	td.Fields = fts
@@ -28,7 +28,13 @@ func (i *DeleteOp) Descriptor() *TupleDesc {
 func (dop *DeleteOp) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
 	iterator, _ := dop.child.Iterator(tid, dop.Descriptor())
 	count := 0
+	done := false
 	return func() (*Tuple, error) {
+		// the count is returned once, after which the iterator is exhausted
+		if done {
+			return nil, nil
+		}
+		done = true
 		for {
 			t, _ := iterator()
 			if t == nil {
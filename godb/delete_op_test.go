@@ -9,7 +9,7 @@ func TestDelete(t *testing.T) {
 	hf.insertTuple(&t1, tid)
 	hf.insertTuple(&t2, tid)
 	bp.CommitTransaction(tid)
-	var f FieldType = FieldType{"age", "", IntType}
+	var f FieldType = FieldType{Fname: "age", Ftype: IntType}
 	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
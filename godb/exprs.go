@@ -2,8 +2,15 @@ package godb
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 //Expressions can be applied to tuples to get concrete values.  They
@@ -13,7 +20,7 @@ import (
 //other values from tuples.
 
 type Expr interface {
-	EvalExpr(t *Tuple) (DBValue, error) //DBValue is either IntField or StringField
+	EvalExpr(t *Tuple) (DBValue, error) //DBValue is either IntField, StringField, FloatField or DecimalField
 	GetExprType() FieldType             //Return the type of the Expression
 }
 
@@ -35,13 +42,29 @@ func (f *FieldExpr) GetExprType() FieldType {
 	return f.selectField
 }
 
+// An expression whose value is returned as a field named name, e.g. an
+// expression such as year(d) that an aggregate groups on, so that the
+// operators above the aggregate can tell it from the fields it reads
+type NamedExpr struct {
+	name string
+	expr Expr
+}
+
+func (n *NamedExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	return n.expr.EvalExpr(t)
+}
+
+func (n *NamedExpr) GetExprType() FieldType {
+	return FieldType{Fname: n.name, Ftype: n.expr.GetExprType().Ftype}
+}
+
 type ConstExpr struct {
-	val       any //should be an IntField or a StringField
+	val       any //should be an IntField, a StringField, a FloatField or a DecimalField
 	constType DBType
 }
 
 func (c *ConstExpr) GetExprType() FieldType {
-	return FieldType{"const", fmt.Sprintf("%v", c.val), c.constType}
+	return FieldType{Fname: "const", TableQualifier: fmt.Sprintf("%v", c.val), Ftype: c.constType}
 }
 
 func (c *ConstExpr) EvalExpr(_ *Tuple) (DBValue, error) {
@@ -54,66 +77,612 @@ type FuncExpr struct {
 }
 
 func (f *FuncExpr) GetExprType() FieldType {
-	fType, exists := funcs[f.op]
+	fType, err := resolveFunc(f.op, f.args)
 	//todo return err
-	if !exists {
-		return FieldType{f.op, "", IntType}
+	if err != nil {
+		return FieldType{Fname: f.op, Ftype: IntType}
 	}
-	ft := FieldType{f.op, "", IntType}
+	ft := FieldType{Fname: f.op, Ftype: IntType}
 	for _, fe := range f.args {
 		fieldExpr, ok := (*fe).(*FieldExpr)
 		if ok {
 			ft = fieldExpr.GetExprType()
 		}
 	}
-	return FieldType{ft.Fname, ft.TableQualifier, fType.outType}
+	return FieldType{Fname: ft.Fname, TableQualifier: ft.TableQualifier, Ftype: fType.outType}
+
+}
+
+// Return the fields that e reads from a tuple, and false if they can't be
+// told from the kind of expression
+func referencedFields(e Expr) ([]FieldType, bool) {
+	switch e := e.(type) {
+	case *FieldExpr:
+		return []FieldType{e.selectField}, true
+	case *ConstExpr:
+		return nil, true
+	case *FuncExpr:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = *arg
+		}
+		return referencedFieldsOf(args)
+	case *CompareExpr:
+		return referencedFieldsOf([]Expr{e.left, e.right})
+	case *IsNullExpr:
+		return referencedFields(e.expr)
+	case *BoolValueExpr:
+		return referencedFields(e.expr)
+	case *BoolExpr:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = arg
+		}
+		return referencedFieldsOf(args)
+	case *NamedExpr:
+		return referencedFields(e.expr)
+	case *CaseExpr:
+		args := append(append([]Expr{}, e.results...), e.els)
+		for _, cond := range e.conds {
+			args = append(args, cond)
+		}
+		return referencedFieldsOf(args)
+	}
+	return nil, false
+}
+
+// Return the fields that any of exprs reads, as [referencedFields] does
+func referencedFieldsOf(exprs []Expr) ([]FieldType, bool) {
+	var fields []FieldType
+	for _, e := range exprs {
+		fs, ok := referencedFields(e)
+		if !ok {
+			return nil, false
+		}
+		fields = append(fields, fs...)
+	}
+	return fields, true
+}
+
+// A Predicate is an expression that is true, false or unknown (see [Truth])
+// for a tuple, built from comparisons, null tests and boolean values combined
+// with and, or and not.  A predicate evaluates to a [BoolField] when it is
+// true or false, and to a [NullField] when it is unknown, so that it can be
+// selected or stored like any other boolean.
+type Predicate interface {
+	Expr
+	truth(t *Tuple) (Truth, error)
+}
+
+func truthToField(t Truth) DBValue {
+	if t == TruthUnknown {
+		return NullField{}
+	}
+	return BoolField{t == TruthTrue}
+}
+
+// CompareExpr compares the values of two expressions of the same type, e.g.
+// a column with a constant or with another column
+type CompareExpr struct {
+	op          BoolOp
+	left, right Expr
+}
+
+// Construct a comparison of left and right.  Numbers of different types are
+// converted to the same type (see [promoteNumeric]); returns an error if they
+// are otherwise of different types.
+func NewCompareExpr(op BoolOp, left Expr, right Expr) (*CompareExpr, error) {
+	left, right = promoteNumeric(left, right)
+	if left.GetExprType().Ftype != right.GetExprType().Ftype {
+		return nil, GoDBError{IncompatibleTypesError, "cannot compare values of different types"}
+	}
+	return &CompareExpr{op, left, right}, nil
+}
+
+func (e *CompareExpr) GetExprType() FieldType {
+	return FieldType{Fname: opToStr(e.op), Ftype: BoolType}
+}
+
+func (e *CompareExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	truth, err := e.truth(t)
+	if err != nil {
+		return nil, err
+	}
+	return truthToField(truth), nil
+}
+
+func (e *CompareExpr) truth(t *Tuple) (Truth, error) {
+	left, err := e.left.EvalExpr(t)
+	if err != nil {
+		return TruthUnknown, err
+	}
+	right, err := e.right.EvalExpr(t)
+	if err != nil {
+		return TruthUnknown, err
+	}
+	if isNull(left) || isNull(right) {
+		return TruthUnknown, nil
+	}
+	switch left.(type) {
+	case IntField:
+		if _, ok := right.(IntField); ok {
+			return evalNullablePred(left, right, intFilterGetter, e.op), nil
+		}
+	case StringField:
+		if _, ok := right.(StringField); ok {
+			return evalNullablePred(left, right, stringFilterGetter, e.op), nil
+		}
+	case FloatField:
+		if _, ok := right.(FloatField); ok {
+			return evalNullablePred(left, right, floatFilterGetter, e.op), nil
+		}
+	case DecimalField:
+		if r, ok := right.(DecimalField); ok {
+			return truthOf(evalPred(left.(DecimalField).cmp(r), 0, e.op)), nil
+		}
+	case DateField:
+		if _, ok := right.(DateField); ok {
+			return evalNullablePred(left, right, temporalFilterGetter, e.op), nil
+		}
+	case TimestampField:
+		if _, ok := right.(TimestampField); ok {
+			return evalNullablePred(left, right, temporalFilterGetter, e.op), nil
+		}
+	case BoolField:
+		if _, ok := right.(BoolField); ok {
+			return evalNullablePred(left, right, boolFilterGetter, e.op), nil
+		}
+	}
+	return TruthUnknown, GoDBError{TypeMismatchError, "cannot compare values of different types"}
+}
+
+// IsNullExpr tests whether an expression is missing (IS NULL), or, if negated,
+// whether it is not (IS NOT NULL).  Unlike a comparison, it is never unknown.
+type IsNullExpr struct {
+	expr   Expr
+	negate bool
+}
+
+// Construct a test of whether expr is missing, or of whether it is present if
+// negate is set
+func NewIsNullExpr(expr Expr, negate bool) *IsNullExpr {
+	return &IsNullExpr{expr, negate}
+}
+
+func (e *IsNullExpr) GetExprType() FieldType {
+	if e.negate {
+		return FieldType{Fname: "is not null", Ftype: BoolType}
+	}
+	return FieldType{Fname: "is null", Ftype: BoolType}
+}
+
+func (e *IsNullExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	truth, err := e.truth(t)
+	if err != nil {
+		return nil, err
+	}
+	return truthToField(truth), nil
+}
+
+func (e *IsNullExpr) truth(t *Tuple) (Truth, error) {
+	v, err := e.expr.EvalExpr(t)
+	if err != nil {
+		return TruthUnknown, err
+	}
+	return truthOf(isNull(v) != e.negate), nil
+}
+
+// BoolValueExpr is the predicate that a boolean expression, such as a boolean
+// column, is true.  It is unknown when the expression is missing.
+type BoolValueExpr struct {
+	expr Expr
+}
+
+// Construct the predicate that expr is true.  Returns an error if expr is not
+// a boolean (or NULL).
+func NewBoolValueExpr(expr Expr) (*BoolValueExpr, error) {
+	if t := expr.GetExprType().Ftype; t != BoolType && t != UnknownType {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("expected a boolean, got %s of type %s", expr.GetExprType().Fname, typeNames[t])}
+	}
+	return &BoolValueExpr{expr}, nil
+}
+
+func (e *BoolValueExpr) GetExprType() FieldType {
+	return FieldType{Fname: e.expr.GetExprType().Fname, TableQualifier: e.expr.GetExprType().TableQualifier, Ftype: BoolType}
+}
+
+func (e *BoolValueExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	truth, err := e.truth(t)
+	if err != nil {
+		return nil, err
+	}
+	return truthToField(truth), nil
+}
+
+func (e *BoolValueExpr) truth(t *Tuple) (Truth, error) {
+	v, err := e.expr.EvalExpr(t)
+	if err != nil || isNull(v) {
+		return TruthUnknown, err
+	}
+	b, ok := v.(BoolField)
+	if !ok {
+		return TruthUnknown, GoDBError{TypeMismatchError, "expected a boolean value"}
+	}
+	return truthOf(b.Value), nil
+}
+
+// BoolExpr combines predicates with "and", "or" or "not" (which has a single
+// argument), following SQL's three-valued logic: and is false if any argument
+// is false, or is true if any argument is true, and otherwise either is
+// unknown if any argument is unknown.  And and or stop evaluating their
+// arguments as soon as the result is known.
+type BoolExpr struct {
+	op   string
+	args []Predicate
+}
+
+// Construct the conjunction of the supplied predicates
+func NewAndExpr(args ...Predicate) *BoolExpr {
+	return &BoolExpr{"and", args}
+}
+
+// Construct the disjunction of the supplied predicates
+func NewOrExpr(args ...Predicate) *BoolExpr {
+	return &BoolExpr{"or", args}
+}
+
+// Construct the negation of the supplied predicate
+func NewNotExpr(arg Predicate) *BoolExpr {
+	return &BoolExpr{"not", []Predicate{arg}}
+}
+
+func (e *BoolExpr) GetExprType() FieldType {
+	return FieldType{Fname: e.op, Ftype: BoolType}
+}
+
+func (e *BoolExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	truth, err := e.truth(t)
+	if err != nil {
+		return nil, err
+	}
+	return truthToField(truth), nil
+}
+
+func (e *BoolExpr) truth(t *Tuple) (Truth, error) {
+	switch e.op {
+	case "not":
+		truth, err := e.args[0].truth(t)
+		return truth.not(), err
+	case "and", "or":
+		decisive := TruthFalse
+		if e.op == "or" {
+			decisive = TruthTrue
+		}
+		result := decisive.not()
+		for _, arg := range e.args {
+			truth, err := arg.truth(t)
+			if err != nil {
+				return TruthUnknown, err
+			}
+			if truth == decisive {
+				return decisive, nil
+			}
+			if truth == TruthUnknown {
+				result = TruthUnknown
+			}
+		}
+		return result, nil
+	}
+	return TruthUnknown, GoDBError{ParseError, fmt.Sprintf("unknown boolean operator %s", e.op)}
+}
 
+// CaseExpr is CASE WHEN cond THEN result ... ELSE result END: the value of the
+// result of the first condition that is true, or of the ELSE result if none
+// is, which is missing if there is no ELSE.  All of the results are of the
+// same type.
+type CaseExpr struct {
+	name    string
+	conds   []Predicate
+	results []Expr
+	els     Expr
+	ftype   DBType
 }
 
+// Construct a CASE expression named name that returns results[i] for the
+// first of conds that is true, and els (which may be nil) if none is.
+// Numbers of different types among the results are converted to the widest
+// of their types, as are dates among timestamps, and string constants among
+// dates (see [promoteNumeric]); returns an error if the results are
+// otherwise of different types.
+func NewCaseExpr(name string, conds []Predicate, results []Expr, els Expr) (*CaseExpr, error) {
+	if els == nil {
+		els = &ConstExpr{NullField{}, UnknownType}
+	}
+	all := append(append([]Expr{}, results...), els)
+	// string constants, which may be dates, are only strings if no other
+	// result has a type
+	ftype := UnknownType
+	strConsts := false
+	for _, e := range all {
+		t := e.GetExprType().Ftype
+		if _, isConst := e.(*ConstExpr); isConst && t == StringType {
+			strConsts = true
+		} else if ftype == UnknownType || widens(ftype, t) {
+			ftype = t
+		}
+	}
+	if ftype == UnknownType && strConsts {
+		ftype = StringType
+	}
+	for i, e := range all {
+		all[i] = convertExpr(e, ftype)
+		// NULL, whose type is unknown, may be the result of any branch
+		if t := all[i].GetExprType().Ftype; t != UnknownType && t != ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("the results of case are of different types, %s and %s", typeNames[ftype], typeNames[t])}
+		}
+	}
+	return &CaseExpr{name, conds, all[:len(results)], all[len(results)], ftype}, nil
+}
+
+func (e *CaseExpr) GetExprType() FieldType {
+	return FieldType{Fname: e.name, Ftype: e.ftype}
+}
+
+func (e *CaseExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	for i, cond := range e.conds {
+		truth, err := cond.truth(t)
+		if err != nil {
+			return nil, err
+		}
+		if truth == TruthTrue {
+			return e.results[i].EvalExpr(t)
+		}
+	}
+	return e.els.EvalExpr(t)
+}
+
+// The type of a function: the types of its arguments and result, and its
+// implementation, which may return an error in place of its result
 type FuncType struct {
 	argTypes []DBType
 	outType  DBType
 	f        func([]any) any
 }
 
-var funcs = map[string]FuncType{
+// The functions that may be used in expressions, by name.  A function may be
+// overloaded, with one FuncType for each list of argument types it accepts;
+// where no overload takes the arguments as they are, an int argument is
+// converted to a decimal or a float, a decimal to a float, and a date to a
+// timestamp, using the first overload that takes them once converted.  Decimal
+// versions of functions are therefore listed before float ones.
+var funcs = map[string][]FuncType{
 	//note should all be lower case
-	"+":                     {[]DBType{IntType, IntType}, IntType, addFunc},
-	"-":                     {[]DBType{IntType, IntType}, IntType, minusFunc},
-	"*":                     {[]DBType{IntType, IntType}, IntType, timesFunc},
-	"/":                     {[]DBType{IntType, IntType}, IntType, divFunc},
-	"mod":                   {[]DBType{IntType, IntType}, IntType, modFunc},
-	"rand":                  {[]DBType{}, IntType, randIntFunc},
-	"sq":                    {[]DBType{IntType}, IntType, sqFunc},
-	"getsubstr":             {[]DBType{StringType, IntType, IntType}, StringType, subStrFunc},
-	"epoch":                 {[]DBType{}, IntType, epoch},
-	"datetimestringtoepoch": {[]DBType{StringType}, IntType, dateTimeToEpoch},
-	"datestringtoepoch":     {[]DBType{StringType}, IntType, dateToEpoch},
-	"epochtodatetimestring": {[]DBType{IntType}, StringType, dateString},
-	"imin":                  {[]DBType{IntType, IntType}, IntType, minFunc},
-	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc},
+	"+": {
+		{[]DBType{IntType, IntType}, IntType, addFunc},
+		{[]DBType{DecimalType, DecimalType}, DecimalType, addDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, addFloatFunc},
+		{[]DBType{DateType, IntervalType}, DateType, addDateIntervalFunc},
+		{[]DBType{TimestampType, IntervalType}, TimestampType, addTimestampIntervalFunc},
+		{[]DBType{IntervalType, IntervalType}, IntervalType, addIntervalFunc},
+	},
+	"-": {
+		{[]DBType{IntType, IntType}, IntType, minusFunc},
+		{[]DBType{DecimalType, DecimalType}, DecimalType, minusDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, minusFloatFunc},
+		{[]DBType{DateType, IntervalType}, DateType, minusDateIntervalFunc},
+		{[]DBType{TimestampType, IntervalType}, TimestampType, minusTimestampIntervalFunc},
+		{[]DBType{IntervalType, IntervalType}, IntervalType, minusIntervalFunc},
+		{[]DBType{DateType, DateType}, IntType, minusDateFunc},
+		{[]DBType{TimestampType, TimestampType}, IntervalType, minusTimestampFunc},
+	},
+	"*": {
+		{[]DBType{IntType, IntType}, IntType, timesFunc},
+		{[]DBType{DecimalType, DecimalType}, DecimalType, timesDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, timesFloatFunc},
+	},
+	"/": {
+		{[]DBType{IntType, IntType}, IntType, divFunc},
+		{[]DBType{DecimalType, DecimalType}, DecimalType, divDecimalFunc},
+		{[]DBType{FloatType, FloatType}, FloatType, divFloatFunc},
+	},
+	"mod":  {{[]DBType{IntType, IntType}, IntType, modFunc}},
+	"rand": {{[]DBType{}, IntType, randIntFunc}},
+	"sq": {
+		{[]DBType{IntType}, IntType, sqFunc},
+		{[]DBType{FloatType}, FloatType, sqFloatFunc},
+	},
+	"float": {
+		{[]DBType{IntType}, FloatType, toFloatFunc},
+		{[]DBType{DecimalType}, FloatType, decimalToFloatFunc},
+	},
+	"decimal": {
+		{[]DBType{IntType}, DecimalType, toDecimalFunc},
+		{[]DBType{FloatType}, DecimalType, floatToDecimalFunc},
+	},
+	"round": {
+		{[]DBType{DecimalType}, IntType, roundDecimalFunc},
+		{[]DBType{FloatType}, IntType, roundFunc},
+	},
+	"date": {
+		{[]DBType{StringType}, DateType, toDateFunc},
+		{[]DBType{TimestampType}, DateType, timestampToDateFunc},
+	},
+	"timestamp": {
+		{[]DBType{StringType}, TimestampType, toTimestampFunc},
+		{[]DBType{DateType}, TimestampType, dateToTimestampFunc},
+	},
+	"date_trunc": {
+		{[]DBType{StringType, DateType}, DateType, truncDateFunc},
+		{[]DBType{StringType, TimestampType}, TimestampType, truncTimestampFunc},
+	},
+	"year":                  {{[]DBType{TimestampType}, IntType, yearFunc}},
+	"month":                 {{[]DBType{TimestampType}, IntType, monthFunc}},
+	"day":                   {{[]DBType{TimestampType}, IntType, dayFunc}},
+	"hour":                  {{[]DBType{TimestampType}, IntType, hourFunc}},
+	"minute":                {{[]DBType{TimestampType}, IntType, minuteFunc}},
+	"second":                {{[]DBType{TimestampType}, IntType, secondFunc}},
+	"getsubstr":             {{[]DBType{StringType, IntType, IntType}, StringType, subStrFunc}},
+	"upper":                 {{[]DBType{StringType}, StringType, upperFunc}},
+	"lower":                 {{[]DBType{StringType}, StringType, lowerFunc}},
+	"length":                {{[]DBType{StringType}, IntType, lengthFunc}},
+	"concat":                {{[]DBType{StringType, StringType}, StringType, concatFunc}},
+	"replace":               {{[]DBType{StringType, StringType, StringType}, StringType, replaceFunc}},
+	"position":              {{[]DBType{StringType, StringType}, IntType, positionFunc}},
+	"starts_with":           {{[]DBType{StringType, StringType}, BoolType, startsWithFunc}},
+	"regexp_match":          {{[]DBType{StringType, StringType}, BoolType, regexpMatchFunc}},
+	"epoch":                 {{[]DBType{}, IntType, epoch}},
+	"datetimestringtoepoch": {{[]DBType{StringType}, IntType, dateTimeToEpoch}},
+	"datestringtoepoch":     {{[]DBType{StringType}, IntType, dateToEpoch}},
+	"epochtodatetimestring": {{[]DBType{IntType}, StringType, dateString}},
+	"imin":                  {{[]DBType{IntType, IntType}, IntType, minFunc}},
+	"imax":                  {{[]DBType{IntType, IntType}, IntType, maxFunc}},
+	"trim": {
+		{[]DBType{StringType}, StringType, trimFunc},
+		{[]DBType{StringType, StringType}, StringType, trimCharsFunc},
+	},
+	"ltrim": {
+		{[]DBType{StringType}, StringType, ltrimFunc},
+		{[]DBType{StringType, StringType}, StringType, ltrimCharsFunc},
+	},
+	"rtrim": {
+		{[]DBType{StringType}, StringType, rtrimFunc},
+		{[]DBType{StringType, StringType}, StringType, rtrimCharsFunc},
+	},
+	"lpad": {
+		{[]DBType{StringType, IntType}, StringType, lpadFunc},
+		{[]DBType{StringType, IntType, StringType}, StringType, lpadFunc},
+	},
+	"rpad": {
+		{[]DBType{StringType, IntType}, StringType, rpadFunc},
+		{[]DBType{StringType, IntType, StringType}, StringType, rpadFunc},
+	},
+}
+
+// Return the overload of the function op that accepts args, preferring one
+// whose argument types match exactly to one that needs values converted to
+// a wider type
+func resolveFunc(op string, args []*Expr) (*FuncType, error) {
+	overloads, exists := funcs[op]
+	if !exists {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", op)}
+	}
+	for _, promote := range []bool{false, true} {
+		for i := range overloads {
+			if overloads[i].accepts(args, promote) {
+				return &overloads[i], nil
+			}
+		}
+	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("no version of function %s takes these arguments; expected %s", op, strings.Join(signatures(op), " or "))}
+}
+
+// Return whether the function takes args, either as they are or, if promote
+// is set, once converted to wider types
+func (fType *FuncType) accepts(args []*Expr, promote bool) bool {
+	if len(fType.argTypes) != len(args) {
+		return false
+	}
+	for j, argType := range fType.argTypes {
+		t := (*args[j]).GetExprType().Ftype
+		if t != argType && !(promote && widens(t, argType)) {
+			return false
+		}
+	}
+	return true
 }
 
+// Return whether an overload of the function op takes args as they are
+func takesExactly(op string, args []*Expr) bool {
+	for i := range funcs[op] {
+		if funcs[op][i].accepts(args, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the argument lists of the overloads of the function op, e.g. "(int,int)"
+func signatures(op string) []string {
+	var sigs []string
+	for _, f := range funcs[op] {
+		names := make([]string, len(f.argTypes))
+		for i, a := range f.argTypes {
+			names[i] = typeNames[a]
+		}
+		sigs = append(sigs, "("+strings.Join(names, ",")+")")
+	}
+	return sigs
+}
+
+// The numeric types, from the narrowest to the widest: ints convert exactly to
+// decimals, and both convert to floats
+var numericRank = map[DBType]int{IntType: 1, DecimalType: 2, FloatType: 3}
+
+// Return whether values of type from may be converted to the wider type to:
+// numbers to wider numbers, and dates to timestamps (of their midnight)
+func widens(from DBType, to DBType) bool {
+	if from == DateType {
+		return to == TimestampType
+	}
+	return numericRank[from] > 0 && numericRank[from] < numericRank[to]
+}
+
+// If a and b are numbers of different types, or a date and a timestamp, return
+// them with the one of the narrower type converted to the type of the other,
+// so that they can be compared or combined; otherwise return them unchanged.
+// The exceptions are constants: a float constant, such as 0.05, combined with
+// a decimal is converted to a decimal, as SQL reads such constants as exact
+// numbers, and a string constant, such as '1995-03-15', combined with a date
+// or a timestamp is read as one.
+func promoteNumeric(a Expr, b Expr) (Expr, Expr) {
+	aType, bType := a.GetExprType().Ftype, b.GetExprType().Ftype
+	_, aConst := a.(*ConstExpr)
+	_, bConst := b.(*ConstExpr)
+	switch {
+	case aType == DecimalType && bType == FloatType && bConst:
+		return a, convertExpr(b, DecimalType)
+	case aType == FloatType && bType == DecimalType && aConst:
+		return convertExpr(a, DecimalType), b
+	case (aType == DateType || aType == TimestampType) && bType == StringType && bConst:
+		return a, convertExpr(b, aType)
+	case (bType == DateType || bType == TimestampType) && aType == StringType && aConst:
+		return convertExpr(a, bType), b
+	case widens(aType, bType):
+		return convertExpr(a, bType), b
+	case widens(bType, aType):
+		return a, convertExpr(b, aType)
+	}
+	return a, b
+}
+
+// Return e converted to t, if e is a value that can be stored in a field of
+// type t (any number in a float, ints and floats in a decimal, and strings
+// and dates in a date or a timestamp), and otherwise e itself
+func convertExpr(e Expr, t DBType) Expr {
+	from := e.GetExprType().Ftype
+	switch {
+	case from == t:
+		return e
+	case (t == FloatType || t == DecimalType) && numericRank[from] > 0,
+		(t == DateType || t == TimestampType) && (from == StringType || from == DateType):
+		return &FuncExpr{typeNames[t], []*Expr{&e}}
+	}
+	return e
+}
+
+// Return the functions and their signatures, one per line, in alphabetical
+// order
 func ListOfFunctions() string {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 	fList := ""
-	for name, f := range funcs {
-		args := "("
-		argList := f.argTypes
-		hasArg := false
-		for _, a := range argList {
-			if hasArg {
-				args = args + ","
-			}
-			switch a {
-			case IntType:
-				args = args + "int"
-			case StringType:
-				args = args + "string"
-			}
-			hasArg = true
+	for _, name := range names {
+		for _, sig := range signatures(name) {
+			fList = fList + "\t" + name + sig + "\n"
 		}
-		args = args + ")"
-		fList = fList + "\t" + name + args + "\n"
 	}
 	return fList
 }
@@ -189,6 +758,157 @@ func addFunc(args []any) any {
 	return args[0].(int64) + args[1].(int64)
 }
 
+func addFloatFunc(args []any) any {
+	return args[0].(float64) + args[1].(float64)
+}
+
+func minusFloatFunc(args []any) any {
+	return args[0].(float64) - args[1].(float64)
+}
+
+func timesFloatFunc(args []any) any {
+	return args[0].(float64) * args[1].(float64)
+}
+
+func divFloatFunc(args []any) any {
+	return args[0].(float64) / args[1].(float64)
+}
+
+func sqFloatFunc(args []any) any {
+	return args[0].(float64) * args[0].(float64)
+}
+
+func toFloatFunc(args []any) any {
+	return float64(args[0].(int64))
+}
+
+func addDecimalFunc(args []any) any {
+	return fieldResult(args[0].(DecimalField).add(args[1].(DecimalField)))
+}
+
+func minusDecimalFunc(args []any) any {
+	return fieldResult(args[0].(DecimalField).sub(args[1].(DecimalField)))
+}
+
+func timesDecimalFunc(args []any) any {
+	return fieldResult(args[0].(DecimalField).mul(args[1].(DecimalField)))
+}
+
+func divDecimalFunc(args []any) any {
+	return fieldResult(args[0].(DecimalField).div(args[1].(DecimalField)))
+}
+
+// Return the value v, or err if it is not nil, as the result of a function
+func fieldResult(v DBValue, err error) any {
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+func toDecimalFunc(args []any) any {
+	return DecimalField{args[0].(int64), 0}
+}
+
+func floatToDecimalFunc(args []any) any {
+	return fieldResult(decimalFromFloat(args[0].(float64)))
+}
+
+func decimalToFloatFunc(args []any) any {
+	return args[0].(DecimalField).float()
+}
+
+func addDateIntervalFunc(args []any) any {
+	return fieldResult(args[0].(DateField).addInterval(args[1].(IntervalField)))
+}
+
+func minusDateIntervalFunc(args []any) any {
+	return fieldResult(args[0].(DateField).addInterval(args[1].(IntervalField).negate()))
+}
+
+func addTimestampIntervalFunc(args []any) any {
+	return args[0].(TimestampField).addInterval(args[1].(IntervalField))
+}
+
+func minusTimestampIntervalFunc(args []any) any {
+	return args[0].(TimestampField).addInterval(args[1].(IntervalField).negate())
+}
+
+func addIntervalFunc(args []any) any {
+	return args[0].(IntervalField).add(args[1].(IntervalField))
+}
+
+func minusIntervalFunc(args []any) any {
+	return args[0].(IntervalField).add(args[1].(IntervalField).negate())
+}
+
+// The number of days from the second date to the first
+func minusDateFunc(args []any) any {
+	return args[0].(DateField).Value - args[1].(DateField).Value
+}
+
+func minusTimestampFunc(args []any) any {
+	return IntervalField{Micros: args[0].(TimestampField).Value - args[1].(TimestampField).Value}
+}
+
+func toDateFunc(args []any) any {
+	return fieldResult(parseDate(args[0].(string)))
+}
+
+func timestampToDateFunc(args []any) any {
+	return dateOf(args[0].(TimestampField).time())
+}
+
+func toTimestampFunc(args []any) any {
+	return fieldResult(parseTimestamp(args[0].(string)))
+}
+
+func dateToTimestampFunc(args []any) any {
+	return timestampOf(args[0].(DateField).time())
+}
+
+func yearFunc(args []any) any {
+	return int64(args[0].(TimestampField).time().Year())
+}
+
+func monthFunc(args []any) any {
+	return int64(args[0].(TimestampField).time().Month())
+}
+
+func dayFunc(args []any) any {
+	return int64(args[0].(TimestampField).time().Day())
+}
+
+func hourFunc(args []any) any {
+	return int64(args[0].(TimestampField).time().Hour())
+}
+
+func minuteFunc(args []any) any {
+	return int64(args[0].(TimestampField).time().Minute())
+}
+
+func secondFunc(args []any) any {
+	return int64(args[0].(TimestampField).time().Second())
+}
+
+func truncDateFunc(args []any) any {
+	t, err := truncTime(args[1].(DateField).time(), args[0].(string))
+	return fieldResult(dateOf(t), err)
+}
+
+func truncTimestampFunc(args []any) any {
+	t, err := truncTime(args[1].(TimestampField).time(), args[0].(string))
+	return fieldResult(timestampOf(t), err)
+}
+
+func roundDecimalFunc(args []any) any {
+	return args[0].(DecimalField).round()
+}
+
+func roundFunc(args []any) any {
+	return int64(math.Round(args[0].(float64)))
+}
+
 func sqFunc(args []any) any {
 	return args[0].(int64) * args[0].(int64)
 }
@@ -210,42 +930,185 @@ func subStrFunc(args []any) any {
 	return substr
 }
 
-func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
-	fType, exists := funcs[f.op]
-	if !exists {
-		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", f.op)}
+// Unlike getsubstr, the string functions below count characters rather than
+// bytes, so that lengths and positions are those of the text
+
+func upperFunc(args []any) any {
+	return strings.ToUpper(args[0].(string))
+}
+
+func lowerFunc(args []any) any {
+	return strings.ToLower(args[0].(string))
+}
+
+func lengthFunc(args []any) any {
+	return int64(utf8.RuneCountInString(args[0].(string)))
+}
+
+func trimFunc(args []any) any {
+	return strings.TrimSpace(args[0].(string))
+}
+
+func ltrimFunc(args []any) any {
+	return strings.TrimLeftFunc(args[0].(string), unicode.IsSpace)
+}
+
+func rtrimFunc(args []any) any {
+	return strings.TrimRightFunc(args[0].(string), unicode.IsSpace)
+}
+
+// trim(s, chars) removes any of the characters of chars, rather than spaces,
+// from both ends of s
+func trimCharsFunc(args []any) any {
+	return strings.Trim(args[0].(string), args[1].(string))
+}
+
+func ltrimCharsFunc(args []any) any {
+	return strings.TrimLeft(args[0].(string), args[1].(string))
+}
+
+func rtrimCharsFunc(args []any) any {
+	return strings.TrimRight(args[0].(string), args[1].(string))
+}
+
+func concatFunc(args []any) any {
+	return args[0].(string) + args[1].(string)
+}
+
+func replaceFunc(args []any) any {
+	return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string))
+}
+
+// position(sub, s) is the position of the first sub in s, counting from 1, or
+// 0 if s doesn't contain sub
+func positionFunc(args []any) any {
+	s := args[1].(string)
+	i := strings.Index(s, args[0].(string))
+	if i < 0 {
+		return int64(0)
+	}
+	return int64(utf8.RuneCountInString(s[:i]) + 1)
+}
+
+func startsWithFunc(args []any) any {
+	return strings.HasPrefix(args[0].(string), args[1].(string))
+}
+
+// Compiled regular expressions, by pattern, so that regexp_match compiles its
+// pattern once rather than once per tuple
+var regexpCache sync.Map
+
+func regexpMatchFunc(args []any) any {
+	pattern := args[1].(string)
+	re, ok := regexpCache.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("malformed regular expression %s: %s", pattern, err)}
+		}
+		re, _ = regexpCache.LoadOrStore(pattern, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(args[0].(string))
+}
+
+// Return s padded to n characters with repetitions of fill (or spaces, if fill
+// is not given), on the left if left is set and otherwise on the right, or
+// cut to its first n characters if it is longer
+func pad(args []any, left bool) any {
+	s := []rune(args[0].(string))
+	n := args[1].(int64)
+	fill := []rune(" ")
+	if len(args) > 2 {
+		fill = []rune(args[2].(string))
+	}
+	if n <= 0 {
+		return ""
+	}
+	if int64(len(s)) >= n {
+		return string(s[:n])
+	}
+	if len(fill) == 0 {
+		return string(s)
+	}
+	padding := make([]rune, n-int64(len(s)))
+	for i := range padding {
+		padding[i] = fill[i%len(fill)]
 	}
-	if len(f.args) != len(fType.argTypes) {
-		return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected %d args", f.op, len(fType.argTypes))}
+	if left {
+		return string(padding) + string(s)
+	}
+	return string(s) + string(padding)
+}
+
+func lpadFunc(args []any) any {
+	return pad(args, true)
+}
+
+func rpadFunc(args []any) any {
+	return pad(args, false)
+}
+
+func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	fType, err := resolveFunc(f.op, f.args)
+	if err != nil {
+		return nil, err
 	}
 	argvals := make([]any, len(fType.argTypes))
 	for i, argType := range fType.argTypes {
 		arg := *f.args[i]
-		if arg.GetExprType().Ftype != argType {
-			typeName := "string"
-			switch argType {
-			case IntType:
-				typeName = "int"
-			}
-			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type %s", f.op, typeName)}
-		}
 		val, err := arg.EvalExpr(t)
 		if err != nil {
 			return nil, err
 		}
+		if isNull(val) {
+			// a function of a missing value is missing
+			return NullField{}, nil
+		}
 		switch argType {
 		case IntType:
 			argvals[i] = val.(IntField).Value
 		case StringType:
 			argvals[i] = val.(StringField).Value
+		case FloatType:
+			switch v := val.(type) {
+			case IntField:
+				argvals[i] = float64(v.Value)
+			case DecimalField:
+				argvals[i] = v.float()
+			default:
+				argvals[i] = val.(FloatField).Value
+			}
+		case DecimalType:
+			if intVal, ok := val.(IntField); ok {
+				argvals[i] = DecimalField{intVal.Value, 0}
+			} else {
+				argvals[i] = val.(DecimalField)
+			}
+		case TimestampType:
+			if dateVal, ok := val.(DateField); ok {
+				argvals[i] = timestampOf(dateVal.time())
+			} else {
+				argvals[i] = val.(TimestampField)
+			}
+		case DateType, IntervalType:
+			argvals[i] = val
 		}
 	}
 	result := fType.f(argvals)
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
 	switch fType.outType {
 	case IntType:
 		return IntField{result.(int64)}, nil
 	case StringType:
 		return StringField{result.(string)}, nil
+	case FloatType:
+		return FloatField{result.(float64)}, nil
+	case BoolType:
+		return BoolField{result.(bool)}, nil
+	case DecimalType, DateType, TimestampType, IntervalType:
+		return result.(DBValue), nil
 	}
 	return nil, GoDBError{ParseError, "unknown result type in function"}
 }
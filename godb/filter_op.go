@@ -15,6 +15,35 @@ func intFilterGetter(v DBValue) int64 {
 	return intV.Value
 }
 
+func floatFilterGetter(v DBValue) float64 {
+	floatV := v.(FloatField)
+	return floatV.Value
+}
+
+// Return the key of a decimal, which is the same for equal decimals of
+// different scales
+func decimalFilterGetter(v DBValue) DecimalField {
+	return v.(DecimalField).normalized()
+}
+
+// Return the value of a date or a timestamp, which are ordered as the numbers
+// of days or microseconds they are stored as
+func temporalFilterGetter(v DBValue) int64 {
+	if d, ok := v.(DateField); ok {
+		return d.Value
+	}
+	return v.(TimestampField).Value
+}
+
+// Return 1 for true and 0 for false, so that booleans are ordered with false
+// before true
+func boolFilterGetter(v DBValue) int64 {
+	if v.(BoolField).Value {
+		return 1
+	}
+	return 0
+}
+
 func stringFilterGetter(v DBValue) string {
 	stringV := v.(StringField)
 	return stringV.Value
@@ -38,6 +67,49 @@ func NewStringFilter(constExpr Expr, op BoolOp, field Expr, child Operator) (*Fi
 	return f, err
 }
 
+// Constructor for a filter operator on floats
+func NewFloatFilter(constExpr Expr, op BoolOp, field Expr, child Operator) (*Filter[float64], error) {
+	if constExpr.GetExprType().Ftype != FloatType || field.GetExprType().Ftype != FloatType {
+		return nil, GoDBError{IncompatibleTypesError, "cannot apply float filter to non float-types"}
+	}
+	f, err := newFilter[float64](constExpr, op, field, child, floatFilterGetter)
+	return f, err
+}
+
+// Construct a filter of the type of field, comparing it with constExpr.
+// Numbers of different types, and dates and timestamps, are converted to the
+// same type, as are strings compared with dates (see [promoteNumeric]).  As
+// decimals aren't ordered by Go's operators, a filter on decimals is a
+// [PredicateFilter] over a [CompareExpr].
+func newTypedFilter(constExpr Expr, op BoolOp, field Expr, child Operator) (Operator, error) {
+	field, constExpr = promoteNumeric(field, constExpr)
+	switch field.GetExprType().Ftype {
+	case DecimalType:
+		pred, err := NewCompareExpr(op, field, constExpr)
+		if err != nil {
+			return nil, err
+		}
+		return NewPredicateFilter(pred, child), nil
+	case IntType:
+		return NewIntFilter(constExpr, op, field, child)
+	case StringType:
+		return NewStringFilter(constExpr, op, field, child)
+	case FloatType:
+		return NewFloatFilter(constExpr, op, field, child)
+	case DateType, TimestampType:
+		if constExpr.GetExprType().Ftype != field.GetExprType().Ftype {
+			return nil, GoDBError{IncompatibleTypesError, "cannot compare values of different types"}
+		}
+		return newFilter[int64](constExpr, op, field, child, temporalFilterGetter)
+	case BoolType:
+		if constExpr.GetExprType().Ftype != BoolType {
+			return nil, GoDBError{IncompatibleTypesError, "cannot compare values of different types"}
+		}
+		return newFilter[int64](constExpr, op, field, child, boolFilterGetter)
+	}
+	return nil, GoDBError{TypeMismatchError, "unsupported type in filter"}
+}
+
 // Getter is a function that reads a value of the desired type
 // from a field of a tuple
 // This allows us to have a generic interface for filters that work
@@ -56,22 +128,73 @@ func (f *Filter[T]) Descriptor() *TupleDesc {
 // the results of the child iterator and return a tuple if it satisfies
 // the predicate.
 // HINT: you can use the evalPred function defined in types.go to compare two values
+//
+// Returns an error if either side can't be evaluated, e.g. if a string
+// compared with a date is not a date.
 func (f *Filter[T]) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
-	opIterator, _ := f.child.Iterator(tid, f.Descriptor())
+	opIterator, err := f.child.Iterator(tid, f.Descriptor())
+	if err != nil {
+		return nil, err
+	}
 	return func() (*Tuple, error) {
 		for {
-			t, _ := opIterator()
-			if t == nil {
-				break
+			t, err := opIterator()
+			if t == nil || err != nil {
+				return nil, err
+			}
+			dbValLeft, err := f.left.EvalExpr(t)
+			if err != nil {
+				return nil, err
+			}
+			dbValRight, err := f.right.EvalExpr(t)
+			if err != nil {
+				return nil, err
+			}
+			if evalNullablePred(dbValLeft, dbValRight, f.getter, f.op) == TruthTrue {
+				return t, nil
+			}
+		}
+	}, nil
+}
+
+// PredicateFilter returns the tuples of its child that satisfy a [Predicate],
+// such as a disjunction or a comparison of two columns, that a [Filter]
+// comparing one expression with another can't express
+type PredicateFilter struct {
+	pred  Predicate
+	child Operator
+}
+
+// Constructor for a filter operator on a predicate
+func NewPredicateFilter(pred Predicate, child Operator) *PredicateFilter {
+	return &PredicateFilter{pred, child}
+}
+
+// Return a TupleDescriptor for this filter op.
+func (f *PredicateFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+// Return an iterator over the tuples of the child for which the predicate is
+// true (and not false or unknown)
+func (f *PredicateFilter) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	childIter, err := f.child.Iterator(tid, f.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := childIter()
+			if t == nil || err != nil {
+				return nil, err
+			}
+			truth, err := f.pred.truth(t)
+			if err != nil {
+				return nil, err
 			}
-			dbValLeft, _ := f.left.EvalExpr(t)
-			dbValRight, _ := f.right.EvalExpr(t)
-			valLeft := f.getter(dbValLeft)
-			valRight := f.getter(dbValRight)
-			if evalPred(valLeft, valRight, f.op) {
+			if truth == TruthTrue {
 				return t, nil
 			}
 		}
-		return nil, nil
 	}, nil
 }
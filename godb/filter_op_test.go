@@ -2,6 +2,8 @@ package godb
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -9,7 +11,7 @@ func TestIntFilter(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeCFTestVars()
 	hf.insertTuple(&t1, tid)
 	hf.insertTuple(&t2, tid)
-	var f FieldType = FieldType{"age", "", IntType}
+	var f FieldType = FieldType{Fname: "age", Ftype: IntType}
 	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -40,7 +42,7 @@ func TestStringFilter(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeCFTestVars()
 	hf.insertTuple(&t1, tid)
 	hf.insertTuple(&t2, tid)
-	var f FieldType = FieldType{"name", "", StringType}
+	var f FieldType = FieldType{Fname: "name", Ftype: StringType}
 	filt, err := NewStringFilter(&ConstExpr{StringField{"sam"}, StringType}, OpEq, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -66,3 +68,323 @@ func TestStringFilter(t *testing.T) {
 		t.Errorf("unexpected number of results")
 	}
 }
+
+func TestPredicateFilter(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeCFTestVars()
+	hf.insertTuple(&t1, tid)
+	hf.insertTuple(&t2, tid)
+	name := &FieldExpr{FieldType{Fname: "name", Ftype: StringType}}
+	age := &FieldExpr{FieldType{Fname: "age", Ftype: IntType}}
+	isSam, err := NewCompareExpr(OpEq, name, &ConstExpr{StringField{"sam"}, StringType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	isOld, err := NewCompareExpr(OpGt, age, &ConstExpr{IntField{100}, IntType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := NewCompareExpr(OpEq, name, age); err == nil {
+		t.Errorf("expected an error comparing a string with an int")
+	}
+	preds := []struct {
+		pred Predicate
+		cnt  int
+	}{
+		{NewOrExpr(isSam, isOld), 2},
+		{NewAndExpr(isSam, isOld), 0},
+		{NewNotExpr(isSam), 1},
+		{NewNotExpr(NewAndExpr(isSam, NewNotExpr(isOld))), 1},
+	}
+	for i, p := range preds {
+		filt := NewPredicateFilter(p.pred, hf)
+		iter, err := filt.Iterator(tid, filt.Descriptor())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			cnt++
+		}
+		if cnt != p.cnt {
+			t.Errorf("predicate %d: expected %d tuples, got %d", i, p.cnt, cnt)
+		}
+	}
+}
+
+func TestWherePredicates(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	checkQueryCounts(t, c, []queryCount{
+		{"select name, age from t where age = 1 or age = 2", 40},
+		{"select name, age from t where not (age < 8)", 40},
+		{"select name, age from t where (age = 1 or age = 2) and name = 'sam'", 40},
+		{"select name, age from t where ((age > 2 and age < 5) or not age <> 9)", 60},
+		{"select name, age from t where 3 < age", 120},
+		{"select name, age from t where age = age", 200},
+		{"select name, age from t where age < age + 1 and age > age", 0},
+		{"select a.age from t a, t b where a.age = b.age and (a.age = 1 or b.age = 2)", 800},
+		{"select a.age from t a, t b where a.age = b.age and a.age < 3 and a.name <> b.name", 0},
+	})
+
+	_, tuples := runQuery(t, c, "delete from t where age = 1 or age = 2")
+	if n := tuples[0].Fields[0].(IntField).Value; n != 40 {
+		t.Errorf("expected 40 deleted rows, got %d", n)
+	}
+	_, tuples = runQuery(t, c, "select age from t")
+	if len(tuples) != 160 {
+		t.Errorf("expected 160 rows after the delete, got %d", len(tuples))
+	}
+}
+
+func TestThreeValuedLogic(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "age", Ftype: IntType}}}
+	tup := &Tuple{Desc: td, Fields: []DBValue{NullField{}}}
+	age := &FieldExpr{td.Fields[0]}
+	isOld, _ := NewCompareExpr(OpGt, age, &ConstExpr{IntField{100}, IntType})
+	alwaysTrue, _ := NewCompareExpr(OpEq, &ConstExpr{IntField{1}, IntType}, &ConstExpr{IntField{1}, IntType})
+	alwaysFalse := NewNotExpr(alwaysTrue)
+	preds := []struct {
+		pred  Predicate
+		truth Truth
+	}{
+		{isOld, TruthUnknown},
+		{NewNotExpr(isOld), TruthUnknown},
+		{NewAndExpr(isOld, alwaysTrue), TruthUnknown},
+		{NewAndExpr(isOld, alwaysFalse), TruthFalse},
+		{NewOrExpr(isOld, alwaysTrue), TruthTrue},
+		{NewOrExpr(alwaysFalse, isOld), TruthUnknown},
+		{NewIsNullExpr(age, false), TruthTrue},
+		{NewIsNullExpr(age, true), TruthFalse},
+		{NewNotExpr(NewIsNullExpr(age, false)), TruthFalse},
+	}
+	for _, p := range preds {
+		truth, err := p.pred.truth(tup)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if truth != p.truth {
+			t.Errorf("%s: expected %d, got %d", exprToStr(p.pred), p.truth, truth)
+		}
+	}
+	if v, _ := isOld.EvalExpr(tup); !isNull(v) {
+		t.Errorf("expected an unknown comparison to evaluate to NULL, got %v", v)
+	}
+}
+
+func TestNullQueries(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 100)
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runQuery(t, c, "insert into t values ('ann', null), ('bob', null), ('cy', 7)")
+	checkQueryCounts(t, c, []queryCount{
+		{"select name from t where age is null", 2},
+		{"select name from t where age is not null", 101},
+		{"select name from t where age > 5", 41},
+		{"select name from t where not (age > 5)", 60},
+		{"select name from t where age > 5 or age is null", 43},
+		{"select name from t where age >= 0 and not (age is null)", 101},
+		{"select name from t where age = 7", 11},
+	})
+
+	// the missing values are sorted last, and read back from disk
+	_, tuples := runQuery(t, c, "select name, age from t order by age")
+	if last := tuples[len(tuples)-1]; !isNull(last.Fields[1]) || last.PrettyPrintString(false) != "bob,NULL" && last.PrettyPrintString(false) != "ann,NULL" {
+		t.Errorf("expected a missing age last, got %v", last.Fields)
+	}
+
+	_, tuples = runQuery(t, c, "update t set age = null where name = 'cy'")
+	if n := tuples[0].Fields[0].(IntField).Value; n != 1 {
+		t.Errorf("expected 1 updated row, got %d", n)
+	}
+	if n := countThroughIndex(t, c, "t_age", 7); n != 10 {
+		t.Errorf("expected the index to find 10 rows with age 7, got %d", n)
+	}
+	_, tuples = runQuery(t, c, "select name from t where age is null")
+	if len(tuples) != 3 {
+		t.Errorf("expected 3 missing ages after the update, got %d", len(tuples))
+	}
+}
+
+func TestFloatQueries(t *testing.T) {
+	c, _ := makeQueryCatalog(t, "p (name string, price float, qty int)\n")
+	runQuery(t, c, "insert into p values ('a', 1.25, 2), ('b', 2.5, 1), ('c', 4, 3), ('d', null, 1)")
+
+	checkQueryCounts(t, c, []queryCount{
+		{"select name from p where price > 2", 2},
+		{"select name from p where price <= 2.5", 2},
+		{"select name from p where price = 4.0", 1},
+		{"select name from p where price * qty >= 2.5", 3},
+		{"select name from p where price is null", 1},
+	})
+
+	checkQueryRows(t, c, "select name, price * (1 - 0.5), price / qty from p order by name", []string{"a,0.625,0.625", "b,1.25,2.5", "c,2,1.3333333333333333", "d,NULL,NULL"})
+
+	_, tuples := runQuery(t, c, "select sum(price), avg(price), min(price), max(price), avg(qty) from p")
+	for i, v := range []DBValue{FloatField{7.75}, FloatField{7.75 / 3}, FloatField{1.25}, FloatField{4}, FloatField{7.0 / 4}} {
+		if tuples[0].Fields[i] != v {
+			t.Errorf("expected %v for aggregate %d, got %v", v, i, tuples[0].Fields[i])
+		}
+	}
+
+	plan, _ := runQuery(t, c, "select p.name, q.name from p, p q where p.price = q.price and p.price > 2")
+	if s := planString(t, plan); !strings.Contains(s, "Hash Join, p.price == q.price") || !strings.Contains(s, "Filter p.price >") || strings.Contains(s, "Unknown op") {
+		t.Errorf("expected a float join and filter in the plan, got\n%s", s)
+	}
+
+	runQuery(t, c, "update p set price = 3 where name = 'd'")
+	_, tuples = runQuery(t, c, "select name from p where price = 3")
+	if len(tuples) != 1 {
+		t.Errorf("expected an int assigned to a float to be stored as a float, got %d matches", len(tuples))
+	}
+
+	if _, _, err := Parse(c, "create table q (x double, y float)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	q, err := c.GetTable("q")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, f := range q.Descriptor().Fields {
+		if f.Ftype != FloatType {
+			t.Errorf("expected double and float columns to be floats, got %v", f)
+		}
+	}
+}
+
+func TestDecimalQueries(t *testing.T) {
+	c, dir := makeQueryCatalog(t, "l (id int, price decimal(15,2), discount numeric(15, 2), qty int)\n")
+	runQuery(t, c, "insert into l values (1, 19.99, 0.05, 2), (2, 0.10, 0, 10), (3, 100.01, 0.1, 1)")
+	csv := dir + "/l.csv"
+	if err := os.WriteFile(csv, []byte("4,,0.02,1\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	f, err := os.Open(csv)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	l, _ := c.GetTable("l")
+	if err := l.(*ColumnFile).LoadFromCSV(f, false, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	checkQueryCounts(t, c, []queryCount{
+		{"select id from l where price > 19.99", 1},
+		{"select id from l where price = 0.1", 1},
+		{"select id from l where price <= 20", 2},
+		{"select id from l where price * qty >= 1", 3},
+		{"select id from l where discount = 0", 1},
+		{"select id from l where price is null", 1},
+	})
+
+	checkQueryRows(t, c, "select id, price * qty, price * (1 - discount), price / 3, price + 0.015 from l order by id", []string{"1,39.98,18.9905,6.66333333,20.005", "2,1.00,0.1000,0.03333333,0.115", "3,100.01,90.0090,33.33666667,100.025", "4,NULL,NULL,NULL,NULL"})
+
+	_, tuples := runQuery(t, c, "select sum(price * (1 - discount)), sum(price), avg(price), min(price), max(price) from l")
+	for i, v := range []string{"109.0995", "120.10", "40.03333333", "0.10", "100.01"} {
+		d, ok := tuples[0].Fields[i].(DecimalField)
+		if !ok || d.String() != v {
+			t.Errorf("expected %s for aggregate %d, got %v", v, i, tuples[0].Fields[i])
+		}
+	}
+
+	runQuery(t, c, "update l set price = 5 where id = 4")
+	_, tuples = runQuery(t, c, "select id from l where price = 5.00")
+	if len(tuples) != 1 {
+		t.Errorf("expected an int assigned to a decimal to be stored as a decimal, got %d matches", len(tuples))
+	}
+
+	// decimals are hash joined, even when both sides are sorted
+	for _, sql := range []string{
+		"select a.id, b.id from l a, l b where a.price = b.discount",
+		"select a.id, b.id from (select id, price from l order by price) a, (select id, price from l order by price) b where a.price = b.price",
+	} {
+		plan, _ := runQuery(t, c, sql)
+		if s := planString(t, plan); !strings.Contains(s, "Hash Join") || strings.Contains(s, "Unknown op") {
+			t.Errorf("expected a decimal hash join in the plan of %s, got\n%s", sql, s)
+		}
+	}
+
+	if _, _, err := Parse(c, "create table q (x decimal(5,2), y numeric, z decimal(5))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	q, err := c.GetTable("q")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, f := range q.Descriptor().Fields {
+		if f.Ftype != DecimalType {
+			t.Errorf("expected decimal and numeric columns to be decimals, got %v", f)
+		}
+	}
+	if _, _, err := Parse(c, "create table r (x decimal(30,2))"); err == nil {
+		t.Errorf("expected an error for a decimal with more than %d digits", maxDecimalDigits)
+	}
+
+	// values are rounded to the scale of their column, and rejected if they
+	// have too many digits before the decimal point, whether inserted,
+	// updated or loaded
+	runQuery(t, c, "insert into q values (10.1, 10.10, 12.5), (10.25, 1, 1)")
+	for _, sql := range []string{"insert into q values (123456.789, 1, 1)", "update q set x = 1000 where z = 13"} {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tid := NewTID()
+		c.bp.BeginTransaction(tid)
+		iter, err := plan.Iterator(tid, plan.Descriptor())
+		if err == nil {
+			_, err = iter()
+		}
+		if err == nil {
+			t.Errorf("expected an error from %s", sql)
+		}
+		c.bp.AbortTransaction(tid)
+	}
+	csv = dir + "/q.csv"
+	if err := os.WriteFile(csv, []byte("123456.789,1,1\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	qf, err := os.Open(csv)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer qf.Close()
+	if err := q.(interface {
+		LoadFromCSV(*os.File, bool, string, bool) error
+	}).LoadFromCSV(qf, false, ",", false); err == nil {
+		t.Errorf("expected an error loading a decimal with too many digits for its column")
+	}
+	// quotients have the scale of their operands' columns, whatever digits
+	// the values have
+	checkQueryRows(t, c, "select x, y, z, x / 3 from q order by x", []string{"10.10,10.1,13,3.36666667", "10.25,1,1,3.41666667"})
+	checkQueryRows(t, c, "select sum(x), avg(x), count(distinct y) from q", []string{"20.35,10.17500000,2"})
+
+	// equal decimals of different scales join and group together
+	checkQueryRows(t, c, "select q1.z, count(*) from q q1 join q q2 on q1.y = q2.x group by q1.z", []string{"13,1"})
+
+	// the precision and scale are kept in the catalog
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	q2, err := c2.GetTable("q")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if fs := q2.Descriptor().Fields; fs[0].Precision != 5 || fs[0].Scale != 2 || fs[1].Precision != 0 || fs[2].Precision != 5 || fs[2].Scale != 0 {
+		t.Errorf("expected decimal(5,2), decimal and decimal(5,0) columns after reloading the catalog, got %v", fs)
+	}
+	if err := queryError(c2, "insert into q values (123456.789, 1, 1)"); err == nil {
+		t.Errorf("expected an error inserting a decimal with too many digits after reloading the catalog")
+	}
+}
@@ -3,13 +3,7 @@ module github.com/srmadden/godb
 go 1.19
 
 require (
-	github.com/bits-and-blooms/bitset v1.8.0
 	github.com/mitchellh/hashstructure/v2 v2.0.2
 	github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1
 )
-
-require (
-	github.com/chzyer/readline v1.5.1 // indirect
-	golang.org/x/sys v0.1.0 // indirect
-)
@@ -3,12 +3,12 @@ package godb
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/mitchellh/hashstructure/v2"
 )
@@ -21,12 +21,24 @@ import (
 type HeapFile struct {
 	// HeapFile should include the fields below;  you may want to add
 	// additional fields
-	numPages int
-	fileName string
-	file     *os.File
-	desc     *TupleDesc
-	bufPool  *BufferPool
-	m        sync.Mutex
+	numPages  int
+	fileName  string
+	file      *os.File
+	desc      *TupleDesc
+	bufPool   *BufferPool
+	indexes   []*BTreeFile // indexes over the file, kept up to date on insert
+	freeSpace *freeSpaceHints
+	m         sync.Mutex
+}
+
+// The free bytes of the pages of a heap file without deleted versions whose
+// space could be reclaimed, so that inserts can skip the pages a tuple doesn't
+// fit on.  The hints are shared by every HeapFile over the same file through
+// the buffer pool, which forgets the pages of transactions that abort (see
+// [BufferPool.freeSpaceOf]).
+type freeSpaceHints struct {
+	free map[int]int
+	m    sync.Mutex
 }
 
 // Create a HeapFile.
@@ -51,11 +63,12 @@ func NewHeapFile(fromFile string, td *TupleDesc, bp *BufferPool) (*HeapFile, err
 	// 	return nil, createFileError
 	// }
 	hp := &HeapFile{
-		numPages: numberOfPages,
-		fileName: fromFile,
-		file:     file,
-		desc:     td,
-		bufPool:  bp,
+		numPages:  numberOfPages,
+		fileName:  fromFile,
+		file:      file,
+		desc:      td,
+		bufPool:   bp,
+		freeSpace: bp.freeSpaceOf(fromFile),
 	}
 	return hp, nil
 }
@@ -69,6 +82,7 @@ func (f *HeapFile) NumPages() int {
 // - hasHeader:  whether or not the CSV file has a header
 // - sep: the character to use to separate fields
 // - skipLastField: if true, the final field is skipped (some TPC datasets include a trailing separator on each line)
+// Empty integer fields are loaded as missing values (NULL).
 // Returns an error if the field cannot be opened or if a line is malformed
 // We provide the implementation of this method, but it won't work until
 // [HeapFile.insertTuple] is implemented
@@ -98,16 +112,73 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 			switch f.Descriptor().Fields[fno].Ftype {
 			case IntType:
 				field = strings.TrimSpace(field)
+				if field == "" {
+					// an empty number is missing
+					newFields = append(newFields, NullField{})
+					continue
+				}
 				floatVal, err := strconv.ParseFloat(field, 64)
 				if err != nil {
 					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to int, tuple %d", field, cnt)}
 				}
 				intValue := int(floatVal)
 				newFields = append(newFields, IntField{int64(intValue)})
-			case StringType:
-				if len(field) > StringLength {
-					field = field[0:StringLength]
+			case FloatType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				floatVal, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to float, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, FloatField{floatVal})
+			case DecimalType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				decimalVal, err := parseDecimal(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to decimal, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, decimalVal)
+			case DateType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				dateVal, err := parseDate(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to date, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, dateVal)
+			case TimestampType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				tsVal, err := parseTimestamp(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to timestamp, tuple %d", field, cnt)}
+				}
+				newFields = append(newFields, tsVal)
+			case BoolType:
+				field = strings.TrimSpace(field)
+				if field == "" {
+					newFields = append(newFields, NullField{})
+					continue
+				}
+				boolVal, err := strconv.ParseBool(field)
+				if err != nil {
+					return GoDBError{TypeMismatchError, fmt.Sprintf("LoadFromCSV: couldn't convert value %s to bool, tuple %d", field, cnt)}
 				}
+				newFields = append(newFields, BoolField{boolVal})
+			case StringType:
 				newFields = append(newFields, StringField{field})
 			}
 		}
@@ -115,7 +186,10 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 		tid := NewTID()
 		bp := f.bufPool
 		bp.BeginTransaction(tid)
-		f.insertTuple(&newT, tid)
+		if err := f.insertTuple(&newT, tid); err != nil {
+			bp.AbortTransaction(tid)
+			return err
+		}
 
 		// hack to force dirty pages to disk
 		// because CommitTransaction may not be implemented
@@ -135,7 +209,9 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 
 		//commit frequently, to avoid all pages in BP being full
 		//todo fix
-		bp.CommitTransaction(tid)
+		if err := bp.CommitTransaction(tid); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -158,11 +234,7 @@ func (f *HeapFile) readPage(pageNo int) (*Page, error) {
 	if numBytes != PageSize || readErr != nil {
 		return nil, readErr
 	}
-	b := new(bytes.Buffer)
-	buf_err := binary.Write(b, binary.LittleEndian, &byteArray)
-	if buf_err != nil {
-		return nil, buf_err
-	}
+	b := bytes.NewBuffer(byteArray)
 	hp := newHeapPage(f.desc, pageNo, f)
 	init_err := hp.initFromBuffer(b)
 	if init_err != nil {
@@ -184,54 +256,245 @@ func (f *HeapFile) readPage(pageNo int) (*Page, error) {
 // rather than directly reading pages itself. For lab 1, you do not need to
 // worry about concurrent transactions modifying the Page or HeapFile.  We will
 // add support for concurrent modifications in lab 3.
+//
+// The tuple is stamped as created by tid, so it only becomes visible to other
+// transactions once tid commits. Slots of full pages that hold tuple versions
+// no snapshot can see anymore are reclaimed on the way.
+//
+// The tuple is added to every index over the file, and the versions reclaimed
+// are removed from them.
 func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
-	// Iterate over the Pages, find a page that is empty
-	numPages := f.NumPages()
-	for i := numPages - 1; i > -1; i-- {
-		p, err := f.bufPool.GetPage(f, i, tid, WritePerm)
+	return f.insertVersion(t, tid, f.bufPool.vacuumHorizon())
+}
+
+// Insert the tuple, reclaiming the versions of full pages deleted at or before
+// horizon
+func (f *HeapFile) insertVersion(t *Tuple, tid TransactionID, horizon int64) error {
+	if err := f.checkInsert(t); err != nil {
+		return err
+	}
+	if err := f.placeVersion(t, tid, horizon); err != nil {
+		return err
+	}
+	return f.index(t, tid)
+}
+
+// Return an error if t can't be stored in the file: if it doesn't have the
+// fields of the file, if a string is longer than the length of its column, if
+// a decimal has too many digits for its column, if it doesn't fit on an empty
+// page, or if its key is too long for an index over the file.  Decimals are
+// rounded to the scale of their column, in a copy of the fields of t.
+func (f *HeapFile) checkInsert(t *Tuple) error {
+	if len(t.Fields) != len(f.desc.Fields) {
+		return GoDBError{TypeMismatchError, "tuple does not have the fields of the file"}
+	}
+	copied := false
+	for i, field := range f.desc.Fields {
+		switch v := t.Fields[i].(type) {
+		case StringField:
+			if field.Length > 0 && utf8.RuneCountInString(v.Value) > field.Length {
+				return GoDBError{IllegalOperationError, fmt.Sprintf("value '%s' is too long for %s varchar(%d)", v.Value, field.Fname, field.Length)}
+			}
+		case DecimalField:
+			fitted, err := v.fitTo(field.Precision, field.Scale)
+			if err != nil {
+				return err
+			}
+			if fitted != v {
+				if !copied {
+					t.Fields = append([]DBValue(nil), t.Fields...)
+					copied = true
+				}
+				t.Fields[i] = fitted
+			}
+		}
+	}
+	if pageSpace(t) > PageSize-heapPageHeaderSize {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("tuple of %d bytes doesn't fit on a page", t.size())}
+	}
+	f.m.Lock()
+	indexes := f.indexes
+	f.m.Unlock()
+	for _, idx := range indexes {
+		if err := idx.checkKeyOf(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The longest varchar(n) that fits on an empty page as the only column of a
+// table, at up to utf8.UTFMax bytes a character
+const maxVarcharLength int = (PageSize - heapPageHeaderSize - slotEntrySize - versionStampSize - 1 - 2) / utf8.UTFMax
+
+// Return an error if a tuple of desc might not fit on an empty page, taking
+// its varchar(n) columns at their longest.  Strings without a length are
+// counted as empty.
+func checkRowSize(desc *TupleDesc) error {
+	size := slotEntrySize + versionStampSize + nullBitmapSize(desc)
+	for _, f := range desc.Fields {
+		size += fieldSize(f.Ftype) + f.Length*utf8.UTFMax
+	}
+	if size > PageSize-heapPageHeaderSize {
+		return GoDBError{ParseError, fmt.Sprintf("rows of the declared column lengths take up to %d bytes, which doesn't fit on a page", size-slotEntrySize-versionStampSize)}
+	}
+	return nil
+}
+
+// Store the tuple in the first page, from the end of the file, with room for
+// it, adding a page if none has room, without adding it to the indexes over
+// the file.  Sets the rid of t.
+func (f *HeapFile) placeVersion(t *Tuple, tid TransactionID, horizon int64) error {
+	// Iterate over the Pages, find a page with room for the tuple
+	for i := f.NumPages() - 1; i > -1; i-- {
+		if !f.mayFit(i, t) {
+			continue
+		}
+		placed, err := f.placeVersionOn(t, tid, horizon, i, -1)
 		if err != nil {
-			// The error is here
-			// I try to get a page from disk and put it in the buffer pool
-			// But all pages are already dirty so I cannot take the page
-			// why though are they all dirty?
-			fmt.Println("Here is the error ", err)
 			return err
 		}
-		var h = (*p).(*heapPage)
-		// If page has size
-		numSlots := h.getNumSlots()
-		usedSlots := len(h.Slots)
-		// Call h.insertTuple to isert tuple to page if it has space
-		if numSlots > usedSlots {
-			_, insertError := h.insertTuple(t)
-			if insertError != nil {
-				return insertError
-			}
+		if placed {
 			return nil
 		}
 	}
-	// acquire a mutex before adding a new page
+	// No page has room so add one, which is empty, so the tuple fits
+	pageNo, err := f.appendPage()
+	if err != nil {
+		return err
+	}
+	if _, err := f.placeVersionOn(t, tid, horizon, pageNo, -1); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Store the tuple at the specified rid, adding pages to the file up to the
+// page of the rid, without adding it to the indexes over the file.  Returns
+// false if the page has no room for the tuple.  A [ColumnFile] uses this to
+// store the fields of a tuple at the same rid in every column.
+func (f *HeapFile) placeVersionAt(t *Tuple, tid TransactionID, horizon int64, rid RecordID) (bool, error) {
+	for f.NumPages() <= rid.pageNo {
+		if _, err := f.appendPage(); err != nil {
+			return false, err
+		}
+	}
+	return f.placeVersionOn(t, tid, horizon, rid.pageNo, rid.slot)
+}
+
+// Store the tuple, stamped as created by tid, in the specified slot of the
+// page, or in any free slot if slot is negative, reclaiming the versions of
+// the page deleted at or before horizon if it is needed.  Returns false if the
+// page has no room for the tuple.
+func (f *HeapFile) placeVersionOn(t *Tuple, tid TransactionID, horizon int64, pageNo int, slot int) (bool, error) {
+	p, err := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
+	if err != nil {
+		return false, err
+	}
+	h := (*p).(*heapPage)
+	stamp := inProgressStamp(tid)
+	place := func() error {
+		if slot < 0 {
+			_, err := h.insertTupleVersion(t, stamp)
+			return err
+		}
+		return h.insertTupleVersionAt(t, slot, stamp)
+	}
+	h.latch.Lock()
+	removed := []*Tuple{}
+	if slot >= 0 && slot < h.getNumSlots() && h.UsedSlots[slot] {
+		removed = h.prune(horizon)
+	}
+	err = place()
+	if isPageFull(err) && len(removed) == 0 && h.hasDeletedVersions() {
+		removed = h.prune(horizon)
+		err = place()
+	}
+	f.noteFreeSpace(h)
+	h.latch.Unlock()
+	if err := f.unindex(removed, tid); err != nil {
+		return false, err
+	}
+	if isPageFull(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Return whether err reports that a page has no room for a tuple
+func isPageFull(err error) bool {
+	e, ok := err.(GoDBError)
+	return ok && e.code == PageFullError
+}
+
+// Physically remove the tuple version at rid, which tid just placed, to undo
+// its insertion before it is indexed
+func (f *HeapFile) removeVersion(rid RecordID, tid TransactionID) error {
+	p, err := f.bufPool.GetPage(f, rid.pageNo, tid, WritePerm)
+	if err != nil {
+		return err
+	}
+	h := (*p).(*heapPage)
+	h.latch.Lock()
+	defer h.latch.Unlock()
+	if err := h.deleteTuple(rid); err != nil {
+		return err
+	}
+	f.noteFreeSpace(h)
+	return nil
+}
+
+// Add an empty page at the end of the file, and return its number.  The page
+// is written out before the file grows, so it only becomes visible to other
+// transactions once it is on disk.
+func (f *HeapFile) appendPage() (int, error) {
 	f.m.Lock()
-	// No empty pages were found so create a new one, insert, and then flush
-	newPage := newHeapPage(f.desc, numPages, f)
-	f.numPages += 1
+	defer f.m.Unlock()
+	newPage := newHeapPage(f.desc, f.numPages, f)
 	var hp Page = newPage
-	newFlushError := f.flushPage(&hp)
-	if newFlushError != nil {
-		f.m.Unlock()
-		return newFlushError
+	if err := f.flushPage(&hp); err != nil {
+		return 0, err
 	}
-	page, getPageError := f.bufPool.GetPage(f, f.numPages-1, tid, WritePerm)
-	if getPageError != nil {
-		return getPageError
+	f.numPages += 1
+	return newPage.pageNo, nil
+}
+
+// Register an index over the file, to be kept up to date as tuples are
+// inserted and reclaimed
+func (f *HeapFile) attachIndex(bf *BTreeFile) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.indexes = append(f.indexes, bf)
+}
+
+// Add a tuple that was just inserted to the indexes over the file
+func (f *HeapFile) index(t *Tuple, tid TransactionID) error {
+	f.m.Lock()
+	indexes := f.indexes
+	f.m.Unlock()
+	for _, idx := range indexes {
+		if err := idx.insertTuple(t, tid); err != nil {
+			return err
+		}
 	}
-	heapPage := (*page).(*heapPage)
-	_, newInserError := heapPage.insertTuple(t)
-	if newInserError != nil {
-		f.m.Unlock()
-		return newInserError
+	return nil
+}
+
+// Remove reclaimed tuple versions from the indexes over the file
+func (f *HeapFile) unindex(removed []*Tuple, tid TransactionID) error {
+	if len(removed) == 0 {
+		return nil
 	}
+	f.m.Lock()
+	indexes := f.indexes
 	f.m.Unlock()
+	for _, idx := range indexes {
+		for _, t := range removed {
+			if err := idx.deleteTuple(t, tid); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -242,8 +505,15 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 // for tuples as they are read via [Iterator].  Note that Rid is an empty interface,
 // so you can supply any object you wish.  You will likely want to identify the
 // heap page and slot within the page that the tuple came from.
+//
+// The tuple is only stamped as deleted by tid, and stays visible to
+// transactions with older snapshots (so it also stays in the indexes over the
+// file until it is reclaimed). If a concurrent transaction already
+// deleted the tuple and committed after tid took its snapshot, tid loses
+// (first-committer-wins) and a SerializationError is returned; the caller
+// should abort tid.
 func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
-	// f.m.Lock()
+	snap := f.bufPool.snapshot(tid)
 	Rid, _ := t.Rid.(RecordID)
 	pageNo := Rid.pageNo
 	p, getPageError := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
@@ -251,10 +521,45 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 		return getPageError
 	}
 	h := (*p).(*heapPage)
-	// call page.deleteTuple
-	h.deleteTuple(Rid)
-	// f.m.Unlock()
-	return nil //replace me
+	h.latch.Lock()
+	defer h.latch.Unlock()
+	f.freeSpace.forget(pageNo)
+	return h.deleteTupleVersion(Rid, snap)
+}
+
+// Return whether t may fit on the page, that is, unless the page is known to
+// have less free space than t needs
+func (f *HeapFile) mayFit(pageNo int, t *Tuple) bool {
+	f.freeSpace.m.Lock()
+	defer f.freeSpace.m.Unlock()
+	free, ok := f.freeSpace.free[pageNo]
+	return !ok || free >= pageSpace(t)
+}
+
+// Record the free space of the page, unless it has deleted versions whose
+// space could be reclaimed.  The caller must hold the page latch.
+func (f *HeapFile) noteFreeSpace(h *heapPage) {
+	if h.hasDeletedVersions() {
+		f.freeSpace.forget(h.pageNo)
+		return
+	}
+	f.freeSpace.m.Lock()
+	defer f.freeSpace.m.Unlock()
+	f.freeSpace.free[h.pageNo] = h.freeSpace()
+}
+
+// Record that the page has no room for another tuple
+func (f *HeapFile) setFull(pageNo int) {
+	f.freeSpace.m.Lock()
+	defer f.freeSpace.m.Unlock()
+	f.freeSpace.free[pageNo] = 0
+}
+
+// Forget the free space of the page, e.g. because it may have changed
+func (hints *freeSpaceHints) forget(pageNo int) {
+	hints.m.Lock()
+	defer hints.m.Unlock()
+	delete(hints.free, pageNo)
 }
 
 // Method to force the specified page back to the backing file at the appropriate
@@ -280,6 +585,9 @@ func (f *HeapFile) flushPage(p *Page) error {
 	if writeError != nil {
 		return writeError
 	}
+	if f.bufPool != nil {
+		f.bufPool.noteWritten(f.pageKey(h.pageNo))
+	}
 	return nil
 }
 
@@ -297,35 +605,81 @@ func (f *HeapFile) Descriptor() *TupleDesc {
 // transactions
 // You should esnure that Tuples returned by this method have their Rid object
 // set appropriate so that [deleteTuple] will work (see additional comments there).
+//
+// The iterator returns the tuples visible to tid's snapshot, and doesn't lock
+// the pages it reads, so readers never wait for writers.
 func (f *HeapFile) Iterator(tid TransactionID, Desc *TupleDesc) (func() (*Tuple, error), error) {
+	snap := f.bufPool.snapshot(tid)
 	currentPage := 0
-	currentSlot := 0
+	tuples := []*Tuple{}
 	return func() (*Tuple, error) {
-		for currentPage < f.NumPages() {
-			p, readPageError := f.bufPool.GetPage(f, currentPage, tid, ReadPerm)
+		for {
+			if len(tuples) > 0 {
+				t := tuples[0]
+				tuples = tuples[1:]
+				return t, nil
+			}
+			if currentPage >= f.NumPages() {
+				return nil, nil
+			}
+			p, readPageError := f.bufPool.GetPage(f, currentPage, tid, SnapshotPerm)
 			if readPageError != nil {
 				return nil, readPageError
 			}
-			h := (*p).(*heapPage)
-			for currentSlot < h.getNumSlots() {
-				t, ok := h.Slots[currentSlot]
-				// If found slot return tuple
-				if ok {
-					currentSlot += 1
-					return t, nil
-				}
-				// Otherwise increment i until you get a slot
-				currentSlot += 1
-			}
-			// If I haven't found anything
+			tuples = (*p).(*heapPage).visibleTuples(snap)
 			currentPage += 1
-			currentSlot = 0
 		}
-		return nil, nil
 	}, nil
 
 }
 
+// Return the tuple stored at rid if it is visible to the snapshot snap of tid,
+// or nil otherwise.  Like [HeapFile.Iterator], doesn't lock the page.
+func (f *HeapFile) fetchTuple(rid RecordID, tid TransactionID, snap snapshot) (*Tuple, error) {
+	if rid.pageNo < 0 {
+		return nil, nil
+	}
+	p, err := f.bufPool.GetPage(f, rid.pageNo, tid, SnapshotPerm)
+	if err != nil {
+		return nil, err
+	}
+	return (*p).(*heapPage).visibleTuple(rid.slot, snap), nil
+}
+
+// Reclaim the slots of deleted tuple versions that no snapshot can see
+// anymore, returning the number of slots freed. Each page is cleaned up in its
+// own transaction, so Vacuum should not be called from within a transaction.
+func (f *HeapFile) Vacuum() (int, error) {
+	return f.vacuum(f.bufPool.vacuumHorizon())
+}
+
+// Reclaim the slots of tuple versions deleted at or before horizon
+func (f *HeapFile) vacuum(horizon int64) (int, error) {
+	cnt := 0
+	for i := 0; i < f.NumPages(); i++ {
+		tid := NewTID()
+		f.bufPool.BeginTransaction(tid)
+		p, err := f.bufPool.GetPage(f, i, tid, WritePerm)
+		if err != nil {
+			f.bufPool.AbortTransaction(tid)
+			return cnt, err
+		}
+		h := (*p).(*heapPage)
+		h.latch.Lock()
+		removed := h.prune(horizon)
+		h.latch.Unlock()
+		if err := f.unindex(removed, tid); err != nil {
+			f.bufPool.AbortTransaction(tid)
+			return cnt, err
+		}
+		cnt += len(removed)
+		if err := f.bufPool.CommitTransaction(tid); err != nil {
+			return cnt, err
+		}
+	}
+	return cnt, nil
+}
+
 // internal strucuture to use as key for a heap page
 type heapHash struct {
 	FileName string
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 )
 
 const TestingFile string = "test.dat"
@@ -206,3 +207,234 @@ func TestHeapFilePageKey(t *testing.T) {
 		}
 	}
 }
+
+// Count the tuples of hf visible to tid
+func countVisible(t *testing.T, hf *HeapFile, tid TransactionID) int {
+	iter, err := hf.Iterator(tid, hf.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return cnt
+		}
+		cnt++
+	}
+}
+
+func TestSnapshotReadDoesNotBlock(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+
+	writer := NewTID()
+	bp.BeginTransaction(writer)
+	hf.insertTuple(&t2, writer)
+
+	reader := NewTID()
+	bp.BeginTransaction(reader)
+	done := make(chan int, 1)
+	go func() {
+		done <- countVisible(t, hf, reader)
+	}()
+	select {
+	case cnt := <-done:
+		if cnt != 1 {
+			t.Errorf("expected reader to see 1 tuple, got %d", cnt)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reader blocked behind writer")
+	}
+	bp.CommitTransaction(reader)
+	bp.CommitTransaction(writer)
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+
+	reader := NewTID()
+	bp.BeginTransaction(reader)
+	if cnt := countVisible(t, hf, reader); cnt != 1 {
+		t.Fatalf("expected 1 tuple, got %d", cnt)
+	}
+
+	writer := NewTID()
+	bp.BeginTransaction(writer)
+	hf.insertTuple(&t2, writer)
+	if cnt := countVisible(t, hf, writer); cnt != 2 {
+		t.Errorf("writer should see its own insert, got %d tuples", cnt)
+	}
+	bp.CommitTransaction(writer)
+
+	if cnt := countVisible(t, hf, reader); cnt != 1 {
+		t.Errorf("insert committed after the snapshot should be invisible, got %d tuples", cnt)
+	}
+	bp.CommitTransaction(reader)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	if cnt := countVisible(t, hf, tid); cnt != 2 {
+		t.Errorf("expected 2 tuples in a new snapshot, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+// Return the first tuple of hf visible to tid
+func firstVisible(t *testing.T, hf *HeapFile, tid TransactionID) *Tuple {
+	iter, _ := hf.Iterator(tid, hf.Descriptor())
+	tup, err := iter()
+	if err != nil || tup == nil {
+		t.Fatalf("expected a tuple (err = %v)", err)
+	}
+	return tup
+}
+
+func TestFirstCommitterWins(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+
+	tid1, tid2 := NewTID(), NewTID()
+	bp.BeginTransaction(tid1)
+	bp.BeginTransaction(tid2)
+	tup1 := firstVisible(t, hf, tid1)
+	tup2 := firstVisible(t, hf, tid2)
+
+	if err := hf.deleteTuple(tup1, tid1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid1)
+
+	err := hf.deleteTuple(tup2, tid2)
+	if gerr, ok := err.(GoDBError); !ok || gerr.code != SerializationError {
+		t.Fatalf("expected SerializationError, got %v", err)
+	}
+	bp.AbortTransaction(tid2)
+}
+
+func TestVacuum(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	hf.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+
+	reader := NewTID()
+	bp.BeginTransaction(reader)
+	countVisible(t, hf, reader)
+
+	deleter := NewTID()
+	bp.BeginTransaction(deleter)
+	if err := hf.deleteTuple(firstVisible(t, hf, deleter), deleter); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(deleter)
+
+	// the reader's snapshot still sees the deleted version
+	if n, err := hf.Vacuum(); err != nil || n != 0 {
+		t.Fatalf("expected nothing to vacuum, got %d (err = %v)", n, err)
+	}
+	if cnt := countVisible(t, hf, reader); cnt != 2 {
+		t.Errorf("expected reader to see 2 tuples, got %d", cnt)
+	}
+	bp.CommitTransaction(reader)
+
+	if n, err := hf.Vacuum(); err != nil || n != 1 {
+		t.Fatalf("expected to vacuum 1 version, got %d (err = %v)", n, err)
+	}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	if cnt := countVisible(t, hf, tid); cnt != 1 {
+		t.Errorf("expected 1 tuple after vacuum, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestCommitTimestampsAcrossBufferPools(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+
+	reader := NewTID()
+	bp.BeginTransaction(reader)
+	if cnt := countVisible(t, hf, reader); cnt != 1 {
+		t.Fatalf("expected 1 tuple, got %d", cnt)
+	}
+	writer := NewTID()
+	bp.BeginTransaction(writer)
+	hf.insertTuple(&t2, writer)
+	bp.CommitTransaction(writer)
+	bp.FlushAllPages()
+
+	// the pages read back by another handle on the file keep their commit
+	// timestamps, so the snapshot taken before the writer committed holds
+	hf2, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cnt := countVisible(t, hf2, reader); cnt != 1 {
+		t.Errorf("expected the reader's snapshot to hold after the pages were written, got %d tuples", cnt)
+	}
+	bp.CommitTransaction(reader)
+
+	deleter := NewTID()
+	bp.BeginTransaction(deleter)
+	if err := hf2.deleteTuple(firstVisible(t, hf2, deleter), deleter); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(deleter)
+	bp.FlushAllPages()
+
+	// a new buffer pool starts counting commits over, and sees the versions
+	// committed by the old one as committed
+	bp2 := NewBufferPool(3)
+	hf3, err := NewHeapFile(TestingFile, &td, bp2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp2.BeginTransaction(tid)
+	tup := firstVisible(t, hf3, tid)
+	if cnt := countVisible(t, hf3, tid); cnt != 1 || !tup.equals(&t2) {
+		t.Errorf("expected only the tuple committed last to be visible to a new buffer pool, got %d tuples", cnt)
+	}
+	bp2.CommitTransaction(tid)
+}
+
+func TestAbortForgetsFreeSpace(t *testing.T) {
+	td, t1, _, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	for i := 0; i < tuplesPerPage(&t1)-1; i++ {
+		hf.insertTuple(&t1, tid)
+	}
+	if hf.mayFit(0, &t1) {
+		t.Fatalf("expected page 0 to be known to be full")
+	}
+	bp.AbortTransaction(tid)
+
+	// the hints are shared with other handles on the file
+	hf2, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !hf2.mayFit(0, &t1) {
+		t.Errorf("expected the free space taken by the aborted inserts to be forgotten")
+	}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	hf2.insertTuple(&t1, tid)
+	bp.CommitTransaction(tid)
+	if hf2.NumPages() != 1 {
+		t.Errorf("expected the tuple to be inserted on page 0, the file has %d pages", hf2.NumPages())
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"unsafe"
+	"sync"
 )
 
 /* HeapPage implements the Page interface for pages of HeapFiles. We have
@@ -14,38 +14,39 @@ interface requires.  You will want to use an interface like what we provide to
 implement the methods of [HeapFile] that insert, delete, and iterate through
 tuples.
 
-In GoDB all tuples are fixed length, which means that given a TupleDesc it is
-possible to figure out how many tuple "slots" fit on a given page.
+Pages are slotted: tuples may be of different lengths, as strings are stored
+at their own length, so a page holds as many tuples as fit in its PageSize
+bytes.  A page begins with a header with a 32 bit integer with the number of
+slots in its slot directory, a second 32 bit integer with the number of used
+slots, and a 64 bit integer with the LSN of the last log record that updated
+the page (see [LogFile]).
 
-In addition, all pages are PageSize bytes.  They begin with a header with a 32
-bit integer with the number of slots (tuples), and a second 32 bit integer with
-the number of used slots.
+The header is followed by the slot directory, which holds, for every slot, the
+offset in the page and the length of its record as 16 bit integers, or two
+zeros if the slot is empty.  The records are stored at the end of the page,
+and the space between them and the slot directory is free.  A record is the
+two 64 bit version stamps of the tuple (see "Tuple versions" below) followed by
+the tuple, as written by [Tuple.writeTo]: a null bitmap, and the fields, where
+strings are written as their length followed by their bytes.
 
-Each tuple occupies the same number of bytes.  You can use the go function
-unsafe.Sizeof() to determine the size in bytes of an object.  So, a GoDB integer
-(represented as an int64) requires unsafe.Sizeof(int64(0)) bytes.  For strings,
-we encode them as byte arrays of StringLength, so they are size
-((int)(unsafe.Sizeof(byte('a')))) * StringLength bytes.  The size in bytes  of a
-tuple is just the sum of the size in bytes of its fields.
-
-Once you have figured out how big a record is, you can determine the number of
-slots on on the page as:
-
-remPageSize = PageSize - 8 // bytes after header
-numSlots = remPageSize / bytesPerTuple //integer division will round down
-
-To serialize a page to a buffer, you can then:
-
-write the number of slots as an int32
-write the number of used slots as an int32
-write the tuples themselves to the buffer
-
-You will follow the inverse process to read pages from a buffer.
+A tuple is only inserted into a page if its record, and its entry in the slot
+directory if it needs a new slot, fit in the free space.  The records are
+packed together again every time the page is written out, so the space of
+deleted tuples is reclaimed then.
 
 Note that to process deletions you will likely delete tuples at a specific
 position (slot) in the heap page.  This means that after a page is read from
-disk, tuples should retain the same slot number. Because GoDB will never evict a
-dirty page, it's OK if tuples are renumbered when they are written back to disk.
+disk, tuples should retain the same slot number, which is why the slot
+directory keeps the slots of deleted tuples.
+
+Tuple versions: to support snapshot isolation, each slot carries the stamp of
+the transaction that created the tuple (xmin) and of the one that deleted it
+(xmax, 0 if the tuple has not been deleted).  While a transaction is running its
+stamps are its id with inProgressFlag set; when it commits, the buffer pool
+replaces them with the transaction's commit timestamp.  Deleting a tuple only
+sets its xmax, so that transactions with older snapshots still see it; the slot
+is reclaimed once no snapshot can see the tuple anymore (see [heapPage.prune]
+and [HeapFile.Vacuum]).
 
 */
 
@@ -56,6 +57,51 @@ type heapPage struct {
 	Desc      *TupleDesc
 	Slots     map[int]*Tuple
 	UsedSlots []bool
+	Xmin      []int64 // creating version stamp of each slot
+	Xmax      []int64 // deleting version stamp of each slot
+	used      int     // bytes taken by the header, slot directory and records
+	lsn       int64
+	latch     sync.RWMutex // protects the slots from concurrent snapshot readers
+}
+
+// size of the page header: number of slots, number of used slots and page LSN
+const heapPageHeaderSize int = 16
+
+// size of the version stamps stored before each tuple
+const versionStampSize int = 16
+
+// size of an entry of the slot directory: the offset and length of a record
+const slotEntrySize int = 4
+
+const (
+	// stamps with this bit set are the ids of running transactions; all other
+	// stamps are commit timestamps
+	inProgressFlag int64 = 1 << 62
+	// commit timestamp of tuples that are visible to every transaction, e.g.,
+	// tuples inserted directly into a page or committed before the buffer
+	// pool was created
+	frozenStamp int64 = 1
+)
+
+// Return the version stamp a running transaction puts on the tuples it creates
+// and deletes
+func inProgressStamp(tid TransactionID) int64 {
+	return inProgressFlag | int64(*tid)
+}
+
+// The snapshot a transaction reads from: it sees the tuple versions committed
+// at or before ts, as well as its own changes, identified by stamp.
+type snapshot struct {
+	ts    int64
+	stamp int64
+}
+
+// Whether a version stamp made by a transaction is visible to the snapshot
+func (s snapshot) sees(stamp int64) bool {
+	if stamp&inProgressFlag != 0 {
+		return stamp == s.stamp
+	}
+	return stamp <= s.ts
 }
 
 // Construct a new heap page
@@ -66,42 +112,91 @@ func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) *heapPage {
 		pageNo: pageNo,
 		Desc:   desc,
 		Slots:  map[int]*Tuple{},
+		used:   heapPageHeaderSize,
 	} //replace me
-	numSlots := heap.getNumSlots()
-	heap.UsedSlots = make([]bool, numSlots)
 	return heap
 }
 
+// Return the number of slots in the slot directory of the page, used or not
 func (h *heapPage) getNumSlots() int {
-	slotSize := 0
-	for i := 0; i < len(h.Desc.Fields); i++ {
-		fieldSize := 0
-		if h.Desc.Fields[i].Ftype == StringType { // is of type StringField
-			fieldSize += ((int)(unsafe.Sizeof(byte('a')))) * StringLength
-		} else { // is of type int
-			fieldSize += (int)(unsafe.Sizeof(int64(0)))
-		}
-		slotSize += fieldSize
-	}
-	remPageSize := PageSize - 8        // bytes after header
-	numSlots := remPageSize / slotSize //integer division will round down
-	return numSlots
+	return len(h.UsedSlots)
+}
+
+// Return the number of free bytes on the page
+func (h *heapPage) freeSpace() int {
+	return PageSize - h.used
 }
 
-// Insert the tuple into a free slot on the page, or return an error if there are
-// no free slots.  Set the tuples rid and return it.
+// Return the number of bytes a tuple takes up on a page when stored in a new
+// slot: its entry in the slot directory, its version stamps and the tuple
+func pageSpace(t *Tuple) int {
+	return slotEntrySize + versionStampSize + t.size()
+}
+
+// Insert the tuple into a free slot on the page, or return an error if there is
+// no room for it.  Set the tuples rid and return it. The tuple is visible to all
+// transactions.
 func (h *heapPage) insertTuple(t *Tuple) (recordID, error) {
-	for j := range h.UsedSlots {
-		if !h.UsedSlots[j] {
-			h.UsedSlots[j] = true
-			rid := RecordID{pageNo: h.pageNo, slot: j}
-			t.Rid = rid
-			h.Slots[j] = t
-			h.setDirty(true)
-			return rid, nil
+	return h.insertTupleVersion(t, frozenStamp)
+}
+
+// Insert the tuple into a free slot on the page, stamped as created by xmin.
+// Empty slots are reused before the slot directory grows.
+func (h *heapPage) insertTupleVersion(t *Tuple, xmin int64) (recordID, error) {
+	slot := len(h.UsedSlots)
+	for j, used := range h.UsedSlots {
+		if !used {
+			slot = j
+			break
 		}
 	}
-	return nil, GoDBError{code: PageFullError, errString: "Page slots are full. Cannot add tuple to page"}
+	if err := h.insertTupleVersionAt(t, slot, xmin); err != nil {
+		return nil, err
+	}
+	return t.Rid, nil
+}
+
+// Insert the tuple into the specified slot, which must be empty, stamped as
+// created by xmin.  The slot directory grows to include the slot if needed.
+// Returns an error if the page has no room for the tuple.
+func (h *heapPage) insertTupleVersionAt(t *Tuple, slot int, xmin int64) error {
+	if slot < len(h.UsedSlots) && h.UsedSlots[slot] {
+		return GoDBError{code: IllegalOperationError, errString: "Slot is already used. Cannot add tuple to it"}
+	}
+	need := versionStampSize + t.size()
+	if slot >= len(h.UsedSlots) {
+		need += (slot + 1 - len(h.UsedSlots)) * slotEntrySize
+	}
+	if need > h.freeSpace() {
+		return GoDBError{code: PageFullError, errString: "Page is full. Cannot add tuple to page"}
+	}
+	for len(h.UsedSlots) <= slot {
+		h.UsedSlots = append(h.UsedSlots, false)
+		h.Xmin = append(h.Xmin, 0)
+		h.Xmax = append(h.Xmax, 0)
+		h.used += slotEntrySize
+	}
+	h.placeTuple(t, slot, xmin, 0)
+	h.setDirty(true)
+	return nil
+}
+
+func (h *heapPage) placeTuple(t *Tuple, slot int, xmin int64, xmax int64) {
+	t.Rid = RecordID{pageNo: h.pageNo, slot: slot}
+	// store a copy, so that inserting the same tuple object twice doesn't
+	// change the rid of the first copy
+	stored := *t
+	h.setSlot(&stored, slot, xmin, xmax)
+}
+
+// Store t in the slot, which must be in the slot directory, without copying it
+func (h *heapPage) setSlot(t *Tuple, slot int, xmin int64, xmax int64) {
+	h.UsedSlots[slot] = true
+	h.Xmin[slot] = xmin
+	h.Xmax[slot] = xmax
+	t.Rid = RecordID{pageNo: h.pageNo, slot: slot}
+	h.Slots[slot] = t
+	h.used += versionStampSize + t.size()
 }
 
 // Delete the tuple in the specified slot number, or return an error if
@@ -113,8 +208,11 @@ func (h *heapPage) deleteTuple(rid recordID) error {
 	}
 	for slot := range h.Slots {
 		if slot == Rid.slot {
+			h.used -= versionStampSize + h.Slots[slot].size()
 			delete(h.Slots, slot)
 			h.UsedSlots[slot] = false
+			h.Xmin[slot] = 0
+			h.Xmax[slot] = 0
 			h.setDirty(true)
 			return nil
 		}
@@ -122,6 +220,117 @@ func (h *heapPage) deleteTuple(rid recordID) error {
 	return GoDBError{code: TupleNotFoundError, errString: "Could not delete tuple with recordId rid"}
 }
 
+// Mark the tuple in the specified slot as deleted by the transaction reading
+// from snap. Following first-committer-wins, returns a SerializationError if
+// another transaction deleted the tuple and committed after snap was taken.
+// The caller must hold the page latch.
+func (h *heapPage) deleteTupleVersion(rid recordID, snap snapshot) error {
+	Rid, ok := rid.(RecordID)
+	if !ok || Rid.slot < 0 || Rid.slot >= len(h.UsedSlots) || !h.UsedSlots[Rid.slot] || !snap.sees(h.Xmin[Rid.slot]) {
+		return GoDBError{code: TupleNotFoundError, errString: "Could not delete tuple with recordId rid"}
+	}
+	xmax := h.Xmax[Rid.slot]
+	switch {
+	case xmax == 0:
+		h.Xmax[Rid.slot] = snap.stamp
+		h.setDirty(true)
+		return nil
+	case snap.sees(xmax):
+		return GoDBError{code: TupleNotFoundError, errString: "Tuple with recordId rid was already deleted"}
+	default:
+		return GoDBError{code: SerializationError, errString: "Tuple was deleted by a concurrent transaction"}
+	}
+}
+
+// Return the tuples of the page that are visible to the snapshot
+func (h *heapPage) visibleTuples(snap snapshot) []*Tuple {
+	h.latch.RLock()
+	defer h.latch.RUnlock()
+	tuples := []*Tuple{}
+	for j := range h.UsedSlots {
+		if h.UsedSlots[j] && snap.sees(h.Xmin[j]) && (h.Xmax[j] == 0 || !snap.sees(h.Xmax[j])) {
+			tuples = append(tuples, h.Slots[j])
+		}
+	}
+	return tuples
+}
+
+// Return the tuple in the specified slot if it is visible to the snapshot, or
+// nil otherwise
+func (h *heapPage) visibleTuple(slot int, snap snapshot) *Tuple {
+	h.latch.RLock()
+	defer h.latch.RUnlock()
+	if slot < 0 || slot >= len(h.UsedSlots) || !h.UsedSlots[slot] {
+		return nil
+	}
+	if !snap.sees(h.Xmin[slot]) || (h.Xmax[slot] != 0 && snap.sees(h.Xmax[slot])) {
+		return nil
+	}
+	return h.Slots[slot]
+}
+
+// Replace the in progress version stamp of a transaction with its commit
+// timestamp.  Returns whether the page held versions of the transaction.
+func (h *heapPage) commitVersions(stamp int64, commitTs int64) bool {
+	h.latch.Lock()
+	defer h.latch.Unlock()
+	found := false
+	for j := range h.UsedSlots {
+		if h.Xmin[j] == stamp {
+			h.Xmin[j] = commitTs
+			found = true
+		}
+		if h.Xmax[j] == stamp {
+			h.Xmax[j] = commitTs
+			found = true
+		}
+	}
+	return found
+}
+
+// Replace the commit timestamps on the page with frozenStamp, so that every
+// snapshot sees the versions as committed, e.g., because they were committed
+// before the buffer pool reading the page was created
+func (h *heapPage) freezeVersions() {
+	h.latch.Lock()
+	defer h.latch.Unlock()
+	for j := range h.UsedSlots {
+		if h.Xmin[j]&inProgressFlag == 0 {
+			h.Xmin[j] = frozenStamp
+		}
+		if h.Xmax[j] != 0 && h.Xmax[j]&inProgressFlag == 0 {
+			h.Xmax[j] = frozenStamp
+		}
+	}
+}
+
+// Free the slots of tuples whose deletion committed at or before horizon, and
+// are therefore invisible to every snapshot.  Returns the tuples removed.  The
+// caller must hold the page latch.
+func (h *heapPage) prune(horizon int64) []*Tuple {
+	removed := []*Tuple{}
+	for j := range h.UsedSlots {
+		xmax := h.Xmax[j]
+		if h.UsedSlots[j] && xmax != 0 && xmax&inProgressFlag == 0 && xmax <= horizon {
+			removed = append(removed, h.Slots[j])
+			h.deleteTuple(RecordID{pageNo: h.pageNo, slot: j})
+		}
+	}
+	return removed
+}
+
+// Return whether some tuple version on the page has been deleted, so that its
+// slot may be reclaimed once the deletion is old enough.  The caller must hold
+// the page latch.
+func (h *heapPage) hasDeletedVersions() bool {
+	for j, used := range h.UsedSlots {
+		if used && h.Xmax[j] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // Page method - return whether or not the page is dirty
 func (h *heapPage) isDirty() bool {
 	return h.Dirty
@@ -139,57 +348,105 @@ func (p *heapPage) getFile() *DBFile {
 	return &file
 }
 
+// Page method - set the LSN of the last log record that updated the page
+func (h *heapPage) setLSN(lsn int64) {
+	h.lsn = lsn
+}
+
+// Page method - return the name of the file the page belongs to and its page
+// number, as recorded in the log
+func (h *heapPage) location() (string, int) {
+	return h.Hfile.fileName, h.pageNo
+}
+
 // Allocate a new bytes.Buffer and write the heap page to it. Returns an error
 // if the write to the the buffer fails. You will likely want to call this from
 // your [HeapFile.flushPage] method.  You should write the page header, using
-// the binary.Write method in LittleEndian order, followed by the tuples of the
-// page, written using the Tuple.writeTo method.
+// LittleEndian order, followed by the slot directory, and the records of the
+// page, from the end of the page, with the tuples written using the
+// Tuple.writeTo method.
 func (h *heapPage) toBuffer() (*bytes.Buffer, error) {
-	// initialize buffer
-	b := new(bytes.Buffer)
-	// write number of slots to buffer
+	h.latch.RLock()
+	defer h.latch.RUnlock()
+	page := make([]byte, PageSize)
 	numberOfSlots := h.getNumSlots()
-	nos_error := binary.Write(b, binary.LittleEndian, (int32)(numberOfSlots))
-	if nos_error != nil {
-		return nil, nos_error
-	}
-	// write number of used slots to buffer
-	numberOfUsedSlots := len(h.Slots)
-	// fmt.Println(numberOfUsedSlots)
-	nous_error := binary.Write(b, binary.LittleEndian, (int32)(numberOfUsedSlots))
-	if nous_error != nil {
-		return nil, nous_error
-	}
-	iter := h.tupleIter()
-	for {
-		tuple, _ := iter()
-		if tuple == nil {
-			break
+	binary.LittleEndian.PutUint32(page, uint32(numberOfSlots))
+	binary.LittleEndian.PutUint32(page[4:], uint32(len(h.Slots)))
+	binary.LittleEndian.PutUint64(page[8:], uint64(h.lsn))
+	directoryEnd := heapPageHeaderSize + numberOfSlots*slotEntrySize
+	// records are written from the end of the page towards the slot directory
+	end := PageSize
+	record := new(bytes.Buffer)
+	for j := 0; j < numberOfSlots; j++ {
+		tuple, ok := h.Slots[j]
+		if !ok {
+			// the directory entry of an empty slot stays zero
+			continue
+		}
+		record.Reset()
+		binary.Write(record, binary.LittleEndian, h.Xmin[j])
+		binary.Write(record, binary.LittleEndian, h.Xmax[j])
+		if err := tuple.writeTo(record); err != nil {
+			return nil, err
 		}
-		tuple_error := tuple.writeTo(b)
-		if tuple_error != nil {
-			return nil, tuple_error
+		end -= record.Len()
+		if end < directoryEnd {
+			return nil, GoDBError{MalformedDataError, "heap page records don't fit on the page"}
 		}
+		copy(page[end:], record.Bytes())
+		entry := page[heapPageHeaderSize+j*slotEntrySize:]
+		binary.LittleEndian.PutUint16(entry, uint16(end))
+		binary.LittleEndian.PutUint16(entry[2:], uint16(record.Len()))
 	}
-	binary.Write(b, binary.LittleEndian, make([]byte, PageSize-b.Len()))
-	return b, nil //replace me
-
+	return bytes.NewBuffer(page), nil
 }
 
 // Read the contents of the HeapPage from the supplied buffer.
 func (h *heapPage) initFromBuffer(buf *bytes.Buffer) error {
-	var numberOfSlots int32
-	var numberOfUsedSlots int32
-	binary.Read(buf, binary.LittleEndian, &numberOfSlots)
-	binary.Read(buf, binary.LittleEndian, &numberOfUsedSlots)
-	for i := 0; i < int(numberOfUsedSlots); i++ {
-		tuple, err := readTupleFrom(buf, h.Desc)
+	page := buf.Next(PageSize)
+	if len(page) < heapPageHeaderSize {
+		return GoDBError{MalformedDataError, "heap page is too short"}
+	}
+	numberOfSlots := int(binary.LittleEndian.Uint32(page))
+	numberOfUsedSlots := int(binary.LittleEndian.Uint32(page[4:]))
+	h.lsn = int64(binary.LittleEndian.Uint64(page[8:]))
+	directoryEnd := heapPageHeaderSize + numberOfSlots*slotEntrySize
+	if directoryEnd > len(page) || numberOfUsedSlots > numberOfSlots {
+		return GoDBError{MalformedDataError, "heap page slot directory is too long"}
+	}
+	h.Slots = make(map[int]*Tuple, numberOfUsedSlots)
+	h.UsedSlots = make([]bool, numberOfSlots)
+	h.Xmin = make([]int64, numberOfSlots)
+	h.Xmax = make([]int64, numberOfSlots)
+	h.used = directoryEnd
+	// allocate the tuples of the page together
+	numFields := len(h.Desc.Fields)
+	tuples := make([]Tuple, numberOfUsedSlots)
+	fields := make([]DBValue, numberOfUsedSlots*numFields)
+	for j := 0; j < numberOfSlots; j++ {
+		entry := page[heapPageHeaderSize+j*slotEntrySize:]
+		offset := int(binary.LittleEndian.Uint16(entry))
+		length := int(binary.LittleEndian.Uint16(entry[2:]))
+		if offset == 0 {
+			// empty slot
+			continue
+		}
+		if offset < directoryEnd || offset+length > len(page) || length < versionStampSize {
+			return GoDBError{MalformedDataError, "heap page record is outside of the page"}
+		}
+		if len(tuples) == 0 {
+			return GoDBError{MalformedDataError, "heap page has more tuples than it claims"}
+		}
+		record := page[offset : offset+length]
+		xmin := int64(binary.LittleEndian.Uint64(record))
+		xmax := int64(binary.LittleEndian.Uint64(record[8:]))
+		tuple := &tuples[0]
+		err := readTupleInto(bytes.NewBuffer(record[versionStampSize:]), h.Desc, tuple, fields[:numFields])
 		if err != nil {
 			return err
 		}
-		rid, _ := h.insertTuple(tuple)
-		h.setDirty(false)
-		tuple.Rid = rid
+		tuples, fields = tuples[1:], fields[numFields:]
+		h.setSlot(tuple, j, xmin, xmax)
 	}
 	return nil
 }
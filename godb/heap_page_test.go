@@ -1,16 +1,25 @@
 package godb
 
 import (
+	"strings"
 	"testing"
 	"unsafe"
 )
 
+// Return the number of copies of tup that fit on an empty heap page
+func tuplesPerPage(tup *Tuple) int {
+	return (PageSize - heapPageHeaderSize) / pageSpace(tup)
+}
+
 func TestInsertHeapPage(t *testing.T) {
 	td, t1, t2, hf, _, _ := makeTestVars()
 	pg := newHeapPage(&td, 0, hf)
-	var expectedSlots = (PageSize - 8) / (StringLength + int(unsafe.Sizeof(int64(0))))
-	if pg.getNumSlots() != expectedSlots {
-		t.Fatalf("Incorrect number of slots, expected %d, got %d", expectedSlots, pg.getNumSlots())
+	// a slot directory entry and the version stamps precede each tuple, and a
+	// one byte null bitmap precedes its fields, with the string stored as
+	// its length followed by its bytes
+	var expectedSlots = (PageSize - heapPageHeaderSize) / (slotEntrySize + versionStampSize + 1 + 2 + len("sam") + int(unsafe.Sizeof(int64(0))))
+	if tuplesPerPage(&t1) != expectedSlots {
+		t.Fatalf("Incorrect number of slots, expected %d, got %d", expectedSlots, tuplesPerPage(&t1))
 	}
 
 	pg.insertTuple(&t1)
@@ -63,7 +72,7 @@ func TestDeleteHeapPage(t *testing.T) {
 func TestHeapPageInsertTuple(t *testing.T) {
 	td, t1, _, hf, _, _ := makeTestVars()
 	page := newHeapPage(&td, 0, hf)
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	for i := 0; i < free; i++ {
 		var addition = Tuple{
@@ -109,7 +118,7 @@ func TestHeapPageInsertTuple(t *testing.T) {
 func TestHeapPageDeleteTuple(t *testing.T) {
 	td, _, _, hf, _, _ := makeTestVars()
 	page := newHeapPage(&td, 0, hf)
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	list := make([]recordID, free)
 	for i := 0; i < free; i++ {
@@ -170,7 +179,7 @@ func TestHeapPageSerialization(t *testing.T) {
 
 	td, _, _, hf, _, _ := makeTestVars()
 	page := newHeapPage(&td, 0, hf)
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
@@ -218,3 +227,51 @@ func TestHeapPageSerialization(t *testing.T) {
 		}
 	}
 }
+
+// strings are stored at their own length, so a page holds fewer long strings,
+// which keep their full value, and slots freed by deletions are reused
+func TestHeapPageVariableLength(t *testing.T) {
+	td, _, _, hf, _, _ := makeTestVars()
+	page := newHeapPage(&td, 0, hf)
+	long := Tuple{Desc: td, Fields: []DBValue{StringField{strings.Repeat("ab", 500)}, IntField{1}}}
+	short := Tuple{Desc: td, Fields: []DBValue{StringField{""}, IntField{2}}}
+	var rids []recordID
+	for {
+		rid, err := page.insertTuple(&long)
+		if err != nil {
+			break
+		}
+		rids = append(rids, rid)
+	}
+	if len(rids) != tuplesPerPage(&long) {
+		t.Fatalf("expected %d long tuples on a page, got %d", tuplesPerPage(&long), len(rids))
+	}
+	if _, err := page.insertTuple(&short); err != nil {
+		t.Fatalf("expected a short tuple to fit in the space left, got %v", err)
+	}
+	page.deleteTuple(rids[1])
+	rid, err := page.insertTuple(&long)
+	if err != nil || rid != rids[1] {
+		t.Fatalf("expected the slot of the deleted tuple to be reused, got %v (%v)", rid, err)
+	}
+
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if buf.Len() != PageSize {
+		t.Fatalf("expected a page of %d bytes, got %d", PageSize, buf.Len())
+	}
+	page2 := newHeapPage(&td, 0, hf)
+	if err := page2.initFromBuffer(buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page2.getNumSlots() != page.getNumSlots() || page2.freeSpace() != page.freeSpace() {
+		t.Fatalf("expected the page to read back with %d slots and %d free bytes, got %d and %d", page.getNumSlots(), page.freeSpace(), page2.getNumSlots(), page2.freeSpace())
+	}
+	for slot, tup := range page.Slots {
+		if !tup.equals(page2.Slots[slot]) {
+			t.Errorf("expected %v in slot %d, got %v", tup.Fields, slot, page2.Slots[slot])
+		}
+	}
+}
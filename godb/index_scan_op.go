@@ -0,0 +1,73 @@
+package godb
+
+import "fmt"
+
+// IndexScan returns the tuples of a table whose key falls in a range, in key
+// order, by scanning a [BTreeFile] over the table.  The planner uses it in
+// place of a scan of the table and a [Filter] when a query compares an indexed
+// column to a constant.
+type IndexScan struct {
+	name        string // name of the index, for EXPLAIN
+	index       *BTreeFile
+	table       DBFile
+	lo, hi      DBValue // bounds of the range; nil if the range is unbounded
+	loInclusive bool
+	hiInclusive bool
+}
+
+// Construct an index scan over the tuples of table with keys between lo and
+// hi.  A nil bound leaves that end of the range open.  Returns an error if a
+// bound is not of the type of the key.
+func NewIndexScan(name string, index *BTreeFile, table DBFile, lo DBValue, loInclusive bool, hi DBValue, hiInclusive bool) (*IndexScan, error) {
+	for _, bound := range []DBValue{lo, hi} {
+		if bound != nil && !index.checkKey(bound) {
+			return nil, GoDBError{TypeMismatchError, "index scan bound does not match the type of the key"}
+		}
+	}
+	return &IndexScan{name, index, table, lo, hi, loInclusive, hiInclusive}, nil
+}
+
+// Return the TupleDesc of the scanned table
+func (s *IndexScan) Descriptor() *TupleDesc {
+	return s.table.Descriptor()
+}
+
+// Iterate over the tuples in the range, as seen by the snapshot of tid
+func (s *IndexScan) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	return s.index.RangeIterator(tid, s.lo, s.loInclusive, s.hi, s.hiInclusive)
+}
+
+// Describe the range of the scan, e.g. "10 <= age < 20"
+func (s *IndexScan) rangeString() string {
+	key := s.index.keyField.Fname
+	if s.lo != nil && s.hi != nil && s.loInclusive && s.hiInclusive && compareKeys(s.lo, s.hi) == 0 {
+		return fmt.Sprintf("%s = %s", key, keyString(s.lo))
+	}
+	str := key
+	if s.lo != nil {
+		op := "<"
+		if s.loInclusive {
+			op = "<="
+		}
+		str = fmt.Sprintf("%s %s %s", keyString(s.lo), op, str)
+	}
+	if s.hi != nil {
+		op := "<"
+		if s.hiInclusive {
+			op = "<="
+		}
+		str = fmt.Sprintf("%s %s %s", str, op, keyString(s.hi))
+	}
+	return str
+}
+
+// Format a key as it would be written in a query
+func keyString(v DBValue) string {
+	switch k := v.(type) {
+	case IntField:
+		return fmt.Sprintf("%d", k.Value)
+	case StringField:
+		return fmt.Sprintf("'%s'", k.Value)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,195 @@
+package godb
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// Return the operator at the bottom of a plan made of projections and filters
+func planLeaf(op Operator) Operator {
+	for {
+		switch o := op.(type) {
+		case *Project:
+			op = o.child
+		case *Filter[int64]:
+			op = o.child
+		case *Filter[string]:
+			op = o.child
+		default:
+			return op
+		}
+	}
+}
+
+func runQuery(t *testing.T, c *Catalog, sql string) (Operator, []*Tuple) {
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %s", sql, err.Error())
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	defer c.bp.CommitTransaction(tid)
+	iter, err := plan.Iterator(tid, plan.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var tuples []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return plan, tuples
+		}
+		tuples = append(tuples, tup)
+	}
+}
+
+// Return the error of planning or running sql, if there is one
+func queryError(c *Catalog, sql string) error {
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		return err
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	defer c.bp.CommitTransaction(tid)
+	iter, err := plan.Iterator(tid, plan.Descriptor())
+	if err != nil {
+		return err
+	}
+	for {
+		tup, err := iter()
+		if tup == nil || err != nil {
+			return err
+		}
+	}
+}
+
+// Create a catalog in a new directory with the tables of the supplied catalog
+// file contents, returning it and the directory
+func makeQueryCatalog(t *testing.T, catalog string) (*Catalog, string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/catalog.txt", []byte(catalog), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return c, dir
+}
+
+// A query and the number of tuples it returns
+type queryCount struct {
+	sql string
+	cnt int
+}
+
+// Check that each query returns its number of tuples
+func checkQueryCounts(t *testing.T, c *Catalog, queries []queryCount) {
+	for _, q := range queries {
+		_, tuples := runQuery(t, c, q.sql)
+		if len(tuples) != q.cnt {
+			t.Errorf("expected %d tuples from %s, got %d", q.cnt, q.sql, len(tuples))
+		}
+	}
+}
+
+// Check that sql returns the expected rows, each printed as comma separated
+// values
+func checkQueryRows(t *testing.T, c *Catalog, sql string, expected []string) {
+	_, tuples := runQuery(t, c, sql)
+	if len(tuples) != len(expected) {
+		t.Errorf("expected %d rows from %s, got %d", len(expected), sql, len(tuples))
+		return
+	}
+	for i, tup := range tuples {
+		if s := tup.PrettyPrintString(false); s != expected[i] {
+			t.Errorf("expected %s in row %d of %s, got %s", expected[i], i, sql, s)
+		}
+	}
+}
+
+// Return the output of PrintPhysicalPlan for plan
+func planString(t *testing.T, plan Operator) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	PrintPhysicalPlan(plan, "")
+	os.Stdout = stdout
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return string(out)
+}
+
+func TestIndexScanChosen(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	plan, tuples := runQuery(t, c, "select name, age from t where age = 3")
+	if _, ok := planLeaf(plan).(*ColumnFile); !ok {
+		t.Errorf("expected a heap scan without an index, got %T", planLeaf(plan))
+	}
+	if len(tuples) != 20 {
+		t.Errorf("expected 20 tuples with age 3, got %d", len(tuples))
+	}
+
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	plan, tuples = runQuery(t, c, "select name, age from t where age = 3")
+	scan, ok := planLeaf(plan).(*IndexScan)
+	if !ok {
+		t.Fatalf("expected an index scan, got %T", planLeaf(plan))
+	}
+	if scan.rangeString() != "age = 3" {
+		t.Errorf("unexpected index scan range %s", scan.rangeString())
+	}
+	if len(tuples) != 20 {
+		t.Errorf("expected 20 tuples with age 3 through the index, got %d", len(tuples))
+	}
+}
+
+func TestIndexScanRange(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	plan, tuples := runQuery(t, c, "select age from t where age >= 2 and age < 5 and name = 'sam'")
+	scan, ok := planLeaf(plan).(*IndexScan)
+	if !ok {
+		t.Fatalf("expected an index scan, got %T", planLeaf(plan))
+	}
+	if scan.rangeString() != "2 <= age < 5" {
+		t.Errorf("unexpected index scan range %s", scan.rangeString())
+	}
+	// the filter on name stays above the scan
+	if _, ok := plan.(*Project).child.(*Filter[string]); !ok {
+		t.Errorf("expected a filter on name above the index scan")
+	}
+	if len(tuples) != 60 {
+		t.Errorf("expected 60 tuples with 2 <= age < 5, got %d", len(tuples))
+	}
+	for i, tup := range tuples {
+		age := tup.Fields[0].(IntField).Value
+		if age < 2 || age >= 5 || (i > 0 && tuples[i-1].Fields[0].(IntField).Value > age) {
+			t.Fatalf("unexpected tuple with age %d", age)
+		}
+	}
+
+	// an equality predicate is preferred over a range
+	plan, tuples = runQuery(t, c, "select age from t where age > 1 and age = 7")
+	if scan := planLeaf(plan).(*IndexScan); scan.rangeString() != "age = 7" {
+		t.Errorf("expected the equality predicate to be used, got %s", scan.rangeString())
+	}
+	if len(tuples) != 20 {
+		t.Errorf("expected 20 tuples with age 7, got %d", len(tuples))
+	}
+}
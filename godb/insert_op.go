@@ -14,7 +14,7 @@ func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
 
 // The insert TupleDesc is a one column descriptor with an integer field named "count"
 func (i *InsertOp) Descriptor() *TupleDesc {
-	ft := FieldType{"count", "", IntType}
+	ft := FieldType{Fname: "count", Ftype: IntType}
 	fts := []FieldType{ft}
 	td := TupleDesc{}
 	td.Fields = fts
@@ -27,15 +27,30 @@ func (i *InsertOp) Descriptor() *TupleDesc {
 // were inserted.  Tuples should be inserted using the [DBFile.insertTuple]
 // method.
 func (iop *InsertOp) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
-	iterator, _ := iop.child.Iterator(tid, iop.Descriptor())
+	iterator, err := iop.child.Iterator(tid, iop.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
 	count := 0
+	done := false
 	return func() (*Tuple, error) {
+		// the count is returned once, after which the iterator is exhausted
+		if done {
+			return nil, nil
+		}
+		done = true
 		for {
 			t, _ := iterator()
 			if t == nil {
 				break
 			}
-			iop.file.insertTuple(t, tid)
+			// store the tuple under the descriptor of the file, as the
+			// names and types the child gives its fields (such as those
+			// of the constants of an insert ... values) may differ
+			err := iop.file.insertTuple(&Tuple{Desc: *iop.file.Descriptor(), Fields: t.Fields}, tid)
+			if err != nil {
+				return nil, err
+			}
 			count += 1
 		}
 		return &Tuple{Desc: *iop.Descriptor(), Fields: []DBValue{IntField{Value: int64(count)}}}, nil
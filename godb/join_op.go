@@ -1,5 +1,24 @@
 package godb
 
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// The kinds of equality join.  Besides the matching pairs of tuples, an outer
+// join returns each tuple of its left input (LeftOuterJoin), right input
+// (RightOuterJoin) or both inputs (FullOuterJoin) that matches no tuple of the
+// other input, padded with missing values ([NullField]s) in place of the
+// fields of the other input.
+type JoinType int
+
+const (
+	InnerJoin JoinType = iota
+	LeftOuterJoin
+	RightOuterJoin
+	FullOuterJoin
+)
+
 type EqualityJoin[T comparable] struct {
 	// Expressions that when applied to tuples from the left or right operators,
 	// respectively, return the value of the left or right side of the join
@@ -11,14 +30,29 @@ type EqualityJoin[T comparable] struct {
 	// one of intFilterGetter or stringFilterGetter
 	getter func(DBValue) T
 
-	// The maximum number of records of intermediate state that the join should use
-	// (only required for optional exercise)
+	// The maximum number of records of intermediate state that the join should
+	// keep in memory; larger inputs are partitioned to disk
 	maxBufferSize int
+
+	joinType JoinType
+
+	// Directory the partitions of inputs that don't fit in memory are written
+	// to, and the buffer pool that removes any partitions left over when the
+	// transaction running the join ends; if bufPool is nil, partitions are
+	// written to the default directory for temporary files
+	dir     string
+	bufPool *BufferPool
 }
 
 // Constructor for a  join of integer expressions
 // Returns an error if either the left or right expression is not an integer
 func NewIntJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int) (*EqualityJoin[int64], error) {
+	return NewIntOuterJoin(left, leftField, right, rightField, maxBufferSize, InnerJoin)
+}
+
+// Constructor for a join of integer expressions of the given type
+// Returns an error if either the left or right expression is not an integer
+func NewIntOuterJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int, joinType JoinType) (*EqualityJoin[int64], error) {
 	if leftField.GetExprType().Ftype != rightField.GetExprType().Ftype {
 		return nil, GoDBError{TypeMismatchError, "can't join fields of different types"}
 	}
@@ -26,7 +60,7 @@ func NewIntJoin(left Operator, leftField Expr, right Operator, rightField Expr,
 	case StringType:
 		return nil, GoDBError{TypeMismatchError, "join field is not an int"}
 	case IntType:
-		return &EqualityJoin[int64]{leftField, rightField, &left, &right, intFilterGetter, maxBufferSize}, nil
+		return &EqualityJoin[int64]{leftField, rightField, &left, &right, intFilterGetter, maxBufferSize, joinType, "", nil}, nil
 	}
 	return nil, GoDBError{TypeMismatchError, "unknown type"}
 }
@@ -34,19 +68,61 @@ func NewIntJoin(left Operator, leftField Expr, right Operator, rightField Expr,
 // Constructor for a  join of string expressions
 // Returns an error if either the left or right expression is not a string
 func NewStringJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int) (*EqualityJoin[string], error) {
+	return NewStringOuterJoin(left, leftField, right, rightField, maxBufferSize, InnerJoin)
+}
 
+// Constructor for a join of string expressions of the given type
+// Returns an error if either the left or right expression is not a string
+func NewStringOuterJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int, joinType JoinType) (*EqualityJoin[string], error) {
 	if leftField.GetExprType().Ftype != rightField.GetExprType().Ftype {
 		return nil, GoDBError{TypeMismatchError, "can't join fields of different types"}
 	}
 	switch leftField.GetExprType().Ftype {
 	case StringType:
-		return &EqualityJoin[string]{leftField, rightField, &left, &right, stringFilterGetter, maxBufferSize}, nil
+		return &EqualityJoin[string]{leftField, rightField, &left, &right, stringFilterGetter, maxBufferSize, joinType, "", nil}, nil
 	case IntType:
 		return nil, GoDBError{TypeMismatchError, "join field is not a string"}
 	}
 	return nil, GoDBError{TypeMismatchError, "unknown type"}
 }
 
+// Constructor for a join of floating point expressions of the given type
+// Returns an error if either the left or right expression is not a float
+func NewFloatOuterJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int, joinType JoinType) (*EqualityJoin[float64], error) {
+	if leftField.GetExprType().Ftype != FloatType || rightField.GetExprType().Ftype != FloatType {
+		return nil, GoDBError{TypeMismatchError, "join field is not a float"}
+	}
+	return &EqualityJoin[float64]{leftField, rightField, &left, &right, floatFilterGetter, maxBufferSize, joinType, "", nil}, nil
+}
+
+// Constructor for a join of decimal expressions of the given type
+// Returns an error if either the left or right expression is not a decimal
+func NewDecimalOuterJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int, joinType JoinType) (*EqualityJoin[DecimalField], error) {
+	if leftField.GetExprType().Ftype != DecimalType || rightField.GetExprType().Ftype != DecimalType {
+		return nil, GoDBError{TypeMismatchError, "join field is not a decimal"}
+	}
+	return &EqualityJoin[DecimalField]{leftField, rightField, &left, &right, decimalFilterGetter, maxBufferSize, joinType, "", nil}, nil
+}
+
+// Constructor for a join of two date or two timestamp expressions of the given
+// type.  Returns an error if the left and right expressions are not both dates
+// or both timestamps.
+func NewTemporalOuterJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferSize int, joinType JoinType) (*EqualityJoin[int64], error) {
+	t := leftField.GetExprType().Ftype
+	if (t != DateType && t != TimestampType) || rightField.GetExprType().Ftype != t {
+		return nil, GoDBError{TypeMismatchError, "join fields are not both dates or both timestamps"}
+	}
+	return &EqualityJoin[int64]{leftField, rightField, &left, &right, temporalFilterGetter, maxBufferSize, joinType, "", nil}, nil
+}
+
+// Write the partitions of the join to dir, and remove any that are left when
+// the transaction running the join ends, e.g. because it stopped reading the
+// join's results, through bp
+func (hj *EqualityJoin[T]) spillTo(dir string, bp *BufferPool) {
+	hj.dir = dir
+	hj.bufPool = bp
+}
+
 // Return a TupleDescriptor for this join. The returned descriptor should contain
 // the union of the fields in the descriptors of the left and right operators.
 // HINT: use the merge function you implemented for TupleDesc in lab1
@@ -56,50 +132,418 @@ func (hj *EqualityJoin[T]) Descriptor() *TupleDesc {
 	return leftDesc.merge(rightDesc)
 }
 
-// Join operator implementation.  This function should iterate over the results
-// of the join. The join should be the result of joining joinOp.left and
-// joinOp.right, applying the joinOp.leftField and joinOp.rightField expressions
-// to the tuples of the left and right iterators respectively, and joining them
-// using an equality predicate.
-// HINT: When implementing the simple nested loop join, you should keep in mind that
-// you only iterate through the left iterator once (outer loop) but iterate through the right iterator
-// once for every tuple in the the left iterator (inner loop).
-// HINT: You can use joinTuples function you implemented in lab1 to join two tuples.
+// Join operator implementation.  This function iterates over the results of
+// joining joinOp.left and joinOp.right, applying the joinOp.leftField and
+// joinOp.rightField expressions to the tuples of the left and right iterators
+// respectively, and joining them using an equality predicate.
+//
+// The join is a hash join that keeps at most maxBufferSize tuples in memory.
+// The two inputs are read in turn until one of them runs out; that input is
+// the smaller one, and a hash table is built over it and probed with the
+// other.  If neither input runs out before maxBufferSize tuples have been
+// read, both inputs are partitioned on the join key into [spillFile]s, and
+// each pair of partitions is joined in the same way (a grace hash join).
+// Partitions that still don't fit after a few rounds of partitioning, because
+// too many tuples share a key, are joined with a block nested loops join.
 //
-// OPTIONAL EXERCISE:  the operator implementation should not use more than
-// maxBufferSize records, and should pass the testBigJoin test without timing
-// out.  To pass this test, you will need to use something other than a nested
-// loops join.
+// Tuples whose join key is missing match nothing; an outer join returns them
+// padded like any other unmatched tuple.
 func (joinOp *EqualityJoin[T]) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
-	leftIteratorPtr := *(joinOp.left)
-	leftIterator, _ := leftIteratorPtr.Iterator(tid, leftIteratorPtr.Descriptor())
-	rightIteratorPtr := *(joinOp.right)
-	rightIterator, _ := rightIteratorPtr.Iterator(tid, rightIteratorPtr.Descriptor())
-	leftTuple, _ := leftIterator()
+	leftOp := *joinOp.left
+	leftIterator, err := leftOp.Iterator(tid, leftOp.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	rightOp := *joinOp.right
+	rightIterator, err := rightOp.Iterator(tid, rightOp.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return joinOp.hashJoin(leftIterator, rightIterator, tid, 0)
+}
+
+// number of partitions each input is split into when the inputs of a join
+// don't fit in memory
+const joinPartitions int = 32
+
+// number of times a join partition is repartitioned before falling back to a
+// block nested loops join
+const maxJoinDepth int = 3
+
+// Return the number of tuples the join may buffer
+func (joinOp *EqualityJoin[T]) budget() int {
+	if joinOp.maxBufferSize < 2 {
+		return 2
+	}
+	return joinOp.maxBufferSize
+}
+
+// Return true if the join returns the unmatched tuples of the left (or right)
+// input
+func (joinOp *EqualityJoin[T]) preserves(left bool) bool {
+	if left {
+		return joinOp.joinType == LeftOuterJoin || joinOp.joinType == FullOuterJoin
+	}
+	return joinOp.joinType == RightOuterJoin || joinOp.joinType == FullOuterJoin
+}
+
+// Return the join key of a tuple from the left (or right) input.  If the key
+// is missing, the returned value is a [NullField] and the key is the zero
+// value.
+func (joinOp *EqualityJoin[T]) key(t *Tuple, left bool) (T, DBValue, error) {
+	field := joinOp.rightField
+	if left {
+		field = joinOp.leftField
+	}
+	var zero T
+	v, err := field.EvalExpr(t)
+	if err != nil {
+		return zero, nil, err
+	}
+	if isNull(v) {
+		return zero, v, nil
+	}
+	return joinOp.getter(v), v, nil
+}
+
+// Return a tuple of missing values in place of a tuple of the left (or right)
+// input
+func (joinOp *EqualityJoin[T]) nullInput(left bool) *Tuple {
+	if left {
+		return nullTuple((*joinOp.left).Descriptor())
+	}
+	return nullTuple((*joinOp.right).Descriptor())
+}
+
+// Join the tuples returned by the left and right iterators, partitioning them
+// at the given depth if neither fits in memory
+func (joinOp *EqualityJoin[T]) hashJoin(left, right func() (*Tuple, error), tid TransactionID, depth int) (func() (*Tuple, error), error) {
+	var leftBuf, rightBuf []*Tuple
+	for len(leftBuf)+len(rightBuf) < joinOp.budget() {
+		t, err := left()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return joinOp.probe(leftBuf, true, rightBuf, right, nil)
+		}
+		leftBuf = append(leftBuf, t)
+		t, err = right()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return joinOp.probe(rightBuf, false, leftBuf, left, nil)
+		}
+		rightBuf = append(rightBuf, t)
+	}
+	return joinOp.partitionJoin(leftBuf, left, rightBuf, right, tid, depth)
+}
+
+// Build a hash table over build (the tuples of the left input if buildLeft is
+// set, otherwise of the right input) and probe it with the tuples of the other
+// input: first the ones in probeBuf, then the rest of probeIter.
+//
+// If the join preserves the build input, its unmatched tuples are returned
+// padded once the probe input is exhausted.  If the join preserves the probe
+// input, its unmatched tuples are returned padded as they are read, unless
+// probeMatched is not nil; it is then up to the caller to pad them, and the
+// ith entry of probeMatched is set if the ith probe tuple matched.
+func (joinOp *EqualityJoin[T]) probe(build []*Tuple, buildLeft bool, probeBuf []*Tuple, probeIter func() (*Tuple, error), probeMatched []bool) (func() (*Tuple, error), error) {
+	table := make(map[T][]int)
+	for i, t := range build {
+		k, v, err := joinOp.key(t, buildLeft)
+		if err != nil {
+			return nil, err
+		}
+		if !isNull(v) {
+			table[k] = append(table[k], i)
+		}
+	}
+	var buildMatched []bool
+	if joinOp.preserves(buildLeft) {
+		buildMatched = make([]bool, len(build))
+	}
+	padProbe := joinOp.preserves(!buildLeft) && probeMatched == nil
+	nullBuild, nullProbe := joinOp.nullInput(buildLeft), joinOp.nullInput(!buildLeft)
+	join := func(buildTuple, probeTuple *Tuple) *Tuple {
+		if buildLeft {
+			return joinTuples(buildTuple, probeTuple)
+		}
+		return joinTuples(probeTuple, buildTuple)
+	}
+
+	var probeTuple *Tuple
+	var matches []int
+	seq := -1
+	probeDone := false
+	unmatched := 0 // the next build tuple to check for a match once probing is done
+	return func() (*Tuple, error) {
+		for len(matches) == 0 {
+			if probeDone {
+				for unmatched < len(buildMatched) {
+					unmatched++
+					if !buildMatched[unmatched-1] {
+						return join(build[unmatched-1], nullProbe), nil
+					}
+				}
+				return nil, nil
+			}
+			if len(probeBuf) > 0 {
+				probeTuple, probeBuf = probeBuf[0], probeBuf[1:]
+			} else {
+				t, err := probeIter()
+				if err != nil {
+					return nil, err
+				}
+				if t == nil {
+					probeDone = true
+					continue
+				}
+				probeTuple = t
+			}
+			seq++
+			k, v, err := joinOp.key(probeTuple, !buildLeft)
+			if err != nil {
+				return nil, err
+			}
+			if !isNull(v) {
+				matches = table[k]
+			}
+			if len(matches) > 0 && probeMatched != nil {
+				probeMatched[seq] = true
+			} else if len(matches) == 0 && padProbe {
+				return join(nullBuild, probeTuple), nil
+			}
+		}
+		i := matches[0]
+		matches = matches[1:]
+		if buildMatched != nil {
+			buildMatched[i] = true
+		}
+		return join(build[i], probeTuple), nil
+	}, nil
+}
+
+// Partition both inputs into spill files on the hash of their join key, and
+// join each pair of partitions in turn.  Each pair is removed once it has been
+// joined, and all pairs not joined yet are removed on an error.
+func (joinOp *EqualityJoin[T]) partitionJoin(leftBuf []*Tuple, left func() (*Tuple, error), rightBuf []*Tuple, right func() (*Tuple, error), tid TransactionID, depth int) (func() (*Tuple, error), error) {
+	leftParts, err := joinOp.partition(leftBuf, left, true, tid, depth)
+	if err != nil {
+		return nil, err
+	}
+	rightParts, err := joinOp.partition(rightBuf, right, false, tid, depth)
+	if err != nil {
+		removeSpillFiles(leftParts)
+		return nil, err
+	}
+	part := -1
+	var iter func() (*Tuple, error)
+	fail := func(err error) (*Tuple, error) {
+		removeSpillFiles(leftParts[part:])
+		removeSpillFiles(rightParts[part:])
+		part = joinPartitions
+		return nil, err
+	}
 	return func() (*Tuple, error) {
-		// if we are done iterating over left:
-		if leftTuple == nil {
-			return nil, nil
+		for part < joinPartitions {
+			if iter != nil {
+				t, err := iter()
+				if err != nil {
+					return fail(err)
+				}
+				if t != nil {
+					return t, nil
+				}
+			}
+			if part >= 0 {
+				leftParts[part].remove()
+				rightParts[part].remove()
+			}
+			part++
+			if part == joinPartitions {
+				break
+			}
+			iter = nil
+			// a pair of partitions has no result unless both have tuples,
+			// or one whose unmatched tuples are returned does
+			nLeft, nRight := leftParts[part].count, rightParts[part].count
+			if (nLeft == 0 || nRight == 0) && !(nLeft > 0 && joinOp.preserves(true)) && !(nRight > 0 && joinOp.preserves(false)) {
+				continue
+			}
+			if depth+1 < maxJoinDepth {
+				l, err := leftParts[part].iterator()
+				if err != nil {
+					return fail(err)
+				}
+				r, err := rightParts[part].iterator()
+				if err != nil {
+					return fail(err)
+				}
+				iter, err = joinOp.hashJoin(l, r, tid, depth+1)
+				if err != nil {
+					return fail(err)
+				}
+			} else {
+				iter = joinOp.blockJoin(leftParts[part], rightParts[part])
+			}
+		}
+		return nil, nil
+	}, nil
+}
+
+// Write buf and the rest of iter to joinPartitions spill files, choosing the
+// partition of each tuple by the hash of its join key
+func (joinOp *EqualityJoin[T]) partition(buf []*Tuple, iter func() (*Tuple, error), left bool, tid TransactionID, depth int) ([]*spillFile, error) {
+	parts := make([]*spillFile, joinPartitions)
+	for i := range parts {
+		var f *spillFile
+		var err error
+		if joinOp.bufPool != nil {
+			f, err = joinOp.bufPool.newSpillFile(tid, joinOp.dir)
+		} else {
+			f, err = newSpillFile(joinOp.dir)
+		}
+		if err != nil {
+			removeSpillFiles(parts[:i])
+			return nil, err
+		}
+		parts[i] = f
+	}
+	for {
+		var t *Tuple
+		if len(buf) > 0 {
+			t, buf = buf[0], buf[1:]
+		} else {
+			var err error
+			t, err = iter()
+			if err != nil {
+				removeSpillFiles(parts)
+				return nil, err
+			}
+			if t == nil {
+				return parts, nil
+			}
+		}
+		_, v, err := joinOp.key(t, left)
+		if err == nil {
+			err = parts[hashValue(v, depth)%uint64(joinPartitions)].append(t)
 		}
+		if err != nil {
+			removeSpillFiles(parts)
+			return nil, err
+		}
+	}
+}
+
+// Join two partitions with a block nested loops join, building a hash table
+// over each block of maxBufferSize tuples of the right partition and probing
+// it with all of the left partition.  If the join preserves the left input,
+// the left tuples that matched no block are returned in a last pass over the
+// left partition.
+func (joinOp *EqualityJoin[T]) blockJoin(leftPart, rightPart *spillFile) func() (*Tuple, error) {
+	var right, iter func() (*Tuple, error)
+	rightDone := false
+	var leftMatched []bool
+	if joinOp.preserves(true) {
+		leftMatched = make([]bool, leftPart.count)
+	}
+	return func() (*Tuple, error) {
 		for {
-			rightTuple, _ := rightIterator()
-			if rightTuple == nil {
-				leftTuple, _ = leftIterator()
-				if leftTuple == nil {
+			if iter != nil {
+				t, err := iter()
+				if err != nil || t != nil {
+					return t, err
+				}
+			}
+			if rightDone {
+				if leftMatched == nil {
 					return nil, nil
 				}
-				rightIterator, _ = rightIteratorPtr.Iterator(tid, rightIteratorPtr.Descriptor())
+				left, err := leftPart.iterator()
+				if err != nil {
+					return nil, err
+				}
+				iter = padUnmatched(left, leftMatched, joinOp.nullInput(false))
+				leftMatched = nil
 				continue
 			}
-			leftDBVal, _ := joinOp.leftField.EvalExpr(leftTuple)
-			leftVal := joinOp.getter(leftDBVal)
-			rightDBVal, _ := joinOp.rightField.EvalExpr(rightTuple)
-			rightVal := joinOp.getter(rightDBVal)
-			// if left and right are equal return the joined tuple
-			if leftVal == rightVal {
-				joinedTuple := joinTuples(leftTuple, rightTuple)
-				return joinedTuple, nil
+			var err error
+			if right == nil {
+				if right, err = rightPart.iterator(); err != nil {
+					return nil, err
+				}
+			}
+			var block []*Tuple
+			for len(block) < joinOp.budget() {
+				t, err := right()
+				if err != nil {
+					return nil, err
+				}
+				if t == nil {
+					rightDone = true
+					break
+				}
+				block = append(block, t)
+			}
+			left, err := leftPart.iterator()
+			if err != nil {
+				return nil, err
+			}
+			if iter, err = joinOp.probe(block, false, nil, left, leftMatched); err != nil {
+				return nil, err
 			}
 		}
-	}, nil
+	}
+}
+
+// Return an iterator over the tuples of left whose entry in matched is not set,
+// each joined with the tuple of missing values nullRight
+func padUnmatched(left func() (*Tuple, error), matched []bool, nullRight *Tuple) func() (*Tuple, error) {
+	seq := -1
+	return func() (*Tuple, error) {
+		for {
+			t, err := left()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			seq++
+			if !matched[seq] {
+				return joinTuples(t, nullRight), nil
+			}
+		}
+	}
+}
+
+func removeSpillFiles(files []*spillFile) {
+	for _, f := range files {
+		f.remove()
+	}
+}
+
+// Hash a value, mixing in seed so that values that hash to the same partition
+// at one level of partitioning are spread out at the next one
+func hashValue(v DBValue, seed int) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(seed)})
+	switch f := v.(type) {
+	case IntField:
+		binary.Write(h, binary.LittleEndian, f.Value)
+	case StringField:
+		h.Write([]byte(f.Value))
+	case FloatField:
+		binary.Write(h, binary.LittleEndian, f.Value)
+	case DecimalField:
+		f = f.normalized()
+		binary.Write(h, binary.LittleEndian, f.Value)
+		h.Write([]byte{byte(f.Scale)})
+	case DateField:
+		binary.Write(h, binary.LittleEndian, f.Value)
+	case TimestampField:
+		binary.Write(h, binary.LittleEndian, f.Value)
+	case BoolField:
+		binary.Write(h, binary.LittleEndian, f.Value)
+	}
+	return h.Sum64()
 }
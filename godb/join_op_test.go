@@ -83,7 +83,7 @@ func TestBigJoinOptional(t *testing.T) {
 	go func() {
 		ntups := 314159
 		bp := NewBufferPool(100)
-		td := TupleDesc{[]FieldType{{"name", "", IntType}}}
+		td := TupleDesc{[]FieldType{{Fname: "name", Ftype: IntType}}}
 		os.Remove(BigJoinFile1)
 		os.Remove(BigJoinFile2)
 		hf1, err := NewHeapFile(BigJoinFile1, &td, bp)
@@ -196,3 +196,268 @@ func TestBigJoinOptional(t *testing.T) {
 	}
 
 }
+
+// Create a heap file with one int field holding the supplied values
+func makeJoinInput(t *testing.T, fileName string, bp *BufferPool, values []int64) *HeapFile {
+	td := TupleDesc{[]FieldType{{Fname: "v", Ftype: IntType}}}
+	os.Remove(fileName)
+	hf, err := NewHeapFile(fileName, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for _, v := range values {
+		if err := hf.insertTuple(&Tuple{td, []DBValue{IntField{v}}, nil}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	return hf
+}
+
+// Join the two files on their only field with the supplied buffer size,
+// returning the number of results
+func countJoin(t *testing.T, bp *BufferPool, left, right *HeapFile, maxBufferSize int) int {
+	field := FieldExpr{left.Descriptor().Fields[0]}
+	join, err := NewIntJoin(left, &field, right, &field, maxBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	iter, err := join.Iterator(tid, join.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return cnt
+		}
+		if tup.Fields[0].(IntField).Value != tup.Fields[1].(IntField).Value {
+			t.Fatalf("joined tuples with different keys: %v", tup.Fields)
+		}
+		cnt++
+	}
+}
+
+func TestHashJoinSpills(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	bp := NewBufferPool(500)
+	var leftVals, rightVals []int64
+	for i := 0; i < 3000; i++ {
+		leftVals = append(leftVals, int64(i))
+		// every other key appears twice on the right
+		rightVals = append(rightVals, int64(i*2))
+		rightVals = append(rightVals, int64(i*2))
+	}
+	left := makeJoinInput(t, BigJoinFile1, bp, leftVals)
+	right := makeJoinInput(t, BigJoinFile2, bp, rightVals)
+
+	if n := countJoin(t, bp, left, right, 100000); n != 3000 {
+		t.Errorf("expected 3000 results from an in-memory join, got %d", n)
+	}
+	if n := countJoin(t, bp, left, right, 100); n != 3000 {
+		t.Errorf("expected 3000 results from a partitioned join, got %d", n)
+	}
+	if n := countJoin(t, bp, right, left, 100); n != 3000 {
+		t.Errorf("expected 3000 results with the inputs swapped, got %d", n)
+	}
+	files, _ := os.ReadDir(tmp)
+	if len(files) != 0 {
+		t.Errorf("expected the join to remove its spill files, found %d", len(files))
+	}
+}
+
+func TestHashJoinAbandoned(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := t.TempDir()
+	bp := NewBufferPool(500)
+	var vals []int64
+	for i := 0; i < 1000; i++ {
+		vals = append(vals, int64(i))
+	}
+	left := makeJoinInput(t, BigJoinFile1, bp, vals)
+	right := makeJoinInput(t, BigJoinFile2, bp, vals)
+	field := FieldExpr{left.Descriptor().Fields[0]}
+	join, err := NewIntJoin(left, &field, right, &field, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	join.spillTo(dir, bp)
+
+	// stop reading after the first result, as under a LIMIT
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := join.Iterator(tid, join.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup == nil {
+		t.Fatalf("expected a result from the join, got %v, %v", tup, err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) == 0 {
+		t.Fatalf("expected the join to partition its inputs in %s", dir)
+	}
+	if err := bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the partitions to be removed at commit, found %d files", len(files))
+	}
+}
+
+func TestHashJoinSkew(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	bp := NewBufferPool(500)
+	// a single key that doesn't fit in memory however often it's partitioned
+	vals := make([]int64, 300)
+	left := makeJoinInput(t, BigJoinFile1, bp, vals)
+	right := makeJoinInput(t, BigJoinFile2, bp, vals)
+	if n := countJoin(t, bp, left, right, 50); n != 300*300 {
+		t.Errorf("expected %d results, got %d", 300*300, n)
+	}
+}
+
+// Join the two files on their only field with an outer join of the supplied
+// type, and check the results against a nested loops join
+func checkOuterJoin(t *testing.T, bp *BufferPool, left, right *HeapFile, leftVals, rightVals []int64, joinType JoinType, maxBufferSize int) {
+	field := FieldExpr{left.Descriptor().Fields[0]}
+	join, err := NewIntOuterJoin(left, &field, right, &field, maxBufferSize, joinType)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// count the results for each pair of values, with -1 for a missing value
+	expected := make(map[[2]int64]int)
+	for _, l := range leftVals {
+		matched := false
+		for _, r := range rightVals {
+			if l == r {
+				expected[[2]int64{l, r}]++
+				matched = true
+			}
+		}
+		if !matched && (joinType == LeftOuterJoin || joinType == FullOuterJoin) {
+			expected[[2]int64{l, -1}]++
+		}
+	}
+	for _, r := range rightVals {
+		matched := false
+		for _, l := range leftVals {
+			matched = matched || l == r
+		}
+		if !matched && (joinType == RightOuterJoin || joinType == FullOuterJoin) {
+			expected[[2]int64{-1, r}]++
+		}
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	result := make(map[[2]int64]int)
+	for _, tup := range collectTuples(t, join, tid) {
+		var pair [2]int64
+		for i, f := range tup.Fields {
+			pair[i] = -1
+			if v, ok := f.(IntField); ok {
+				pair[i] = v.Value
+			}
+		}
+		result[pair]++
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("join type %d with buffer %d: expected %d distinct results, got %d", joinType, maxBufferSize, len(expected), len(result))
+	}
+	for pair, n := range expected {
+		if result[pair] != n {
+			t.Errorf("join type %d with buffer %d: expected %v %d times, got %d", joinType, maxBufferSize, pair, n, result[pair])
+		}
+	}
+}
+
+func TestOuterJoin(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	bp := NewBufferPool(500)
+	var leftVals, rightVals []int64
+	for i := 0; i < 400; i++ {
+		leftVals = append(leftVals, int64(i))
+		rightVals = append(rightVals, int64(i*3))
+	}
+	// a key shared by too many tuples to fit in memory, so that some
+	// partitions are joined with a block nested loops join
+	for i := 0; i < 60; i++ {
+		leftVals = append(leftVals, 1000)
+		rightVals = append(rightVals, 1000, 1001)
+	}
+	left := makeJoinInput(t, BigJoinFile1, bp, leftVals)
+	right := makeJoinInput(t, BigJoinFile2, bp, rightVals)
+
+	for _, joinType := range []JoinType{InnerJoin, LeftOuterJoin, RightOuterJoin, FullOuterJoin} {
+		for _, bufSize := range []int{100000, 50} {
+			checkOuterJoin(t, bp, left, right, leftVals, rightVals, joinType, bufSize)
+			checkOuterJoin(t, bp, right, left, rightVals, leftVals, joinType, bufSize)
+		}
+	}
+}
+
+func TestOuterJoinQuery(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 100)
+	young := "(select age from t where age < 5) b"
+	queries := []struct {
+		sql      string
+		joinType JoinType
+		rows     int
+		nulls    int
+	}{
+		{"select a.age, b.age from t a left join " + young + " on a.age = b.age", LeftOuterJoin, 550, 50},
+		{"select a.age, b.age from t a left outer join " + young + " on b.age = a.age", LeftOuterJoin, 550, 50},
+		{"select a.age, b.age from " + young + " right join t a on a.age = b.age", RightOuterJoin, 550, 50},
+		// filters on the padded side see the padded tuples
+		{"select a.age, b.age from t a left join " + young + " on a.age = b.age where b.age < 3", LeftOuterJoin, 300, 0},
+		{"select a.age, b.age from t a left join " + young + " on a.age = b.age where a.age > 6", LeftOuterJoin, 30, 30},
+		{"select a.age, b.age from (select age from t where age >= 3) a full outer join " + young + " on a.age = b.age", FullOuterJoin, 280, 80},
+		{"select a.age, b.age from (select age from t where age >= 3) a full join " + young + " on a.age = b.age", FullOuterJoin, 280, 80},
+	}
+	for _, q := range queries {
+		plan, tuples := runQuery(t, c, q.sql)
+		join, ok := plan.(*Project).child.(*EqualityJoin[int64])
+		if !ok {
+			join, ok = plan.(*Project).child.(*Filter[int64]).child.(*EqualityJoin[int64])
+		}
+		if !ok || join.joinType != q.joinType {
+			t.Errorf("%s: expected a join of type %d", q.sql, q.joinType)
+		}
+		if len(tuples) != q.rows {
+			t.Errorf("%s: expected %d rows, got %d", q.sql, q.rows, len(tuples))
+		}
+		nulls := 0
+		for _, tup := range tuples {
+			for _, f := range tup.Fields {
+				if isNull(f) {
+					nulls++
+				}
+			}
+		}
+		if nulls != q.nulls {
+			t.Errorf("%s: expected %d missing values, got %d", q.sql, q.nulls, nulls)
+		}
+	}
+
+	if _, _, err := Parse(c, "select a.age from t a left join t b on a.age = b.age and b.name = 'sam'"); err == nil {
+		t.Errorf("expected an error for an outer join condition that is not a single equality")
+	}
+
+	// only the join itself is rewritten to a full outer join
+	if err := queryError(c, "select a.age from t a straight_join t b on a.age = b.age"); err == nil {
+		t.Errorf("expected an error for a straight_join")
+	}
+	runQuery(t, c, "insert into t values ('a full join', 10), ('straight_join', 11)")
+	checkQueryRows(t, c, "select name, age from t where age >= 10 order by age", []string{"a full join,10", "straight_join,11"})
+}
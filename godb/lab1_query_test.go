@@ -6,8 +6,8 @@ import (
 )
 
 func TestLab1Query(t *testing.T) {
-	f1 := FieldType{"name", "", StringType}
-	f2 := FieldType{"age", "", IntType}
+	f1 := FieldType{Fname: "name", Ftype: StringType}
+	f2 := FieldType{Fname: "age", Ftype: IntType}
 	td := TupleDesc{[]FieldType{f1, f2}}
 	sum, err := computeFieldSum("lab1_test.csv", td, "age")
 	if err != nil {
@@ -83,9 +83,11 @@ func TestSetDirty(t *testing.T) {
 	_, t1, _, hf, bp, _ := makeTestVars()
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	for i := 0; i < 308; i++ {
+	// the buffer pool holds 3 pages
+	full := 3 * tuplesPerPage(&t1)
+	for i := 0; i < full+2; i++ {
 		err := hf.insertTuple(&t1, tid)
-		if err != nil && (i == 306 || i == 307) {
+		if err != nil && (i == full || i == full+1) {
 			return
 		} else if err != nil {
 			t.Fatalf("%v", err)
@@ -275,8 +277,8 @@ func TestHeapFileSize(t *testing.T) {
 
 func TestProjectExtra(t *testing.T) {
 	_, _, t1, _, _ := makeJoinOrderingVars()
-	ft1 := FieldType{"a", "", StringType}
-	ft2 := FieldType{"b", "", IntType}
+	ft1 := FieldType{Fname: "a", Ftype: StringType}
+	ft2 := FieldType{Fname: "b", Ftype: IntType}
 	outTup, _ := t1.project([]FieldType{ft1})
 	if (len(outTup.Fields)) != 1 {
 		t.Fatalf("project returned %d fields, expected 1", len(outTup.Fields))
@@ -332,7 +334,7 @@ func TestBufferLen(t *testing.T) {
 
 	td, _, _, hf, _, _ := makeTestVars()
 	page := newHeapPage(&td, 0, hf)
-	free := page.getNumSlots()
+	free := tuplesPerPage(&Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, IntField{0}}})
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
@@ -0,0 +1,250 @@
+package godb
+
+import (
+	"sync"
+)
+
+// LockManager implements strict two phase locking for the BufferPool.  Each
+// lockable object (a page key, see [DBFile.pageKey]) can be held in shared
+// mode by any number of transactions, or in exclusive mode by one.
+//
+// Transactions that cannot be granted a lock wait in a per-object FIFO queue,
+// sleeping on a condition variable until the holders release the lock, so
+// that a steady stream of readers can't starve a writer.  A transaction that
+// holds a shared lock and asks for an exclusive one is queued ahead of every
+// other waiter and is granted the lock as soon as it is the only holder left.
+//
+// Before a transaction starts waiting, and every time it is woken up without
+// getting its lock, the lock manager checks the waits-for graph for a cycle
+// through that transaction; if there is one, the lock request fails with a
+// DeadlockError and the caller is expected to abort the transaction.
+type LockManager struct {
+	m       sync.Mutex
+	locks   map[any]*objectLock
+	held    map[TransactionID]map[any]RWPerm // locks held by each transaction
+	waiting map[TransactionID]*lockRequest   // the request each blocked transaction waits on
+}
+
+type objectLock struct {
+	shared    map[TransactionID]bool
+	exclusive TransactionID
+	queue     []*lockRequest
+	cond      *sync.Cond
+}
+
+type lockRequest struct {
+	tid       TransactionID
+	key       any
+	perm      RWPerm
+	upgrade   bool
+	cancelled bool
+}
+
+// Create a new, empty LockManager
+func NewLockManager() *LockManager {
+	return &LockManager{
+		locks:   map[any]*objectLock{},
+		held:    map[TransactionID]map[any]RWPerm{},
+		waiting: map[TransactionID]*lockRequest{},
+	}
+}
+
+func (lm *LockManager) getLock(key any) *objectLock {
+	l, ok := lm.locks[key]
+	if !ok {
+		l = &objectLock{shared: map[TransactionID]bool{}, cond: sync.NewCond(&lm.m)}
+		lm.locks[key] = l
+	}
+	return l
+}
+
+// Acquire a lock on key with the specified permission on behalf of tid,
+// blocking until the lock is granted. Returns a DeadlockError if waiting for
+// the lock would deadlock, or if tid's locks were released (i.e., it was
+// aborted) while it was waiting.
+func (lm *LockManager) Lock(tid TransactionID, key any, perm RWPerm) error {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+
+	held, holds := lm.held[tid][key]
+	if holds && (held == WritePerm || perm == ReadPerm) {
+		return nil
+	}
+	l := lm.getLock(key)
+	req := &lockRequest{tid: tid, key: key, perm: perm, upgrade: holds}
+	if len(l.queue) == 0 && l.compatible(req) {
+		lm.grant(l, req)
+		return nil
+	}
+
+	// upgrades go ahead of all waiters that aren't upgrading themselves
+	pos := len(l.queue)
+	if req.upgrade {
+		pos = 0
+		for pos < len(l.queue) && l.queue[pos].upgrade {
+			pos++
+		}
+	}
+	l.queue = append(l.queue, nil)
+	copy(l.queue[pos+1:], l.queue[pos:])
+	l.queue[pos] = req
+	lm.waiting[tid] = req
+
+	for {
+		if req.cancelled {
+			return GoDBError{code: DeadlockError, errString: "Transaction aborted while waiting for a lock"}
+		}
+		if l.queue[0] == req && l.compatible(req) {
+			l.queue = l.queue[1:]
+			delete(lm.waiting, tid)
+			lm.grant(l, req)
+			// the next waiter may be compatible too, e.g., a run of readers
+			l.cond.Broadcast()
+			return nil
+		}
+		if lm.deadlocked(tid) {
+			lm.dequeue(l, req)
+			return GoDBError{code: DeadlockError, errString: "Transaction deadlocked"}
+		}
+		l.cond.Wait()
+	}
+}
+
+// Whether req can be granted given the current holders of l
+func (l *objectLock) compatible(req *lockRequest) bool {
+	if l.exclusive != nil && l.exclusive != req.tid {
+		return false
+	}
+	if req.perm == ReadPerm {
+		return true
+	}
+	for sharedTid := range l.shared {
+		if sharedTid != req.tid {
+			return false
+		}
+	}
+	return true
+}
+
+func (lm *LockManager) grant(l *objectLock, req *lockRequest) {
+	if lm.held[req.tid] == nil {
+		lm.held[req.tid] = map[any]RWPerm{}
+	}
+	if req.perm == WritePerm {
+		delete(l.shared, req.tid)
+		l.exclusive = req.tid
+	} else {
+		l.shared[req.tid] = true
+	}
+	lm.held[req.tid][req.key] = req.perm
+}
+
+// Remove a request that will not be granted from the queue it waits in
+func (lm *LockManager) dequeue(l *objectLock, req *lockRequest) {
+	for i, r := range l.queue {
+		if r == req {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	if lm.waiting[req.tid] == req {
+		delete(lm.waiting, req.tid)
+	}
+	// waiters behind req may be grantable now
+	l.cond.Broadcast()
+}
+
+// Return the transactions the request req has to wait for: the incompatible
+// holders of the lock it asks for and the requests queued ahead of it.
+func (lm *LockManager) blockers(req *lockRequest) []TransactionID {
+	l := lm.locks[req.key]
+	tids := []TransactionID{}
+	if l.exclusive != nil && l.exclusive != req.tid {
+		tids = append(tids, l.exclusive)
+	}
+	if req.perm == WritePerm {
+		for sharedTid := range l.shared {
+			if sharedTid != req.tid {
+				tids = append(tids, sharedTid)
+			}
+		}
+	}
+	for _, r := range l.queue {
+		if r == req {
+			break
+		}
+		tids = append(tids, r.tid)
+	}
+	return tids
+}
+
+// Check whether there is a cycle through tid in the waits-for graph
+func (lm *LockManager) deadlocked(tid TransactionID) bool {
+	visited := map[TransactionID]bool{}
+	stack := []TransactionID{tid}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		req, ok := lm.waiting[cur]
+		if !ok {
+			continue
+		}
+		for _, next := range lm.blockers(req) {
+			if next == tid {
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	return false
+}
+
+// Return the keys tid holds an exclusive lock on
+func (lm *LockManager) exclusiveKeys(tid TransactionID) []any {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	keys := []any{}
+	for key, perm := range lm.held[tid] {
+		if perm == WritePerm {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Return the transaction holding an exclusive lock on key, if any
+func (lm *LockManager) exclusiveHolder(key any) (TransactionID, bool) {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	l, ok := lm.locks[key]
+	if !ok || l.exclusive == nil {
+		return nil, false
+	}
+	return l.exclusive, true
+}
+
+// Release all locks held by tid, and cancel the request it is waiting on, if
+// any, waking up the transactions waiting on those locks.
+func (lm *LockManager) ReleaseAll(tid TransactionID) {
+	lm.m.Lock()
+	defer lm.m.Unlock()
+	if req, ok := lm.waiting[tid]; ok {
+		req.cancelled = true
+		lm.dequeue(lm.locks[req.key], req)
+	}
+	for key := range lm.held[tid] {
+		l := lm.locks[key]
+		delete(l.shared, tid)
+		if l.exclusive == tid {
+			l.exclusive = nil
+		}
+		if len(l.shared) == 0 && l.exclusive == nil && len(l.queue) == 0 {
+			delete(lm.locks, key)
+		}
+		l.cond.Broadcast()
+	}
+	delete(lm.held, tid)
+}
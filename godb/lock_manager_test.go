@@ -0,0 +1,112 @@
+package godb
+
+import (
+	"testing"
+	"time"
+)
+
+// Start acquiring a lock in the background; the returned channel receives
+// the result once the lock is granted or refused
+func lockAsync(lm *LockManager, tid TransactionID, key any, perm RWPerm) chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- lm.Lock(tid, key, perm)
+	}()
+	return done
+}
+
+func expectBlocked(t *testing.T, done chan error, what string) {
+	select {
+	case err := <-done:
+		t.Fatalf("%s should be blocked, got %v", what, err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectGranted(t *testing.T, done chan error, what string) {
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s should be granted, got %v", what, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s was never granted", what)
+	}
+}
+
+func TestLockManagerFIFO(t *testing.T) {
+	lm := NewLockManager()
+	tid1, tid2, tid3 := NewTID(), NewTID(), NewTID()
+	if err := lm.Lock(tid1, "p", ReadPerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	writer := lockAsync(lm, tid2, "p", WritePerm)
+	expectBlocked(t, writer, "writer")
+	// a reader arriving after a waiting writer queues behind it
+	reader := lockAsync(lm, tid3, "p", ReadPerm)
+	expectBlocked(t, reader, "reader")
+
+	lm.ReleaseAll(tid1)
+	expectGranted(t, writer, "writer")
+	expectBlocked(t, reader, "reader")
+	lm.ReleaseAll(tid2)
+	expectGranted(t, reader, "reader")
+}
+
+func TestLockManagerUpgrade(t *testing.T) {
+	lm := NewLockManager()
+	tid1, tid2, tid3 := NewTID(), NewTID(), NewTID()
+	lm.Lock(tid1, "p", ReadPerm)
+	lm.Lock(tid2, "p", ReadPerm)
+	writer := lockAsync(lm, tid3, "p", WritePerm)
+	expectBlocked(t, writer, "writer")
+	upgrade := lockAsync(lm, tid1, "p", WritePerm)
+	expectBlocked(t, upgrade, "upgrade")
+
+	// the upgrade goes ahead of the waiting writer
+	lm.ReleaseAll(tid2)
+	expectGranted(t, upgrade, "upgrade")
+	expectBlocked(t, writer, "writer")
+	if holder, ok := lm.exclusiveHolder("p"); !ok || holder != tid1 {
+		t.Errorf("expected tid1 to hold the exclusive lock")
+	}
+	lm.ReleaseAll(tid1)
+	expectGranted(t, writer, "writer")
+}
+
+func TestLockManagerDeadlock(t *testing.T) {
+	lm := NewLockManager()
+	tid1, tid2 := NewTID(), NewTID()
+	lm.Lock(tid1, "p0", WritePerm)
+	lm.Lock(tid2, "p1", WritePerm)
+	waiter := lockAsync(lm, tid1, "p1", WritePerm)
+	expectBlocked(t, waiter, "tid1")
+
+	err := lm.Lock(tid2, "p0", WritePerm)
+	if err == nil {
+		t.Fatalf("expected deadlock")
+	}
+	if gerr, ok := err.(GoDBError); !ok || gerr.code != DeadlockError {
+		t.Fatalf("expected DeadlockError, got %v", err)
+	}
+	lm.ReleaseAll(tid2)
+	expectGranted(t, waiter, "tid1")
+}
+
+func TestLockManagerReleaseCancelsWait(t *testing.T) {
+	lm := NewLockManager()
+	tid1, tid2 := NewTID(), NewTID()
+	lm.Lock(tid1, "p", WritePerm)
+	waiter := lockAsync(lm, tid2, "p", ReadPerm)
+	expectBlocked(t, waiter, "tid2")
+
+	lm.ReleaseAll(tid2)
+	select {
+	case err := <-waiter:
+		if err == nil {
+			t.Fatalf("cancelled request should not be granted")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("cancelled request still waiting")
+	}
+}
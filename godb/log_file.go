@@ -0,0 +1,449 @@
+package godb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogFile is the write-ahead log used by the BufferPool.  GoDB logs physical
+// page images:  every time a transaction commits, the before and after image of
+// each page it dirtied is appended to the log, followed by a commit record, and
+// the log is forced to disk before the commit returns.  Dirty pages can then be
+// written back to their files lazily, whenever the buffer pool evicts them.
+//
+// The log starts with an 8 byte header holding the LSN of its first record, so
+// that LSNs keep growing when the log is truncated after recovery.  Each
+// record is laid out as
+//
+//	int32 length | int8 type | int64 tid | type specific payload
+//
+// where the payload of an update record is the name of the file the page
+// belongs to, its page number and the before and after images of the page.
+// The LSN of a record is the base LSN plus its offset in the log.
+//
+// Besides being truncated by recovery, the log is checkpointed by the buffer
+// pool when a commit finds it larger than checkpointSize (see
+// [BufferPool.checkpoint]).
+type LogFile struct {
+	fileName       string
+	file           *os.File
+	baseLSN        int64
+	endLSN         int64
+	checkpointSize int64
+	files          map[string]bool // names of the files updated by the records in the log
+	m              sync.Mutex
+}
+
+type logRecordType int8
+
+const (
+	BeginLogRecord  logRecordType = iota
+	UpdateLogRecord logRecordType = iota
+	CommitLogRecord logRecordType = iota
+	AbortLogRecord  logRecordType = iota
+)
+
+const (
+	logHeaderSize    int = 8
+	logRecHeaderSize int = 4 + 1 + 8
+	// offset of the page LSN in the header of every page type, used by
+	// recovery to decide whether an update has to be redone
+	pageLSNOffset int = 8
+)
+
+const LogFileName string = "godb.log"
+
+// The size in bytes the log may grow to before the buffer pool checkpoints it
+const LogCheckpointSize int64 = 64 << 20
+
+type logRecord struct {
+	lsn      int64
+	recType  logRecordType
+	tid      int64
+	fileName string
+	pageNo   int
+	before   []byte
+	after    []byte
+}
+
+// Open the log stored in fileName, creating it if it does not exist.
+func NewLogFile(fileName string) (*LogFile, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l := &LogFile{fileName: fileName, file: file, checkpointSize: LogCheckpointSize, files: map[string]bool{}}
+	if info.Size() < int64(logHeaderSize) {
+		if err := l.reset(0); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+	var base int64
+	if err := binary.Read(io.NewSectionReader(file, 0, int64(logHeaderSize)), binary.LittleEndian, &base); err != nil {
+		file.Close()
+		return nil, err
+	}
+	l.baseLSN = base
+	l.endLSN = base + info.Size() - int64(logHeaderSize)
+	return l, nil
+}
+
+// Truncate the log, so that the next record appended has the supplied LSN
+func (l *LogFile) reset(base int64) error {
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.LittleEndian, base)
+	if _, err := l.file.WriteAt(b.Bytes(), 0); err != nil {
+		return err
+	}
+	l.baseLSN = base
+	l.endLSN = base
+	l.files = map[string]bool{}
+	return l.file.Sync()
+}
+
+// Return the number of bytes of records in the log
+func (l *LogFile) size() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.endLSN - l.baseLSN
+}
+
+// Return the names of the files updated by the records in the log
+func (l *LogFile) fileNames() []string {
+	l.m.Lock()
+	defer l.m.Unlock()
+	names := make([]string, 0, len(l.files))
+	for name := range l.files {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Discard every record in the log, e.g. once the files reflect all of them
+func (l *LogFile) truncate() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.reset(l.endLSN)
+}
+
+func (l *LogFile) append(rec *logRecord) (int64, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.appendLocked(rec)
+}
+
+// Append a record to the log; the caller must hold l.m
+func (l *LogFile) appendLocked(rec *logRecord) (int64, error) {
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.LittleEndian, int32(0)) // length, filled in below
+	binary.Write(b, binary.LittleEndian, int8(rec.recType))
+	binary.Write(b, binary.LittleEndian, rec.tid)
+	if rec.recType == UpdateLogRecord {
+		binary.Write(b, binary.LittleEndian, int32(len(rec.fileName)))
+		b.WriteString(rec.fileName)
+		binary.Write(b, binary.LittleEndian, int32(rec.pageNo))
+		b.Write(rec.before)
+		b.Write(rec.after)
+	}
+	buf := b.Bytes()
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+	lsn := l.endLSN
+	_, err := l.file.WriteAt(buf, int64(logHeaderSize)+lsn-l.baseLSN)
+	if err != nil {
+		return 0, err
+	}
+	l.endLSN += int64(len(buf))
+	rec.lsn = lsn
+	if rec.recType == UpdateLogRecord {
+		l.files[rec.fileName] = true
+	}
+	return lsn, nil
+}
+
+func (l *LogFile) logBegin(tid TransactionID) error {
+	_, err := l.append(&logRecord{recType: BeginLogRecord, tid: int64(*tid)})
+	return err
+}
+
+func (l *LogFile) logCommit(tid TransactionID) error {
+	_, err := l.append(&logRecord{recType: CommitLogRecord, tid: int64(*tid)})
+	return err
+}
+
+func (l *LogFile) logAbort(tid TransactionID) error {
+	_, err := l.append(&logRecord{recType: AbortLogRecord, tid: int64(*tid)})
+	return err
+}
+
+// Append an update record for the page with the supplied before image, and
+// return its LSN.  The LSN of the record is stored in the page before the
+// after image is taken, so the page written back to disk carries the LSN of
+// the last update to it.
+func (l *LogFile) logUpdate(tid TransactionID, p Page, before []byte) (int64, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	p.setLSN(l.endLSN)
+	after, err := p.toBuffer()
+	if err != nil {
+		return 0, err
+	}
+	fileName, pageNo := p.location()
+	return l.appendLocked(&logRecord{recType: UpdateLogRecord, tid: int64(*tid), fileName: fileName, pageNo: pageNo, before: before, after: after.Bytes()})
+}
+
+// Read back the update record with the supplied LSN, e.g. to undo a page that
+// was stolen from a transaction that then aborted
+func (l *LogFile) readUpdate(lsn int64) (*logRecord, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if lsn < l.baseLSN || lsn+int64(logRecHeaderSize) > l.endLSN {
+		return nil, GoDBError{MalformedDataError, "log record is no longer in the log"}
+	}
+	offset := int64(logHeaderSize) + lsn - l.baseLSN
+	var lengthBytes [4]byte
+	if _, err := l.file.ReadAt(lengthBytes[:], offset); err != nil {
+		return nil, err
+	}
+	length := int64(binary.LittleEndian.Uint32(lengthBytes[:]))
+	if length < int64(logRecHeaderSize) || lsn+length > l.endLSN {
+		return nil, GoDBError{MalformedDataError, "log record is corrupt"}
+	}
+	body := make([]byte, length-4)
+	if _, err := l.file.ReadAt(body, offset+4); err != nil {
+		return nil, err
+	}
+	rec, ok := decodeLogRecord(body)
+	if !ok || rec.recType != UpdateLogRecord {
+		return nil, GoDBError{MalformedDataError, "log record is not an update"}
+	}
+	rec.lsn = lsn
+	return rec, nil
+}
+
+// Append a compensation record that restores a page to the supplied image,
+// e.g., when undoing an update.  The image is stamped with the LSN of the
+// record, so that redo repeats the undo as well as the original update.
+// Returns the stamped image.
+func (l *LogFile) logCompensation(tid int64, fileName string, pageNo int, current []byte, image []byte) ([]byte, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	stamped := make([]byte, len(image))
+	copy(stamped, image)
+	binary.LittleEndian.PutUint64(stamped[pageLSNOffset:], uint64(l.endLSN))
+	_, err := l.appendLocked(&logRecord{recType: UpdateLogRecord, tid: tid, fileName: fileName, pageNo: pageNo, before: current, after: stamped})
+	return stamped, err
+}
+
+// Force the log to disk
+func (l *LogFile) force() error {
+	return l.file.Sync()
+}
+
+// Read all complete records from the log. A record that was only partially
+// written when the process died is ignored, along with anything after it.
+func (l *LogFile) readRecords() ([]*logRecord, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	size := l.endLSN - l.baseLSN
+	r := bufio.NewReader(io.NewSectionReader(l.file, int64(logHeaderSize), size))
+	var records []*logRecord
+	offset := int64(0)
+	for offset < size {
+		var length int32
+		if binary.Read(r, binary.LittleEndian, &length) != nil || length < int32(logRecHeaderSize) || offset+int64(length) > size {
+			break
+		}
+		body := make([]byte, length-4)
+		if _, err := io.ReadFull(r, body); err != nil {
+			break
+		}
+		rec, ok := decodeLogRecord(body)
+		if !ok {
+			break
+		}
+		rec.lsn = l.baseLSN + offset
+		records = append(records, rec)
+		offset += int64(length)
+	}
+	// drop a torn tail so later appends start right after the last good record
+	l.endLSN = l.baseLSN + offset
+	if err := l.file.Truncate(int64(logHeaderSize) + offset); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func decodeLogRecord(body []byte) (*logRecord, bool) {
+	b := bytes.NewBuffer(body)
+	var recType int8
+	var tid int64
+	binary.Read(b, binary.LittleEndian, &recType)
+	binary.Read(b, binary.LittleEndian, &tid)
+	rec := &logRecord{recType: logRecordType(recType), tid: tid}
+	if rec.recType != UpdateLogRecord {
+		return rec, b.Len() == 0
+	}
+	var nameLen, pageNo int32
+	if binary.Read(b, binary.LittleEndian, &nameLen) != nil || nameLen < 0 || int(nameLen) > b.Len() {
+		return nil, false
+	}
+	rec.fileName = string(b.Next(int(nameLen)))
+	if binary.Read(b, binary.LittleEndian, &pageNo) != nil || b.Len() != 2*PageSize {
+		return nil, false
+	}
+	rec.pageNo = int(pageNo)
+	rec.before = b.Next(PageSize)
+	rec.after = b.Next(PageSize)
+	return rec, true
+}
+
+// Read the LSN stored in the header of a page on disk.  Pages that don't exist
+// yet have LSN -1.
+func readPageLSN(file *os.File, pageNo int) int64 {
+	var lsnBytes [8]byte
+	n, err := file.ReadAt(lsnBytes[:], int64(pageNo*PageSize+pageLSNOffset))
+	if n != len(lsnBytes) || err != nil {
+		return -1
+	}
+	return int64(binary.LittleEndian.Uint64(lsnBytes[:]))
+}
+
+// Read the image of a page directly from the file it belongs to.  Pages past
+// the end of the file read as zeros.
+func readPageImage(fileName string, pageNo int) ([]byte, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	image := make([]byte, PageSize)
+	if _, err := file.ReadAt(image, int64(pageNo*PageSize)); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return image, nil
+}
+
+// Write a page image directly into the file it belongs to.  Returns false if
+// the file no longer exists (e.g., because its table was dropped).
+func writePageImage(fileName string, pageNo int, image []byte) (bool, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+	if _, err := file.WriteAt(image, int64(pageNo*PageSize)); err != nil {
+		return false, err
+	}
+	return true, file.Sync()
+}
+
+// Force the named file to disk.  Files that no longer exist are skipped.
+func syncFile(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// Bring the files referenced by the log to a transaction consistent state, in
+// the style of ARIES:
+//
+//   - analysis: find the transactions that never committed or aborted (losers)
+//   - redo: repeat history, reapplying the after image of every update whose
+//     LSN is newer than the LSN of the page on disk
+//   - undo: roll back the losers in reverse log order by writing their before
+//     images, logging each undo as a compensation record, and then log an
+//     abort record for each loser
+//
+// Because compensation records are redone like any other update, a crash
+// during recovery is handled by simply recovering again.  Once all files are
+// consistent the log is truncated.
+func (l *LogFile) recover() error {
+	records, err := l.readRecords()
+	if err != nil {
+		return err
+	}
+
+	// analysis
+	losers := map[int64]bool{}
+	for _, rec := range records {
+		switch rec.recType {
+		case BeginLogRecord, UpdateLogRecord:
+			losers[rec.tid] = true
+		case CommitLogRecord, AbortLogRecord:
+			delete(losers, rec.tid)
+		}
+	}
+
+	// redo
+	for _, rec := range records {
+		if rec.recType != UpdateLogRecord {
+			continue
+		}
+		file, err := os.OpenFile(rec.fileName, os.O_RDONLY, 0644)
+		if err != nil {
+			continue // file was removed, nothing to redo
+		}
+		diskLSN := readPageLSN(file, rec.pageNo)
+		file.Close()
+		if diskLSN >= rec.lsn {
+			continue
+		}
+		if _, err := writePageImage(rec.fileName, rec.pageNo, rec.after); err != nil {
+			return err
+		}
+	}
+
+	// undo
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := records[i]
+		if rec.recType != UpdateLogRecord || !losers[rec.tid] {
+			continue
+		}
+		image, err := l.logCompensation(rec.tid, rec.fileName, rec.pageNo, rec.after, rec.before)
+		if err != nil {
+			return err
+		}
+		if _, err := writePageImage(rec.fileName, rec.pageNo, image); err != nil {
+			return err
+		}
+	}
+	for tid := range losers {
+		if _, err := l.append(&logRecord{recType: AbortLogRecord, tid: tid}); err != nil {
+			return err
+		}
+	}
+	if err := l.force(); err != nil {
+		return err
+	}
+
+	// every file now reflects the log, so it can be discarded
+	return l.truncate()
+}
+
+// Close the underlying log file
+func (l *LogFile) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,215 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+const TestingLogFile string = "test.log"
+
+func makeLogTestVars(t *testing.T) (TupleDesc, Tuple, Tuple, *HeapFile, *BufferPool, TransactionID) {
+	td, t1, t2, hf, bp, tid := makeTestVars()
+	os.Remove(TestingLogFile)
+	log, err := NewLogFile(TestingLogFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = bp.useLog(log)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// makeTestVars began tid before the log was attached
+	bp.BeginTransaction(tid)
+	return td, t1, t2, hf, bp, tid
+}
+
+// Simulate a crash by throwing away the buffer pool, and recover the heap
+// file from the log with a fresh one
+func restartFromLog(t *testing.T, td *TupleDesc) (*HeapFile, *BufferPool) {
+	bp := NewBufferPool(3)
+	log, err := NewLogFile(TestingLogFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = bp.useLog(log)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf, err := NewHeapFile(TestingFile, td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return hf, bp
+}
+
+func countTuples(t *testing.T, hf *HeapFile, bp *BufferPool, t0 *Tuple) int {
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := hf.Iterator(tid, hf.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if tup.equals(t0) {
+			cnt++
+		}
+	}
+	bp.CommitTransaction(tid)
+	return cnt
+}
+
+func TestLogCommitIsNotForced(t *testing.T) {
+	_, t1, _, hf, bp, tid := makeLogTestVars(t)
+	err := hf.insertTuple(&t1, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	pg, err := hf.readPage(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len((*pg).(*heapPage).Slots) != 0 {
+		t.Errorf("committed page should not have been forced to disk")
+	}
+	if countTuples(t, hf, bp, &t1) != 1 {
+		t.Errorf("committed tuple not visible")
+	}
+}
+
+func TestLogRedoCommitted(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeLogTestVars(t)
+	for i := 0; i < 200; i++ {
+		err := hf.insertTuple(&t1, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	err := hf.insertTuple(&t2, tid2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// crash without flushing any pages
+	bp.log.Close()
+	hf, bp = restartFromLog(t, &td)
+	if cnt := countTuples(t, hf, bp, &t1); cnt != 200 {
+		t.Errorf("expected 200 committed tuples after recovery, got %d", cnt)
+	}
+	if cnt := countTuples(t, hf, bp, &t2); cnt != 0 {
+		t.Errorf("expected uncommitted tuple to be lost, got %d", cnt)
+	}
+}
+
+func TestLogUndoLoser(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeLogTestVars(t)
+	err := hf.insertTuple(&t1, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	err = hf.insertTuple(&t2, tid2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// log the uncommitted update and write it to disk, as if the page had been
+	// stolen just before the crash
+	pg := bp.Pages[hf.pageKey(0)]
+	_, err = bp.log.logUpdate(tid2, *pg, bp.beforeImages[hf.pageKey(0)])
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = hf.flushPage(pg)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	bp.log.Close()
+	hf, bp = restartFromLog(t, &td)
+	if cnt := countTuples(t, hf, bp, &t1); cnt != 1 {
+		t.Errorf("expected committed tuple after recovery, got %d", cnt)
+	}
+	if cnt := countTuples(t, hf, bp, &t2); cnt != 0 {
+		t.Errorf("expected uncommitted tuple to be undone, got %d", cnt)
+	}
+}
+
+func TestLogTornTail(t *testing.T) {
+	td, t1, _, hf, bp, tid := makeLogTestVars(t)
+	err := hf.insertTuple(&t1, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.CommitTransaction(tid)
+	bp.log.Close()
+
+	// a record that was only partially written
+	f, err := os.OpenFile(TestingLogFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	f.Write([]byte{200, 1, 0, 0, 1, 2, 3})
+	f.Close()
+
+	hf, bp = restartFromLog(t, &td)
+	if cnt := countTuples(t, hf, bp, &t1); cnt != 1 {
+		t.Errorf("expected committed tuple after recovery, got %d", cnt)
+	}
+}
+
+func TestLogCheckpoint(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeLogTestVars(t)
+	bp.log.checkpointSize = 0
+	err := hf.insertTuple(&t1, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = bp.CommitTransaction(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if size := bp.log.size(); size != 0 {
+		t.Errorf("expected the log to be truncated by the checkpoint, %d bytes left", size)
+	}
+
+	// a running transaction's pages are not flushed, so they can still be
+	// undone
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	err = hf.insertTuple(&t2, tid2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid3 := NewTID()
+	bp.BeginTransaction(tid3)
+	err = bp.CommitTransaction(tid3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the committed tuple survives a crash even though its records are gone
+	bp.log.Close()
+	hf, bp = restartFromLog(t, &td)
+	if cnt := countTuples(t, hf, bp, &t1); cnt != 1 {
+		t.Errorf("expected committed tuple after recovery, got %d", cnt)
+	}
+	if cnt := countTuples(t, hf, bp, &t2); cnt != 0 {
+		t.Errorf("expected uncommitted tuple to be lost, got %d", cnt)
+	}
+}
@@ -0,0 +1,172 @@
+package godb
+
+import "golang.org/x/exp/constraints"
+
+// SortMergeJoin is an equality join over inputs that are both sorted in
+// ascending order on their join key, such as the output of an [OrderBy] or an
+// [IndexScan].  It merges the two inputs in a single pass, keeping in memory
+// only the right tuples that share the current key, so unlike [EqualityJoin]
+// it needs neither a hash table nor spill files.
+type SortMergeJoin[T constraints.Ordered] struct {
+	// Expressions that when applied to tuples from the left or right operators,
+	// respectively, return the value of the left or right side of the join
+	leftField, rightField Expr
+
+	left, right Operator //operators for the two inputs of the join
+
+	// Function that when applied to a DBValue returns the join value; will be
+	// one of intFilterGetter or stringFilterGetter
+	getter func(DBValue) T
+}
+
+// Constructor for a sort-merge join of integer expressions
+// Returns an error if either the left or right expression is not an integer
+func NewIntSortMergeJoin(left Operator, leftField Expr, right Operator, rightField Expr) (*SortMergeJoin[int64], error) {
+	if leftField.GetExprType().Ftype != rightField.GetExprType().Ftype {
+		return nil, GoDBError{TypeMismatchError, "can't join fields of different types"}
+	}
+	switch leftField.GetExprType().Ftype {
+	case StringType:
+		return nil, GoDBError{TypeMismatchError, "join field is not an int"}
+	case IntType:
+		return &SortMergeJoin[int64]{leftField, rightField, left, right, intFilterGetter}, nil
+	}
+	return nil, GoDBError{TypeMismatchError, "unknown type"}
+}
+
+// Constructor for a sort-merge join of string expressions
+// Returns an error if either the left or right expression is not a string
+func NewStringSortMergeJoin(left Operator, leftField Expr, right Operator, rightField Expr) (*SortMergeJoin[string], error) {
+	if leftField.GetExprType().Ftype != rightField.GetExprType().Ftype {
+		return nil, GoDBError{TypeMismatchError, "can't join fields of different types"}
+	}
+	switch leftField.GetExprType().Ftype {
+	case StringType:
+		return &SortMergeJoin[string]{leftField, rightField, left, right, stringFilterGetter}, nil
+	case IntType:
+		return nil, GoDBError{TypeMismatchError, "join field is not a string"}
+	}
+	return nil, GoDBError{TypeMismatchError, "unknown type"}
+}
+
+// Return a TupleDescriptor for this join, containing the fields of the left
+// operator followed by those of the right operator
+func (j *SortMergeJoin[T]) Descriptor() *TupleDesc {
+	return j.left.Descriptor().merge(j.right.Descriptor())
+}
+
+// Return the join key of a tuple from the left or right input, and false if
+// the key is missing
+func (j *SortMergeJoin[T]) key(t *Tuple, left bool) (T, bool, error) {
+	field := j.rightField
+	if left {
+		field = j.leftField
+	}
+	var zero T
+	v, err := field.EvalExpr(t)
+	if err != nil || isNull(v) {
+		return zero, false, err
+	}
+	return j.getter(v), true, nil
+}
+
+// Return an iterator over the joined tuples.  The inputs are advanced in step:
+// whichever side has the smaller key moves forward, and when the keys are
+// equal the run of right tuples with that key is read into memory and joined
+// with every left tuple that has the same key, so keys that repeat on both
+// sides produce all of their pairs.  Results come out in key order.
+//
+// Returns an error from the iterator if either input turns out not to be
+// sorted on its join key.
+func (j *SortMergeJoin[T]) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	leftIter, err := j.left.Iterator(tid, j.left.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	rightIter, err := j.right.Iterator(tid, j.right.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		l, r       *Tuple // current left tuple and next unread right tuple
+		lKey, rKey T
+		group      []*Tuple // right tuples with key groupKey
+		groupKey   T
+		haveGroup  bool
+		pos        int // next tuple of group to join with l
+	)
+	// advance one of the inputs, checking that its keys never go backwards
+	advance := func(iter func() (*Tuple, error), t **Tuple, key *T, left bool) error {
+		prev, started := *key, *t != nil
+		next, err := iter()
+		if err != nil {
+			return err
+		}
+		*t = next
+		if next == nil {
+			return nil
+		}
+		k, ok, err := j.key(next, left)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// missing keys match nothing, and sort after all others, so
+			// the rest of the input can be skipped
+			*t = nil
+			return nil
+		}
+		*key = k
+		if started && *key < prev {
+			return GoDBError{IllegalOperationError, "sort-merge join input is not sorted on the join key"}
+		}
+		return nil
+	}
+	if err := advance(leftIter, &l, &lKey, true); err != nil {
+		return nil, err
+	}
+	if err := advance(rightIter, &r, &rKey, false); err != nil {
+		return nil, err
+	}
+
+	return func() (*Tuple, error) {
+		for l != nil {
+			if haveGroup && lKey == groupKey {
+				if pos < len(group) {
+					pos++
+					return joinTuples(l, group[pos-1]), nil
+				}
+				// done with this left tuple; the next one may share its key
+				pos = 0
+				if err := advance(leftIter, &l, &lKey, true); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			for r != nil && rKey < lKey {
+				if err := advance(rightIter, &r, &rKey, false); err != nil {
+					return nil, err
+				}
+			}
+			if r == nil {
+				return nil, nil
+			}
+			if lKey < rKey {
+				if err := advance(leftIter, &l, &lKey, true); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			// the keys are equal, so read in the right tuples with this key
+			group, groupKey, haveGroup, pos = group[:0], rKey, true, 0
+			for r != nil && rKey == groupKey {
+				group = append(group, r)
+				if err := advance(rightIter, &r, &rKey, false); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	}, nil
+}
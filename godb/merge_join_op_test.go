@@ -0,0 +1,116 @@
+package godb
+
+import (
+	"testing"
+)
+
+// Return an operator returning the tuples of hf sorted on its only field
+func sortedInput(hf *HeapFile) *OrderBy {
+	field := FieldExpr{hf.Descriptor().Fields[0]}
+	op, _ := NewOrderBy([]Expr{&field}, hf, []bool{true})
+	return op
+}
+
+func TestSortMergeJoin(t *testing.T) {
+	bp := NewBufferPool(500)
+	// keys repeat on both sides, and each side has keys the other lacks
+	left := makeJoinInput(t, BigJoinFile1, bp, []int64{5, 1, 3, 3, 9, 7, 3, 1, 0})
+	right := makeJoinInput(t, BigJoinFile2, bp, []int64{3, 8, 1, 3, 5, 5, 2, 10})
+
+	field := FieldExpr{left.Descriptor().Fields[0]}
+	join, err := NewIntSortMergeJoin(sortedInput(left), &field, sortedInput(right), &field)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	iter, err := join.Iterator(tid, join.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var keys []int64
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if tup.Fields[0].(IntField).Value != tup.Fields[1].(IntField).Value {
+			t.Fatalf("joined tuples with different keys: %v", tup.Fields)
+		}
+		keys = append(keys, tup.Fields[0].(IntField).Value)
+	}
+	// 1 matches 1*2, 3 matches 3*2, and 5 matches 1*2 times
+	expected := []int64{1, 1, 3, 3, 3, 3, 3, 3, 5, 5}
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %d results, got %d: %v", len(expected), len(keys), keys)
+	}
+	for i, k := range keys {
+		if k != expected[i] {
+			t.Fatalf("expected keys %v, got %v", expected, keys)
+		}
+	}
+}
+
+func TestSortMergeJoinUnsorted(t *testing.T) {
+	bp := NewBufferPool(500)
+	left := makeJoinInput(t, BigJoinFile1, bp, []int64{1, 2, 3})
+	right := makeJoinInput(t, BigJoinFile2, bp, []int64{1, 3, 2})
+
+	field := FieldExpr{left.Descriptor().Fields[0]}
+	join, err := NewIntSortMergeJoin(sortedInput(left), &field, right, &field)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	iter, err := join.Iterator(tid, join.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			return
+		}
+		if tup == nil {
+			t.Fatalf("expected an error joining an unsorted input")
+		}
+	}
+}
+
+func TestSortMergeJoinChosen(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	query := "select a.name, b.age from t a, t b where a.age = b.age and a.age >= 2 and b.age < 4"
+	plan, tuples := runQuery(t, c, query)
+	if _, ok := plan.(*Project).child.(*EqualityJoin[int64]); !ok {
+		t.Errorf("expected a hash join without an index, got %T", plan.(*Project).child)
+	}
+	if len(tuples) != 800 {
+		t.Errorf("expected 800 results, got %d", len(tuples))
+	}
+
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	plan, tuples = runQuery(t, c, query)
+	if _, ok := plan.(*Project).child.(*SortMergeJoin[int64]); !ok {
+		t.Fatalf("expected a sort-merge join over index scans, got %T", plan.(*Project).child)
+	}
+	if len(tuples) != 800 {
+		t.Errorf("expected 800 results, got %d", len(tuples))
+	}
+
+	// a sorted subquery can be merged with an index scan
+	plan, tuples = runQuery(t, c, "select b.age from (select age from t order by age) a, t b where a.age = b.age and b.age < 3")
+	if _, ok := plan.(*Project).child.(*SortMergeJoin[int64]); !ok {
+		t.Fatalf("expected a sort-merge join over a sorted subquery, got %T", plan.(*Project).child)
+	}
+	if len(tuples) != 1200 {
+		t.Errorf("expected 1200 results, got %d", len(tuples))
+	}
+}
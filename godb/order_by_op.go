@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"container/heap"
 	"sort"
 )
 
@@ -9,21 +10,51 @@ type OrderBy struct {
 	orderBy   []Expr // OrderBy should include these two fields (used by parser)
 	child     Operator
 	ascending []bool
+
+	// The maximum number of tuples the sort keeps in memory; larger inputs are
+	// sorted in runs that are written to spill files in dir and then merged
+	maxBufferSize int
+	dir           string
+	bufPool       *BufferPool // removes the runs left when the transaction ends
 }
 
+// The maximum number of runs merged at once; more runs than this are merged
+// in several passes, so that the sort doesn't run out of file handles
+const sortMergeFanIn = 64
+
 // Order by constructor -- should save the list of field, child, and ascending
 // values for use in the Iterator() method. Here, orderByFields is a list of
 // expressions that can be extacted from the child operator's tuples, and the
 // ascending bitmap indicates whether the ith field in the orderByFields
 // list should be in ascending (true) or descending (false) order.
 func NewOrderBy(orderByFields []Expr, child Operator, ascending []bool) (*OrderBy, error) {
+	return NewExternalOrderBy(orderByFields, child, ascending, SortBufferSize, "")
+}
+
+// Construct an order by that keeps at most maxBufferSize tuples in memory,
+// writing the sorted runs of larger inputs to temporary files in dir (or in
+// the default directory for temporary files if dir is empty).
+func NewExternalOrderBy(orderByFields []Expr, child Operator, ascending []bool, maxBufferSize int, dir string) (*OrderBy, error) {
+	if len(orderByFields) != len(ascending) {
+		return nil, GoDBError{IllegalOperationError, "order by needs a direction for every field"}
+	}
 	return &OrderBy{
-		orderBy:   orderByFields,
-		child:     child,
-		ascending: ascending,
+		orderBy:       orderByFields,
+		child:         child,
+		ascending:     ascending,
+		maxBufferSize: maxBufferSize,
+		dir:           dir,
 	}, nil
 }
 
+// Write the runs of the sort to dir, and remove any that are left when the
+// transaction running the sort ends, e.g. because a LIMIT stopped reading
+// its results, through bp
+func (o *OrderBy) spillTo(dir string, bp *BufferPool) {
+	o.dir = dir
+	o.bufPool = bp
+}
+
 func (o *OrderBy) Descriptor() *TupleDesc {
 	return o.child.Descriptor()
 }
@@ -55,7 +86,11 @@ func (ms *multiSorter) Swap(i, j int) {
 }
 
 func (ms *multiSorter) Less(i, j int) bool {
-	p, q := ms.tuples[i], ms.tuples[j]
+	return ms.lessTuples(ms.tuples[i], ms.tuples[j])
+}
+
+// Return true if p sorts before q
+func (ms *multiSorter) lessTuples(p, q *Tuple) bool {
 	// Try all but the last comparison.
 	var k int
 	for k = 0; k < len(ms.less)-1; k++ {
@@ -77,34 +112,140 @@ func (ms *multiSorter) Less(i, j int) bool {
 
 // Return a function that iterators through the results of the child iterator in
 // ascending/descending order, as specified in the construtor.  This sort is
-// "blocking" -- it should first construct an in-memory sorted list of results
-// to return, and then iterate through them one by one on each subsequent
-// invocation of the iterator function.
+// "blocking" -- it reads all of its input before returning the first result.
 //
-// Although you are free to implement your own sorting logic, you may wish to
-// leverage the go sort pacakge and the [sort.Sort] method for this purpose.  To
-// use this you will need to implement three methods:  Len, Swap, and Less that
-// the sort algorithm will invoke to preduce a sorted list. See the first
-// example, example of SortMultiKeys, and documentation at: https://pkg.go.dev/sort
+// Inputs of up to maxBufferSize tuples are sorted in memory.  Larger inputs
+// are sorted with an external merge sort: every maxBufferSize tuples are
+// sorted and written to a [spillFile] as a sorted run, and the runs are then
+// merged, at most sortMergeFanIn at a time, into a single sorted stream.  The
+// spill files are removed once the last tuple has been returned.
 func (o *OrderBy) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
-	childIterator, _ := o.child.Iterator(tid, o.child.Descriptor())
+	childIterator, err := o.child.Iterator(tid, o.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	sorter := o.sorter()
+	budget := o.maxBufferSize
+	if budget < 1 {
+		budget = 1
+	}
+	var runs []*spillFile
 	tuples := []*Tuple{}
 	for {
-		t, _ := childIterator()
+		t, err := childIterator()
+		if err != nil {
+			removeSpillFiles(runs)
+			return nil, err
+		}
 		if t == nil {
 			break
 		}
 		tuples = append(tuples, t)
+		if len(tuples) == budget {
+			run, err := o.writeRun(tid, sorter, tuples)
+			if err != nil {
+				removeSpillFiles(runs)
+				return nil, err
+			}
+			runs = append(runs, run)
+			tuples = []*Tuple{}
+		}
+	}
+
+	if len(runs) == 0 {
+		sorter.Sort(tuples)
+		counter := 0
+		return func() (*Tuple, error) {
+			for counter < len(tuples) {
+				returnVal := tuples[counter]
+				counter += 1
+				return returnVal, nil
+			}
+			return nil, nil
+		}, nil
+	}
+	if len(tuples) > 0 {
+		run, err := o.writeRun(tid, sorter, tuples)
+		if err != nil {
+			removeSpillFiles(runs)
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	tuples = nil
+
+	// merge the runs in passes until they can be merged in one go
+	for len(runs) > sortMergeFanIn {
+		var merged []*spillFile
+		for i := 0; i < len(runs); i += sortMergeFanIn {
+			end := i + sortMergeFanIn
+			if end > len(runs) {
+				end = len(runs)
+			}
+			run, err := o.mergeToRun(tid, sorter, runs[i:end])
+			if err != nil {
+				removeSpillFiles(merged)
+				removeSpillFiles(runs)
+				return nil, err
+			}
+			removeSpillFiles(runs[i:end])
+			merged = append(merged, run)
+		}
+		runs = merged
+	}
+
+	iter, err := mergeRuns(sorter, runs)
+	if err != nil {
+		removeSpillFiles(runs)
+		return nil, err
 	}
+	return func() (*Tuple, error) {
+		if runs == nil {
+			return nil, nil
+		}
+		t, err := iter()
+		if t == nil || err != nil {
+			removeSpillFiles(runs)
+			runs = nil
+		}
+		return t, err
+	}, nil
+}
+
+// Return a sorter for the order by fields and directions of o
+func (o *OrderBy) sorter() *multiSorter {
+	return makeSorter(o.orderBy, o.ascending)
+}
+
+// Return a sorter ordering tuples on the supplied fields, each either in
+// ascending or descending order
+func makeSorter(orderByFields []Expr, ascending []bool) *multiSorter {
 	lessthan := func(field Expr, t1, t2 *Tuple) bool {
 		dbval1, _ := field.EvalExpr(t1)
 		dbval2, _ := field.EvalExpr(t2)
+		if cmp, ok := compareNulls(dbval1, dbval2); ok {
+			return cmp < 0
+		}
 		switch field.GetExprType().Ftype {
 		case IntType:
 			val1 := dbval1.(IntField)
 			val2 := dbval2.(IntField)
 			return val1.Value < val2.Value
 
+		case FloatType:
+			val1 := dbval1.(FloatField)
+			val2 := dbval2.(FloatField)
+			return val1.Value < val2.Value
+
+		case DecimalType:
+			return dbval1.(DecimalField).cmp(dbval2.(DecimalField)) < 0
+
+		case DateType, TimestampType:
+			return temporalFilterGetter(dbval1) < temporalFilterGetter(dbval2)
+
+		case BoolType:
+			return boolFilterGetter(dbval1) < boolFilterGetter(dbval2)
+
 		case StringType:
 			val1 := dbval1.(StringField)
 			val2 := dbval2.(StringField)
@@ -115,12 +256,29 @@ func (o *OrderBy) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple,
 	greaterthan := func(field Expr, t1, t2 *Tuple) bool {
 		dbval1, _ := field.EvalExpr(t1)
 		dbval2, _ := field.EvalExpr(t2)
+		if cmp, ok := compareNulls(dbval1, dbval2); ok {
+			return cmp > 0
+		}
 		switch field.GetExprType().Ftype {
 		case IntType:
 			val1 := dbval1.(IntField)
 			val2 := dbval2.(IntField)
 			return val1.Value > val2.Value
 
+		case FloatType:
+			val1 := dbval1.(FloatField)
+			val2 := dbval2.(FloatField)
+			return val1.Value > val2.Value
+
+		case DecimalType:
+			return dbval1.(DecimalField).cmp(dbval2.(DecimalField)) > 0
+
+		case DateType, TimestampType:
+			return temporalFilterGetter(dbval1) > temporalFilterGetter(dbval2)
+
+		case BoolType:
+			return boolFilterGetter(dbval1) > boolFilterGetter(dbval2)
+
 		case StringType:
 			val1 := dbval1.(StringField)
 			val2 := dbval2.(StringField)
@@ -129,21 +287,147 @@ func (o *OrderBy) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple,
 		return false
 	}
 	orderFuncs := []lessFunc{}
-	for _, val := range o.ascending {
+	for _, val := range ascending {
 		if val {
 			orderFuncs = append(orderFuncs, lessthan)
 		} else {
 			orderFuncs = append(orderFuncs, greaterthan)
 		}
 	}
-	OrderedBy(o.orderBy, orderFuncs...).Sort(tuples)
-	counter := 0
+	return OrderedBy(orderByFields, orderFuncs...)
+}
+
+// Compare two values of which at least one is missing, returning -1, 0 or 1 as
+// v1 sorts before, with, or after v2, and true; missing values sort after all
+// others, so they come last in ascending order and first in descending order.
+// Returns false if neither value is missing.
+func compareNulls(v1, v2 DBValue) (int, bool) {
+	switch {
+	case isNull(v1) && isNull(v2):
+		return 0, true
+	case isNull(v1):
+		return 1, true
+	case isNull(v2):
+		return -1, true
+	}
+	return 0, false
+}
+
+// Sort tuples and write them to a new spill file of tid
+func (o *OrderBy) writeRun(tid TransactionID, sorter *multiSorter, tuples []*Tuple) (*spillFile, error) {
+	sorter.Sort(tuples)
+	run, err := o.bufPool.newSpillFile(tid, o.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tuples {
+		if err := run.append(t); err != nil {
+			run.remove()
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// Merge runs into a single new spill file of tid
+func (o *OrderBy) mergeToRun(tid TransactionID, sorter *multiSorter, runs []*spillFile) (*spillFile, error) {
+	iter, err := mergeRuns(sorter, runs)
+	if err != nil {
+		return nil, err
+	}
+	run, err := o.bufPool.newSpillFile(tid, o.dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			run.remove()
+			return nil, err
+		}
+		if t == nil {
+			return run, nil
+		}
+		if err := run.append(t); err != nil {
+			run.remove()
+			return nil, err
+		}
+	}
+}
+
+// The next tuple of a sorted run being merged
+type runHead struct {
+	tuple *Tuple
+	iter  func() (*Tuple, error)
+	run   int // position of the run, to break ties in the order of the runs
+}
+
+// A min-heap of the next tuples of the runs being merged
+type runHeap struct {
+	heads  []*runHead
+	sorter *multiSorter
+}
+
+func (h *runHeap) Len() int {
+	return len(h.heads)
+}
+
+func (h *runHeap) Less(i, j int) bool {
+	p, q := h.heads[i], h.heads[j]
+	if h.sorter.lessTuples(p.tuple, q.tuple) {
+		return true
+	}
+	return !h.sorter.lessTuples(q.tuple, p.tuple) && p.run < q.run
+}
+
+func (h *runHeap) Swap(i, j int) {
+	h.heads[i], h.heads[j] = h.heads[j], h.heads[i]
+}
+
+func (h *runHeap) Push(x any) {
+	h.heads = append(h.heads, x.(*runHead))
+}
+
+func (h *runHeap) Pop() any {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
+
+// Return an iterator over the tuples of the sorted runs in sorted order (a
+// k-way merge), repeatedly taking the smallest of the next tuples of the runs
+func mergeRuns(sorter *multiSorter, runs []*spillFile) (func() (*Tuple, error), error) {
+	h := &runHeap{sorter: sorter}
+	for i, run := range runs {
+		iter, err := run.iterator()
+		if err != nil {
+			return nil, err
+		}
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			h.heads = append(h.heads, &runHead{t, iter, i})
+		}
+	}
+	heap.Init(h)
 	return func() (*Tuple, error) {
-		for counter < len(tuples) {
-			returnVal := tuples[counter]
-			counter += 1
-			return returnVal, nil
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		head := h.heads[0]
+		t := head.tuple
+		next, err := head.iter()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			heap.Pop(h)
+		} else {
+			head.tuple = next
+			heap.Fix(h, 0)
 		}
-		return nil, nil
+		return t, nil
 	}, nil
 }
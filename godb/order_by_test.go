@@ -2,6 +2,7 @@ package godb
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -160,3 +161,122 @@ func TestMultiFieldOrderBy(t *testing.T) {
 	bp.CommitTransaction(tid)
 
 }
+
+// sort an input much larger than the sort's buffer, so that it is sorted in
+// runs that are merged in more than one pass, and compare the result with an
+// in-memory sort
+func TestExternalOrderBy(t *testing.T) {
+	var td = TupleDesc{Fields: []FieldType{
+		{Fname: "name", Ftype: StringType},
+		{Fname: "age", Ftype: IntType},
+	}}
+	bp := NewBufferPool(50)
+	os.Remove(TestingFile)
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	names := []string{"sam", "tim", "mike", "ann"}
+	for i := 0; i < 1000; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{names[i*7%4]}, IntField{int64(i * 37 % 101)}}}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	//order by name ascending and then age descending
+	exprs := []Expr{&FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}}
+	ascDesc := []bool{true, false}
+	readAll := func(oby *OrderBy) []*Tuple {
+		iter, err := oby.Iterator(tid, oby.Descriptor())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var tups []*Tuple
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return tups
+			}
+			tups = append(tups, tup)
+		}
+	}
+	inMemory, err := NewOrderBy(exprs, hf, ascDesc)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dir := t.TempDir()
+	external, err := NewExternalOrderBy(exprs, hf, ascDesc, 10, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := readAll(inMemory)
+	result := readAll(external)
+	if len(result) != 1000 || len(expected) != 1000 {
+		t.Fatalf("expected 1000 sorted tuples, got %d and %d", len(expected), len(result))
+	}
+	for i, tup := range result {
+		if i > 0 {
+			prev := result[i-1]
+			prevName, name := prev.Fields[0].(StringField).Value, tup.Fields[0].(StringField).Value
+			if prevName > name || (prevName == name && prev.Fields[1].(IntField).Value < tup.Fields[1].(IntField).Value) {
+				t.Fatalf("tuples %v and %v are out of order", prev.Fields, tup.Fields)
+			}
+		}
+		if !tup.equals(expected[i]) {
+			t.Fatalf("external sort differs from in-memory sort at position %d (expected %v, got %v)", i, expected[i].Fields, tup.Fields)
+		}
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("expected the sort to remove its runs, found %d files", len(files))
+	}
+}
+
+func TestSortAbandoned(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/catalog.txt", []byte("s (x int)\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c.SetSortBufferSize(3)
+	runQuery(t, c, "insert into s values (5), (3), (9), (1), (7), (2), (8), (4), (6), (0)")
+	spills := func() []string {
+		files, _ := filepath.Glob(dir + "/godb-spill-*")
+		return files
+	}
+
+	// stop reading after the first result, as a client closing the cursor
+	// would
+	_, plan, err := Parse(c, "select x from s order by x")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	iter, err := plan.Iterator(tid, plan.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup == nil || tup.Fields[0].(IntField).Value != 0 {
+		t.Fatalf("expected 0 first, got %v, %v", tup, err)
+	}
+	if len(spills()) == 0 {
+		t.Fatalf("expected the sort to write runs of 3 tuples to %s", dir)
+	}
+	if err := c.bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if files := spills(); len(files) != 0 {
+		t.Errorf("expected the runs to be removed at commit, found %v", files)
+	}
+}
@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -19,8 +20,34 @@ type LogicalFilterNode struct {
 type LogicalJoinNode struct {
 	left, right *LogicalSelectNode
 	predOp      BoolOp
+	joinType    JoinType // joins from the where clause are inner joins
+	nullable    []string // tables whose fields an outer join may pad with missing values
 }
 
+// A boolean combination of comparisons from a where clause that can't be
+// split into filters and joins, such as a disjunction or a comparison of two
+// columns of a table.  Comparisons have left and right set, null tests and
+// tests of boolean values have left set, while and, or and not nodes have
+// args.
+type LogicalPredNode struct {
+	op          LogicalPredOp
+	cmp         BoolOp
+	left, right *LogicalSelectNode
+	args        []*LogicalPredNode
+}
+
+type LogicalPredOp int
+
+const (
+	PredCompare LogicalPredOp = iota
+	PredAnd     LogicalPredOp = iota
+	PredOr      LogicalPredOp = iota
+	PredNot     LogicalPredOp = iota
+	PredIsNull  LogicalPredOp = iota
+	PredNotNull LogicalPredOp = iota
+	PredValue   LogicalPredOp = iota // a boolean value, such as a boolean column
+)
+
 type SelectExprType int
 
 const (
@@ -29,6 +56,8 @@ const (
 	ExprFunc  SelectExprType = iota
 	ExprStar  SelectExprType = iota
 	ExprAggr  SelectExprType = iota
+	ExprPred  SelectExprType = iota
+	ExprCase  SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
@@ -37,8 +66,16 @@ type LogicalSelectNode struct {
 	field       string
 	funcOp      *string //may be nil, if no aggregate
 	alias       string
-	value       string
+	value       string               //for constants, the value; for functions, predicates and CASE, the expression as written
+	null        bool                 //for constants, whether the constant is NULL
+	float       bool                 //for constants, whether the constant is a floating point number
+	interval    string               //for constants, the unit of an INTERVAL, e.g. "day", if the constant is one
+	boolean     bool                 //for constants, whether the constant is TRUE or FALSE
+	pred        *LogicalPredNode     //for predicates, such as comparisons, in the select list
+	whens       []*LogicalPredNode   //for CASE, the condition of each WHEN
+	thens       []*LogicalSelectNode //for CASE, the result of each WHEN, followed by the ELSE result if there is one
 	args        []*LogicalSelectNode //for functions other than aggregates
+	distinct    bool                 //for aggregates of distinct values, e.g. count(distinct x)
 	cachedField *FieldType
 }
 
@@ -83,6 +120,37 @@ func NewFuncSelectNode(op string, args []*LogicalSelectNode, alias string) Logic
 	return lsn
 }
 
+// Construct a select node for a predicate, e.g. the comparison age > 30 in
+// select age > 30 from t, with text, the predicate as written, as its name
+func NewPredSelectNode(pred *LogicalPredNode, text string, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprPred
+	lsn.pred = pred
+	lsn.value = text
+	lsn.alias = alias
+	// the operands of the predicate, which tell which table it reads and
+	// which aggregates it contains
+	lsn.args = pred.operands()
+	return lsn
+}
+
+// Construct a select node for CASE WHEN whens[0] THEN thens[0] ... END, with
+// an ELSE result if thens has one more element than whens, and with text, the
+// expression as written, as its name
+func NewCaseSelectNode(whens []*LogicalPredNode, thens []*LogicalSelectNode, text string, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprCase
+	lsn.whens = whens
+	lsn.thens = thens
+	lsn.value = text
+	lsn.alias = alias
+	for _, when := range whens {
+		lsn.args = append(lsn.args, when.operands()...)
+	}
+	lsn.args = append(lsn.args, thens...)
+	return lsn
+}
+
 func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, error) {
 	if table == "" && subqueries != nil {
 		for _, q := range subqueries {
@@ -120,7 +188,7 @@ func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPla
 	if lsn.exprType == ExprConst {
 		return "", "", nil
 	}
-	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
+	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr || lsn.exprType == ExprPred || lsn.exprType == ExprCase {
 		tabName := ""
 		fieldName := ""
 		for _, subLsn := range lsn.args {
@@ -173,12 +241,14 @@ type OrderByNode struct {
 
 type LogicalPlan struct {
 	filters       []*LogicalFilterNode
+	preds         []*LogicalPredNode
 	joins         []*LogicalJoinNode
 	selects       []*LogicalSelectNode
 	aggs          []*LogicalSelectNode
 	tables        []*LogicalTableNode
 	subqueries    []*LogicalPlan
 	groupByFields []*GroupBy
+	having        []*LogicalFilterNode
 	orderByFields []*OrderByNode
 	limit         *LogicalSelectNode
 	distinct      bool
@@ -189,59 +259,312 @@ func (p *LogicalPlan) getSubplanFields(c *Catalog) []*FieldType {
 	var nodes []*FieldType
 	for _, s := range p.selects {
 		_, field, _ := s.getTableField(c, p.subqueries, p.tables)
-		nodes = append(nodes, &FieldType{field, p.alias, UnknownType})
+		nodes = append(nodes, &FieldType{Fname: field, TableQualifier: p.alias, Ftype: UnknownType})
 	}
 	return nodes
 }
 
-func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, error) {
+// Parse a where clause into the filters comparing a column of a table to a
+// constant, the equality joins between tables, and the predicates that are
+// neither, such as disjunctions and comparisons of two columns.  The clause is
+// split on its top level conjunctions, so that each part can be applied
+// separately.
+func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, []*LogicalPredNode, error) {
 	switch expr := expr.(type) {
 	case *sqlparser.AndExpr:
 		//print("got and")
-		filterListLeft, joinListLeft, _ := parseWhere(c, subqueries, ts, expr.Left)
-		filterListRight, joinListRight, _ := parseWhere(c, subqueries, ts, expr.Right)
+		filterListLeft, joinListLeft, predListLeft, err := parseWhere(c, subqueries, ts, expr.Left)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		filterListRight, joinListRight, predListRight, err := parseWhere(c, subqueries, ts, expr.Right)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		filterExprs := append(filterListLeft, filterListRight...)
 		joinExprs := append(joinListLeft, joinListRight...)
-		return filterExprs, joinExprs, nil
+		predExprs := append(predListLeft, predListRight...)
+		return filterExprs, joinExprs, predExprs, nil
+	case *sqlparser.ParenExpr:
+		return parseWhere(c, subqueries, ts, expr.Expr)
+	case *sqlparser.OrExpr, *sqlparser.NotExpr, *sqlparser.IsExpr:
+		pred, err := parsePred(c, expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, []*LogicalPredNode{pred}, nil
 	case *sqlparser.ComparisonExpr:
-		op := BoolOpMap[expr.Operator]
+		op, ok := BoolOpMap[expr.Operator]
+		if !ok {
+			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported comparison operator %s", expr.Operator)}
+		}
 		//print(op)
 		//print("got compare")
 
 		left, err := parseExpr(c, expr.Left, "")
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		right, err := parseExpr(c, expr.Right, "")
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		//here we want to search the catalog for the table id, if it's not specified
 		lTable, _, err := left.getTableField(c, subqueries, ts)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		rTable, _, err := right.getTableField(c, subqueries, ts)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		if lTable != "" && rTable != "" && lTable != rTable { //join
-
-			if op != OpEq {
-				return nil, nil, GoDBError{IllegalOperationError, "only equality joins are supported"}
-			}
-			join := LogicalJoinNode{left, right, op}
+		if lTable != "" && rTable != "" && lTable != rTable && op == OpEq { //join
+			join := LogicalJoinNode{left, right, op, InnerJoin, nil}
 			lj := make([]*LogicalJoinNode, 1)
 			lj[0] = &join
-			return nil, lj, nil
-		} else {
+			return nil, lj, nil, nil
+		}
+		if lTable != "" && rTable == "" {
 			filter := LogicalFilterNode{*left, *right, op}
 			lf := make([]*LogicalFilterNode, 1)
 			lf[0] = &filter
-			return lf, nil, nil
+			return lf, nil, nil, nil
+		}
+		if flipped, ok := flipOp(op); ok && lTable == "" && rTable != "" {
+			//put the column on the left, e.g. 3 < age becomes age > 3
+			filter := LogicalFilterNode{*right, *left, flipped}
+			return []*LogicalFilterNode{&filter}, nil, nil, nil
+		}
+		//anything else, e.g. a comparison of two columns, is a general predicate
+		pred := &LogicalPredNode{op: PredCompare, cmp: op, left: left, right: right}
+		return nil, nil, []*LogicalPredNode{pred}, nil
+	default:
+		// a boolean value, such as a boolean column
+		pred, err := parsePred(c, expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, []*LogicalPredNode{pred}, nil
+	}
+}
+
+// Return the operator that compares b with a when op compares a with b, e.g.
+// > for <.  Returns false if there is no such operator.
+func flipOp(op BoolOp) (BoolOp, bool) {
+	switch op {
+	case OpGt:
+		return OpLt, true
+	case OpLt:
+		return OpGt, true
+	case OpGe:
+		return OpLe, true
+	case OpLe:
+		return OpGe, true
+	case OpEq, OpNeq:
+		return op, true
+	}
+	return op, false
+}
+
+// Parse a boolean combination of comparisons into a predicate
+func parsePred(c *Catalog, expr sqlparser.Expr) (*LogicalPredNode, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := parsePred(c, expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parsePred(c, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &LogicalPredNode{op: PredAnd, args: []*LogicalPredNode{left, right}}, nil
+	case *sqlparser.OrExpr:
+		left, err := parsePred(c, expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parsePred(c, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &LogicalPredNode{op: PredOr, args: []*LogicalPredNode{left, right}}, nil
+	case *sqlparser.NotExpr:
+		arg, err := parsePred(c, expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &LogicalPredNode{op: PredNot, args: []*LogicalPredNode{arg}}, nil
+	case *sqlparser.ParenExpr:
+		return parsePred(c, expr.Expr)
+	case *sqlparser.ComparisonExpr:
+		op, ok := BoolOpMap[expr.Operator]
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported comparison operator %s", expr.Operator)}
+		}
+		left, err := parseExpr(c, expr.Left, "")
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseExpr(c, expr.Right, "")
+		if err != nil {
+			return nil, err
+		}
+		return &LogicalPredNode{op: PredCompare, cmp: op, left: left, right: right}, nil
+	case *sqlparser.IsExpr:
+		var op LogicalPredOp
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			op = PredIsNull
+		case sqlparser.IsNotNullStr:
+			op = PredNotNull
+		default:
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported test %s", expr.Operator)}
+		}
+		arg, err := parseExpr(c, expr.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		return &LogicalPredNode{op: op, left: arg}, nil
+	}
+	// anything else must be a boolean value, which is checked once its type
+	// is known
+	arg, err := parseExpr(c, expr, "")
+	if err != nil {
+		return nil, err
+	}
+	return &LogicalPredNode{op: PredValue, left: arg}, nil
+}
+
+// Return the expressions the predicate compares or tests
+func (p *LogicalPredNode) operands() []*LogicalSelectNode {
+	switch p.op {
+	case PredCompare:
+		return []*LogicalSelectNode{p.left, p.right}
+	case PredIsNull, PredNotNull, PredValue:
+		return []*LogicalSelectNode{p.left}
+	}
+	var operands []*LogicalSelectNode
+	for _, arg := range p.args {
+		operands = append(operands, arg.operands()...)
+	}
+	return operands
+}
+
+// Return the names of the tables whose columns the predicate refers to
+func (p *LogicalPredNode) getTables(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) ([]string, error) {
+	var tables []string
+	add := func(lsn *LogicalSelectNode) error {
+		tabName, _, err := lsn.getTableField(c, subqueries, ts)
+		if err != nil {
+			return err
+		}
+		for _, t := range tables {
+			if t == tabName {
+				return nil
+			}
+		}
+		if tabName != "" {
+			tables = append(tables, tabName)
+		}
+		return nil
+	}
+	var walk func(p *LogicalPredNode) error
+	walk = func(p *LogicalPredNode) error {
+		switch p.op {
+		case PredCompare:
+			if err := add(p.left); err != nil {
+				return err
+			}
+			return add(p.right)
+		case PredIsNull, PredNotNull, PredValue:
+			return add(p.left)
+		}
+		for _, arg := range p.args {
+			if err := walk(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := walk(p)
+	return tables, err
+}
+
+// Generate the predicate over tuples described by inputDesc
+func (p *LogicalPredNode) generatePred(c *Catalog, inputDesc *TupleDesc, tableMap map[string]*PlanNode) (Predicate, error) {
+	if p.op == PredCompare {
+		left, _, err := p.left.generateExpr(c, inputDesc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		right, _, err := p.right.generateExpr(c, inputDesc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		return NewCompareExpr(p.cmp, left, right)
+	}
+	if p.op == PredIsNull || p.op == PredNotNull || p.op == PredValue {
+		arg, _, err := p.left.generateExpr(c, inputDesc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		if p.op == PredValue {
+			return NewBoolValueExpr(arg)
+		}
+		return NewIsNullExpr(arg, p.op == PredNotNull), nil
+	}
+	args := make([]Predicate, len(p.args))
+	for i, arg := range p.args {
+		pred, err := arg.generatePred(c, inputDesc, tableMap)
+		if err != nil {
+			return nil, err
 		}
+		args[i] = pred
+	}
+	switch p.op {
+	case PredAnd:
+		return NewAndExpr(args...), nil
+	case PredOr:
+		return NewOrExpr(args...), nil
+	}
+	return NewNotExpr(args[0]), nil
+}
+
+// Parse the predicates of a HAVING clause, a conjunction of comparisons
+// between aggregates, group by columns and constants.  Unlike the predicates
+// of a WHERE clause, both sides of a comparison may be arbitrary expressions,
+// as they are evaluated over the output of the aggregation.
+func parseHaving(c *Catalog, expr sqlparser.Expr) ([]*LogicalFilterNode, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := parseHaving(c, expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseHaving(c, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	case *sqlparser.ParenExpr:
+		return parseHaving(c, expr.Expr)
+	case *sqlparser.ComparisonExpr:
+		op, ok := BoolOpMap[expr.Operator]
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s in having clause", expr.Operator)}
+		}
+		left, err := parseExpr(c, expr.Left, "")
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseExpr(c, expr.Right, "")
+		if err != nil {
+			return nil, err
+		}
+		return []*LogicalFilterNode{{*left, *right, op}}, nil
 	default:
-		return nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
+		return nil, GoDBError{ParseError, "having expression that is not a comparison (disjunctions are not supported)"}
 	}
 }
 
@@ -304,23 +627,160 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		if joinTable.Join != "join" {
+		joinType, ok := joinTypes[joinTable.Join]
+		if !ok {
 			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported join type %s", joinTable.Join)}
 		}
+		if len(joinTable.Condition.Using) > 0 {
+			return nil, nil, nil, GoDBError{ParseError, "join ... using is not supported"}
+		}
 		tabList := append(leftTables, rightTables...)
 		subPlanList := append(leftSubplans, rightSubplans...)
-		_, joins, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
+		filters, joins, preds, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
 		if err != nil {
 			return nil, nil, nil, err
 		}
+		if len(preds) > 0 {
+			return nil, nil, nil, GoDBError{ParseError, "join conditions must be conjunctions of comparisons"}
+		}
+		if joinType != InnerJoin {
+			if len(joins) != 1 || len(filters) > 0 {
+				return nil, nil, nil, GoDBError{ParseError, "outer join conditions must be a single equality between the two sides"}
+			}
+			if err := orientOuterJoin(c, joins[0], joinType, leftTables, leftSubplans, rightTables, rightSubplans); err != nil {
+				return nil, nil, nil, err
+			}
+		}
 		return tabList, subPlanList, append(leftJoins, append(rightJoins, joins...)...), nil
 
 	}
 	return nil, nil, nil, GoDBError{ParseError, "unknown query type in parseFrom"}
 }
 
+// The join types of the from clause.  sqlparser has no full outer join, so
+// Parse rewrites FULL [OUTER] JOIN to STRAIGHT_JOIN, which GoDB doesn't
+// otherwise support, and rejects STRAIGHT_JOIN written in the query itself.
+var joinTypes = map[string]JoinType{
+	sqlparser.JoinStr:         InnerJoin,
+	sqlparser.LeftJoinStr:     LeftOuterJoin,
+	sqlparser.RightJoinStr:    RightOuterJoin,
+	sqlparser.StraightJoinStr: FullOuterJoin,
+}
+
+var fullJoinRegexp = regexp.MustCompile(`(?i)\bfull\s+(outer\s+)?join\b`)
+var straightJoinRegexp = regexp.MustCompile(`(?i)\bstraight_join\b`)
+
+// sqlparser has no BOOL or BOOLEAN column type either, so Parse rewrites them
+// to BIT where they follow a column name in CREATE TABLE statements
+var createTableRegexp = regexp.MustCompile(`(?i)^\s*create\s+table\b`)
+var boolTypeRegexp = regexp.MustCompile("(?i)([(,]\\s*(?:\\w+|`[^`]*`)\\s+)bool(?:ean)?\\b")
+
+var concatRegexp = regexp.MustCompile(`\|\|`)
+
+// sqlparser reads || as OR, as MySQL does, rather than as SQL's string
+// concatenation, so Parse rewrites it to |, which GoDB otherwise doesn't
+// support, and which parseExpr reads as concat.  Quoted strings and names are
+// left as they are.
+func rewriteConcat(query string) string {
+	return replaceUnquoted(concatRegexp, query, "|")
+}
+
+// Report which bytes of query are part of a quoted string or name, quotes
+// included
+func quotedBytes(query string) []bool {
+	quoted := make([]bool, len(query))
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			quoted[i] = true
+			if ch == '\\' && i+1 < len(query) {
+				i++
+				quoted[i] = true
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quoted[i] = true
+			quote = ch
+		}
+	}
+	return quoted
+}
+
+// Replace the matches of re that start outside the quoted strings and names
+// of query with repl, which may refer to the submatches of re as in
+// Regexp.Expand
+func replaceUnquoted(re *regexp.Regexp, query string, repl string) string {
+	quoted := quotedBytes(query)
+	var out []byte
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(query, -1) {
+		if quoted[m[0]] {
+			continue
+		}
+		out = append(out, query[last:m[0]]...)
+		out = re.ExpandString(out, repl, query, m)
+		last = m[1]
+	}
+	return string(append(out, query[last:]...))
+}
+
+// Report whether re matches query outside its quoted strings and names
+func matchUnquoted(re *regexp.Regexp, query string) bool {
+	return replaceUnquoted(re, query, "") != query
+}
+
+// Set the type of the join node j of an outer join, and the tables it pads
+// with missing values, swapping its sides if needed so that its left side is
+// a field of the left input (given by leftTables and leftSubplans) of the
+// join
+func orientOuterJoin(c *Catalog, j *LogicalJoinNode, joinType JoinType, leftTables []*LogicalTableNode, leftSubplans []*LogicalPlan, rightTables []*LogicalTableNode, rightSubplans []*LogicalPlan) error {
+	if j.predOp != OpEq {
+		return GoDBError{ParseError, "outer join conditions must be a single equality between the two sides"}
+	}
+	leftNames, rightNames := tableNames(leftTables, leftSubplans), tableNames(rightTables, rightSubplans)
+	tabName, _, err := j.left.getTableField(c, append(leftSubplans, rightSubplans...), append(leftTables, rightTables...))
+	if err != nil {
+		return err
+	}
+	if !leftNames[tabName] {
+		j.left, j.right = j.right, j.left
+	}
+	j.joinType = joinType
+	if joinType == LeftOuterJoin || joinType == FullOuterJoin {
+		for name := range rightNames {
+			j.nullable = append(j.nullable, name)
+		}
+	}
+	if joinType == RightOuterJoin || joinType == FullOuterJoin {
+		for name := range leftNames {
+			j.nullable = append(j.nullable, name)
+		}
+	}
+	return nil
+}
+
+// Return the set of names by which the planner refers to the supplied tables
+// and subqueries
+func tableNames(tables []*LogicalTableNode, subplans []*LogicalPlan) map[string]bool {
+	names := make(map[string]bool)
+	for _, t := range tables {
+		if t.alias != "" {
+			names[t.alias] = true
+		} else {
+			names[t.tableName] = true
+		}
+	}
+	for _, p := range subplans {
+		names[p.alias] = true
+	}
+	return names
+}
+
 func isAgg(funcName string) bool {
-	aggs := []string{"count", "sum", "avg", "min", "max"}
+	aggs := []string{"count", "sum", "avg", "min", "max", "bool_and", "bool_or"}
 	for _, s := range aggs {
 		if s == funcName {
 			return true
@@ -337,9 +797,12 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 			if len(expr.Exprs) != 1 {
 				return nil, GoDBError{ParseError, fmt.Sprintf("expected one argument to aggregate %s in select list", sqlparser.String(expr.Name))}
 			}
+			if expr.Distinct && funName != "count" {
+				return nil, GoDBError{ParseError, fmt.Sprintf("distinct is not supported in aggregate %s", funName)}
+			}
 			star, ok := expr.Exprs[0].(*sqlparser.StarExpr)
 			if ok {
-				if funName != "count" {
+				if funName != "count" || expr.Distinct {
 					return nil, GoDBError{ParseError, "got * in non-count aggregate"}
 				}
 				subField := NewFieldSelectNode(strings.ToLower(sqlparser.String(star.TableName)), "*", "")
@@ -351,6 +814,7 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 				return nil, err
 			}
 			outer := NewAggrSelectNode(funName, field, alias)
+			outer.distinct = expr.Distinct
 			return &outer, nil
 		} else {
 			funName := strings.ToLower(sqlparser.String(expr.Name))
@@ -366,10 +830,15 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 				funName = funName[1 : len(funName)-1]
 			}
 			outer := NewFuncSelectNode(funName, exprList, alias)
+			outer.value = sqlparser.String(expr)
 			return &outer, nil
 		}
 	case *sqlparser.BinaryExpr:
 		opname := expr.Operator
+		if opname == sqlparser.BitOrStr {
+			// a || b, which Parse has rewritten
+			opname = "concat"
+		}
 		left, err := parseExpr(c, expr.Left, "")
 		if err != nil {
 			return nil, err
@@ -382,6 +851,7 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 		exprList[0] = left
 		exprList[1] = right
 		outer := NewFuncSelectNode(opname, exprList, alias)
+		outer.value = sqlparser.String(expr)
 		return &outer, nil
 	case *sqlparser.ParenExpr:
 		return parseExpr(c, expr.Expr, alias)
@@ -402,6 +872,80 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 			//str = str[-1]
 		}
 		field := NewConstSelectNode(str, alias)
+		field.float = expr.Type == sqlparser.FloatVal
+		return &field, nil
+	case *sqlparser.NullVal:
+		field := NewConstSelectNode("null", alias)
+		field.null = true
+		return &field, nil
+	case sqlparser.BoolVal:
+		field := NewConstSelectNode(sqlparser.String(expr), alias)
+		field.boolean = true
+		return &field, nil
+	case *sqlparser.ComparisonExpr, *sqlparser.AndExpr, *sqlparser.OrExpr, *sqlparser.NotExpr, *sqlparser.IsExpr:
+		pred, err := parsePred(c, expr)
+		if err != nil {
+			return nil, err
+		}
+		field := NewPredSelectNode(pred, sqlparser.String(expr), alias)
+		return &field, nil
+	case *sqlparser.CaseExpr:
+		// CASE x WHEN v THEN ... is CASE WHEN x = v THEN ...
+		var subject *LogicalSelectNode
+		if expr.Expr != nil {
+			var err error
+			subject, err = parseExpr(c, expr.Expr, "")
+			if err != nil {
+				return nil, err
+			}
+		}
+		var whens []*LogicalPredNode
+		var thens []*LogicalSelectNode
+		for _, when := range expr.Whens {
+			var cond *LogicalPredNode
+			if subject != nil {
+				value, err := parseExpr(c, when.Cond, "")
+				if err != nil {
+					return nil, err
+				}
+				cond = &LogicalPredNode{op: PredCompare, cmp: OpEq, left: subject, right: value}
+			} else {
+				var err error
+				cond, err = parsePred(c, when.Cond)
+				if err != nil {
+					return nil, err
+				}
+			}
+			result, err := parseExpr(c, when.Val, "")
+			if err != nil {
+				return nil, err
+			}
+			whens = append(whens, cond)
+			thens = append(thens, result)
+		}
+		if expr.Else != nil {
+			result, err := parseExpr(c, expr.Else, "")
+			if err != nil {
+				return nil, err
+			}
+			thens = append(thens, result)
+		}
+		field := NewCaseSelectNode(whens, thens, sqlparser.String(expr), alias)
+		return &field, nil
+	case *sqlparser.IntervalExpr:
+		// INTERVAL n UNIT, where n is a whole number, which may be quoted
+		n, ok := expr.Expr.(*sqlparser.SQLVal)
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("expected a number in %s", sqlparser.String(expr))}
+		}
+		if _, err := strconv.ParseInt(string(n.Val), 10, 64); err != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("expected a whole number in %s", sqlparser.String(expr))}
+		}
+		if _, err := newInterval(0, expr.Unit); err != nil {
+			return nil, err
+		}
+		field := NewConstSelectNode(string(n.Val), alias)
+		field.interval = strings.ToLower(expr.Unit)
 		return &field, nil
 	default:
 		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
@@ -430,7 +974,7 @@ func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
 	switch s.exprType {
 	case ExprAggr:
 		return []*LogicalSelectNode{s}
-	case ExprFunc:
+	case ExprFunc, ExprPred, ExprCase:
 		var aggs []*LogicalSelectNode
 		for _, subs := range s.args {
 			aggs = append(aggs, extractAggs(subs)...)
@@ -447,6 +991,7 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		subplans []*LogicalPlan
 		joins    []*LogicalJoinNode
 		filters  []*LogicalFilterNode
+		preds    []*LogicalPredNode
 		aggs     []*LogicalSelectNode
 		selects  []*LogicalSelectNode
 		groupBys []*GroupBy
@@ -473,12 +1018,13 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 					}
 		*/
 		//}
-		newFilters, newJoins, err := parseWhere(c, subplans, tables, where.Expr)
+		newFilters, newJoins, newPreds, err := parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
 			return nil, err
 		}
 		joins = append(joins, newJoins...)
 		filters = append(filters, newFilters...)
+		preds = append(preds, newPreds...)
 	}
 	//extract select list
 	for _, stmt := range s.SelectExprs {
@@ -495,9 +1041,30 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		if err != nil {
 			return nil, err
 		}
+		expr, err = groupByAlias(c, expr, selects, subplans, tables)
+		if err != nil {
+			return nil, err
+		}
 		groupBys = append(groupBys, &GroupBy{expr})
 	}
 
+	var having []*LogicalFilterNode
+	if s.Having != nil {
+		var err error
+		having, err = parseHaving(c, s.Having.Expr)
+		if err != nil {
+			return nil, err
+		}
+		//aggregates that only appear in the having clause still have to be computed
+		for _, h := range having {
+			aggs = append(aggs, extractAggs(&h.fieldExpr)...)
+			aggs = append(aggs, extractAggs(&h.constExpr)...)
+		}
+		if len(aggs) == 0 && len(groupBys) == 0 {
+			return nil, GoDBError{ParseError, "having clause in a query without aggregates or group by"}
+		}
+	}
+
 	for _, oby := range s.OrderBy {
 		expr, err := parseExpr(c, oby.Expr, "")
 		if err != nil {
@@ -517,11 +1084,35 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		}
 	}
 
-	p := LogicalPlan{filters, joins, selects, aggs, tables, subplans, groupBys, orderBys, limExpr, s.Distinct != "", ""}
+	p := LogicalPlan{filters, preds, joins, selects, aggs, tables, subplans, groupBys, having, orderBys, limExpr, s.Distinct != "", ""}
 
 	return &p, nil
 }
 
+// Return the expression of the select list that a GROUP BY name refers to by
+// its alias, or gby itself if gby is not a name or names a field of the
+// tables or subqueries of the query
+func groupByAlias(c *Catalog, gby *LogicalSelectNode, selects []*LogicalSelectNode, subplans []*LogicalPlan, tables []*LogicalTableNode) (*LogicalSelectNode, error) {
+	if gby.exprType != ExprField || gby.table != "" {
+		return gby, nil
+	}
+	if tabName, err := checkNameInTablesOrSubqueries("", gby.field, c, subplans, tables); err != nil || tabName != "" {
+		return gby, err
+	}
+	for _, sel := range selects {
+		if sel.alias != gby.field {
+			continue
+		}
+		if len(extractAggs(sel)) > 0 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("cannot group by %s, which is an aggregate", gby.field)}
+		}
+		expr := *sel
+		expr.alias = ""
+		return &expr, nil
+	}
+	return gby, nil
+}
+
 func fieldToOp(tab string, field string, opMap map[string]*PlanNode) (*PlanNode, error) {
 	node := opMap[tab]
 
@@ -589,7 +1180,7 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		if s.cachedField != nil {
 			field = *s.cachedField
 		} else {
-			fieldNo, err := findFieldInTd(FieldType{s.field, s.table, UnknownType}, inputDesc)
+			fieldNo, err := findFieldInTd(FieldType{Fname: s.field, TableQualifier: s.table, Ftype: UnknownType}, inputDesc)
 			// if it doesn't match a field in the descriptor,
 			// look in the underlying tables
 			if err != nil {
@@ -633,7 +1224,30 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		var fval any
 		constType := StringType
 		intFval, e := strconv.Atoi(s.value)
-		if e == nil {
+		if s.null {
+			// the type of NULL is that of whatever it is compared with or
+			// assigned to
+			fval = NullField{}
+			constType = UnknownType
+		} else if s.boolean {
+			constType = BoolType
+			fval = BoolField{s.value == "true"}
+		} else if s.interval != "" {
+			n, _ := strconv.ParseInt(s.value, 10, 64)
+			iv, err := newInterval(n, s.interval)
+			if err != nil {
+				return nil, "", err
+			}
+			constType = IntervalType
+			fval = iv
+		} else if s.float {
+			floatFval, err := strconv.ParseFloat(s.value, 64)
+			if err != nil {
+				return nil, "", GoDBError{ParseError, fmt.Sprintf("malformed number %s", s.value)}
+			}
+			constType = FloatType
+			fval = FloatField{floatFval}
+		} else if e == nil {
 			constType = IntType
 			fval = IntField{int64(intFval)}
 		} else {
@@ -650,6 +1264,11 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		if s.alias != "" {
 			fieldName = s.alias
 		}
+		// a function that is grouped on has already been computed by the
+		// aggregate, and is one of its fields
+		if fieldNo, err := findFieldInTd(FieldType{Fname: s.value, Ftype: UnknownType}, inputDesc); err == nil {
+			return &FieldExpr{inputDesc.Fields[fieldNo]}, fieldName, nil
+		}
 		exprs := make([]*Expr, len(s.args))
 		for i, lsn := range s.args {
 			newExpr, _, err := lsn.generateExpr(c, inputDesc, tableMap)
@@ -658,16 +1277,87 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 			}
 			exprs[i] = &newExpr
 		}
+		if len(exprs) == 2 && !takesExactly(*s.funcOp, exprs) {
+			// convert the operands to the same type, e.g. so that price *
+			// 1.05 is computed exactly for a decimal price
+			left, right := promoteNumeric(*exprs[0], *exprs[1])
+			exprs[0], exprs[1] = &left, &right
+		}
+		// check the types of the arguments now, rather than when the
+		// function is first evaluated
+		if _, err := resolveFunc(*s.funcOp, exprs); err != nil {
+			return nil, "", err
+		}
 
 		fe := FuncExpr{*s.funcOp, exprs}
 		return &fe, fieldName, nil
-	}
-	return nil, "", GoDBError{ParseError, "unhandled expression type in select list"}
-
+	case ExprPred:
+		fieldName := s.value
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		// as is a predicate that is grouped on
+		if fieldNo, err := findFieldInTd(FieldType{Fname: s.value, Ftype: UnknownType}, inputDesc); err == nil {
+			return &FieldExpr{inputDesc.Fields[fieldNo]}, fieldName, nil
+		}
+		pred, err := s.pred.generatePred(c, inputDesc, tableMap)
+		if err != nil {
+			return nil, "", err
+		}
+		return pred, fieldName, nil
+	case ExprCase:
+		fieldName := s.value
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		// a CASE that is grouped on has already been computed by the
+		// aggregate, and is one of its fields
+		if fieldNo, err := findFieldInTd(FieldType{Fname: s.value, Ftype: UnknownType}, inputDesc); err == nil {
+			return &FieldExpr{inputDesc.Fields[fieldNo]}, fieldName, nil
+		}
+		conds := make([]Predicate, len(s.whens))
+		for i, when := range s.whens {
+			cond, err := when.generatePred(c, inputDesc, tableMap)
+			if err != nil {
+				return nil, "", err
+			}
+			conds[i] = cond
+		}
+		results := make([]Expr, len(s.thens))
+		for i, then := range s.thens {
+			result, _, err := then.generateExpr(c, inputDesc, tableMap)
+			if err != nil {
+				return nil, "", err
+			}
+			results[i] = result
+		}
+		var els Expr
+		if len(results) > len(conds) {
+			results, els = results[:len(conds)], results[len(conds)]
+		}
+		ce, err := NewCaseExpr(s.value, conds, results, els)
+		if err != nil {
+			return nil, "", err
+		}
+		return ce, fieldName, nil
+	}
+	return nil, "", GoDBError{ParseError, "unhandled expression type in select list"}
+
 }
 
 const JoinBufferSize int = 10000000
 
+// The maximum number of tuples an ORDER BY sorts in memory, unless the
+// catalog sets another (see [Catalog.SetSortBufferSize])
+const SortBufferSize int = 1000000
+
+// The maximum number of groups a GROUP BY aggregates in memory, unless the
+// catalog sets another (see [Catalog.SetAggBufferSize])
+const AggBufferSize int = 1000000
+
+// The maximum number of distinct tuples a SELECT DISTINCT remembers in memory
+const DistinctBufferSize int = 1000000
+
 func exprToStr(e Expr) string {
 	switch ex := e.(type) {
 	case *FieldExpr:
@@ -684,6 +1374,28 @@ func exprToStr(e Expr) string {
 			argStr += fmt.Sprintf("%s,", exprToStr(*arg))
 		}
 		return fmt.Sprintf("%s(%s)", ex.op, argStr)
+	case *CompareExpr:
+		return fmt.Sprintf("%s %s %s", exprToStr(ex.left), opToStr(ex.op), exprToStr(ex.right))
+	case *IsNullExpr:
+		return fmt.Sprintf("%s %s", exprToStr(ex.expr), ex.GetExprType().Fname)
+	case *BoolValueExpr:
+		return exprToStr(ex.expr)
+	case *CaseExpr:
+		return ex.name
+	case *NamedExpr:
+		return ex.name
+	case *BoolExpr:
+		if ex.op == "not" {
+			return fmt.Sprintf("not (%s)", exprToStr(ex.args[0]))
+		}
+		argStr := ""
+		for i, arg := range ex.args {
+			if i > 0 {
+				argStr += " " + ex.op + " "
+			}
+			argStr += "(" + exprToStr(arg) + ")"
+		}
+		return argStr
 	default:
 		return fmt.Sprintf("%+v, ", e)
 	}
@@ -737,25 +1449,58 @@ func getStrFromObj(obj any) string {
 	return fmt.Sprintf("%v", obj)
 }
 
+// Prefixes naming the type of a join in a printed plan
+var joinTypeNames = map[JoinType]string{
+	InnerJoin:      "",
+	LeftOuterJoin:  "Left Outer ",
+	RightOuterJoin: "Right Outer ",
+	FullOuterJoin:  "Full Outer ",
+}
+
 func PrintPhysicalPlan(o Operator, indent string) {
 	switch op := o.(type) {
 	case *EqualityJoin[int64]:
-		fmt.Printf("%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
+		fmt.Printf("%s%sHash Join, %+v == %+v\n", indent, joinTypeNames[op.joinType], exprToStr(op.leftField), exprToStr(op.rightField))
 		indent = indent + "\t"
 		PrintPhysicalPlan(*op.left, indent)
 		PrintPhysicalPlan(*op.right, indent)
 	case *EqualityJoin[string]:
-		fmt.Printf("%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
+		fmt.Printf("%s%sHash Join, %+v == %+v\n", indent, joinTypeNames[op.joinType], exprToStr(op.leftField), exprToStr(op.rightField))
 		indent = indent + "\t"
 		PrintPhysicalPlan(*op.left, indent)
 		PrintPhysicalPlan(*op.right, indent)
+	case *EqualityJoin[float64]:
+		fmt.Printf("%s%sHash Join, %+v == %+v\n", indent, joinTypeNames[op.joinType], exprToStr(op.leftField), exprToStr(op.rightField))
+		indent = indent + "\t"
+		PrintPhysicalPlan(*op.left, indent)
+		PrintPhysicalPlan(*op.right, indent)
+	case *EqualityJoin[DecimalField]:
+		fmt.Printf("%s%sHash Join, %+v == %+v\n", indent, joinTypeNames[op.joinType], exprToStr(op.leftField), exprToStr(op.rightField))
+		indent = indent + "\t"
+		PrintPhysicalPlan(*op.left, indent)
+		PrintPhysicalPlan(*op.right, indent)
+
+	case *SortMergeJoin[int64]:
+		fmt.Printf("%sSort Merge Join, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
+		indent = indent + "\t"
+		PrintPhysicalPlan(op.left, indent)
+		PrintPhysicalPlan(op.right, indent)
+	case *SortMergeJoin[string]:
+		fmt.Printf("%sSort Merge Join, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
+		indent = indent + "\t"
+		PrintPhysicalPlan(op.left, indent)
+		PrintPhysicalPlan(op.right, indent)
 
 	case *Project:
 		selectStr := ""
 		for _, ex := range op.selectFields {
 			selectStr += exprToStr(ex) + ","
 		}
-		fmt.Printf("%sProject %+v -> %+v\n", indent, selectStr, op.outputNames)
+		distinctStr := ""
+		if op.distinct {
+			distinctStr = "Distinct "
+		}
+		fmt.Printf("%sProject %s%+v -> %+v\n", indent, distinctStr, selectStr, op.outputNames)
 		indent = indent + "\t"
 		PrintPhysicalPlan(op.child, indent)
 	case *Filter[int64]:
@@ -766,8 +1511,22 @@ func PrintPhysicalPlan(o Operator, indent string) {
 		fmt.Printf("%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
 		indent = indent + "\t"
 		PrintPhysicalPlan(op.child, indent)
+	case *Filter[float64]:
+		fmt.Printf("%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
+		indent = indent + "\t"
+		PrintPhysicalPlan(op.child, indent)
+	case *PredicateFilter:
+		fmt.Printf("%sFilter %s\n", indent, exprToStr(op.pred))
+		indent = indent + "\t"
+		PrintPhysicalPlan(op.child, indent)
+	case *AliasOp:
+		fmt.Printf("%sAlias %s\n", indent, op.alias)
+		indent = indent + "\t"
+		PrintPhysicalPlan(op.child, indent)
 	case *ColumnFile:
 		fmt.Printf("%sHeap Scan %v\n", indent, getStrFromObj(op))
+	case *IndexScan:
+		fmt.Printf("%sIndex Scan %s on %v, %s\n", indent, op.name, getStrFromObj(op.table), op.rangeString())
 	case *OrderBy:
 		orderStr := ""
 		for _, ex := range op.orderBy {
@@ -776,6 +1535,14 @@ func PrintPhysicalPlan(o Operator, indent string) {
 		fmt.Printf("%sOrder By %s\n", indent, orderStr)
 		indent = indent + "\t"
 		PrintPhysicalPlan(op.child, indent)
+	case *TopN:
+		orderStr := ""
+		for _, ex := range op.orderBy {
+			orderStr += exprToStr(ex) + ","
+		}
+		fmt.Printf("%sTop N %s Order By %s\n", indent, exprToStr(op.limitTups), orderStr)
+		indent = indent + "\t"
+		PrintPhysicalPlan(op.child, indent)
 	case *LimitOp:
 		fmt.Printf("%sLimit %s\n", indent, exprToStr(op.limitTups))
 		indent = indent + "\t"
@@ -803,6 +1570,150 @@ func PrintPhysicalPlan(o Operator, indent string) {
 	}
 }
 
+// Bounds on an indexed column collected from the filters of a query
+type indexBounds struct {
+	idx         *tableIndex
+	lo, hi      DBValue
+	loInclusive bool
+	hiInclusive bool
+	eq          bool                 // whether lo and hi come from an equality predicate
+	used        []*LogicalFilterNode // filters enforced by the bounds
+}
+
+// Return how selective a scan with the bounds is likely to be; equality is
+// preferred over a closed range, and a closed range over an open one
+func (b *indexBounds) rank() int {
+	if b.eq {
+		return 3
+	}
+	if b.lo != nil && b.hi != nil {
+		return 2
+	}
+	return 1
+}
+
+// Choose an index to scan table t (named name in the query) with.  Filters
+// comparing an indexed column of t to a constant become the bounds of the
+// scan.  Returns nil if no index applies, and otherwise the [IndexScan] along
+// with the filters that still have to be applied on top of it.
+func chooseIndexScan(c *Catalog, plan *LogicalPlan, t *LogicalTableNode, name string, filters []*LogicalFilterNode) (Operator, []*LogicalFilterNode, error) {
+	var candidates []*indexBounds
+	byColumn := make(map[string]*indexBounds)
+	for _, f := range filters {
+		if f.fieldExpr.exprType != ExprField || f.constExpr.exprType != ExprConst {
+			continue
+		}
+		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
+		if err != nil || tabName != name {
+			continue
+		}
+		idx := c.findIndexOn(t.tableName, fieldName)
+		if idx == nil {
+			continue
+		}
+		constExpr, _, err := f.constExpr.generateExpr(c, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		val, err := constExpr.EvalExpr(nil)
+		if err != nil || !idx.file.checkKey(val) {
+			continue
+		}
+		b := byColumn[fieldName]
+		if b == nil {
+			b = &indexBounds{idx: idx}
+			byColumn[fieldName] = b
+			candidates = append(candidates, b)
+		}
+		switch {
+		case b.eq:
+			// the column is already restricted to a single key
+		case f.predOp == OpEq:
+			*b = indexBounds{idx, val, val, true, true, true, []*LogicalFilterNode{f}}
+		case (f.predOp == OpGt || f.predOp == OpGe) && b.lo == nil:
+			b.lo, b.loInclusive = val, f.predOp == OpGe
+			b.used = append(b.used, f)
+		case (f.predOp == OpLt || f.predOp == OpLe) && b.hi == nil:
+			b.hi, b.hiInclusive = val, f.predOp == OpLe
+			b.used = append(b.used, f)
+		}
+	}
+	var best *indexBounds
+	for _, b := range candidates {
+		if len(b.used) > 0 && (best == nil || b.rank() > best.rank()) {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil, filters, nil
+	}
+	scan, err := NewIndexScan(best.idx.name, best.idx.file, *t.file, best.lo, best.loInclusive, best.hi, best.hiInclusive)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rest []*LogicalFilterNode
+	for _, f := range filters {
+		used := false
+		for _, u := range best.used {
+			used = used || u == f
+		}
+		if !used {
+			rest = append(rest, f)
+		}
+	}
+	return scan, rest, nil
+}
+
+// Return true if the tuples of op come out in ascending order of field, which
+// must be a plain column.  Scans through an index on the column and sorts on
+// it produce such an order, and filters, limits and projections keep it.
+func sortedOn(op Operator, field Expr) bool {
+	f, ok := field.(*FieldExpr)
+	if !ok {
+		return false
+	}
+	// names are only compared when they can't refer to another column, as
+	// tables and subqueries are renamed between operators
+	matches := func(desc *TupleDesc, name string) bool {
+		n := 0
+		for _, df := range desc.Fields {
+			if df.Fname == f.selectField.Fname {
+				n++
+			}
+		}
+		return n == 1 && name == f.selectField.Fname
+	}
+	switch o := op.(type) {
+	case *IndexScan:
+		return matches(o.Descriptor(), o.index.keyField.Fname)
+	case *OrderBy:
+		first, ok := o.orderBy[0].(*FieldExpr)
+		return ok && o.ascending[0] && matches(o.Descriptor(), first.selectField.Fname)
+	case *Filter[int64]:
+		return sortedOn(o.child, field)
+	case *Filter[string]:
+		return sortedOn(o.child, field)
+	case *TopN:
+		first, ok := o.orderBy[0].(*FieldExpr)
+		return ok && o.ascending[0] && matches(o.Descriptor(), first.selectField.Fname)
+	case *LimitOp:
+		return sortedOn(o.child, field)
+	case *AliasOp:
+		return sortedOn(o.child, field)
+	case *Project:
+		if o.distinct {
+			// duplicates that are spilled come out after the rest
+			return false
+		}
+		for i, name := range o.outputNames {
+			if name == f.selectField.Fname && matches(o.Descriptor(), name) {
+				return sortedOn(o.child, o.selectFields[i])
+			}
+		}
+	}
+	return false
+}
+
 func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 	//build mapping from table names / aliases to operators
 
@@ -830,12 +1741,46 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		tableMap[name] = &PlanNode{*t.file, td}
 	}
 
+	//filters over tables that an outer join pads with missing values must see
+	//the padded tuples, so they are applied after the joins
+	nullable := make(map[string]bool)
+	for _, j := range plan.joins {
+		for _, name := range j.nullable {
+			nullable[name] = true
+		}
+	}
+
+	//scan tables through an index when a filter allows it
+	filters := plan.filters
+	for _, t := range plan.tables {
+		name := t.tableName
+		if t.alias != "" {
+			name = t.alias
+		}
+		if nullable[name] {
+			continue
+		}
+		scan, rest, err := chooseIndexScan(c, plan, t, name, filters)
+		if err != nil {
+			return nil, err
+		}
+		if scan != nil {
+			tableMap[name] = &PlanNode{scan, tableMap[name].desc}
+			filters = rest
+		}
+	}
+
 	//now apply each filter to appropriate table
-	for _, f := range plan.filters {
+	var joinedFilters []*LogicalFilterNode
+	for _, f := range filters {
 		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
 		}
+		if nullable[tabName] {
+			joinedFilters = append(joinedFilters, f)
+			continue
+		}
 		node, err := fieldToOp(tabName, fieldName, tableMap)
 		if err != nil {
 			return nil, err
@@ -853,22 +1798,44 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		desc := *op.Descriptor()
 		desc.setTableAlias(tabName)
 
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			newOp, err := NewIntFilter(rightExpr, f.predOp, leftExpr, op)
-			if err != nil {
-				return nil, err
-			}
-			tableMap[leftExpr.GetExprType().TableQualifier] = &PlanNode{newOp, &desc}
-		case StringType:
-			newOp, err := NewStringFilter(rightExpr, f.predOp, leftExpr, op)
-			if err != nil {
-				return nil, err
-			}
-			tableMap[leftExpr.GetExprType().TableQualifier] = &PlanNode{newOp, &desc}
+		newOp, err := newTypedFilter(rightExpr, f.predOp, leftExpr, op)
+		if err != nil {
+			return nil, err
+		}
+		tableMap[tabName] = &PlanNode{newOp, &desc}
+	}
+	//apply predicates over a single table to that table, and leave the others
+	//until the tables have been joined
+	var joinedPreds []*LogicalPredNode
+	for _, p := range plan.preds {
+		tabs, err := p.getTables(c, plan.subqueries, plan.tables)
+		if err != nil {
+			return nil, err
+		}
+		if len(tabs) != 1 || nullable[tabs[0]] {
+			joinedPreds = append(joinedPreds, p)
+			continue
+		}
+		node, err := fieldToOp(tabs[0], "", tableMap)
+		if err != nil {
+			return nil, err
+		}
+		pred, err := p.generatePred(c, node.desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		desc := *node.op.Descriptor()
+		desc.setTableAlias(tabs[0])
+		tableMap[tabs[0]] = &PlanNode{NewPredicateFilter(pred, node.op), &desc}
+	}
+
+	//finally apply joins, qualifying the fields of each input with its name so
+	//that the joined tuples keep the fields of the inputs apart
+	if len(plan.joins) > 0 {
+		for name, node := range tableMap {
+			tableMap[name] = &PlanNode{NewAliasOp(name, node.op), node.desc}
 		}
 	}
-	//finally apply joins
 	for _, j := range plan.joins {
 		lTabName, lFieldName, err := j.left.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
@@ -914,15 +1881,38 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		var (
 			newOp Operator
 		)
+		// merge inputs that already arrive in join key order, and hash the
+		// rest; only the hash join pads unmatched tuples for outer joins
+		merge := j.joinType == InnerJoin && sortedOn(op1, leftExpr) && sortedOn(op2, rightExpr)
 		switch leftExpr.GetExprType().Ftype {
 		case IntType:
-			newOp, err = NewIntJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+			if merge {
+				newOp, err = NewIntSortMergeJoin(op1, leftExpr, op2, rightExpr)
+			} else {
+				newOp, err = NewIntOuterJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize, j.joinType)
+			}
 		case StringType:
-			newOp, err = NewStringJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+			if merge {
+				newOp, err = NewStringSortMergeJoin(op1, leftExpr, op2, rightExpr)
+			} else {
+				newOp, err = NewStringOuterJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize, j.joinType)
+			}
+		case FloatType:
+			// floats, decimals, dates and timestamps are only hash joined
+			newOp, err = NewFloatOuterJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize, j.joinType)
+		case DecimalType:
+			newOp, err = NewDecimalOuterJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize, j.joinType)
+		case DateType, TimestampType:
+			newOp, err = NewTemporalOuterJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize, j.joinType)
+		default:
+			err = GoDBError{TypeMismatchError, "unsupported type in join"}
 		}
 		if err != nil {
 			return nil, err
 		}
+		if hj, ok := newOp.(interface{ spillTo(string, *BufferPool) }); ok {
+			hj.spillTo(c.rootPath, c.bp)
+		}
 		newNode := &PlanNode{newOp, newOp.Descriptor()}
 		for key, node := range tableMap {
 			if node.op == op1 {
@@ -953,6 +1943,27 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 	}
 
 	topOp := curOp
+	for _, f := range joinedFilters {
+		leftExpr, _, err := f.fieldExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		rightExpr, _, err := f.constExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		topOp, err = newTypedFilter(rightExpr, f.predOp, leftExpr, topOp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range joinedPreds {
+		pred, err := p.generatePred(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewPredicateFilter(pred, topOp)
+	}
 
 	//var fieldList []FieldType
 	var fieldNames []string
@@ -1002,38 +2013,82 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 					return nil, err
 				}
 
-				switch aggExpr.GetExprType().Ftype {
+				aggType := aggExpr.GetExprType().Ftype
+				switch aggType {
 				case IntType:
 					getter = intAggGetter
 				case StringType:
 					getter = stringAggGetter
+				case FloatType:
+					getter = floatAggGetter
+				case DecimalType:
+					getter = decimalAggGetter
+				case DateType, TimestampType:
+					getter = temporalAggGetter
+				}
+				// dates and timestamps have a maximum and a minimum but no
+				// sum, intervals, which aren't ordered, can only be
+				// counted, and booleans can be counted or combined with
+				// bool_and and bool_or, which take nothing else
+				temporal := aggType == DateType || aggType == TimestampType
+				boolAgg := *s.funcOp == "bool_and" || *s.funcOp == "bool_or"
+				if (temporal && (*s.funcOp == "sum" || *s.funcOp == "avg")) || (aggType == IntervalType && *s.funcOp != "count") ||
+					(aggType == BoolType && *s.funcOp != "count" && !boolAgg) || (boolAgg && aggType != BoolType) {
+					return nil, GoDBError{ParseError, fmt.Sprintf("aggregate %s of values of type %s is not supported", *s.funcOp, typeNames[aggType])}
 				}
 
 				switch *s.funcOp {
 				case "max":
-					if aggExpr.GetExprType().Ftype == StringType {
+					if aggType == DecimalType {
+						as = &DecimalMaxAggState{}
+					} else if aggType == StringType {
 						as = &MaxAggState[string]{}
+					} else if aggType == FloatType {
+						as = &MaxAggState[float64]{}
 					} else {
 						as = &MaxAggState[int64]{}
 					}
 
 				case "min":
-					if aggExpr.GetExprType().Ftype == StringType {
+					if aggType == DecimalType {
+						as = &DecimalMaxAggState{min: true}
+					} else if aggType == StringType {
 						as = &MinAggState[string]{}
+					} else if aggType == FloatType {
+						as = &MinAggState[float64]{}
 					} else {
 						as = &MinAggState[int64]{}
 					}
 				case "avg":
-					as = &AvgAggState[int64]{}
+					if aggType == FloatType {
+						as = &AvgAggState[float64]{}
+					} else {
+						as = &AvgAggState[int64]{}
+					}
 				case "sum":
-					as = &SumAggState[int64]{}
+					if aggType == FloatType {
+						as = &SumAggState[float64]{}
+					} else {
+						as = &SumAggState[int64]{}
+					}
+				case "bool_and", "bool_or":
+					as = &BoolAggState{or: *s.funcOp == "bool_or"}
 				case "count":
-					as = &CountAggState{}
+					if s.distinct {
+						as = &CountDistinctAggState{}
+					} else {
+						// count(*) counts rows, and count(x) the rows
+						// where x is not missing
+						as = &CountAggState{countAll: fieldName == "*"}
+					}
 				default:
 					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", *s.funcOp)}
 				}
 				//make sure name has unique id
 				name := fmt.Sprintf("%s(%s.%s)%d", *s.funcOp, tabName, fieldName, aggCnt)
+				if s.distinct {
+					name = fmt.Sprintf("%s(distinct %s.%s)%d", *s.funcOp, tabName, fieldName, aggCnt)
+				}
 				aggCnt++
 				if s.alias != "" {
 					name = s.alias
@@ -1049,15 +2104,40 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 			if err != nil {
 				return nil, err
 			}
+			// the aggregate returns an expression it groups on as a field
+			// named after the expression, which the select list, having
+			// clause and order by then read rather than evaluating the
+			// expression again over the aggregate's fields
+			if gby.expr.exprType == ExprFunc || gby.expr.exprType == ExprPred {
+				expr = &NamedExpr{gby.expr.value, expr}
+			}
 			gbys = append(gbys, expr)
 		}
 
 		if len(gbys) == 0 {
 			topOp = NewAggregator(aggs, topOp)
 		} else {
-			topOp = NewGroupedAggregator(aggs, gbys, topOp)
+			agg := NewExternalGroupedAggregator(aggs, gbys, topOp, c.aggBufferSize, c.rootPath)
+			agg.spillTo(c.rootPath, c.bp)
+			topOp = agg
 		}
 	}
+	//filter the groups on the having clause
+	for _, h := range plan.having {
+		leftExpr, _, err := h.fieldExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		rightExpr, _, err := h.constExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		topOp, err = newTypedFilter(rightExpr, h.predOp, leftExpr, topOp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	exprList := make([]Expr, len(plan.selects))
 	for i, s := range plan.selects {
 		switch s.exprType {
@@ -1075,10 +2155,11 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		}
 	}
 	if !selectAll {
-		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
+		projOp, err := NewExternalProjectOp(exprList, fieldNames, plan.distinct, topOp, DistinctBufferSize, c.rootPath)
 		if err != nil {
 			return nil, err
 		}
+		projOp.(*Project).spillTo(c.rootPath, c.bp)
 		topOp = projOp
 	}
 
@@ -1095,11 +2176,12 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 			ascs = append(ascs, oby.ascending)
 
 		}
-		var err error
-		topOp, err = NewOrderBy(exprs, topOp, ascs)
+		oby, err := NewExternalOrderBy(exprs, topOp, ascs, c.sortBufferSize, c.rootPath)
 		if err != nil {
 			return nil, err
 		}
+		oby.spillTo(c.rootPath, c.bp)
+		topOp = oby
 
 	}
 
@@ -1108,7 +2190,15 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
-		topOp = NewLimitOp(expr, topOp)
+		// a limit over a sort only needs the first tuples of the sort
+		if oby, ok := topOp.(*OrderBy); ok {
+			topOp, err = NewTopN(oby.orderBy, oby.child, oby.ascending, expr)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			topOp = NewLimitOp(expr, topOp)
+		}
 	}
 	return topOp, nil
 }
@@ -1123,12 +2213,13 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 		return nil, err
 	}
 
+	desc := file.Descriptor()
 	switch stmt := insStmt.Rows.(type) {
 	case sqlparser.Values:
 		var exprAr []([]Expr)
 		for _, t := range stmt {
 			var tupAr []Expr
-			for _, e := range t {
+			for i, e := range t {
 				expr, err := parseExpr(c, e, "")
 				if err != nil {
 					return nil, err
@@ -1137,6 +2228,10 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 				if err != nil {
 					return nil, err
 				}
+				// a number may be stored in a column of another numeric type
+				if i < len(desc.Fields) {
+					exprOp = convertExpr(exprOp, desc.Fields[i].Ftype)
+				}
 				tupAr = append(tupAr, exprOp)
 			}
 			exprAr = append(exprAr, tupAr)
@@ -1162,31 +2257,81 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 }
 
 func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
-	if len(delStmt.TableExprs) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+	table, _, scan, err := parseSingleTableScan(c, delStmt.TableExprs, delStmt.Where, "deleting from")
+	if err != nil {
+		return nil, err
+	}
+	return NewDeleteOp(*table.file, scan), nil
+}
+
+func parseUpdate(c *Catalog, updStmt *sqlparser.Update) (Operator, error) {
+	if len(updStmt.OrderBy) > 0 || updStmt.Limit != nil {
+		return nil, GoDBError{ParseError, "godb does not support order by or limit in updates"}
+	}
+	table, tableMap, scan, err := parseSingleTableScan(c, updStmt.TableExprs, updStmt.Where, "updating")
+	if err != nil {
+		return nil, err
+	}
+	desc := tableMap[table.tableName].desc
+	var (
+		setFields []string
+		setExprs  []Expr
+	)
+	for _, ue := range updStmt.Exprs {
+		name := strings.ToLower(sqlparser.String(ue.Name.Name))
+		if len(name) > 1 && (name[0] == '\'' || name[0] == '`') {
+			name = name[1 : len(name)-1]
+		}
+		value, err := parseExpr(c, ue.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		expr, _, err := value.generateExpr(c, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		setFields = append(setFields, name)
+		setExprs = append(setExprs, expr)
 	}
-	tables, subplans, joins, err := parseFrom(c, delStmt.TableExprs[0])
+	uop, err := NewUpdateOp(*table.file, setFields, setExprs, scan, c.rootPath)
 	if err != nil {
 		return nil, err
 	}
+	uop.spillTo(c.rootPath, c.bp)
+	return uop, nil
+}
+
+// Plan the scan of the rows of a single table matching a where clause, for a
+// delete or an update (described by verb, for error messages).  Returns the
+// table, the mapping from its name to its plan node, and the scan.
+func parseSingleTableScan(c *Catalog, tableExprs sqlparser.TableExprs, where *sqlparser.Where, verb string) (*LogicalTableNode, map[string]*PlanNode, Operator, error) {
+	multipleTables := GoDBError{ParseError, fmt.Sprintf("godb does not supporting %s multiple tables", verb)}
+	if len(tableExprs) > 1 {
+		return nil, nil, nil, multipleTables
+	}
+	tables, subplans, joins, err := parseFrom(c, tableExprs[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	if len(tables) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, nil, multipleTables
 	}
 	if subplans != nil || joins != nil {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, nil, multipleTables
 	}
 
 	tableMap := make(map[string]*PlanNode)
 	tableMap[tables[0].tableName] = &PlanNode{*tables[0].file, (*tables[0].file).Descriptor()}
 
 	var filters []*LogicalFilterNode = make([]*LogicalFilterNode, 0)
-	if delStmt.Where != nil {
-		filters, joins, err = parseWhere(c, subplans, tables, delStmt.Where.Expr)
+	var preds []*LogicalPredNode
+	if where != nil {
+		filters, joins, preds, err = parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		if joins != nil {
-			return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+			return nil, nil, nil, multipleTables
 		}
 	}
 	var newOp Operator
@@ -1194,40 +2339,37 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 	for _, f := range filters {
 		tabName, fieldName, err := f.fieldExpr.getTableField(c, subplans, tables)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		node, err := fieldToOp(tabName, fieldName, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 
 		//op := node.op
 		//dbField, _ := fieldNameToField(f.table, f.field, &PlanNode{op, &desc})
 
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			//newInt, _ := strconv.Atoi(f.constVal)
-			newOp, err = NewIntFilter(rightExpr, f.predOp, leftExpr, newOp)
-			if err != nil {
-				return nil, err
-			}
-		case StringType:
-			newOp, err = NewStringFilter(rightExpr, f.predOp, leftExpr, newOp)
-			if err != nil {
-				return nil, err
-			}
+		newOp, err = newTypedFilter(rightExpr, f.predOp, leftExpr, newOp)
+		if err != nil {
+			return nil, nil, nil, err
 		}
 	}
-	return NewDeleteOp(*tables[0].file, newOp), nil
-
+	for _, p := range preds {
+		pred, err := p.generatePred(c, tableMap[tables[0].tableName].desc, tableMap)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		newOp = NewPredicateFilter(pred, newOp)
+	}
+	return tables[0], tableMap, newOp, nil
 }
 
 type QueryType int
@@ -1239,9 +2381,71 @@ const (
 	AbortXactionType     QueryType = iota
 	CreateTableQueryType QueryType = iota
 	DropTableQueryType   QueryType = iota
+	CreateIndexQueryType QueryType = iota
+	DropIndexQueryType   QueryType = iota
 	UnknownQueryType     QueryType = iota
 )
 
+// sqlparser parses CREATE INDEX and DROP INDEX statements as ALTER TABLE
+// statements and drops the name and columns of the index, so they are matched
+// before the query is handed to it
+var (
+	createIndexRegexp = regexp.MustCompile(`(?i)^\s*create\s+index\s+(\w+)\s+on\s+(\w+)\s*\(\s*(\w+)\s*\)\s*;?\s*$`)
+	dropIndexRegexp   = regexp.MustCompile(`(?i)^\s*drop\s+index\s+(\w+)(?:\s+on\s+(\w+))?\s*;?\s*$`)
+)
+
+func processIndexDDL(c *Catalog, query string) (QueryType, bool, error) {
+	if m := createIndexRegexp.FindStringSubmatch(query); m != nil {
+		err := c.createIndex(strings.ToLower(m[1]), strings.ToLower(m[2]), strings.ToLower(m[3]))
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		return CreateIndexQueryType, true, nil
+	}
+	if m := dropIndexRegexp.FindStringSubmatch(query); m != nil {
+		name := strings.ToLower(m[1])
+		idx := c.findIndex(name)
+		if idx == nil || (m[2] != "" && idx.table != strings.ToLower(m[2])) {
+			return UnknownQueryType, true, GoDBError{NoSuchIndexError, fmt.Sprintf("no index '%s' found", name)}
+		}
+		err := c.dropIndex(name)
+		if err != nil {
+			return UnknownQueryType, true, err
+		}
+		return DropIndexQueryType, true, nil
+	}
+	return UnknownQueryType, false, nil
+}
+
+// Return the precision and scale of a decimal(p,s) column, which are 0 if
+// they are not given, or an error if they are not supported
+func checkDecimalColumn(t sqlparser.ColumnType) (int, int, error) {
+	if t.Length == nil {
+		return 0, 0, nil
+	}
+	precision, err := strconv.Atoi(string(t.Length.Val))
+	if err != nil {
+		return 0, 0, GoDBError{ParseError, fmt.Sprintf("malformed decimal precision %s", t.Length.Val)}
+	}
+	scale := 0
+	if t.Scale != nil {
+		if scale, err = strconv.Atoi(string(t.Scale.Val)); err != nil {
+			return 0, 0, GoDBError{ParseError, fmt.Sprintf("malformed decimal scale %s", t.Scale.Val)}
+		}
+	}
+	return precision, scale, checkDecimalPrecision(precision, scale)
+}
+
+// Return the length n of a varchar(n), or an error if it is not a whole number
+// between 1 and the length of the longest varchar that fits on a page
+func checkVarcharLength(n string) (int, error) {
+	length, err := strconv.Atoi(n)
+	if err != nil || length < 1 || length > maxVarcharLength {
+		return 0, GoDBError{ParseError, fmt.Sprintf("varchar length %s is not between 1 and %d", n, maxVarcharLength)}
+	}
+	return length, nil
+}
+
 func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 	switch ddl.Action {
 	case "create":
@@ -1257,20 +2461,49 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 			switch col.Type.Type {
 			case "int":
 				colType = IntType
+			case "float", "double":
+				colType = FloatType
+			case "decimal", "numeric":
+				precision, scale, err := checkDecimalColumn(col.Type)
+				if err != nil {
+					return UnknownQueryType, err
+				}
+				fields[i].Precision, fields[i].Scale = precision, scale
+				colType = DecimalType
+			case "bit":
+				colType = BoolType
+			case "date":
+				colType = DateType
+			case "timestamp", "datetime":
+				colType = TimestampType
+			// strings are stored at their own length, which for a
+			// varchar(n) is checked when they are inserted
 			case "string":
 				fallthrough
 			case "text":
-				fallthrough
+				colType = StringType
 			case "varchar":
+				if col.Type.Length != nil {
+					length, err := checkVarcharLength(string(col.Type.Length.Val))
+					if err != nil {
+						return UnknownQueryType, err
+					}
+					fields[i].Length = length
+				}
 				colType = StringType
 			default:
 				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", col.Type.Type)}
 
 			}
-			fields[i] = FieldType{colName, "", colType}
+			fields[i].Fname = colName
+			fields[i].Ftype = colType
 		}
 
-		c.addTable(tabName, TupleDesc{fields})
+		desc := TupleDesc{fields}
+		if err := checkRowSize(&desc); err != nil {
+			return UnknownQueryType, err
+		}
+		c.addTable(tabName, desc)
 		return CreateTableQueryType, nil
 
 	case "drop":
@@ -1286,7 +2519,17 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 }
 
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
-	stmt, err := sqlparser.Parse(query)
+	if qtype, ok, err := processIndexDDL(c, query); ok {
+		return qtype, nil, err
+	}
+	if createTableRegexp.MatchString(query) {
+		query = replaceUnquoted(boolTypeRegexp, query, "${1}bit")
+	}
+	if matchUnquoted(straightJoinRegexp, query) {
+		return UnknownQueryType, nil, GoDBError{ParseError, "unsupported join type straight_join"}
+	}
+	query = rewriteConcat(query)
+	stmt, err := sqlparser.Parse(replaceUnquoted(fullJoinRegexp, query, sqlparser.StraightJoinStr))
 	if err != nil {
 		return UnknownQueryType, nil, err
 	}
@@ -1316,6 +2559,12 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 			return UnknownQueryType, nil, err
 		}
 		return IteratorType, op, nil
+	case *sqlparser.Update:
+		op, err := parseUpdate(c, stmt)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
 	case *sqlparser.Begin:
 		return BeginXactionType, nil, nil
 	case *sqlparser.Commit:
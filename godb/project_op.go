@@ -4,6 +4,14 @@ type Project struct {
 	selectFields []Expr // required fields for parser
 	outputNames  []string
 	child        Operator
+	distinct     bool
+
+	// For distinct projections, the maximum number of distinct tuples
+	// remembered in memory; other tuples are partitioned into spill files in
+	// dir and have their duplicates removed later
+	maxBufferSize int
+	dir           string
+	bufPool       *BufferPool // removes the partitions left when the transaction ends
 }
 
 // Project constructor -- should save the list of selected field, child, and the child op.
@@ -12,14 +20,35 @@ type Project struct {
 // selectFields; throws error if not), distinct is for noting whether the projection reports
 // only distinct results, and child is the child operator.
 func NewProjectOp(selectFields []Expr, outputNames []string, distinct bool, child Operator) (Operator, error) {
+	return NewExternalProjectOp(selectFields, outputNames, distinct, child, DistinctBufferSize, "")
+}
+
+// Construct a projection that, if distinct, remembers at most maxBufferSize
+// distinct tuples in memory, spilling the rest to temporary files in dir (or
+// in the default directory for temporary files if dir is empty)
+func NewExternalProjectOp(selectFields []Expr, outputNames []string, distinct bool, child Operator, maxBufferSize int, dir string) (Operator, error) {
+	if len(selectFields) != len(outputNames) {
+		return nil, GoDBError{IllegalOperationError, "projection needs a name for every field"}
+	}
 	project := &Project{
-		selectFields: selectFields,
-		outputNames:  outputNames,
-		child:        child,
+		selectFields:  selectFields,
+		outputNames:   outputNames,
+		child:         child,
+		distinct:      distinct,
+		maxBufferSize: maxBufferSize,
+		dir:           dir,
 	}
 	return project, nil
 }
 
+// Write the partitions of a distinct projection to dir, and remove any that
+// are left when the transaction running the projection ends, e.g. because a
+// LIMIT stopped reading its results, through bp
+func (p *Project) spillTo(dir string, bp *BufferPool) {
+	p.dir = dir
+	p.bufPool = bp
+}
+
 // Return a TupleDescriptor for this projection. The returned descriptor should contain
 // fields for each field in the constructor selectFields list with outputNames
 // as specified in the constructor.
@@ -37,6 +66,25 @@ func (p *Project) Descriptor() *TupleDesc {
 
 }
 
+// Return a descriptor of the fields of the child that the projection reads, so
+// that a child that stores its columns separately, such as a [ColumnFile],
+// only reads those columns.  If that can't be told, or no field is read, this
+// is the descriptor of the child.
+func (p *Project) inputDesc() *TupleDesc {
+	var fields []FieldType
+	for _, e := range p.selectFields {
+		fs, ok := referencedFields(e)
+		if !ok {
+			return p.child.Descriptor()
+		}
+		fields = append(fields, fs...)
+	}
+	if len(fields) == 0 {
+		return p.child.Descriptor()
+	}
+	return &TupleDesc{Fields: fields}
+}
+
 // Project operator implementation.  This function should iterate over the
 // results of the child iterator, projecting out the fields from each tuple. In
 // the case of distinct projection, duplicate tuples should be removed.
@@ -44,15 +92,21 @@ func (p *Project) Descriptor() *TupleDesc {
 // distinct tuples seen so far.  Note that support for the distinct keyword is
 // optional as specified in the lab 2 assignment.
 func (p *Project) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
-	childIterator, _ := p.child.Iterator(tid, p.Descriptor())
-	return func() (*Tuple, error) {
-		t, _ := childIterator()
-		if t == nil {
-			return nil, nil
+	childIterator, err := p.child.Iterator(tid, p.inputDesc())
+	if err != nil {
+		return nil, err
+	}
+	projected := func() (*Tuple, error) {
+		t, err := childIterator()
+		if t == nil || err != nil {
+			return nil, err
 		}
 		fields := []DBValue{}
 		for _, selectField := range p.selectFields {
-			val, _ := selectField.EvalExpr(t)
+			val, err := selectField.EvalExpr(t)
+			if err != nil {
+				return nil, err
+			}
 			fields = append(fields, val)
 		}
 		td := &Tuple{
@@ -60,5 +114,99 @@ func (p *Project) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple,
 			Fields: fields,
 		}
 		return td, nil
-	}, nil
+	}
+	if p.distinct {
+		return p.distinctIterator(tid, projected, 0), nil
+	}
+	return projected, nil
+}
+
+// Return an iterator over the distinct tuples of iter.  Tuples are returned
+// as soon as they are first seen, while the set of tuples seen so far fits in
+// maxBufferSize.  After that, tuples that are not in the set are partitioned
+// on their value into [spillFile]s, and once iter is used up the distinct
+// tuples of each partition are returned in the same way.  A DISTINCT is a
+// group by on every field, so it partitions like the [Aggregator].  depth is
+// the number of times the input has been partitioned already.  The partitions
+// are spill files of tid.
+func (p *Project) distinctIterator(tid TransactionID, iter func() (*Tuple, error), depth int) func() (*Tuple, error) {
+	seen := make(map[any]bool)
+	var partitions []*spillFile
+	var partitionIter func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		if partitionIter != nil {
+			return partitionIter()
+		}
+		for {
+			t, err := iter()
+			if err != nil {
+				removeSpillFiles(partitions)
+				partitions = nil
+				return nil, err
+			}
+			if t == nil {
+				partitionIter = p.partitionsIterator(tid, partitions, depth)
+				return partitionIter()
+			}
+			key := t.tupleKey()
+			if seen[key] {
+				continue
+			}
+			if len(seen) >= p.maxBufferSize && depth < maxAggDepth {
+				if partitions == nil {
+					for i := 0; i < aggPartitions; i++ {
+						part, err := p.bufPool.newSpillFile(tid, p.dir)
+						if err != nil {
+							removeSpillFiles(partitions)
+							partitions = nil
+							return nil, err
+						}
+						partitions = append(partitions, part)
+					}
+				}
+				if err := partitions[groupPartition(t, depth)].append(t); err != nil {
+					removeSpillFiles(partitions)
+					partitions = nil
+					return nil, err
+				}
+				continue
+			}
+			seen[key] = true
+			return t, nil
+		}
+	}
+}
+
+// Return an iterator over the distinct tuples of each partition in turn,
+// removing each partition once it has been read
+func (p *Project) partitionsIterator(tid TransactionID, partitions []*spillFile, depth int) func() (*Tuple, error) {
+	var current *spillFile
+	iter := func() (*Tuple, error) { return nil, nil }
+	return func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if t != nil {
+				return t, nil
+			}
+			if current != nil {
+				current.remove()
+				current = nil
+			}
+			if err != nil || len(partitions) == 0 {
+				removeSpillFiles(partitions)
+				partitions = nil
+				return nil, err
+			}
+			current, partitions = partitions[0], partitions[1:]
+			partIter, err := current.iterator()
+			if err != nil {
+				current.remove()
+				current = nil
+				removeSpillFiles(partitions)
+				partitions = nil
+				return nil, err
+			}
+			iter = p.distinctIterator(tid, partIter, depth+1)
+		}
+	}
 }
@@ -1,6 +1,8 @@
 package godb
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -68,3 +70,139 @@ func TestProjectDistinctOptional(t *testing.T) {
 	}
 
 }
+
+// project more distinct values than the projection remembers in memory, so
+// that tuples are spilled to disk and partitions are split again
+func TestProjectDistinctSpills(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "k", Ftype: IntType}, {Fname: "v", Ftype: IntType}}}
+	bp := NewBufferPool(50)
+	os.Remove(TestingFile)
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	for i := 0; i < 2000; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{IntField{int64(i * 7 % 500)}, IntField{int64(i)}}}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	dir := t.TempDir()
+	proj, err := NewExternalProjectOp([]Expr{&FieldExpr{td.Fields[0]}}, []string{"k"}, true, hf, 5, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := proj.Iterator(tid, proj.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	seen := make(map[int64]bool)
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		k := tup.Fields[0].(IntField).Value
+		if seen[k] {
+			t.Fatalf("value %d returned twice", k)
+		}
+		seen[k] = true
+	}
+	if len(seen) != 500 {
+		t.Errorf("expected 500 distinct values, got %d", len(seen))
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("expected the projection to remove its spill files, found %d", len(files))
+	}
+}
+
+func TestSelectDistinct(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	_, tuples := runQuery(t, c, "select distinct age from t")
+	if len(tuples) != 10 {
+		t.Errorf("expected 10 distinct ages, got %d", len(tuples))
+	}
+	_, tuples = runQuery(t, c, "select distinct name, age from t where age < 4")
+	if len(tuples) != 4 {
+		t.Errorf("expected 4 distinct rows, got %d", len(tuples))
+	}
+}
+
+// A projection of a function of a column reads that column from a column
+// file, rather than the columns named by its output
+func TestProjectFunctionOfColumn(t *testing.T) {
+	_, t1, t2, cf, _, tid := makeCFTestVars()
+	cf.insertTuple(&t1, tid)
+	cf.insertTuple(&t2, tid)
+	var age Expr = &FieldExpr{t1.Desc.Fields[1]}
+	var one Expr = &ConstExpr{IntField{1}, IntType}
+	proj, err := NewProjectOp([]Expr{&FuncExpr{"+", []*Expr{&age, &one}}}, []string{"older"}, false, cf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := proj.Iterator(tid, proj.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, expected := range []int64{26, 1000} {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil || tup.Fields[0].(IntField).Value != expected {
+			t.Fatalf("expected %d, got %v", expected, tup)
+		}
+	}
+}
+
+func TestDistinctAbandoned(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/catalog.txt", []byte("d (x int)\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", NewBufferPool(100), dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	runQuery(t, c, "insert into d values (1), (2), (3), (4), (5)")
+	spills := func() []string {
+		files, _ := filepath.Glob(dir + "/godb-spill-*")
+		return files
+	}
+
+	// remember only 2 distinct tuples, and stop reading after the first
+	// result, as a client closing the cursor would
+	_, plan, err := Parse(c, "select distinct x from d")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	plan.(*Project).maxBufferSize = 2
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	iter, err := plan.Iterator(tid, plan.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < 3; i++ {
+		if tup, err := iter(); err != nil || tup == nil {
+			t.Fatalf("expected a distinct tuple, got %v, %v", tup, err)
+		}
+	}
+	if len(spills()) == 0 {
+		t.Fatalf("expected the projection to partition the tuples past the first 2 in %s", dir)
+	}
+	if err := c.bp.CommitTransaction(tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if files := spills(); len(files) != 0 {
+		t.Errorf("expected the partitions to be removed at commit, found %v", files)
+	}
+}
@@ -25,12 +25,12 @@ func TestSimpleQuery(t *testing.T) {
 	if err != nil {
 		t.Fatalf("no table t2, %s", err.Error())
 	}
-	f_name := FieldExpr{FieldType{"name", "", StringType}}
+	f_name := FieldExpr{FieldType{Fname: "name", Ftype: StringType}}
 	joinOp, err := NewStringJoin(hf1, &f_name, hf2, &f_name, 1000)
 	if err != nil {
 		t.Fatalf("failed to construct join, %s", err.Error())
 	}
-	f_age := FieldExpr{FieldType{"age", "t", IntType}}
+	f_age := FieldExpr{FieldType{Fname: "age", TableQualifier: "t", Ftype: IntType}}
 	e_const := ConstExpr{IntField{30}, IntType}
 	filterOp, err := NewIntFilter(&e_const, OpGt, &f_age, joinOp)
 	if err != nil {
@@ -0,0 +1,182 @@
+package godb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// spillFile is a temporary file holding tuples that an operator can't keep in
+// memory, such as the partitions of a hash join.  Tuples are appended to the
+// file and read back in the order they were written.  Unlike heap files, the
+// pages of spill files don't go through the buffer pool, as they are private
+// to the operator that writes them; the buffer pool only removes the spill
+// files of a transaction that are left when it ends (see
+// [BufferPool.newSpillFile]).
+//
+// Each tuple is written as a 32 bit field count followed by its fields, each
+// of which is a one byte [DBType] tag followed by the value: an int64 for
+// ints, dates and timestamps, a float64 for floats, an int64 and a one byte
+// scale for decimals, a byte for bools, the int64 months and microseconds of
+// intervals, and a 32 bit length followed by the bytes of the string for
+// strings.  A missing value is the tag of UnknownType with nothing after it.
+// Strings are written in full, so tuples round trip exactly.
+type spillFile struct {
+	file   *os.File
+	writer *bufio.Writer
+	desc   *TupleDesc // descriptor of the tuples in the file
+	count  int        // number of tuples in the file
+	// called when the file is removed, if not nil
+	release func()
+}
+
+// Create a new spill file in dir, or in the default directory for temporary
+// files if dir is empty
+func newSpillFile(dir string) (*spillFile, error) {
+	file, err := os.CreateTemp(dir, "godb-spill-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// Append a tuple to the file
+func (s *spillFile) append(t *Tuple) error {
+	if s.desc == nil {
+		// cap the fields so that appending to the descriptor of a tuple read
+		// back from the file never writes to the shared array
+		fields := t.Desc.Fields[:len(t.Desc.Fields):len(t.Desc.Fields)]
+		s.desc = &TupleDesc{Fields: fields}
+	}
+	binary.Write(s.writer, binary.LittleEndian, int32(len(t.Fields)))
+	for _, f := range t.Fields {
+		switch v := f.(type) {
+		case IntField:
+			s.writer.WriteByte(byte(IntType))
+			binary.Write(s.writer, binary.LittleEndian, v.Value)
+		case StringField:
+			s.writer.WriteByte(byte(StringType))
+			binary.Write(s.writer, binary.LittleEndian, int32(len(v.Value)))
+			s.writer.WriteString(v.Value)
+		case FloatField:
+			s.writer.WriteByte(byte(FloatType))
+			binary.Write(s.writer, binary.LittleEndian, v.Value)
+		case DecimalField:
+			s.writer.WriteByte(byte(DecimalType))
+			binary.Write(s.writer, binary.LittleEndian, v.Value)
+			s.writer.WriteByte(byte(v.Scale))
+		case DateField:
+			s.writer.WriteByte(byte(DateType))
+			binary.Write(s.writer, binary.LittleEndian, v.Value)
+		case TimestampField:
+			s.writer.WriteByte(byte(TimestampType))
+			binary.Write(s.writer, binary.LittleEndian, v.Value)
+		case BoolField:
+			s.writer.WriteByte(byte(BoolType))
+			binary.Write(s.writer, binary.LittleEndian, v.Value)
+		case IntervalField:
+			s.writer.WriteByte(byte(IntervalType))
+			binary.Write(s.writer, binary.LittleEndian, v.Months)
+			binary.Write(s.writer, binary.LittleEndian, v.Micros)
+		case NullField:
+			// a missing value has no type, and nothing follows its tag
+			s.writer.WriteByte(byte(UnknownType))
+		default:
+			return GoDBError{TypeMismatchError, "cannot spill value of unknown type"}
+		}
+	}
+	s.count++
+	return nil
+}
+
+// Return an iterator over the tuples in the file.  Every call starts over from
+// the first tuple; the file must not be appended to while it is being read.
+func (s *spillFile) iterator() (func() (*Tuple, error), error) {
+	if err := s.writer.Flush(); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(io.NewSectionReader(s.file, 0, 1<<62))
+	return func() (*Tuple, error) {
+		var numFields int32
+		err := binary.Read(reader, binary.LittleEndian, &numFields)
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		fields := make([]DBValue, numFields)
+		for i := range fields {
+			tag, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			switch DBType(tag) {
+			case IntType:
+				var v int64
+				if err := binary.Read(reader, binary.LittleEndian, &v); err != nil {
+					return nil, err
+				}
+				fields[i] = IntField{v}
+			case StringType:
+				var n int32
+				if err := binary.Read(reader, binary.LittleEndian, &n); err != nil {
+					return nil, err
+				}
+				buf := make([]byte, n)
+				if _, err := io.ReadFull(reader, buf); err != nil {
+					return nil, err
+				}
+				fields[i] = StringField{string(buf)}
+			case FloatType:
+				var v float64
+				if err := binary.Read(reader, binary.LittleEndian, &v); err != nil {
+					return nil, err
+				}
+				fields[i] = FloatField{v}
+			case DecimalType:
+				var v int64
+				if err := binary.Read(reader, binary.LittleEndian, &v); err != nil {
+					return nil, err
+				}
+				scale, err := reader.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				fields[i] = DecimalField{v, int(scale)}
+			case DateType, TimestampType:
+				var v int64
+				if err := binary.Read(reader, binary.LittleEndian, &v); err != nil {
+					return nil, err
+				}
+				fields[i] = int64Field(DBType(tag), v)
+			case BoolType:
+				var v bool
+				if err := binary.Read(reader, binary.LittleEndian, &v); err != nil {
+					return nil, err
+				}
+				fields[i] = BoolField{v}
+			case IntervalType:
+				var v IntervalField
+				if err := binary.Read(reader, binary.LittleEndian, &v); err != nil {
+					return nil, err
+				}
+				fields[i] = v
+			case UnknownType:
+				fields[i] = NullField{}
+			default:
+				return nil, GoDBError{MalformedDataError, "corrupt spill file"}
+			}
+		}
+		return &Tuple{Desc: *s.desc, Fields: fields}, nil
+	}, nil
+}
+
+// Close and delete the file
+func (s *spillFile) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+	if s.release != nil {
+		s.release()
+	}
+}
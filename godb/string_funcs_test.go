@@ -0,0 +1,79 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringFunctions(t *testing.T) {
+	cases := []struct {
+		f    func([]any) any
+		args []any
+		is   any
+	}{
+		{upperFunc, []any{"déjà vu"}, "DÉJÀ VU"},
+		{lowerFunc, []any{"GoDB"}, "godb"},
+		{lengthFunc, []any{"déjà"}, int64(4)},
+		{trimFunc, []any{"  a b \t"}, "a b"},
+		{ltrimFunc, []any{"  a "}, "a "},
+		{rtrimFunc, []any{"  a "}, "  a"},
+		{trimCharsFunc, []any{"xxaxy", "xy"}, "a"},
+		{concatFunc, []any{"a", "b"}, "ab"},
+		{replaceFunc, []any{"a-b-c", "-", "+"}, "a+b+c"},
+		{positionFunc, []any{"jà", "déjà"}, int64(3)},
+		{positionFunc, []any{"z", "déjà"}, int64(0)},
+		{startsWithFunc, []any{"godb", "go"}, true},
+		{regexpMatchFunc, []any{"order-123", `^order-\d+$`}, true},
+		{regexpMatchFunc, []any{"order-x", `^order-\d+$`}, false},
+		{lpadFunc, []any{"7", int64(3), "0"}, "007"},
+		{lpadFunc, []any{"ab", int64(7), "xyz"}, "xyzxyab"},
+		{lpadFunc, []any{"hello", int64(2)}, "he"},
+		{rpadFunc, []any{"ab", int64(4)}, "ab  "},
+		{rpadFunc, []any{"ab", int64(4), ""}, "ab"},
+	}
+	for _, c := range cases {
+		if v := c.f(c.args); v != c.is {
+			t.Errorf("expected %v from %v, got %v", c.is, c.args, v)
+		}
+	}
+	if _, ok := regexpMatchFunc([]any{"a", "("}).(error); !ok {
+		t.Errorf("expected an error from a malformed regular expression")
+	}
+
+	// every function is listed, once for each of its overloads
+	list := ListOfFunctions()
+	for _, sig := range []string{"upper(string)", "trim(string,string)", "lpad(string,int,string)", "regexp_match(string,string)"} {
+		if !strings.Contains(list, "\t"+sig+"\n") {
+			t.Errorf("expected %s in the list of functions", sig)
+		}
+	}
+
+	if s := rewriteConcat(`select a || 'x||y' || "b||" from t where c = 'it''s||'`); s != `select a | 'x||y' | "b||" from t where c = 'it''s||'` {
+		t.Errorf("unexpected rewrite %s", s)
+	}
+}
+
+func TestStringQueries(t *testing.T) {
+	c, _ := makeQueryCatalog(t, "c (id int, name string, code string)\n")
+	runQuery(t, c, "insert into c values (1, '  Ada ', 'UK-12'), (2, 'grace', 'US-7'), (3, 'Linus', null)")
+
+	checkQueryRows(t, c, "select id, upper(trim(name)) || ':' || lpad(trim(name), 6, '*'), length(name), replace(code, '-', ''), position('-', code), starts_with(code, 'U') from c order by id", []string{
+		"1,ADA:***Ada,6,UK12,3,true",
+		"2,GRACE:*grace,5,US7,3,true",
+		"3,LINUS:*Linus,5,NULL,NULL,NULL",
+	})
+
+	checkQueryCounts(t, c, []queryCount{
+		{"select id from c where regexp_match(code, '^U[SK]-[0-9]+$')", 2},
+		{"select id from c where lower(name) || 'x' = 'gracex'", 1},
+		{"select id from c where starts_with(rtrim(name), ' ')", 1},
+		{"select id from c where name = 'a||b' or id = 3", 1},
+	})
+
+	// arguments of the wrong type are rejected when the query is planned
+	for _, sql := range []string{"select length(id) from c", "select lpad(name, 'x') from c", "select concat(name) from c", "select upper(name, code) from c"} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected an error planning %s", sql)
+		}
+	}
+}
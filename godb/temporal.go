@@ -0,0 +1,214 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateField is a calendar date, stored as the number of days since
+// 1970-01-01.  Like timestamps, dates have no time zone; they are read and
+// written as UTC.
+type DateField struct {
+	Value int64
+}
+
+// TimestampField is a date and time of day, stored as the number of
+// microseconds since 1970-01-01 00:00:00
+type TimestampField struct {
+	Value int64
+}
+
+// IntervalField is a length of time, such as the value of INTERVAL 3 MONTH,
+// that can be added to or subtracted from dates and timestamps.  Months are
+// kept apart from shorter units, as their length depends on the date they are
+// added to.  Intervals are the result of expressions, and can't be stored in
+// tables.
+type IntervalField struct {
+	Months int64
+	Micros int64
+}
+
+const microsPerSecond int64 = 1000000
+const microsPerDay int64 = 24 * 60 * 60 * microsPerSecond
+
+const dateLayout = "2006-01-02"
+
+// The layout in which timestamps are printed; when parsing, fractions of a
+// second are accepted even though the layout has none
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+func dateOf(t time.Time) DateField {
+	y, m, d := t.Date()
+	return DateField{time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (microsPerDay / microsPerSecond)}
+}
+
+func timestampOf(t time.Time) TimestampField {
+	return TimestampField{t.UnixMicro()}
+}
+
+func (d DateField) time() time.Time {
+	return time.Unix(d.Value*(microsPerDay/microsPerSecond), 0).UTC()
+}
+
+func (ts TimestampField) time() time.Time {
+	return time.UnixMicro(ts.Value).UTC()
+}
+
+func (d DateField) String() string {
+	return d.time().Format(dateLayout)
+}
+
+func (ts TimestampField) String() string {
+	return ts.time().Format(timestampLayout)
+}
+
+// Parse a date written as YYYY-MM-DD
+func parseDate(s string) (DateField, error) {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return DateField{}, GoDBError{TypeMismatchError, fmt.Sprintf("malformed date %s, expected YYYY-MM-DD", s)}
+	}
+	return dateOf(t), nil
+}
+
+// Parse a timestamp written as YYYY-MM-DD HH:MM:SS, with an optional fraction
+// of a second, or as a date, which is the timestamp of its midnight
+func parseTimestamp(s string) (TimestampField, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", dateLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return timestampOf(t), nil
+		}
+	}
+	return TimestampField{}, GoDBError{TypeMismatchError, fmt.Sprintf("malformed timestamp %s, expected YYYY-MM-DD HH:MM:SS", s)}
+}
+
+// Return the interval of n of the supplied unit, e.g. 3 and "month" for
+// INTERVAL 3 MONTH.  Units may be singular or plural.
+func newInterval(n int64, unit string) (IntervalField, error) {
+	switch strings.TrimSuffix(strings.ToLower(unit), "s") {
+	case "year":
+		return IntervalField{Months: 12 * n}, nil
+	case "quarter":
+		return IntervalField{Months: 3 * n}, nil
+	case "month":
+		return IntervalField{Months: n}, nil
+	case "week":
+		return IntervalField{Micros: 7 * n * microsPerDay}, nil
+	case "day":
+		return IntervalField{Micros: n * microsPerDay}, nil
+	case "hour":
+		return IntervalField{Micros: n * 60 * 60 * microsPerSecond}, nil
+	case "minute":
+		return IntervalField{Micros: n * 60 * microsPerSecond}, nil
+	case "second":
+		return IntervalField{Micros: n * microsPerSecond}, nil
+	case "microsecond":
+		return IntervalField{Micros: n}, nil
+	}
+	return IntervalField{}, GoDBError{ParseError, fmt.Sprintf("unsupported interval unit %s", unit)}
+}
+
+func (iv IntervalField) negate() IntervalField {
+	return IntervalField{-iv.Months, -iv.Micros}
+}
+
+func (iv IntervalField) add(iv2 IntervalField) IntervalField {
+	return IntervalField{iv.Months + iv2.Months, iv.Micros + iv2.Micros}
+}
+
+// Return the interval as years, months, days and a time of day, e.g.
+// "1 year 2 months 3 days 04:05:06", leaving out the parts that are zero
+func (iv IntervalField) String() string {
+	var parts []string
+	plural := func(n int64, unit string) {
+		if n == 1 || n == -1 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+		} else if n != 0 {
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit))
+		}
+	}
+	plural(iv.Months/12, "year")
+	plural(iv.Months%12, "month")
+	plural(iv.Micros/microsPerDay, "day")
+	if rest := iv.Micros % microsPerDay; rest != 0 {
+		sign := ""
+		if rest < 0 {
+			sign, rest = "-", -rest
+		}
+		clock := time.UnixMicro(rest).UTC().Format("15:04:05.999999")
+		parts = append(parts, sign+clock)
+	}
+	if len(parts) == 0 {
+		return "0 days"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Return t moved by the supplied number of months, keeping its day of the
+// month unless the new month is shorter, in which case it is the last day of
+// the month (so 2024-01-31 plus a month is 2024-02-29)
+func addMonths(t time.Time, months int64) time.Time {
+	y, m, d := t.Date()
+	total := int64(y)*12 + int64(m-1) + months
+	year, month := total/12, total%12
+	if month < 0 {
+		year, month = year-1, month+12
+	}
+	lastDay := time.Date(int(year), time.Month(month+2), 0, 0, 0, 0, 0, time.UTC).Day()
+	if d > lastDay {
+		d = lastDay
+	}
+	return time.Date(int(year), time.Month(month+1), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// Return d moved by iv, which must be a whole number of days and months
+func (d DateField) addInterval(iv IntervalField) (DateField, error) {
+	if iv.Micros%microsPerDay != 0 {
+		return DateField{}, GoDBError{IllegalOperationError, fmt.Sprintf("can't move a date by %s, which is not a whole number of days; convert it to a timestamp", iv)}
+	}
+	moved := dateOf(addMonths(d.time(), iv.Months))
+	return DateField{moved.Value + iv.Micros/microsPerDay}, nil
+}
+
+func (ts TimestampField) addInterval(iv IntervalField) TimestampField {
+	return TimestampField{addMonths(ts.time(), iv.Months).UnixMicro() + iv.Micros}
+}
+
+// Return t truncated to the start of the year, quarter, month, week (which
+// starts on Monday), day, hour, minute or second that contains it
+func truncTime(t time.Time, unit string) (time.Time, error) {
+	y, m, d := t.Date()
+	switch strings.ToLower(unit) {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC), nil
+	case "quarter":
+		return time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), nil
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC), nil
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	case "hour":
+		return t.Truncate(time.Hour), nil
+	case "minute":
+		return t.Truncate(time.Minute), nil
+	case "second":
+		return t.Truncate(time.Second), nil
+	}
+	return time.Time{}, GoDBError{IllegalOperationError, fmt.Sprintf("can't truncate a date to %s", unit)}
+}
+
+// Return the field of type t, which is an int, a date or a timestamp, with
+// the int64 v as its value
+func int64Field(t DBType, v int64) DBValue {
+	switch t {
+	case DateType:
+		return DateField{v}
+	case TimestampType:
+		return TimestampField{v}
+	}
+	return IntField{v}
+}
@@ -0,0 +1,174 @@
+package godb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestTemporalArithmetic(t *testing.T) {
+	date := func(s string) DateField {
+		d, err := parseDate(s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return d
+	}
+	ts := func(s string) TimestampField {
+		v, err := parseTimestamp(s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return v
+	}
+	interval := func(n int64, unit string) IntervalField {
+		iv, err := newInterval(n, unit)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return iv
+	}
+	if d := date("1970-01-02"); d.Value != 1 {
+		t.Errorf("expected 1970-01-02 to be day 1, got %d", d.Value)
+	}
+	if d := date("1969-12-31"); d.Value != -1 || d.String() != "1969-12-31" {
+		t.Errorf("expected 1969-12-31 to be day -1, got %d (%s)", d.Value, d)
+	}
+	for in, out := range map[string]string{"1995-03-15 10:20:30": "1995-03-15 10:20:30", "1995-03-15T10:20:30.25": "1995-03-15 10:20:30.25", "1995-03-15": "1995-03-15 00:00:00"} {
+		if s := ts(in).String(); s != out {
+			t.Errorf("expected %s to parse as %s, got %s", in, out, s)
+		}
+	}
+	for _, in := range []string{"", "1995-13-01", "15/03/1995", "1995-02-30"} {
+		if _, err := parseDate(in); err == nil {
+			t.Errorf("expected an error parsing the date %q", in)
+		}
+	}
+	if _, err := newInterval(1, "fortnight"); err == nil {
+		t.Errorf("expected an error for an unknown interval unit")
+	}
+
+	dates := []struct {
+		d, is string
+		iv    IntervalField
+	}{
+		{"1995-01-31", "1995-02-28", interval(1, "month")},
+		{"1996-01-31", "1996-02-29", interval(1, "month")},
+		{"1995-03-31", "1994-12-31", interval(-1, "quarter")},
+		{"1995-12-25", "1996-01-08", interval(2, "weeks")},
+		{"1996-02-29", "1997-02-28", interval(1, "year")},
+		{"1995-01-01", "1994-12-31", interval(-1, "day")},
+	}
+	for _, c := range dates {
+		d, err := date(c.d).addInterval(c.iv)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if d.String() != c.is {
+			t.Errorf("expected %s + %s = %s, got %s", c.d, c.iv, c.is, d)
+		}
+	}
+	if _, err := date("1995-01-01").addInterval(interval(3, "hour")); err == nil {
+		t.Errorf("expected an error moving a date by hours")
+	}
+	moved := ts("1995-01-31 23:30:00").addInterval(interval(1, "month").add(interval(45, "minute")))
+	if moved.String() != "1995-03-01 00:15:00" {
+		t.Errorf("expected 1995-03-01 00:15:00, got %s", moved)
+	}
+	if s := interval(14, "month").add(interval(3, "day")).add(interval(3661, "second")).String(); s != "1 year 2 months 3 days 01:01:01" {
+		t.Errorf("unexpected interval %s", s)
+	}
+	if s := interval(-90, "minute").String(); s != "-01:30:00" {
+		t.Errorf("unexpected interval %s", s)
+	}
+
+	truncs := map[string]string{"year": "1995-01-01 00:00:00", "quarter": "1995-07-01 00:00:00", "month": "1995-08-01 00:00:00", "week": "1995-08-14 00:00:00", "day": "1995-08-17 00:00:00", "hour": "1995-08-17 13:00:00"}
+	for unit, is := range truncs {
+		tt, err := truncTime(ts("1995-08-17 13:45:10").time(), unit)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if s := timestampOf(tt).String(); s != is {
+			t.Errorf("expected date_trunc(%s) to be %s, got %s", unit, is, s)
+		}
+	}
+
+	// dates are stored in four bytes, and timestamps in eight
+	desc := TupleDesc{Fields: []FieldType{{Fname: "d", Ftype: DateType}, {Fname: "ts", Ftype: TimestampType}}}
+	tup := Tuple{Desc: desc, Fields: []DBValue{date("1901-06-30"), ts("2038-01-19 03:14:08.5")}}
+	var buf bytes.Buffer
+	if err := tup.writeTo(&buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if buf.Len() != tup.size() || buf.Len() != nullBitmapSize(&desc)+4+8 {
+		t.Errorf("expected a tuple of %d bytes, got %d", nullBitmapSize(&desc)+4+8, buf.Len())
+	}
+	read, err := readTupleFrom(&buf, &desc)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !read.equals(&tup) {
+		t.Errorf("expected %v after a round trip, got %v", tup.Fields, read.Fields)
+	}
+}
+
+func TestTemporalQueries(t *testing.T) {
+	c, dir := makeQueryCatalog(t, "o (id int, odate date, shipped timestamp)\nh (day date, name string)\n")
+	runQuery(t, c, "insert into o values (1, '1995-01-31', '1995-02-02 09:30:00'), (2, '1995-03-15', '1995-03-15 18:00:00')")
+	runQuery(t, c, "insert into h values ('1995-03-15', 'ides')")
+	csv := dir + "/o.csv"
+	if err := os.WriteFile(csv, []byte("3,1996-02-29,1996-03-01 00:00:01\n4,1995-01-31,\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	f, err := os.Open(csv)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	o, _ := c.GetTable("o")
+	if err := o.(*ColumnFile).LoadFromCSV(f, false, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	checkQueryCounts(t, c, []queryCount{
+		{"select id from o where odate = '1995-01-31'", 2},
+		{"select id from o where odate >= '1995-02-01' and odate < date('1995-01-01') + interval 1 year", 1},
+		{"select id from o where odate > date('1995-12-31') - interval '3' month", 1},
+		{"select id from o where shipped > odate", 3},
+		{"select id from o where shipped - interval 1 day < odate", 1},
+		{"select id from o where year(odate) = 1995 and month(shipped) = 3", 1},
+		{"select id from o where shipped is null", 1},
+		{"select id from o, h where o.odate = h.day", 1},
+	})
+
+	checkQueryRows(t, c, "select id, odate, odate + interval 1 month, odate - date('1995-01-01'), shipped - odate, date_trunc('month', shipped) from o order by odate desc, id", []string{
+		"3,1996-02-29,1996-03-29,424,1 day 00:00:01,1996-03-01 00:00:00",
+		"2,1995-03-15,1995-04-15,73,18:00:00,1995-03-01 00:00:00",
+		"1,1995-01-31,1995-02-28,30,2 days 09:30:00,1995-02-01 00:00:00",
+		"4,1995-01-31,1995-02-28,30,NULL,NULL",
+	})
+	checkQueryRows(t, c, "select date_trunc('year', odate) y, count(*), min(shipped), max(odate) from o group by date_trunc('year', odate) order by y", []string{"1995-01-01,3,1995-02-02 09:30:00,1995-03-15", "1996-01-01,1,1996-03-01 00:00:01,1996-02-29"})
+
+	// expressions grouped on are read from the aggregate, not evaluated again
+	// over its fields
+	checkQueryRows(t, c, "select year(odate) y, month(odate) m, count(*) from o group by year(odate), month(odate) order by y, m", []string{"1995,1,2", "1995,3,1", "1996,2,1"})
+	checkQueryRows(t, c, "select year(shipped), count(*) from o group by year(shipped) having year(shipped) > 1995", []string{"1996,1"})
+	checkQueryRows(t, c, "select id+1 n, count(*) from o where id < 3 group by id + 1 order by n", []string{"2,1", "3,1"})
+
+	for _, sql := range []string{"select sum(odate) from o", "select id from o where odate = 'soon'", "select odate + interval 1 fortnight from o"} {
+		if err := queryError(c, sql); err == nil {
+			t.Errorf("expected an error from %s", sql)
+		}
+	}
+
+	if _, _, err := Parse(c, "create table e (d date, ts timestamp, dt datetime)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	e, err := c.GetTable("e")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if fs := e.Descriptor().Fields; fs[0].Ftype != DateType || fs[1].Ftype != TimestampType || fs[2].Ftype != TimestampType {
+		t.Errorf("expected date and timestamp columns, got %v", fs)
+	}
+}
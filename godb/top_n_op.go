@@ -0,0 +1,126 @@
+package godb
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// TopN returns the first lim tuples of its child in the order given by a list
+// of fields, like a [LimitOp] over an [OrderBy], but without sorting the whole
+// input: it keeps the best lim tuples seen so far in a bounded heap, so it
+// needs memory for only lim tuples and O(log lim) work per input tuple.  The
+// planner uses it in place of a limit over an order by.
+type TopN struct {
+	orderBy   []Expr
+	child     Operator
+	ascending []bool
+	limitTups Expr
+}
+
+// Construct a TopN returning the first lim tuples of child when ordered on
+// orderByFields, with the ith field in ascending (true) or descending (false)
+// order as given by ascending.
+func NewTopN(orderByFields []Expr, child Operator, ascending []bool, lim Expr) (*TopN, error) {
+	if len(orderByFields) != len(ascending) {
+		return nil, GoDBError{IllegalOperationError, "order by needs a direction for every field"}
+	}
+	return &TopN{orderByFields, child, ascending, lim}, nil
+}
+
+// Return a TupleDescriptor for this operator, which is that of its child
+func (n *TopN) Descriptor() *TupleDesc {
+	return n.child.Descriptor()
+}
+
+// A tuple held by a TopN, along with its position in the input so that ties
+// are returned in the order they were read, as a stable sort would
+type topNEntry struct {
+	tuple *Tuple
+	seq   int
+}
+
+// A heap of the best tuples seen so far, with the worst of them on top
+type topNHeap struct {
+	entries []topNEntry
+	sorter  *multiSorter
+}
+
+// Return true if a sorts before b
+func (h *topNHeap) before(a, b topNEntry) bool {
+	if h.sorter.lessTuples(a.tuple, b.tuple) {
+		return true
+	}
+	return !h.sorter.lessTuples(b.tuple, a.tuple) && a.seq < b.seq
+}
+
+func (h *topNHeap) Len() int {
+	return len(h.entries)
+}
+
+func (h *topNHeap) Less(i, j int) bool {
+	return h.before(h.entries[j], h.entries[i])
+}
+
+func (h *topNHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+}
+
+func (h *topNHeap) Push(x any) {
+	h.entries = append(h.entries, x.(topNEntry))
+}
+
+func (h *topNHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// Return an iterator over the first lim tuples of the child in sorted order.
+// Like [OrderBy], TopN is blocking: it reads all of its input before
+// returning the first tuple.
+func (n *TopN) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	limVal, err := n.limitTups.EvalExpr(nil)
+	if err != nil {
+		return nil, err
+	}
+	lim, ok := limVal.(IntField)
+	if !ok || lim.Value < 0 {
+		return nil, GoDBError{TypeMismatchError, "limit must be a non-negative integer"}
+	}
+	childIterator, err := n.child.Iterator(tid, n.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+
+	h := &topNHeap{sorter: makeSorter(n.orderBy, n.ascending)}
+	for seq := 0; lim.Value > 0; seq++ {
+		t, err := childIterator()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		entry := topNEntry{t, seq}
+		if int64(h.Len()) < lim.Value {
+			heap.Push(h, entry)
+		} else if h.before(entry, h.entries[0]) {
+			// replace the worst of the tuples kept so far
+			h.entries[0] = entry
+			heap.Fix(h, 0)
+		}
+	}
+
+	entries := h.entries
+	sort.Slice(entries, func(i, j int) bool {
+		return h.before(entries[i], entries[j])
+	})
+	counter := 0
+	return func() (*Tuple, error) {
+		if counter < len(entries) {
+			counter++
+			return entries[counter-1].tuple, nil
+		}
+		return nil, nil
+	}, nil
+}
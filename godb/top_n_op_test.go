@@ -0,0 +1,92 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+// Return the tuples of op
+func collectTuples(t *testing.T, op Operator, tid TransactionID) []*Tuple {
+	iter, err := op.Iterator(tid, op.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return tups
+		}
+		tups = append(tups, tup)
+	}
+}
+
+// check that a TopN returns the same tuples as a limit over an order by
+func TestTopN(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "name", Ftype: StringType},
+		{Fname: "age", Ftype: IntType},
+	}}
+	bp := NewBufferPool(50)
+	os.Remove(TestingFile)
+	hf, err := NewHeapFile(TestingFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	names := []string{"sam", "tim", "mike"}
+	for i := 0; i < 500; i++ {
+		tup := Tuple{Desc: td, Fields: []DBValue{StringField{names[i%3]}, IntField{int64(i * 31 % 97)}}}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	//order by age descending and then name ascending
+	exprs := []Expr{&FieldExpr{td.Fields[1]}, &FieldExpr{td.Fields[0]}}
+	ascDesc := []bool{false, true}
+	for _, n := range []int64{0, 1, 20, 500, 600} {
+		lim := &ConstExpr{IntField{n}, IntType}
+		oby, _ := NewOrderBy(exprs, hf, ascDesc)
+		expected := collectTuples(t, NewLimitOp(lim, oby), tid)
+		topN, err := NewTopN(exprs, hf, ascDesc, lim)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		result := collectTuples(t, topN, tid)
+		if len(result) != len(expected) {
+			t.Fatalf("top %d returned %d tuples, expected %d", n, len(result), len(expected))
+		}
+		for i := range result {
+			if !result[i].equals(expected[i]) {
+				t.Fatalf("top %d differs at position %d (expected %v, got %v)", n, i, expected[i].Fields, result[i].Fields)
+			}
+		}
+	}
+}
+
+func TestTopNChosen(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 200)
+	plan, tuples := runQuery(t, c, "select name, age from t order by age desc limit 5")
+	if _, ok := plan.(*TopN); !ok {
+		t.Fatalf("expected a top n for a limit over an order by, got %T", plan)
+	}
+	if len(tuples) != 5 {
+		t.Fatalf("expected 5 tuples, got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		if tup.Fields[1].(IntField).Value != 9 {
+			t.Errorf("expected the oldest tuples, got %v", tup.Fields)
+		}
+	}
+
+	plan, _ = runQuery(t, c, "select name, age from t limit 5")
+	if _, ok := plan.(*LimitOp); !ok {
+		t.Errorf("expected a limit without an order by, got %T", plan)
+	}
+}
@@ -1,12 +1,15 @@
 package godb
 
+import "sync/atomic"
+
 type TransactionID *int
 
-var nextTid = 0
+var nextTid int64 = 0
 
 func NewTID() TransactionID {
-	id := nextTid
-	nextTid++
+	// transactions are started concurrently, and the lock manager relies on
+	// every transaction having its own id
+	id := int(atomic.AddInt64(&nextTid, 1) - 1)
 	return &id
 }
 
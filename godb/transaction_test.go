@@ -97,7 +97,8 @@ func writeXaction(hf *HeapFile, bp *BufferPool, writeTuple Tuple, wg *sync.WaitG
 func TestTransactions(t *testing.T) {
 
 	_, t1, t2, _, _, _ := makeTestVars()
-	bp := NewBufferPool(20)
+	// enough pages to hold the 2000 tuples inserted below
+	bp := NewBufferPool(2000/tuplesPerPage(&t2) + 1)
 	tid := NewTID()
 	bp.BeginTransaction(tid)
 	hf, _ := NewHeapFile(TestingFile, &t1.Desc, bp)
@@ -148,7 +149,12 @@ func transactionTestSetUpVarLen(t *testing.T, tupCnt int, pgCnt int) (*BufferPoo
 		t.Fatalf("error opening test file")
 	}
 	hf.LoadFromCSV(csvFile, false, ",", false)
-	if hf.NumPages() != pgCnt {
+	// pgCnt in the file name is the number of pages the tuples used to take;
+	// every row of the test files is the same tuple, which now carries its
+	// version stamps
+	row := Tuple{Desc: t1.Desc, Fields: []DBValue{StringField{"george jones"}, IntField{999}}}
+	perPage := tuplesPerPage(&row)
+	if hf.NumPages() != (tupCnt+perPage-1)/perPage {
 		t.Fatalf("error making test vars; unexpected number of pages")
 	}
 
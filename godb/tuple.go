@@ -7,7 +7,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"math"
+	"strconv"
 	"strings"
+	"unsafe"
 
 	"github.com/mitchellh/hashstructure/v2"
 )
@@ -16,12 +20,18 @@ import (
 type DBType int
 
 const (
-	IntType     DBType = iota
-	StringType  DBType = iota
-	UnknownType DBType = iota //used internally, during parsing, because sometimes the type is unknown
+	IntType       DBType = iota
+	StringType    DBType = iota
+	FloatType     DBType = iota
+	DecimalType   DBType = iota
+	DateType      DBType = iota
+	TimestampType DBType = iota
+	IntervalType  DBType = iota //the type of expressions such as INTERVAL 3 DAY, which can't be stored
+	BoolType      DBType = iota
+	UnknownType   DBType = iota //used internally, during parsing, because sometimes the type is unknown
 )
 
-var typeNames map[DBType]string = map[DBType]string{IntType: "int", StringType: "string"}
+var typeNames map[DBType]string = map[DBType]string{IntType: "int", StringType: "string", FloatType: "float", DecimalType: "decimal", DateType: "date", TimestampType: "timestamp", IntervalType: "interval", BoolType: "bool"}
 
 // FieldType is the type of a field in a tuple, e.g., its name, table, and [godb.DBType].
 // TableQualifier may or may not be an emtpy string, depending on whether the table
@@ -30,6 +40,13 @@ type FieldType struct {
 	Fname          string
 	TableQualifier string
 	Ftype          DBType
+	// for strings, the maximum number of characters of a VARCHAR(n) column,
+	// or 0 if strings of any length are allowed
+	Length int
+	// for decimals, the precision and scale of a DECIMAL(p,s) column, which
+	// its values are rounded to, or 0 if decimals of any size are allowed
+	Precision int
+	Scale     int
 }
 
 // TupleDesc is "type" of the tuple, e.g., the field names and types
@@ -130,6 +147,37 @@ type StringField struct {
 	Value string
 }
 
+// Floating point field value
+type FloatField struct {
+	Value float64
+}
+
+// Boolean field value, which is also the value of predicates such as
+// comparisons
+type BoolField struct {
+	Value bool
+}
+
+// The value of a field that is missing, such as the fields of the unmatched
+// side of an outer join.  It compares as neither equal to nor different from
+// any other value, so it satisfies no predicate.
+type NullField struct{}
+
+// Return true if v is a missing value
+func isNull(v DBValue) bool {
+	_, ok := v.(NullField)
+	return ok
+}
+
+// Return a tuple with desc as its descriptor and every field missing
+func nullTuple(desc *TupleDesc) *Tuple {
+	fields := make([]DBValue, len(desc.Fields))
+	for i := range fields {
+		fields[i] = NullField{}
+	}
+	return &Tuple{Desc: *desc, Fields: fields}
+}
+
 // Tuple represents the contents of a tuple read from a database
 // It includes the tuple descriptor, and the value of the fields
 type Tuple struct {
@@ -146,80 +194,211 @@ type RecordID struct {
 	slot   int
 }
 
-// Serialize the contents of the tuple into a byte array Since all tuples are of
-// fixed size, this method should simply write the fields in sequential order
-// into the supplied buffer.
+// Serialize the contents of the tuple into a byte array.  This method writes
+// the fields in sequential order into the supplied buffer; as strings are
+// written at their own length, tuples are of different sizes (see
+// [Tuple.size]).
 //
 // See the function [binary.Write].  Objects should be serialized in little
 // endian oder.
 //
-// Strings can be converted to byte arrays by casting to []byte. Note that all
-// strings need to be padded to StringLength bytes (set in types.go). For
-// example if StringLength is set to 5, the string 'mit' should be written as
-// 'm', 'i', 't', 0, 0
+// Strings can be converted to byte arrays by casting to []byte. Strings are
+// written as their length, a 16 bit integer, followed by their bytes, so the
+// string 'mit' is written as 3, 0, 'm', 'i', 't'.
 //
-// May return an error if the buffer has insufficient capacity to store the
-// tuple.
+// The fields are preceded by a null bitmap of nullBitmapSize bytes, in which
+// bit i (counting from the low bit of the first byte) is set if field i is
+// missing.  A missing field is written as the zero value of its type (an
+// empty string for strings).
+//
+// Returns an error if a string is longer than maxStringLength bytes.
 func (t *Tuple) writeTo(b *bytes.Buffer) error {
+	bitmap := make([]byte, nullBitmapSize(&t.Desc))
+	for i, f := range t.Fields {
+		if isNull(f) {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+	if _, err := b.Write(bitmap); err != nil {
+		return err
+	}
 	for i := 0; i < len(t.Fields); i++ {
-		if _, ok := t.Fields[i].(StringField); ok {
-			fieldValue := (t.Fields[i]).(StringField)
-			padded_string := strings.Join([]string{fieldValue.Value, strings.Repeat("0", StringLength-len(fieldValue.Value))}, "")
-			final_field := []byte(padded_string)
-			err := binary.Write(b, binary.LittleEndian, final_field)
+		if fieldValue, ok := t.Fields[i].(StringField); ok {
+			if len(fieldValue.Value) > maxStringLength {
+				return GoDBError{IllegalOperationError, fmt.Sprintf("string of %d bytes is longer than the maximum of %d", len(fieldValue.Value), maxStringLength)}
+			}
+			if err := binary.Write(b, binary.LittleEndian, uint16(len(fieldValue.Value))); err != nil {
+				return err
+			}
+			if _, err := b.WriteString(fieldValue.Value); err != nil {
+				return err
+			}
+		} else if fieldValue, ok := t.Fields[i].(IntField); ok {
+			err := binary.Write(b, binary.LittleEndian, fieldValue.Value)
 			if err != nil {
 				return err
 			}
-		} else {
-			fieldValue := (t.Fields[i]).(IntField)
+		} else if fieldValue, ok := t.Fields[i].(FloatField); ok {
 			err := binary.Write(b, binary.LittleEndian, fieldValue.Value)
 			if err != nil {
 				return err
 			}
+		} else if fieldValue, ok := t.Fields[i].(DecimalField); ok {
+			if err := binary.Write(b, binary.LittleEndian, fieldValue.Value); err != nil {
+				return err
+			}
+			if err := b.WriteByte(byte(fieldValue.Scale)); err != nil {
+				return err
+			}
+		} else if fieldValue, ok := t.Fields[i].(DateField); ok {
+			if err := binary.Write(b, binary.LittleEndian, int32(fieldValue.Value)); err != nil {
+				return err
+			}
+		} else if fieldValue, ok := t.Fields[i].(TimestampField); ok {
+			if err := binary.Write(b, binary.LittleEndian, fieldValue.Value); err != nil {
+				return err
+			}
+		} else if fieldValue, ok := t.Fields[i].(BoolField); ok {
+			if err := binary.Write(b, binary.LittleEndian, fieldValue.Value); err != nil {
+				return err
+			}
+		} else if isNull(t.Fields[i]) {
+			if _, err := b.Write(make([]byte, fieldSize(t.Desc.Fields[i].Ftype))); err != nil {
+				return err
+			}
+		} else {
+			return GoDBError{TypeMismatchError, "cannot store value of unknown type"}
 		}
 	}
 	return nil
 }
 
+// Return the number of bytes of the null bitmap of tuples described by desc
+func nullBitmapSize(desc *TupleDesc) int {
+	return (len(desc.Fields) + 7) / 8
+}
+
+// The longest string, in bytes, that can be stored in a tuple
+const maxStringLength int = math.MaxUint16
+
+// Return the number of bytes a field of type t occupies in a tuple, or, for
+// strings, the number of bytes of their length.  Decimals are stored as their
+// unscaled value followed by a byte with their scale, dates as a 32 bit
+// number of days, and booleans as a byte.
+func fieldSize(t DBType) int {
+	if t == StringType {
+		return (int)(unsafe.Sizeof(uint16(0)))
+	}
+	if t == DecimalType {
+		return (int)(unsafe.Sizeof(int64(0))) + 1
+	}
+	if t == DateType {
+		return (int)(unsafe.Sizeof(int32(0)))
+	}
+	if t == BoolType {
+		return (int)(unsafe.Sizeof(false))
+	}
+	return (int)(unsafe.Sizeof(int64(0)))
+}
+
+// Return the number of bytes t occupies when written with [Tuple.writeTo]
+func (t *Tuple) size() int {
+	size := nullBitmapSize(&t.Desc)
+	for i, f := range t.Fields {
+		if s, ok := f.(StringField); ok {
+			size += fieldSize(StringType) + len(s.Value)
+		} else {
+			size += fieldSize(t.Desc.Fields[i].Ftype)
+		}
+	}
+	return size
+}
+
 // Read the contents of a tuple with the specified [TupleDesc] from the
 // specified buffer, returning a Tuple.
 //
 // See [binary.Read]. Objects should be deserialized in little endian oder.
 //
-// All strings are stored as StringLength byte objects.
-//
-// Strings with length < StringLength will be padded with zeros, and these
-// trailing zeros should be removed from the strings.  A []byte can be cast
-// directly to string.
+// Strings are stored as their length followed by their bytes.  A []byte can be
+// cast directly to string.
 //
 // May return an error if the buffer has insufficent data to deserialize the
 // tuple.
 func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
-	tupleFields := []DBValue{}
+	t := &Tuple{}
+	err := readTupleInto(b, desc, t, make([]DBValue, len(desc.Fields)))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Like [readTupleFrom], but read the tuple into t, storing its fields in
+// fields (which must have room for every field of desc), so that callers
+// reading many tuples can allocate them together.
+func readTupleInto(b *bytes.Buffer, desc *TupleDesc, t *Tuple, fields []DBValue) error {
+	bitmap := b.Next(nullBitmapSize(desc))
+	if len(bitmap) < nullBitmapSize(desc) {
+		return io.ErrUnexpectedEOF
+	}
 	for i := range desc.Fields {
 		if desc.Fields[i].Ftype == StringType { // If field is a string
-			byteArray := make([]byte, StringLength)
-			str_err := binary.Read(b, binary.LittleEndian, byteArray)
-			if str_err != nil {
-				return nil, str_err
+			lengthBytes := b.Next(fieldSize(StringType))
+			if len(lengthBytes) < fieldSize(StringType) {
+				return io.ErrUnexpectedEOF
+			}
+			length := int(binary.LittleEndian.Uint16(lengthBytes))
+			byteArray := b.Next(length)
+			if len(byteArray) < length {
+				return io.ErrUnexpectedEOF
+			}
+			fields[i] = StringField{Value: string(byteArray)}
+		} else if desc.Fields[i].Ftype == FloatType {
+			floatBytes := b.Next(8)
+			if len(floatBytes) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			fields[i] = FloatField{Value: math.Float64frombits(binary.LittleEndian.Uint64(floatBytes))}
+		} else if desc.Fields[i].Ftype == DecimalType {
+			decimalBytes := b.Next(fieldSize(DecimalType))
+			if len(decimalBytes) < fieldSize(DecimalType) {
+				return io.ErrUnexpectedEOF
 			}
-			strField := StringField{Value: strings.TrimRight(string(byteArray), "\\00")}
-			tupleFields = append(tupleFields, strField)
+			fields[i] = DecimalField{Value: int64(binary.LittleEndian.Uint64(decimalBytes)), Scale: int(decimalBytes[8])}
+		} else if desc.Fields[i].Ftype == DateType {
+			dateBytes := b.Next(fieldSize(DateType))
+			if len(dateBytes) < fieldSize(DateType) {
+				return io.ErrUnexpectedEOF
+			}
+			fields[i] = DateField{Value: int64(int32(binary.LittleEndian.Uint32(dateBytes)))}
+		} else if desc.Fields[i].Ftype == TimestampType {
+			tsBytes := b.Next(8)
+			if len(tsBytes) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			fields[i] = TimestampField{Value: int64(binary.LittleEndian.Uint64(tsBytes))}
+		} else if desc.Fields[i].Ftype == BoolType {
+			boolBytes := b.Next(fieldSize(BoolType))
+			if len(boolBytes) < fieldSize(BoolType) {
+				return io.ErrUnexpectedEOF
+			}
+			fields[i] = BoolField{Value: boolBytes[0] != 0}
 		} else { // Field is int
-			var intVal int64
-			int_error := binary.Read(b, binary.LittleEndian, &intVal)
-			if int_error != nil {
-				return nil, int_error
+			intBytes := b.Next(8)
+			if len(intBytes) < 8 {
+				return io.ErrUnexpectedEOF
 			}
-			intField := IntField{Value: intVal}
-			tupleFields = append(tupleFields, intField)
+			fields[i] = IntField{Value: int64(binary.LittleEndian.Uint64(intBytes))}
 		}
 	}
-	result := &Tuple{
-		Desc:   *desc,
-		Fields: tupleFields,
+	for i := range desc.Fields {
+		if bitmap[i/8]&(1<<(i%8)) != 0 {
+			fields[i] = NullField{}
+		}
 	}
-	return result, nil
+	t.Desc = *desc
+	t.Fields = fields[:len(desc.Fields):len(desc.Fields)]
+	return nil
 }
 
 // Compare two tuples for equality.  Equality means that the TupleDescs are equal
@@ -295,6 +474,15 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 	if t2_err != nil {
 		return OrderedEqual, t2_err
 	}
+	if cmp, ok := compareNulls(t1_value, t2_value); ok {
+		switch cmp {
+		case -1:
+			return OrderedLessThan, nil
+		case 1:
+			return OrderedGreaterThan, nil
+		}
+		return OrderedEqual, nil
+	}
 
 	switch field.GetExprType().Ftype {
 	case IntType:
@@ -307,6 +495,42 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 			return OrderedGreaterThan, nil
 		}
 		return OrderedEqual, nil
+	case FloatType:
+		t1Val := t1_value.(FloatField)
+		t2Val := t2_value.(FloatField)
+		if t1Val.Value < t2Val.Value {
+			return OrderedLessThan, nil
+		}
+		if t1Val.Value > t2Val.Value {
+			return OrderedGreaterThan, nil
+		}
+		return OrderedEqual, nil
+	case BoolType:
+		t1Val, t2Val := boolFilterGetter(t1_value), boolFilterGetter(t2_value)
+		if t1Val < t2Val {
+			return OrderedLessThan, nil
+		}
+		if t1Val > t2Val {
+			return OrderedGreaterThan, nil
+		}
+		return OrderedEqual, nil
+	case DateType, TimestampType:
+		t1Val, t2Val := temporalFilterGetter(t1_value), temporalFilterGetter(t2_value)
+		if t1Val < t2Val {
+			return OrderedLessThan, nil
+		}
+		if t1Val > t2Val {
+			return OrderedGreaterThan, nil
+		}
+		return OrderedEqual, nil
+	case DecimalType:
+		switch t1_value.(DecimalField).cmp(t2_value.(DecimalField)) {
+		case -1:
+			return OrderedLessThan, nil
+		case 1:
+			return OrderedGreaterThan, nil
+		}
+		return OrderedEqual, nil
 	case StringType:
 		t1Val := t1_value.(StringField)
 		t2Val := t2_value.(StringField)
@@ -360,6 +584,19 @@ func (t *Tuple) project(fields []FieldType) (*Tuple, error) {
 
 // Compute a key for the tuple to be used in a map structure
 func (t *Tuple) tupleKey() any {
+	// equal decimals of different scales are the same key
+	for i, f := range t.Fields {
+		if d, ok := f.(DecimalField); ok && d != d.normalized() {
+			fields := append([]DBValue(nil), t.Fields...)
+			for j := i; j < len(fields); j++ {
+				if d, ok := fields[j].(DecimalField); ok {
+					fields[j] = d.normalized()
+				}
+			}
+			t = &Tuple{t.Desc, fields, t.Rid}
+			break
+		}
+	}
 
 	//todo efficiency here is poor - hashstructure is probably slow
 	hash, _ := hashstructure.Hash(t, hashstructure.FormatV2, nil)
@@ -418,6 +655,20 @@ func (t *Tuple) PrettyPrintString(aligned bool) string {
 			str = fmt.Sprintf("%d", f.Value)
 		case StringField:
 			str = f.Value
+		case FloatField:
+			str = strconv.FormatFloat(f.Value, 'f', -1, 64)
+		case DecimalField:
+			str = f.String()
+		case DateField:
+			str = f.String()
+		case TimestampField:
+			str = f.String()
+		case IntervalField:
+			str = f.String()
+		case BoolField:
+			str = strconv.FormatBool(f.Value)
+		case NullField:
+			str = "NULL"
 		}
 		if aligned {
 			outstr = fmt.Sprintf("%s %s", outstr, fmtCol(str, len(t.Fields)))
@@ -206,3 +206,54 @@ func TestTupleEquals(t *testing.T) {
 	TAssertNotEquals(t, t1, stringTup)
 	TAssertNotEquals(t, stringTup, t2)
 }
+
+func TestTupleNullSerialization(t *testing.T) {
+	td, _, _, _, _, _ := makeTestVars()
+	for _, fields := range [][]DBValue{
+		{NullField{}, IntField{25}},
+		{StringField{"sam"}, NullField{}},
+		{NullField{}, NullField{}},
+	} {
+		t1 := Tuple{Desc: td, Fields: fields}
+		b := new(bytes.Buffer)
+		if err := t1.writeTo(b); err != nil {
+			t.Fatalf(err.Error())
+		}
+		// a missing value takes the space of the zero value of its type
+		zeros := Tuple{Desc: td, Fields: []DBValue{StringField{""}, IntField{0}}}
+		for i, f := range fields {
+			if !isNull(f) {
+				zeros.Fields[i] = f
+			}
+		}
+		if b.Len() != zeros.size() {
+			t.Errorf("expected a tuple with missing values to take %d bytes, got %d", zeros.size(), b.Len())
+		}
+		t2, err := readTupleFrom(b, &td)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !t2.equals(&t1) {
+			t.Errorf("expected %v after serialization, got %v", t1.Fields, t2.Fields)
+		}
+	}
+}
+
+func TestTupleFloatSerialization(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{{Fname: "price", Ftype: FloatType}, {Fname: "qty", Ftype: IntType}}}
+	t1 := Tuple{Desc: td, Fields: []DBValue{FloatField{-1234.5625}, IntField{3}}}
+	b := new(bytes.Buffer)
+	if err := t1.writeTo(b); err != nil {
+		t.Fatalf(err.Error())
+	}
+	t2, err := readTupleFrom(b, &td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !t2.equals(&t1) {
+		t.Errorf("expected %v after serialization, got %v", t1.Fields, t2.Fields)
+	}
+	if s := t2.PrettyPrintString(false); s != "-1234.5625,3" {
+		t.Errorf("expected -1234.5625,3, got %s", s)
+	}
+}
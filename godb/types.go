@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"strings"
@@ -24,6 +25,9 @@ const (
 	IllegalOperationError   GoDBErrorCode = iota
 	DeadlockError           GoDBErrorCode = iota
 	IllegalTransactionError GoDBErrorCode = iota
+	SerializationError      GoDBErrorCode = iota
+	DuplicateIndexError     GoDBErrorCode = iota
+	NoSuchIndexError        GoDBErrorCode = iota
 )
 
 type GoDBError struct {
@@ -46,6 +50,11 @@ type Page interface {
 	isDirty() bool
 	setDirty(dirty bool)
 	getFile() *DBFile
+
+	//these methods are used by the write-ahead log
+	toBuffer() (*bytes.Buffer, error)
+	setLSN(lsn int64)
+	location() (string, int)
 }
 
 type DBFile interface {
@@ -88,6 +97,44 @@ var BoolOpMap = map[string]BoolOp{
 	"like": OpLike,
 }
 
+// The value of a predicate in SQL's three-valued logic, in which a comparison
+// with a missing value ([NullField]) is neither true nor false but unknown.
+// Filters keep only the tuples for which their predicate is true.
+type Truth int
+
+const (
+	TruthFalse   Truth = iota
+	TruthTrue    Truth = iota
+	TruthUnknown Truth = iota
+)
+
+func truthOf(b bool) Truth {
+	if b {
+		return TruthTrue
+	}
+	return TruthFalse
+}
+
+// Return the negation of t; the negation of unknown is unknown
+func (t Truth) not() Truth {
+	switch t {
+	case TruthTrue:
+		return TruthFalse
+	case TruthFalse:
+		return TruthTrue
+	}
+	return TruthUnknown
+}
+
+// Compare two values, which are either both of the type read by getter or
+// missing, returning unknown if either is missing
+func evalNullablePred[T constraints.Ordered](v1 DBValue, v2 DBValue, getter func(DBValue) T, op BoolOp) Truth {
+	if isNull(v1) || isNull(v2) {
+		return TruthUnknown
+	}
+	return truthOf(evalPred(getter(v1), getter(v2), op))
+}
+
 func evalPred[T constraints.Ordered](i1 T, i2 T, op BoolOp) bool {
 	switch op {
 	case OpEq:
@@ -0,0 +1,138 @@
+package godb
+
+import "fmt"
+
+type UpdateOp struct {
+	file     DBFile
+	child    Operator
+	fieldIdx []int  // positions in the tuples of file of the fields to set
+	values   []Expr // new values of the fields, evaluated on the old tuples
+	dir      string // directory for the spill file of new tuples
+	bufPool  *BufferPool
+}
+
+// Construtor.  The update operator replaces each record of the child Operator
+// in the specified DBFile with a copy in which the fields named setFields are
+// set to the values of setExprs, evaluated on the original record.  New
+// versions are held in a temporary file in dir (or in the default directory
+// for temporary files if dir is empty) until all of the records have been
+// read.  Returns an error if a field does not exist in the file, or if a
+// value is not of the type of its field (though numbers are converted to
+// decimal and float fields, see [convertExpr]).
+func NewUpdateOp(updateFile DBFile, setFields []string, setExprs []Expr, child Operator, dir string) (*UpdateOp, error) {
+	if len(setFields) != len(setExprs) {
+		return nil, GoDBError{IllegalOperationError, "update needs a value for every field"}
+	}
+	desc := updateFile.Descriptor()
+	fieldIdx := make([]int, len(setFields))
+	for i, name := range setFields {
+		idx, err := findFieldInTd(FieldType{Fname: name, Ftype: UnknownType}, desc)
+		if err != nil {
+			return nil, err
+		}
+		setExprs[i] = convertExpr(setExprs[i], desc.Fields[idx].Ftype)
+		// NULL, whose type is unknown, can be assigned to any field
+		if t := setExprs[i].GetExprType().Ftype; t != UnknownType && t != desc.Fields[idx].Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("value assigned to %s is not of its type", name)}
+		}
+		fieldIdx[i] = idx
+	}
+	return &UpdateOp{updateFile, child, fieldIdx, setExprs, dir, nil}, nil
+}
+
+// Write the spill file of new tuples to dir, and remove it if it is left when
+// the transaction running the update ends, e.g. because the update failed,
+// through bp
+func (uop *UpdateOp) spillTo(dir string, bp *BufferPool) {
+	uop.dir = dir
+	uop.bufPool = bp
+}
+
+// The update TupleDesc is a one column descriptor with an integer field named "count"
+func (uop *UpdateOp) Descriptor() *TupleDesc {
+	ft := FieldType{Fname: "count", Ftype: IntType}
+	fts := []FieldType{ft}
+	td := TupleDesc{}
+	td.Fields = fts
+	return &td
+}
+
+// Return an iterator function that updates all of the tuples from the child
+// iterator and then returns a one-field tuple with a "count" field indicating
+// the number of tuples that were updated.
+//
+// An update is a [DBFile.deleteTuple] of the old tuple followed by a
+// [DBFile.insertTuple] of the new one, so both take the page locks they need
+// through the buffer pool, and indexes on the file are maintained.  The new
+// tuples are only inserted once the child has been read in full, so that the
+// child never sees, and updates again, a tuple it has already updated.
+func (uop *UpdateOp) Iterator(tid TransactionID, desc *TupleDesc) (func() (*Tuple, error), error) {
+	iterator, err := uop.child.Iterator(tid, uop.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	done := false
+	return func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
+		done = true
+		updated, err := uop.bufPool.newSpillFile(tid, uop.dir)
+		if err != nil {
+			return nil, err
+		}
+		defer updated.remove()
+		for {
+			t, err := iterator()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				break
+			}
+			newTup, err := uop.newVersion(t)
+			if err != nil {
+				return nil, err
+			}
+			if err := uop.file.deleteTuple(t, tid); err != nil {
+				return nil, err
+			}
+			if err := updated.append(newTup); err != nil {
+				return nil, err
+			}
+		}
+		if updated.count > 0 {
+			newTuples, err := updated.iterator()
+			if err != nil {
+				return nil, err
+			}
+			for {
+				t, err := newTuples()
+				if err != nil {
+					return nil, err
+				}
+				if t == nil {
+					break
+				}
+				if err := uop.file.insertTuple(t, tid); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return &Tuple{Desc: *uop.Descriptor(), Fields: []DBValue{IntField{Value: int64(updated.count)}}}, nil
+	}, nil
+}
+
+// Return a copy of t with the fields of the update set to their new values
+func (uop *UpdateOp) newVersion(t *Tuple) (*Tuple, error) {
+	fields := make([]DBValue, len(t.Fields))
+	copy(fields, t.Fields)
+	for i, idx := range uop.fieldIdx {
+		v, err := uop.values[i].EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		fields[idx] = v
+	}
+	return &Tuple{Desc: *uop.file.Descriptor(), Fields: fields}, nil
+}
@@ -0,0 +1,87 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(&t1, tid)
+	hf.insertTuple(&t2, tid)
+	bp.CommitTransaction(tid)
+	var f FieldType = FieldType{Fname: "age", Ftype: IntType}
+	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	uop, err := NewUpdateOp(hf, []string{"name"}, []Expr{&ConstExpr{StringField{"old"}, StringType}}, filt, t.TempDir())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := uop.Iterator(tid, uop.Descriptor())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup == nil || tup.Fields[0].(IntField).Value != 1 {
+		t.Fatalf("expected one updated tuple, got %v", tup)
+	}
+	bp.CommitTransaction(tid)
+
+	tid = NewTID()
+	bp.BeginTransaction(tid)
+	iter, _ = hf.Iterator(tid, hf.Descriptor())
+	names := make(map[string]int64)
+	for {
+		tup, _ := iter()
+		if tup == nil {
+			break
+		}
+		names[tup.Fields[0].(StringField).Value] = tup.Fields[1].(IntField).Value
+	}
+	bp.CommitTransaction(tid)
+	if len(names) != 2 || names["sam"] != 25 || names["old"] != 999 {
+		t.Errorf("unexpected tuples after update: %v", names)
+	}
+
+	if _, err := NewUpdateOp(hf, []string{"age"}, []Expr{&ConstExpr{StringField{"x"}, StringType}}, hf, ""); err == nil {
+		t.Errorf("expected an error assigning a string to an int field")
+	}
+	if _, err := NewUpdateOp(hf, []string{"height"}, []Expr{&ConstExpr{IntField{1}, IntType}}, hf, ""); err == nil {
+		t.Errorf("expected an error assigning to a missing field")
+	}
+}
+
+// update every row of a column file so that rows move past the scan, and
+// check that each is updated once and that the index on the column follows
+func TestUpdateQuery(t *testing.T) {
+	c, _, _ := makeCatalogTestVars(t, 100)
+	if _, _, err := Parse(c, "create index t_age on t(age)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, tuples := runQuery(t, c, "update t set age = age + 10, name = 'bob' where age >= 5")
+	if n := tuples[0].Fields[0].(IntField).Value; n != 50 {
+		t.Errorf("expected 50 updated rows, got %d", n)
+	}
+	_, tuples = runQuery(t, c, "select name, age from t")
+	if len(tuples) != 100 {
+		t.Fatalf("expected 100 rows after the update, got %d", len(tuples))
+	}
+	for _, tup := range tuples {
+		name, age := tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value
+		if (age < 5 && name != "sam") || (age >= 5 && (age < 15 || age > 19 || name != "bob")) {
+			t.Errorf("unexpected row %v after the update", tup.Fields)
+		}
+	}
+	if n := countThroughIndex(t, c, "t_age", 17); n != 10 {
+		t.Errorf("expected the index to find 10 rows with age 17, got %d", n)
+	}
+	if n := countThroughIndex(t, c, "t_age", 7); n != 0 {
+		t.Errorf("expected the index to find no rows with age 7, got %d", n)
+	}
+}
@@ -299,7 +299,9 @@ func main() {
 				}
 			}
 			if autocommit {
-				bp.CommitTransaction(tid)
+				if err := bp.CommitTransaction(tid); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				}
 			}
 		outer:
 			fmt.Printf("\033[32;1m(%d results)\033[0m\n", nresults)
@@ -319,8 +321,11 @@ func main() {
 			if autocommit {
 				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot abort transaction unless in transaction")
 			} else {
-				bp.AbortTransaction(tid)
 				autocommit = true
+				if err := bp.AbortTransaction(tid); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+					break
+				}
 				fmt.Printf("\033[32;1mABORT\033[0m\n\n")
 			}
 
@@ -328,8 +333,11 @@ func main() {
 			if autocommit {
 				fmt.Printf("\033[31;1m%s\033[0m\n", "Cannot commit transaction unless in transaction")
 			} else {
-				bp.CommitTransaction(tid)
 				autocommit = true
+				if err := bp.CommitTransaction(tid); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+					break
+				}
 				fmt.Printf("\033[32;1mCOMMIT\033[0m\n\n")
 			}
 		case godb.CreateTableQueryType:
@@ -344,6 +352,18 @@ func main() {
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 			}
+		case godb.CreateIndexQueryType:
+			fmt.Printf("\033[32;1mCREATE INDEX\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.DropIndexQueryType:
+			fmt.Printf("\033[32;1mDROP INDEX\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
 		}
 
 	}